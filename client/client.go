@@ -0,0 +1,305 @@
+// Package client - Go клиент HTTP API сервиса: регистрация, автоматическое
+// обновление access токена, повтор запросов на 429 и ожидание задач.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxRetries = 3
+	// пауза перед повтором, если сервер не прислал Retry-After
+	defaultRetryDelay = time.Second
+)
+
+// Client безопасен для одновременного использования из нескольких горутин
+type Client struct {
+	baseURL    string
+	http       *http.Client
+	maxRetries int
+	adminToken string
+
+	mu      sync.Mutex
+	userID  string
+	access  string
+	refresh string
+	// onRefresh вызывается с новой парой токенов после обновления
+	onRefresh func(Tokens)
+}
+
+// Tokens - пара токенов пользователя
+type Tokens struct {
+	UserID  string `json:"userID,omitempty"`
+	Access  string `json:"access"`
+	Refresh string `json:"refresh"`
+}
+
+type Option func(*Client)
+
+// WithHTTPClient задает http.Client для запросов
+func WithHTTPClient(h *http.Client) Option {
+	return func(c *Client) { c.http = h }
+}
+
+// WithTokens задает сохраненную ранее пару токенов вместо регистрации
+func WithTokens(tokens Tokens) Option {
+	return func(c *Client) {
+		c.userID, c.access, c.refresh = tokens.UserID, tokens.Access, tokens.Refresh
+	}
+}
+
+// WithMaxRetries задает число повторов запроса после ответа 429
+func WithMaxRetries(n int) Option {
+	return func(c *Client) { c.maxRetries = n }
+}
+
+// WithAdminToken задает токен администратора для методов /admin
+func WithAdminToken(token string) Option {
+	return func(c *Client) { c.adminToken = token }
+}
+
+// OnRefresh задает функцию, которая получает новую пару токенов после
+// обновления, например чтобы сохранить ее на диск
+func OnRefresh(fn func(Tokens)) Option {
+	return func(c *Client) { c.onRefresh = fn }
+}
+
+// New создает клиент API по адресу baseURL, например http://localhost:8080
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		http:       http.DefaultClient,
+		maxRetries: defaultMaxRetries,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Tokens возвращает текущую пару токенов
+func (c *Client) Tokens() Tokens {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return Tokens{UserID: c.userID, Access: c.access, Refresh: c.refresh}
+}
+
+// Register создает нового пользователя, дальше клиент работает от его имени
+func (c *Client) Register(ctx context.Context) (Tokens, error) {
+	tokens := Tokens{}
+	if _, err := c.do(ctx, http.MethodGet, "/register", nil, &tokens, false); err != nil {
+		return Tokens{}, err
+	}
+
+	c.mu.Lock()
+	c.userID, c.access, c.refresh = tokens.UserID, tokens.Access, tokens.Refresh
+	c.mu.Unlock()
+	return tokens, nil
+}
+
+// Refresh обновляет пару токенов. Обычно вызывать не нужно: клиент сам
+// обновляет токены, когда сервер отвечает invalid_token.
+func (c *Client) Refresh(ctx context.Context) (Tokens, error) {
+	c.mu.Lock()
+	access := c.access
+	c.mu.Unlock()
+	return c.refreshTokens(ctx, access)
+}
+
+// refreshTokens обновляет пару, если она все еще та, с которой запрос
+// получил 401. Иначе ее уже обновил другой запрос, и хватит повтора.
+func (c *Client) refreshTokens(ctx context.Context, stale string) (Tokens, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	current := Tokens{UserID: c.userID, Access: c.access, Refresh: c.refresh}
+	if current.Access != stale {
+		return current, nil
+	}
+	if current.Refresh == "" {
+		return Tokens{}, errors.New("client: no refresh token, call Register first")
+	}
+
+	body, _ := json.Marshal(map[string]string{"refresh": current.Refresh})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/api/refresh", bytes.NewReader(body))
+	if err != nil {
+		return Tokens{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+current.Access)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return Tokens{}, fmt.Errorf("refresh tokens: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Tokens{}, decodeError(resp)
+	}
+	tokens := Tokens{}
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return Tokens{}, fmt.Errorf("decode tokens: %w", err)
+	}
+
+	tokens.UserID = current.UserID
+	c.access, c.refresh = tokens.Access, tokens.Refresh
+	if c.onRefresh != nil {
+		c.onRefresh(tokens)
+	}
+	return tokens, nil
+}
+
+// do отправляет запрос и разбирает ответ в out. На 429 запрос повторяется
+// после Retry-After, на invalid_token - один раз после обновления токенов.
+func (c *Client) do(ctx context.Context, method, path string, in, out any, authorized bool) (*http.Response, error) {
+	return c.doHeader(ctx, method, path, nil, in, out, authorized)
+}
+
+// doHeader - do с дополнительными заголовками запроса
+func (c *Client) doHeader(ctx context.Context, method, path string, header http.Header, in, out any, authorized bool) (*http.Response, error) {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return nil, fmt.Errorf("encode request: %w", err)
+		}
+	}
+
+	refreshed := false
+	retries := 0
+	for {
+		access := ""
+		if authorized {
+			c.mu.Lock()
+			access = c.access
+			c.mu.Unlock()
+		}
+
+		resp, err := c.send(ctx, method, path, header, body, access)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case resp.StatusCode == http.StatusTooManyRequests && retries < c.maxRetries:
+			delay := retryAfter(resp.Header.Get("Retry-After"))
+			resp.Body.Close()
+			retries++
+			if err := sleep(ctx, delay); err != nil {
+				return nil, err
+			}
+			continue
+		case resp.StatusCode == http.StatusUnauthorized && authorized && !refreshed:
+			apiErr := decodeError(resp)
+			if apiErr.Code != CodeInvalidToken {
+				return resp, apiErr
+			}
+			if _, err := c.refreshTokens(ctx, access); err != nil {
+				return resp, fmt.Errorf("%w (refresh failed: %w)", apiErr, err)
+			}
+			refreshed = true
+			continue
+		case resp.StatusCode >= http.StatusBadRequest:
+			return resp, decodeError(resp)
+		}
+
+		// тело потока событий читает и закрывает вызывающий
+		if stream, ok := out.(streamBody); ok {
+			*stream.body = resp.Body
+			return resp, nil
+		}
+
+		defer resp.Body.Close()
+		if out == nil || resp.StatusCode == http.StatusNoContent {
+			return resp, nil
+		}
+		if raw, ok := out.(rawBody); ok {
+			err = raw.decode(resp.Body)
+		} else {
+			err = json.NewDecoder(resp.Body).Decode(out)
+		}
+		if err != nil {
+			return resp, fmt.Errorf("decode response: %w", err)
+		}
+		return resp, nil
+	}
+}
+
+func (c *Client) send(ctx context.Context, method, path string, header http.Header, body []byte, access string) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if req.Header.Get("Accept") == "" {
+		req.Header.Set("Accept", "application/json")
+	}
+	if access != "" {
+		req.Header.Set("Authorization", "Bearer "+access)
+	}
+	if c.adminToken != "" && strings.HasPrefix(path, "/admin/") {
+		req.Header.Set("X-Admin-Token", c.adminToken)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %w", method, path, err)
+	}
+	return resp, nil
+}
+
+// retryAfter разбирает Retry-After: число секунд или HTTP дату
+func retryAfter(value string) time.Duration {
+	if value == "" {
+		return defaultRetryDelay
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(at); delay > 0 {
+			return delay
+		}
+		return 0
+	}
+	return defaultRetryDelay
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func taskPath(id string, suffix string) string {
+	return "/v1/tasks/" + url.PathEscape(id) + suffix
+}
@@ -0,0 +1,323 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"ioboundlimiter/internal/clock"
+	"ioboundlimiter/internal/middleware"
+	"ioboundlimiter/internal/router"
+	"ioboundlimiter/internal/workers"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	workers.RegisterRemoteType("sdk-remote")
+	workers.InitWorkers()
+	defer workers.Shutdown()
+
+	// перед настоящим API сервер отвечает 429 столько раз, сколько задано в throttle
+	var throttle, throttled atomic.Int32
+	api := router.New()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if throttle.Add(-1) >= 0 {
+			throttled.Add(1)
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		api.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	newClient := func(opts ...Option) *Client {
+		c := New(srv.URL, opts...)
+		_, err := c.Register(ctx)
+		assert.NoError(t, err)
+		return c
+	}
+
+	// задачи удаленного типа только ставятся в очередь и не выполняются
+	remoteTask := TaskRequest{Name: "sdk task", Type: "sdk-remote", Payload: []byte(`{"n":1}`)}
+
+	t.Run("submit, get, list, cancel", func(t *testing.T) {
+		c := newClient()
+
+		task, err := c.Submit(ctx, remoteTask)
+		assert.NoError(t, err)
+		assert.Equal(t, StatePending, task.State)
+		assert.JSONEq(t, `{"n":1}`, string(task.Payload))
+
+		got, err := c.Get(ctx, task.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, "sdk task", got.Name)
+
+		list, err := c.List(ctx, ListOptions{States: []string{StatePending}})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, list.Total)
+
+		canceled, err := c.Cancel(ctx, task.ID)
+		assert.NoError(t, err)
+		assert.True(t, canceled.Finished())
+
+		_, err = c.Cancel(ctx, task.ID)
+		var apiErr *Error
+		if assert.True(t, errors.As(err, &apiErr)) {
+			assert.Equal(t, http.StatusConflict, apiErr.Status)
+			assert.Equal(t, CodeTaskFinished, apiErr.Code)
+			assert.JSONEq(t, `"canceled"`, string(apiErr.Extra["state"]))
+			assert.NotEmpty(t, apiErr.RequestID)
+		}
+
+		assert.NoError(t, c.Delete(ctx, task.ID))
+		_, err = c.Get(ctx, task.ID)
+		assert.True(t, errors.As(err, &apiErr))
+		assert.Equal(t, CodeTaskNotFound, apiErr.Code)
+	})
+
+	t.Run("update with version", func(t *testing.T) {
+		c := newClient()
+
+		task, err := c.Submit(ctx, TaskRequest{Name: "patched", Type: "sdk-remote", Labels: map[string]string{"env": "dev"}})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, task.Version)
+
+		priority := 5
+		updated, err := c.Update(ctx, task.ID, TaskPatch{Priority: &priority, Labels: map[string]string{}}, task.Version)
+		assert.NoError(t, err)
+		assert.Equal(t, 5, updated.Priority)
+		assert.Empty(t, updated.Labels)
+		assert.Equal(t, 2, updated.Version)
+
+		var apiErr *Error
+		_, err = c.Update(ctx, task.ID, TaskPatch{Priority: &priority}, task.Version)
+		if assert.True(t, errors.As(err, &apiErr)) {
+			assert.Equal(t, http.StatusPreconditionFailed, apiErr.Status)
+			assert.Equal(t, CodeStaleVersion, apiErr.Code)
+		}
+
+		_, err = c.Cancel(ctx, task.ID)
+		assert.NoError(t, err)
+		_, err = c.Update(ctx, task.ID, TaskPatch{Priority: &priority}, 0)
+		if assert.True(t, errors.As(err, &apiErr)) {
+			assert.Equal(t, http.StatusConflict, apiErr.Status)
+			assert.Equal(t, CodeTaskFinished, apiErr.Code)
+		}
+	})
+
+	t.Run("invalid task", func(t *testing.T) {
+		c := newClient()
+
+		_, err := c.Submit(ctx, TaskRequest{})
+		var apiErr *Error
+		if assert.True(t, errors.As(err, &apiErr)) {
+			assert.Equal(t, CodeInvalidTask, apiErr.Code)
+		}
+
+		// тип без исполнителя и удаленных воркеров ждал бы в очереди вечно
+		_, err = c.Submit(ctx, TaskRequest{Name: "typo", Type: "htpp"})
+		if assert.True(t, errors.As(err, &apiErr)) {
+			assert.Equal(t, http.StatusBadRequest, apiErr.Status)
+			assert.Equal(t, CodeUnknownType, apiErr.Code)
+		}
+	})
+
+	t.Run("worker routes reject user tokens", func(t *testing.T) {
+		middleware.SetWorkerTokens(map[string]string{"worker-1": "worker-secret"})
+		defer middleware.SetWorkerTokens(nil)
+		c := newClient()
+
+		lease := func(header, value string) int {
+			req, _ := http.NewRequest(http.MethodPost, srv.URL+"/worker/lease", strings.NewReader(`{"types":["sdk-remote-none"]}`))
+			req.Header.Set(header, value)
+			resp, err := http.DefaultClient.Do(req)
+			if !assert.NoError(t, err) {
+				return 0
+			}
+			resp.Body.Close()
+			return resp.StatusCode
+		}
+
+		assert.Equal(t, http.StatusUnauthorized, lease("Authorization", "Bearer "+c.Tokens().Access))
+		assert.Equal(t, http.StatusUnauthorized, lease("X-Worker-Token", "guess"))
+		assert.Equal(t, http.StatusOK, lease("X-Worker-Token", "worker-secret"))
+	})
+
+	t.Run("legacy result is owner only", func(t *testing.T) {
+		owner, other := newClient(), newClient()
+		task, err := owner.Submit(ctx, remoteTask)
+		assert.NoError(t, err)
+		_, err = owner.Cancel(ctx, task.ID)
+		assert.NoError(t, err)
+
+		result := func(c *Client) int {
+			req, _ := http.NewRequest(http.MethodGet, srv.URL+"/result/"+task.ID, nil)
+			if c != nil {
+				req.Header.Set("Authorization", "Bearer "+c.Tokens().Access)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if !assert.NoError(t, err) {
+				return 0
+			}
+			resp.Body.Close()
+			return resp.StatusCode
+		}
+
+		assert.Equal(t, http.StatusUnauthorized, result(nil))
+		assert.Equal(t, http.StatusForbidden, result(other))
+		assert.Equal(t, http.StatusUnprocessableEntity, result(owner))
+	})
+
+	t.Run("wait", func(t *testing.T) {
+		c := newClient()
+		task, err := c.Submit(ctx, remoteTask)
+		assert.NoError(t, err)
+
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			c.Cancel(ctx, task.ID)
+		}()
+
+		finished, err := c.Wait(ctx, task.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, StateCanceled, finished.State)
+	})
+
+	t.Run("watch", func(t *testing.T) {
+		c := newClient()
+		task, err := c.Submit(ctx, remoteTask)
+		assert.NoError(t, err)
+
+		states := []string{}
+		err = c.Watch(ctx, task.ID, func(changed *Task) error {
+			states = append(states, changed.State)
+			if changed.State == StatePending {
+				_, err := c.Cancel(ctx, task.ID)
+				return err
+			}
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, StatePending, states[0])
+		assert.Equal(t, StateCanceled, states[len(states)-1])
+
+		// поток завершенной задачи сразу отдает ее состояние
+		states = states[:0]
+		assert.NoError(t, c.Watch(ctx, task.ID, func(changed *Task) error {
+			states = append(states, changed.State)
+			return nil
+		}))
+		assert.Equal(t, []string{StateCanceled}, states)
+
+		stop := errors.New("stop")
+		assert.ErrorIs(t, c.Watch(ctx, task.ID, func(*Task) error { return stop }), stop)
+
+		var apiErr *Error
+		err = newClient().Watch(ctx, task.ID, func(*Task) error { return nil })
+		if assert.True(t, errors.As(err, &apiErr)) {
+			assert.Equal(t, CodeTaskForbidden, apiErr.Code)
+		}
+	})
+
+	t.Run("delivery of task without callback", func(t *testing.T) {
+		c := newClient()
+		task, err := c.Submit(ctx, remoteTask)
+		assert.NoError(t, err)
+
+		_, err = c.Delivery(ctx, task.ID)
+		var apiErr *Error
+		if assert.True(t, errors.As(err, &apiErr)) {
+			assert.Equal(t, CodeNoDelivery, apiErr.Code)
+		}
+	})
+
+	t.Run("retries on 429", func(t *testing.T) {
+		c := newClient(WithMaxRetries(2))
+		throttled.Store(0)
+
+		throttle.Store(2)
+		_, err := c.List(ctx, ListOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, int32(2), throttled.Load())
+
+		throttle.Store(3)
+		_, err = c.List(ctx, ListOptions{})
+		var apiErr *Error
+		if assert.True(t, errors.As(err, &apiErr)) {
+			assert.Equal(t, http.StatusTooManyRequests, apiErr.Status)
+		}
+	})
+
+	t.Run("refreshes expired access token", func(t *testing.T) {
+		fake := clock.NewFake(time.Now())
+		clock.Set(fake)
+		defer clock.Set(clock.Real{})
+
+		var saved Tokens
+		c := newClient(OnRefresh(func(tokens Tokens) { saved = tokens }))
+		before := c.Tokens()
+
+		fake.Advance(time.Hour)
+		_, err := c.List(ctx, ListOptions{})
+		assert.NoError(t, err)
+
+		after := c.Tokens()
+		assert.NotEqual(t, before.Access, after.Access)
+		assert.Equal(t, before.UserID, after.UserID)
+		assert.Equal(t, after, saved)
+
+		// старую пару больше нельзя использовать
+		stale := New(srv.URL, WithTokens(before))
+		_, err = stale.List(ctx, ListOptions{})
+		var apiErr *Error
+		if assert.True(t, errors.As(err, &apiErr)) {
+			assert.Equal(t, CodeInvalidToken, apiErr.Code)
+		}
+	})
+}
+
+func TestRetryAfter(t *testing.T) {
+	assert.Equal(t, 2*time.Second, retryAfter("2"))
+	assert.Equal(t, defaultRetryDelay, retryAfter(""))
+	assert.Equal(t, defaultRetryDelay, retryAfter("soon"))
+	assert.Equal(t, time.Duration(0), retryAfter(time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat)))
+}
+
+func TestReadEvents(t *testing.T) {
+	stream := "retry: 500\n\n" +
+		": ping\n\n" +
+		"id: 7\nevent: task\ndata: {\"id\":\"a\",\r\ndata: \"state\":\"running\"}\n\n" +
+		"id: 8\nevent: deleted\ndata: {\"id\":\"a\"}\n\n" +
+		"id: 9\nevent: task\ndata: {\"id\":\"b\"}"
+
+	events := []event{}
+	delay, err := readEvents(strings.NewReader(stream), func(e event) error {
+		events = append(events, e)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 500*time.Millisecond, delay)
+	// последнее событие оборвано и не передается
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, event{id: "7", name: "task", data: []byte("{\"id\":\"a\",\n\"state\":\"running\"}")}, events[0])
+		assert.Equal(t, "deleted", events[1].name)
+	}
+
+	stop := errors.New("stop")
+	_, err = readEvents(strings.NewReader(stream), func(event) error { return stop })
+	assert.ErrorIs(t, err, stop)
+
+	delay, _ = readEvents(strings.NewReader(""), func(event) error { return nil })
+	assert.Equal(t, defaultReconnectDelay, delay)
+}
@@ -0,0 +1,76 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Стабильные коды ошибок API, по ним удобно различать ошибки через
+// errors.As и поле Code
+const (
+	CodeBadRequest     = "bad_request"
+	CodeInvalidTask    = "invalid_task"
+	CodeUnknownType    = "unknown_task_type"
+	CodeUnauthorized   = "unauthorized"
+	CodeInvalidToken   = "invalid_token"
+	CodeTaskForbidden  = "task_forbidden"
+	CodeTaskNotFound   = "task_not_found"
+	CodeTaskFinished   = "task_finished"
+	CodeStateConflict  = "state_conflict"
+	CodeTaskStarted    = "task_started"
+	CodeStaleVersion   = "version_mismatch"
+	CodeMemoCallback   = "memo_callback_conflict"
+	CodeResultNotReady = "result_not_ready"
+	CodeTaskFailed     = "task_failed"
+	CodeServerBusy     = "server_busy"
+	CodeNoDelivery     = "delivery_not_found"
+)
+
+// Error - ответ API с ошибкой (RFC 7807)
+type Error struct {
+	Status    int    `json:"status"`
+	Code      string `json:"code"`
+	Detail    string `json:"detail"`
+	Instance  string `json:"instance"`
+	RequestID string `json:"request_id"`
+	// Extra - дополнительные поля, например state задачи
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("api error %d %s", e.Status, e.Code)
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	if e.RequestID != "" {
+		msg += " (request_id " + e.RequestID + ")"
+	}
+	return msg
+}
+
+// decodeError читает тело ответа с ошибкой и закрывает его
+func decodeError(resp *http.Response) *Error {
+	defer resp.Body.Close()
+
+	apiErr := &Error{Status: resp.StatusCode}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err := json.Unmarshal(data, apiErr); err != nil || apiErr.Code == "" {
+		// ответ не из API, например от прокси
+		apiErr.Status = resp.StatusCode
+		apiErr.Detail = http.StatusText(resp.StatusCode)
+		return apiErr
+	}
+
+	fields := map[string]json.RawMessage{}
+	if json.Unmarshal(data, &fields) == nil {
+		for _, key := range []string{"type", "title", "status", "detail", "instance", "code", "request_id"} {
+			delete(fields, key)
+		}
+		if len(fields) > 0 {
+			apiErr.Extra = fields
+		}
+	}
+	return apiErr
+}
@@ -0,0 +1,125 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// пауза перед переподключением к потоку, если сервер не прислал retry
+const defaultReconnectDelay = 3 * time.Second
+
+// ErrTaskDeleted - задачу удалили, пока Watch следил за ней
+var ErrTaskDeleted = errors.New("task deleted")
+
+// streamBody получает тело ответа открытым, закрывает его вызывающий
+type streamBody struct {
+	body *io.ReadCloser
+}
+
+// event - событие Server-Sent Events
+type event struct {
+	id   string
+	name string
+	data []byte
+}
+
+// Watch следит за задачей через поток /v1/events и вызывает fn с задачей
+// на каждое изменение, пока она не завершится. После обрыва поток
+// продолжается с Last-Event-ID: пропущенные изменения приходят одним
+// вызовом fn с текущим состоянием задачи.
+// Ошибка fn прерывает Watch и возвращается как есть.
+func (c *Client) Watch(ctx context.Context, id string, fn func(*Task) error) error {
+	header := http.Header{}
+	header.Set("Accept", "text/event-stream")
+	path := "/v1/events?task_id=" + url.QueryEscape(id)
+
+	for {
+		var body io.ReadCloser
+		if _, err := c.doHeader(ctx, http.MethodGet, path, header, nil, streamBody{&body}, true); err != nil {
+			return err
+		}
+
+		finished := false
+		delay, err := readEvents(body, func(e event) error {
+			if e.id != "" {
+				header.Set("Last-Event-ID", e.id)
+			}
+			switch e.name {
+			case "deleted":
+				return fmt.Errorf("%s: %w", id, ErrTaskDeleted)
+			case "task":
+				task := &Task{}
+				if err := json.Unmarshal(e.data, task); err != nil {
+					return fmt.Errorf("decode event: %w", err)
+				}
+				if err := fn(task); err != nil {
+					return err
+				}
+				finished = task.Finished()
+			}
+			return nil
+		})
+		body.Close()
+		if err != nil || finished {
+			return err
+		}
+
+		// поток оборвался раньше, чем задача завершилась
+		if err := sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// readEvents передает fn события из r, пока поток не закончится или fn не
+// вернет ошибку. Обрыв потока - не ошибка: возвращается пауза перед
+// переподключением, которую просил сервер.
+func readEvents(r io.Reader, fn func(event) error) (time.Duration, error) {
+	delay := defaultReconnectDelay
+	e := event{}
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return delay, nil
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "":
+			// пустая строка завершает событие, строка с двоеточия - комментарий
+			if line == "" && e.name != "" {
+				if err := fn(e); err != nil {
+					return delay, err
+				}
+			}
+			if line == "" {
+				e = event{}
+			}
+		case "id":
+			e.id = value
+		case "event":
+			e.name = value
+		case "data":
+			if e.data != nil {
+				e.data = append(e.data, '\n')
+			}
+			e.data = append(e.data, value...)
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil && ms >= 0 {
+				delay = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+type QueueStatus struct {
+	Length           int  `json:"queue_length"`
+	Capacity         int  `json:"queue_capacity"`
+	RemoteLength     int  `json:"remote_queue_length"`
+	Leased           int  `json:"leased"`
+	InFlight         int  `json:"in_flight"`
+	UsedCapacity     int  `json:"used_capacity"`
+	ConcurrencyLimit int  `json:"concurrency_limit"`
+	Adaptive         bool `json:"adaptive"`
+}
+
+type WorkerInfo struct {
+	ID        int        `json:"id"`
+	Busy      bool       `json:"busy"`
+	Task      string     `json:"task,omitempty"`
+	TaskType  string     `json:"task_type,omitempty"`
+	StartedAt *time.Time `json:"started_at,omitempty"`
+}
+
+type Throughput struct {
+	LastMinute int     `json:"last_minute"`
+	PerMinute  float64 `json:"per_minute_5m"`
+	AvgWait    string  `json:"avg_wait"`
+}
+
+// Introspection - подробное состояние очередей и воркеров
+type Introspection struct {
+	Queue               QueueStatus    `json:"queue"`
+	PendingByType       map[string]int `json:"pending_by_type"`
+	RemotePendingByType map[string]int `json:"remote_pending_by_type"`
+	Workers             []WorkerInfo   `json:"workers"`
+	Throughput          Throughput     `json:"throughput"`
+}
+
+// Queue возвращает состояние очереди
+func (c *Client) Queue(ctx context.Context) (*QueueStatus, error) {
+	status := &QueueStatus{}
+	if _, err := c.do(ctx, http.MethodGet, "/api/queue", nil, status, true); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// Introspect возвращает состояние очередей и воркеров, нужен WithAdminToken
+func (c *Client) Introspect(ctx context.Context) (*Introspection, error) {
+	info := &Introspection{}
+	if _, err := c.do(ctx, http.MethodGet, "/admin/queues", nil, info, false); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
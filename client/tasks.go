@@ -0,0 +1,250 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Состояния задачи
+const (
+	StatePending  = "pending"
+	StateRunning  = "running"
+	StateDone     = "done"
+	StateFailed   = "failed"
+	StateCanceled = "canceled"
+)
+
+// сколько секунд сервер держит один запрос ожидания, максимум 120
+const waitTimeout = 30
+
+// TaskRequest - новая задача
+type TaskRequest struct {
+	Name           string          `json:"taskname"`
+	Cost           int             `json:"cost,omitempty"`
+	Type           string          `json:"type,omitempty"`
+	Payload        json.RawMessage `json:"payload,omitempty"`
+	Priority       int             `json:"priority,omitempty"`
+	ScheduledAt    *time.Time      `json:"scheduled_at,omitempty"`
+	CallbackURL    string          `json:"callback_url,omitempty"`
+	CallbackSecret string          `json:"callback_secret,omitempty"`
+	Memoize        bool            `json:"memoize,omitempty"`
+	// CacheTTL - сколько секунд переиспользовать результат memoize задачи
+	CacheTTL int `json:"cache_ttl,omitempty"`
+	// Labels - до 16 меток задачи
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+type Progress struct {
+	Done    int64   `json:"done"`
+	Total   int64   `json:"total"`
+	Percent float64 `json:"percent"`
+}
+
+type TaskError struct {
+	// Code - panic, canceled или failed
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Stack   string `json:"stack,omitempty"`
+}
+
+type Blob struct {
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+}
+
+// Task - задача, как ее возвращает /v1/tasks
+type Task struct {
+	ID         string          `json:"id"`
+	Name       string          `json:"name"`
+	Type       string          `json:"type"`
+	State      string          `json:"state"`
+	Status     string          `json:"status"`
+	Cost       int             `json:"cost"`
+	Priority   int             `json:"priority"`
+	Version    int             `json:"version"`
+	GroupID    string          `json:"group_id,omitempty"`
+	Payload    json.RawMessage `json:"payload,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+	Scheduled  *time.Time      `json:"scheduled_at,omitempty"`
+	FinishedAt *time.Time      `json:"finished_at,omitempty"`
+	Heartbeat  *time.Time      `json:"heartbeat,omitempty"`
+	Progress   *Progress       `json:"progress,omitempty"`
+	Error      *TaskError      `json:"error,omitempty"`
+	Result     json.RawMessage `json:"result,omitempty"`
+	Blob       *Blob           `json:"blob,omitempty"`
+	// Labels - метки задачи
+	Labels map[string]string `json:"labels,omitempty"`
+	// Cache - результат поиска memoize задачи: miss, hit или coalesced
+	Cache string `json:"-"`
+}
+
+// Finished сообщает, что задача в конечном состоянии
+func (t *Task) Finished() bool {
+	return t.State == StateDone || t.State == StateFailed || t.State == StateCanceled
+}
+
+type TaskList struct {
+	Tasks  []Task `json:"tasks"`
+	Total  int    `json:"total"`
+	Limit  int    `json:"limit"`
+	Offset int    `json:"offset"`
+}
+
+// ListOptions - фильтры списка задач, пустые поля не фильтруют
+type ListOptions struct {
+	States        []string
+	Type          string
+	GroupID       string
+	Name          string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	Limit         int
+	Offset        int
+}
+
+func (o ListOptions) query() string {
+	q := url.Values{}
+	if len(o.States) > 0 {
+		q.Set("state", strings.Join(o.States, ","))
+	}
+	if o.Type != "" {
+		q.Set("type", o.Type)
+	}
+	if o.GroupID != "" {
+		q.Set("group_id", o.GroupID)
+	}
+	if o.Name != "" {
+		q.Set("name", o.Name)
+	}
+	if !o.CreatedAfter.IsZero() {
+		q.Set("created_after", o.CreatedAfter.Format(time.RFC3339))
+	}
+	if !o.CreatedBefore.IsZero() {
+		q.Set("created_before", o.CreatedBefore.Format(time.RFC3339))
+	}
+	if o.Limit > 0 {
+		q.Set("limit", strconv.Itoa(o.Limit))
+	}
+	if o.Offset > 0 {
+		q.Set("offset", strconv.Itoa(o.Offset))
+	}
+	if len(q) == 0 {
+		return ""
+	}
+	return "?" + q.Encode()
+}
+
+// Submit создает задачу
+func (c *Client) Submit(ctx context.Context, task TaskRequest) (*Task, error) {
+	created := &Task{}
+	resp, err := c.do(ctx, http.MethodPost, "/v1/tasks", task, created, true)
+	if err != nil {
+		return nil, err
+	}
+	created.Cache = resp.Header.Get("X-Cache")
+	return created, nil
+}
+
+func (c *Client) Get(ctx context.Context, id string) (*Task, error) {
+	task := &Task{}
+	if _, err := c.do(ctx, http.MethodGet, taskPath(id, ""), nil, task, true); err != nil {
+		return nil, err
+	}
+	return task, nil
+}
+
+func (c *Client) List(ctx context.Context, opts ListOptions) (*TaskList, error) {
+	list := &TaskList{}
+	if _, err := c.do(ctx, http.MethodGet, "/v1/tasks"+opts.query(), nil, list, true); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// TaskPatch - изменения задачи, nil поля не меняются
+type TaskPatch struct {
+	Name        *string    `json:"name,omitempty"`
+	Priority    *int       `json:"priority,omitempty"`
+	ScheduledAt *time.Time `json:"scheduled_at,omitempty"`
+	// Labels заменяют все метки задачи, пустая карта удаляет их
+	Labels  map[string]string `json:"labels"`
+	Payload json.RawMessage   `json:"payload,omitempty"`
+}
+
+// Update меняет задачу, которая еще не начала выполняться. С version > 0
+// задача меняется, только если ее версия не изменилась, иначе - ошибка
+// с кодом CodeStaleVersion. Для выполняющейся задачи ошибка с кодом
+// CodeTaskStarted, для завершенной - CodeTaskFinished.
+func (c *Client) Update(ctx context.Context, id string, patch TaskPatch, version int) (*Task, error) {
+	header := http.Header{}
+	if version > 0 {
+		header.Set("If-Match", `"`+strconv.Itoa(version)+`"`)
+	}
+
+	task := &Task{}
+	if _, err := c.doHeader(ctx, http.MethodPatch, taskPath(id, ""), header, patch, task, true); err != nil {
+		return nil, err
+	}
+	return task, nil
+}
+
+// Cancel отменяет задачу, которая еще не завершилась
+func (c *Client) Cancel(ctx context.Context, id string) (*Task, error) {
+	task := &Task{}
+	if _, err := c.do(ctx, http.MethodPost, taskPath(id, "/cancel"), nil, task, true); err != nil {
+		return nil, err
+	}
+	return task, nil
+}
+
+// Delete удаляет задачу, выполняющаяся задача при этом отменяется
+func (c *Client) Delete(ctx context.Context, id string) error {
+	_, err := c.do(ctx, http.MethodDelete, taskPath(id, ""), nil, nil, true)
+	return err
+}
+
+// Result возвращает результат успешно завершенной задачи и его тип
+// содержимого. Для задачи без результата data пустой.
+func (c *Client) Result(ctx context.Context, id string) (data []byte, contentType string, err error) {
+	raw := json.RawMessage{}
+	resp, err := c.do(ctx, http.MethodGet, taskPath(id, "/result"), nil, rawBody{&raw}, true)
+	if err != nil {
+		return nil, "", err
+	}
+	return raw, resp.Header.Get("Content-Type"), nil
+}
+
+// rawBody получает тело ответа как есть, даже если это не JSON
+type rawBody struct {
+	data *json.RawMessage
+}
+
+func (b rawBody) decode(r io.Reader) error {
+	data, err := io.ReadAll(r)
+	*b.data = data
+	return err
+}
+
+// Wait ждет завершения задачи длинными запросами /wait и возвращает ее в
+// конечном состоянии. Неудачная или отмененная задача - не ошибка Wait,
+// проверяйте State.
+func (c *Client) Wait(ctx context.Context, id string) (*Task, error) {
+	for {
+		task := &Task{}
+		resp, err := c.do(ctx, http.MethodGet, taskPath(id, fmt.Sprintf("/wait?timeout=%d", waitTimeout)), nil, task, true)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusOK {
+			return task, nil
+		}
+		// 202: задача еще выполняется, ждем дальше
+	}
+}
@@ -0,0 +1,40 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Состояния доставки уведомления о завершении задачи
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+type DeliveryAttempt struct {
+	N          int       `json:"attempt"`
+	At         time.Time `json:"at"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+}
+
+// Delivery - доставка callback-уведомления задачи и все попытки отправки
+type Delivery struct {
+	TaskID   string            `json:"uuid"`
+	URL      string            `json:"url"`
+	State    string            `json:"state"`
+	Attempts []DeliveryAttempt `json:"attempts"`
+}
+
+// Delivery возвращает доставку уведомления задачи. Для задачи без
+// callback_url или с уже удаленной доставкой - ошибка с кодом CodeNoDelivery.
+func (c *Client) Delivery(ctx context.Context, id string) (*Delivery, error) {
+	delivery := &Delivery{}
+	if _, err := c.do(ctx, http.MethodPost, "/api/webhooks", map[string]string{"uuid": id}, delivery, true); err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
@@ -0,0 +1,402 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"ioboundlimiter/client"
+	"os"
+	"strings"
+	"time"
+)
+
+func newFlags(name, args string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: iobctl %s %s\n", name, args)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// taskIDs разбирает флаги команды, которой нужны UUID задач
+func taskIDs(name string, args []string, min int) ([]string, error) {
+	flags := newFlags(name, "<id>...")
+	if err := parseFlags(flags, args); err != nil {
+		return nil, err
+	}
+	if flags.NArg() < min {
+		flags.Usage()
+		return nil, fmt.Errorf("%s: task id is required", name)
+	}
+	return flags.Args(), nil
+}
+
+func registerCmd(ctx context.Context, a *app, args []string) error {
+	if err := parseFlags(newFlags("register", ""), args); err != nil {
+		return err
+	}
+
+	tokens, err := a.client.Register(ctx)
+	if err != nil {
+		return err
+	}
+	a.cfg.setTokens(tokens)
+	if err := a.cfg.save(); err != nil {
+		return err
+	}
+
+	if a.out.json {
+		return a.out.printJSON(map[string]string{"user_id": tokens.UserID, "config": a.cfg.path})
+	}
+	fmt.Fprintf(a.out.w, "Registered user %s, credentials saved to %s\n", tokens.UserID, a.cfg.path)
+	return nil
+}
+
+func submitCmd(ctx context.Context, a *app, args []string) error {
+	flags := newFlags("submit", "[-name NAME -type TYPE -payload JSON ...] | -file tasks.jsonl")
+	task := client.TaskRequest{}
+	flags.StringVar(&task.Name, "name", "", "название задачи")
+	flags.StringVar(&task.Type, "type", "", "тип задачи")
+	flags.IntVar(&task.Cost, "cost", 0, "вес задачи")
+	payload := flags.String("payload", "", "входные данные в JSON")
+	flags.StringVar(&task.CallbackURL, "callback-url", "", "адрес уведомления о завершении")
+	flags.BoolVar(&task.Memoize, "memoize", false, "переиспользовать задачу с теми же type и payload")
+	flags.IntVar(&task.CacheTTL, "cache-ttl", 0, "сколько секунд переиспользовать результат")
+	file := flags.String("file", "", "JSONL файл с задачами в формате POST /v1/tasks, - для stdin")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	if err := a.requireLogin(); err != nil {
+		return err
+	}
+
+	var tasks []client.TaskRequest
+	switch {
+	case *file != "":
+		var err error
+		if tasks, err = readTasks(*file); err != nil {
+			return err
+		}
+	case task.Name != "":
+		if *payload != "" {
+			if !json.Valid([]byte(*payload)) {
+				return errors.New("submit: payload should be JSON")
+			}
+			task.Payload = json.RawMessage(*payload)
+		}
+		tasks = []client.TaskRequest{task}
+	default:
+		flags.Usage()
+		return errors.New("submit: -name or -file is required")
+	}
+
+	// созданные задачи печатаются и при ошибке, чтобы их не отправили повторно
+	created := make([]client.Task, 0, len(tasks))
+	var submitErr error
+	for i, task := range tasks {
+		resp, err := a.client.Submit(ctx, task)
+		if err != nil {
+			submitErr = fmt.Errorf("task %d (%s): %w", i+1, task.Name, err)
+			break
+		}
+		created = append(created, *resp)
+	}
+
+	if len(created) > 0 {
+		if err := a.out.tasks(created); err != nil {
+			return err
+		}
+	}
+	return submitErr
+}
+
+// readTasks читает задачи из JSONL файла, пустые строки пропускаются
+func readTasks(path string) ([]client.TaskRequest, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var tasks []client.TaskRequest
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		task := client.TaskRequest{}
+		if err := json.Unmarshal([]byte(text), &task); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		tasks = append(tasks, task)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	if len(tasks) == 0 {
+		return nil, fmt.Errorf("%s: no tasks", path)
+	}
+	return tasks, nil
+}
+
+func getCmd(ctx context.Context, a *app, args []string) error {
+	ids, err := taskIDs("get", args, 1)
+	if err != nil {
+		return err
+	}
+	if err := a.requireLogin(); err != nil {
+		return err
+	}
+
+	task, err := a.client.Get(ctx, ids[0])
+	if err != nil {
+		return err
+	}
+	return a.out.task(task)
+}
+
+func listCmd(ctx context.Context, a *app, args []string) error {
+	flags := newFlags("list", "[flags]")
+	opts := client.ListOptions{}
+	states := flags.String("state", "", "состояния через запятую, например pending,running")
+	flags.StringVar(&opts.Type, "type", "", "тип задачи")
+	flags.StringVar(&opts.GroupID, "group", "", "UUID группы")
+	flags.StringVar(&opts.Name, "name", "", "подстрока названия")
+	since := flags.Duration("since", 0, "только задачи, созданные за этот период, например 1h")
+	flags.IntVar(&opts.Limit, "limit", 0, "сколько задач показать, по умолчанию 50")
+	flags.IntVar(&opts.Offset, "offset", 0, "сколько задач пропустить")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	if err := a.requireLogin(); err != nil {
+		return err
+	}
+	if *states != "" {
+		opts.States = strings.Split(*states, ",")
+	}
+	if *since > 0 {
+		opts.CreatedAfter = time.Now().Add(-*since)
+	}
+
+	list, err := a.client.List(ctx, opts)
+	if err != nil {
+		return err
+	}
+	if a.out.json {
+		return a.out.printJSON(list)
+	}
+	if err := a.out.tasks(list.Tasks); err != nil {
+		return err
+	}
+	fmt.Fprintf(a.out.w, "\n%d of %d tasks\n", len(list.Tasks), list.Total)
+	return nil
+}
+
+// watchCmd печатает изменения задачи из потока событий, пока она не
+// завершится
+func watchCmd(ctx context.Context, a *app, args []string) error {
+	ids, err := taskIDs("watch", args, 1)
+	if err != nil {
+		return err
+	}
+	if err := a.requireLogin(); err != nil {
+		return err
+	}
+
+	last := ""
+	return a.client.Watch(ctx, ids[0], func(task *client.Task) error {
+		// отмена публикует несколько изменений подряд, печатаются только отличия
+		line := task.State + "\t" + progress(task.Progress) + "\t" + task.Status
+		if line == last {
+			return nil
+		}
+		last = line
+		return a.out.change(task)
+	})
+}
+
+// deadLettersCmd показывает задачи, которые не выполнились, а с -webhooks -
+// завершенные задачи, уведомление о которых не доставлено после всех попыток.
+// Отдельной очереди недоставленного в сервисе нет, поэтому это выборка из
+// списка задач.
+func deadLettersCmd(ctx context.Context, a *app, args []string) error {
+	flags := newFlags("deadletters", "[flags]")
+	webhooks := flags.Bool("webhooks", false, "недоставленные уведомления о завершении вместо упавших задач")
+	opts := client.ListOptions{}
+	flags.StringVar(&opts.Type, "type", "", "тип задачи")
+	since := flags.Duration("since", 0, "только задачи, созданные за этот период, например 1h")
+	flags.IntVar(&opts.Limit, "limit", 0, "сколько задач просмотреть, по умолчанию 50")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	if err := a.requireLogin(); err != nil {
+		return err
+	}
+	opts.States = []string{client.StateFailed}
+	if *webhooks {
+		opts.States = []string{client.StateDone, client.StateFailed, client.StateCanceled}
+	}
+	if *since > 0 {
+		opts.CreatedAfter = time.Now().Add(-*since)
+	}
+
+	list, err := a.client.List(ctx, opts)
+	if err != nil {
+		return err
+	}
+	if !*webhooks {
+		return a.out.failedTasks(list.Tasks)
+	}
+
+	letters := []deadLetter{}
+	for _, task := range list.Tasks {
+		delivery, err := a.client.Delivery(ctx, task.ID)
+		var apiErr *client.Error
+		if errors.As(err, &apiErr) && apiErr.Code == client.CodeNoDelivery {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if delivery.State == client.DeliveryFailed {
+			letters = append(letters, deadLetter{Task: task, Delivery: *delivery})
+		}
+	}
+	return a.out.deadLetters(letters)
+}
+
+func waitCmd(ctx context.Context, a *app, args []string) error {
+	ids, err := taskIDs("wait", args, 1)
+	if err != nil {
+		return err
+	}
+	if err := a.requireLogin(); err != nil {
+		return err
+	}
+
+	task, err := a.client.Wait(ctx, ids[0])
+	if err != nil {
+		return err
+	}
+	if err := a.out.task(task); err != nil {
+		return err
+	}
+	if task.State != client.StateDone {
+		return fmt.Errorf("task %s is %s", task.ID, task.State)
+	}
+	return nil
+}
+
+// eachTask выполняет fn для каждой задачи, ошибки не прерывают остальные
+func eachTask(ctx context.Context, a *app, name string, args []string, fn func(id string) (*client.Task, error)) error {
+	ids, err := taskIDs(name, args, 1)
+	if err != nil {
+		return err
+	}
+	if err := a.requireLogin(); err != nil {
+		return err
+	}
+
+	tasks := []client.Task{}
+	failed := 0
+	for _, id := range ids {
+		task, err := fn(id)
+		if err != nil {
+			fmt.Fprintf(stderr, "iobctl: %s %s: %v\n", name, id, err)
+			failed++
+			continue
+		}
+		tasks = append(tasks, *task)
+	}
+
+	if len(tasks) > 0 {
+		if err := a.out.tasks(tasks); err != nil {
+			return err
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%s: %d of %d tasks failed", name, failed, len(ids))
+	}
+	return nil
+}
+
+func cancelCmd(ctx context.Context, a *app, args []string) error {
+	return eachTask(ctx, a, "cancel", args, func(id string) (*client.Task, error) {
+		return a.client.Cancel(ctx, id)
+	})
+}
+
+// retryCmd создает новую задачу с названием, типом, весом и payload
+// завершенной. Повторов на стороне сервиса нет, уведомление не переносится.
+func retryCmd(ctx context.Context, a *app, args []string) error {
+	return eachTask(ctx, a, "retry", args, func(id string) (*client.Task, error) {
+		task, err := a.client.Get(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if !task.Finished() {
+			return nil, fmt.Errorf("task is still %s", task.State)
+		}
+		return a.client.Submit(ctx, client.TaskRequest{Name: task.Name, Type: task.Type, Cost: task.Cost, Payload: task.Payload, Priority: task.Priority, Labels: task.Labels})
+	})
+}
+
+func resultCmd(ctx context.Context, a *app, args []string) error {
+	ids, err := taskIDs("result", args, 1)
+	if err != nil {
+		return err
+	}
+	if err := a.requireLogin(); err != nil {
+		return err
+	}
+
+	data, _, err := a.client.Result(ctx, ids[0])
+	if err != nil {
+		return err
+	}
+	_, err = a.out.w.Write(data)
+	return err
+}
+
+func queueCmd(ctx context.Context, a *app, args []string) error {
+	flags := newFlags("queue", "[-admin]")
+	admin := flags.Bool("admin", false, "очереди по типам и воркеры, нужен admin_token в настройках или IOBCTL_ADMIN_TOKEN")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	if *admin {
+		if a.cfg.AdminToken == "" {
+			return errors.New("queue: admin token is not set, use IOBCTL_ADMIN_TOKEN or admin_token in config")
+		}
+		info, err := a.client.Introspect(ctx)
+		if err != nil {
+			return err
+		}
+		return a.out.introspection(info)
+	}
+
+	if err := a.requireLogin(); err != nil {
+		return err
+	}
+	status, err := a.client.Queue(ctx)
+	if err != nil {
+		return err
+	}
+	return a.out.queue(status)
+}
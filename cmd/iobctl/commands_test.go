@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"ioboundlimiter/client"
+	"ioboundlimiter/internal/router"
+	"ioboundlimiter/internal/storage"
+	"ioboundlimiter/internal/webhook"
+	"ioboundlimiter/internal/workers"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// remoteType - задачи этого типа ждут удаленных воркеров и остаются в pending
+const remoteType = "iobctl-remote"
+
+func TestReadTasks(t *testing.T) {
+	write := func(t *testing.T, content string) string {
+		path := filepath.Join(t.TempDir(), "tasks.jsonl")
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		return path
+	}
+
+	t.Run("skips blank lines", func(t *testing.T) {
+		path := write(t, "{\"taskname\":\"a\",\"type\":\"http\",\"payload\":{\"n\":1}}\n\n  \n{\"taskname\":\"b\",\"cost\":2}\n")
+
+		tasks, err := readTasks(path)
+		assert.NoError(t, err)
+		if assert.Len(t, tasks, 2) {
+			assert.Equal(t, "a", tasks[0].Name)
+			assert.JSONEq(t, `{"n":1}`, string(tasks[0].Payload))
+			assert.Equal(t, client.TaskRequest{Name: "b", Cost: 2}, tasks[1])
+		}
+	})
+
+	t.Run("error names the line", func(t *testing.T) {
+		path := write(t, "{\"taskname\":\"a\"}\n\n{broken\n")
+
+		_, err := readTasks(path)
+		assert.ErrorContains(t, err, path+":3:")
+	})
+
+	t.Run("empty file", func(t *testing.T) {
+		_, err := readTasks(write(t, "\n"))
+		assert.ErrorContains(t, err, "no tasks")
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := readTasks(filepath.Join(t.TempDir(), "missing.jsonl"))
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+}
+
+func TestTaskIDs(t *testing.T) {
+	ids, err := taskIDs("cancel", []string{"a", "b"}, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, ids)
+
+	captureStderr(t)
+	_, err = taskIDs("get", nil, 1)
+	assert.ErrorContains(t, err, "get: task id is required")
+
+	_, err = taskIDs("get", []string{"-all", "a"}, 1)
+	assert.ErrorIs(t, err, errUsage)
+}
+
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// newTestApp запускает API и возвращает зарегистрированное приложение,
+// вывод которого пишется в буфер
+func newTestApp(t *testing.T) (*app, *bytes.Buffer) {
+	gin.SetMode(gin.TestMode)
+	workers.RegisterRemoteType(remoteType)
+	workers.InitWorkers()
+	srv := httptest.NewServer(router.New())
+	t.Cleanup(func() {
+		srv.Close()
+		workers.Shutdown()
+	})
+
+	cfg := &config{URL: srv.URL, path: filepath.Join(t.TempDir(), "config.json")}
+	buf := &bytes.Buffer{}
+	a := &app{cfg: cfg, client: client.New(srv.URL), out: output{w: buf}}
+	assert.NoError(t, registerCmd(context.Background(), a, nil))
+	a.client = client.New(srv.URL, client.WithTokens(cfg.tokens()))
+	buf.Reset()
+	return a, buf
+}
+
+func TestCommands(t *testing.T) {
+	a, buf := newTestApp(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	submit := func(t *testing.T, name string) string {
+		task, err := a.client.Submit(ctx, client.TaskRequest{Name: name, Type: remoteType})
+		assert.NoError(t, err)
+		return task.ID
+	}
+
+	t.Run("requires login", func(t *testing.T) {
+		anonymous := &app{cfg: &config{path: "config.json"}, out: a.out}
+		assert.ErrorContains(t, listCmd(ctx, anonymous, nil), `run "iobctl register" first`)
+	})
+
+	t.Run("submit from file", func(t *testing.T) {
+		buf.Reset()
+		path := filepath.Join(t.TempDir(), "tasks.jsonl")
+		assert.NoError(t, os.WriteFile(path, []byte(`{"taskname":"from file","type":"`+remoteType+`"}`+"\n"), 0o600))
+
+		assert.NoError(t, submitCmd(ctx, a, []string{"-file", path}))
+		assert.Contains(t, buf.String(), "from file")
+
+		assert.ErrorContains(t, submitCmd(ctx, a, []string{"-name", "bad", "-payload", "{"}), "payload should be JSON")
+	})
+
+	t.Run("watch follows the stream", func(t *testing.T) {
+		// задачу отменяют, когда watch напечатал первое изменение
+		printed := &lockedBuffer{}
+		watcher := &app{cfg: a.cfg, client: a.client, out: output{json: true, w: printed}}
+		id := submit(t, "watched")
+
+		go func() {
+			assert.Eventually(t, func() bool { return strings.Contains(printed.String(), id) }, 5*time.Second, time.Millisecond)
+			a.client.Cancel(ctx, id)
+		}()
+		assert.NoError(t, watchCmd(ctx, watcher, []string{id}))
+
+		states := []string{}
+		for _, line := range strings.Split(strings.TrimSpace(printed.String()), "\n") {
+			task := client.Task{}
+			assert.NoError(t, json.Unmarshal([]byte(line), &task))
+			states = append(states, task.State)
+		}
+		assert.Equal(t, []string{client.StatePending, client.StateCanceled}, states)
+	})
+
+	t.Run("dead letters", func(t *testing.T) {
+		buf.Reset()
+		failed := submit(t, "broken")
+		assert.NoError(t, storage.FailTask(failed, "boom", ""))
+		canceled := submit(t, "canceled")
+		_, err := a.client.Cancel(ctx, canceled)
+		assert.NoError(t, err)
+
+		assert.NoError(t, deadLettersCmd(ctx, a, nil))
+		assert.Contains(t, buf.String(), failed)
+		assert.Contains(t, buf.String(), "boom")
+		assert.NotContains(t, buf.String(), canceled)
+	})
+
+	t.Run("undelivered webhooks", func(t *testing.T) {
+		webhook.SetSecret("iobctl-secret")
+		defer webhook.SetSecret("")
+		webhook.Init(webhook.Config{MaxAttempts: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond, Timeout: time.Second, Senders: 1, AllowPrivate: true})
+		defer webhook.Shutdown()
+
+		hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer hook.Close()
+
+		task, err := a.client.Submit(ctx, client.TaskRequest{Name: "notified", Type: remoteType, CallbackURL: hook.URL})
+		assert.NoError(t, err)
+		_, err = a.client.Cancel(ctx, task.ID)
+		assert.NoError(t, err)
+		assert.Eventually(t, func() bool {
+			delivery, err := a.client.Delivery(ctx, task.ID)
+			return err == nil && delivery.State == client.DeliveryFailed
+		}, 5*time.Second, 10*time.Millisecond)
+
+		buf.Reset()
+		a.out.json = true
+		defer func() { a.out.json = false }()
+		assert.NoError(t, deadLettersCmd(ctx, a, []string{"-webhooks"}))
+
+		letters := []deadLetter{}
+		assert.NoError(t, json.Unmarshal(buf.Bytes(), &letters))
+		if assert.Len(t, letters, 1) {
+			assert.Equal(t, task.ID, letters[0].Task.ID)
+			assert.Equal(t, hook.URL, letters[0].Delivery.URL)
+			assert.Len(t, letters[0].Delivery.Attempts, 2)
+		}
+	})
+}
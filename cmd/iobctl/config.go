@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"ioboundlimiter/client"
+	"os"
+	"path/filepath"
+)
+
+const defaultURL = "http://localhost:8080"
+
+// config - адрес сервиса и учетные данные, хранится в файле с правами 0600
+type config struct {
+	URL        string `json:"url"`
+	UserID     string `json:"user_id,omitempty"`
+	Access     string `json:"access,omitempty"`
+	Refresh    string `json:"refresh,omitempty"`
+	AdminToken string `json:"admin_token,omitempty"`
+
+	path string
+}
+
+// configPath - флаг -config, затем IOBCTL_CONFIG, затем каталог настроек пользователя
+func configPath(flagValue string) (string, error) {
+	if flagValue != "" {
+		return flagValue, nil
+	}
+	if path := os.Getenv("IOBCTL_CONFIG"); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot find config dir: %w", err)
+	}
+	return filepath.Join(dir, "iobctl", "config.json"), nil
+}
+
+// loadConfig читает файл настроек, отсутствующий файл - пустые настройки
+func loadConfig(path string) (*config, error) {
+	cfg := &config{path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("parse config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+func (cfg *config) save() error {
+	if err := os.MkdirAll(filepath.Dir(cfg.path), 0o700); err != nil {
+		return fmt.Errorf("create config dir: %w", err)
+	}
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	// файл с токенами не должны читать другие пользователи
+	tmp := cfg.path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o600); err != nil {
+		return fmt.Errorf("write config: %w", err)
+	}
+	return os.Rename(tmp, cfg.path)
+}
+
+func (cfg *config) setTokens(tokens client.Tokens) {
+	if tokens.UserID != "" {
+		cfg.UserID = tokens.UserID
+	}
+	cfg.Access, cfg.Refresh = tokens.Access, tokens.Refresh
+}
+
+func (cfg *config) tokens() client.Tokens {
+	return client.Tokens{UserID: cfg.UserID, Access: cfg.Access, Refresh: cfg.Refresh}
+}
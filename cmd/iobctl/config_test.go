@@ -0,0 +1,66 @@
+package main
+
+import (
+	"ioboundlimiter/client"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfig(t *testing.T) {
+	t.Run("save and load", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "iobctl", "config.json")
+
+		cfg, err := loadConfig(path)
+		assert.NoError(t, err)
+		assert.Equal(t, &config{path: path}, cfg)
+
+		cfg.URL = "http://localhost:9000"
+		cfg.setTokens(client.Tokens{UserID: "user", Access: "access", Refresh: "refresh"})
+		assert.NoError(t, cfg.save())
+
+		info, err := os.Stat(path)
+		assert.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+		loaded, err := loadConfig(path)
+		assert.NoError(t, err)
+		assert.Equal(t, cfg, loaded)
+		assert.Equal(t, client.Tokens{UserID: "user", Access: "access", Refresh: "refresh"}, loaded.tokens())
+	})
+
+	t.Run("refreshed tokens keep user", func(t *testing.T) {
+		cfg := &config{UserID: "user"}
+		cfg.setTokens(client.Tokens{Access: "new access", Refresh: "new refresh"})
+		assert.Equal(t, client.Tokens{UserID: "user", Access: "new access", Refresh: "new refresh"}, cfg.tokens())
+	})
+
+	t.Run("broken file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.json")
+		assert.NoError(t, os.WriteFile(path, []byte("{"), 0o600))
+
+		_, err := loadConfig(path)
+		assert.ErrorContains(t, err, "parse config")
+	})
+
+	t.Run("path from flag, env and user dir", func(t *testing.T) {
+		t.Setenv("IOBCTL_CONFIG", "/env/config.json")
+		t.Setenv("XDG_CONFIG_HOME", "/xdg")
+		t.Setenv("HOME", "/home/user")
+
+		path, err := configPath("/flag/config.json")
+		assert.NoError(t, err)
+		assert.Equal(t, "/flag/config.json", path)
+
+		path, err = configPath("")
+		assert.NoError(t, err)
+		assert.Equal(t, "/env/config.json", path)
+
+		t.Setenv("IOBCTL_CONFIG", "")
+		path, err = configPath("")
+		assert.NoError(t, err)
+		assert.Equal(t, filepath.Join("/xdg", "iobctl", "config.json"), path)
+	})
+}
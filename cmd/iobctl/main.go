@@ -0,0 +1,180 @@
+// iobctl - утилита командной строки для работы с сервисом: регистрация,
+// создание и отслеживание задач, состояние очередей.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"ioboundlimiter/client"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+const usage = `Usage: iobctl [-url URL] [-config FILE] [-o table|json] <command> [args]
+
+Commands:
+  register                  зарегистрироваться и сохранить токены
+  submit [flags]            создать задачу из флагов или задачи из JSONL файла (-file)
+  get <id>                  показать задачу
+  list [flags]              список задач
+  watch <id>                показывать изменения задачи до ее завершения
+  deadletters [-webhooks]   упавшие задачи, с -webhooks - недоставленные уведомления
+  wait <id>                 дождаться завершения задачи
+  cancel <id>...            отменить задачи
+  retry <id>...             создать задачи заново с теми же параметрами
+  result <id>               вывести результат задачи
+  queue [-admin]            состояние очереди, с -admin - очереди и воркеры
+
+Run "iobctl <command> -h" for command flags.
+`
+
+// app - общие для команд настройки
+type app struct {
+	cfg    *config
+	client *client.Client
+	out    output
+}
+
+type command func(ctx context.Context, a *app, args []string) error
+
+var commands = map[string]command{
+	"register":    registerCmd,
+	"submit":      submitCmd,
+	"get":         getCmd,
+	"list":        listCmd,
+	"watch":       watchCmd,
+	"deadletters": deadLettersCmd,
+	"wait":        waitCmd,
+	"cancel":      cancelCmd,
+	"retry":       retryCmd,
+	"result":      resultCmd,
+	"queue":       queueCmd,
+}
+
+// stderr - куда пишутся справка по флагам и ошибки отдельных задач
+var stderr io.Writer = os.Stderr
+
+// errUsage - ошибка в командной строке, flag уже вывел ее вместе со справкой
+var errUsage = errors.New("invalid usage")
+
+// invocation - разобранная командная строка
+type invocation struct {
+	name   string
+	cmd    command
+	url    string
+	config string
+	format string
+	args   []string
+}
+
+func main() {
+	inv, err := parseArgs(os.Args[1:])
+	if err == nil {
+		err = run(inv.cmd, inv.url, inv.config, inv.format, inv.args)
+	}
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+	case errors.Is(err, errUsage):
+		os.Exit(2)
+	default:
+		fmt.Fprintf(os.Stderr, "iobctl: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// parseArgs разбирает общие флаги и находит команду, ее флаги разбирает
+// сама команда
+func parseArgs(args []string) (invocation, error) {
+	flags := flag.NewFlagSet("iobctl", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() { fmt.Fprint(flags.Output(), usage) }
+	inv := invocation{}
+	flags.StringVar(&inv.url, "url", os.Getenv("IOBCTL_URL"), "адрес сервиса")
+	flags.StringVar(&inv.config, "config", "", "файл настроек")
+	flags.StringVar(&inv.format, "o", "table", "формат вывода: table или json")
+	if err := parseFlags(flags, args); err != nil {
+		return inv, err
+	}
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return inv, errUsage
+	}
+	inv.name = flags.Arg(0)
+	cmd, ok := commands[inv.name]
+	if !ok {
+		fmt.Fprintf(stderr, "iobctl: unknown command %q\n\n", inv.name)
+		flags.Usage()
+		return inv, errUsage
+	}
+	inv.cmd, inv.args = cmd, flags.Args()[1:]
+	return inv, nil
+}
+
+// parseFlags разбирает флаги, -h возвращает flag.ErrHelp, остальные
+// ошибки - errUsage
+func parseFlags(flags *flag.FlagSet, args []string) error {
+	err := flags.Parse(args)
+	if err != nil && !errors.Is(err, flag.ErrHelp) {
+		return errUsage
+	}
+	return err
+}
+
+func run(cmd command, url, configFlag, format string, args []string) error {
+	out, err := newOutput(format)
+	if err != nil {
+		return err
+	}
+
+	path, err := configPath(configFlag)
+	if err != nil {
+		return err
+	}
+	cfg, err := loadConfig(path)
+	if err != nil {
+		return err
+	}
+	if url != "" {
+		cfg.URL = url
+	}
+	if cfg.URL == "" {
+		cfg.URL = defaultURL
+	}
+	if token := os.Getenv("IOBCTL_ADMIN_TOKEN"); token != "" {
+		cfg.AdminToken = token
+	}
+
+	// обновленные клиентом токены сразу сохраняются: старая пара больше не действует
+	c := client.New(cfg.URL,
+		client.WithTokens(cfg.tokens()),
+		client.WithAdminToken(cfg.AdminToken),
+		client.OnRefresh(func(tokens client.Tokens) {
+			cfg.setTokens(tokens)
+			if err := cfg.save(); err != nil {
+				fmt.Fprintf(stderr, "iobctl: cannot save refreshed tokens: %v\n", err)
+			}
+		}),
+	)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err = cmd(ctx, &app{cfg: cfg, client: c, out: out}, args)
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
+}
+
+// requireLogin не дает отправить запрос без токенов
+func (a *app) requireLogin() error {
+	if a.cfg.Access == "" {
+		return fmt.Errorf("no credentials in %s, run \"iobctl register\" first", a.cfg.path)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// captureStderr перенаправляет справку и ошибки flag в буфер до конца теста
+func captureStderr(t *testing.T) *bytes.Buffer {
+	buf, prev := &bytes.Buffer{}, stderr
+	stderr = buf
+	t.Cleanup(func() { stderr = prev })
+	return buf
+}
+
+func TestParseArgs(t *testing.T) {
+	t.Run("global flags before command", func(t *testing.T) {
+		t.Setenv("IOBCTL_URL", "http://env:8080")
+
+		inv, err := parseArgs([]string{"-o", "json", "-config", "/tmp/iobctl.json", "list", "-state", "failed"})
+		assert.NoError(t, err)
+		assert.Equal(t, "list", inv.name)
+		assert.NotNil(t, inv.cmd)
+		assert.Equal(t, "json", inv.format)
+		assert.Equal(t, "/tmp/iobctl.json", inv.config)
+		assert.Equal(t, "http://env:8080", inv.url)
+		assert.Equal(t, []string{"-state", "failed"}, inv.args)
+	})
+
+	t.Run("url flag overrides env", func(t *testing.T) {
+		t.Setenv("IOBCTL_URL", "http://env:8080")
+
+		inv, err := parseArgs([]string{"-url", "http://flag:8080", "queue"})
+		assert.NoError(t, err)
+		assert.Equal(t, "http://flag:8080", inv.url)
+		assert.Equal(t, "table", inv.format)
+		assert.Empty(t, inv.args)
+	})
+
+	t.Run("command is required", func(t *testing.T) {
+		out := captureStderr(t)
+
+		_, err := parseArgs(nil)
+		assert.ErrorIs(t, err, errUsage)
+		assert.Contains(t, out.String(), "Usage: iobctl")
+	})
+
+	t.Run("unknown command", func(t *testing.T) {
+		out := captureStderr(t)
+
+		_, err := parseArgs([]string{"lsit"})
+		assert.ErrorIs(t, err, errUsage)
+		assert.Contains(t, out.String(), `unknown command "lsit"`)
+	})
+
+	t.Run("unknown flag", func(t *testing.T) {
+		captureStderr(t)
+
+		_, err := parseArgs([]string{"-verbose", "list"})
+		assert.ErrorIs(t, err, errUsage)
+	})
+
+	t.Run("help", func(t *testing.T) {
+		captureStderr(t)
+
+		_, err := parseArgs([]string{"-h"})
+		assert.ErrorIs(t, err, flag.ErrHelp)
+	})
+}
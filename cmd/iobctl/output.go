@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"ioboundlimiter/client"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// output печатает результаты команд таблицей или JSON
+type output struct {
+	json bool
+	w    io.Writer
+}
+
+func newOutput(format string) (output, error) {
+	switch format {
+	case "table":
+		return output{w: os.Stdout}, nil
+	case "json":
+		return output{json: true, w: os.Stdout}, nil
+	default:
+		return output{}, fmt.Errorf("unknown output format %q, use table or json", format)
+	}
+}
+
+func (o output) printJSON(v any) error {
+	enc := json.NewEncoder(o.w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func (o output) table(write func(tw *tabwriter.Writer)) error {
+	tw := tabwriter.NewWriter(o.w, 0, 0, 2, ' ', 0)
+	write(tw)
+	return tw.Flush()
+}
+
+func (o output) tasks(tasks []client.Task) error {
+	if o.json {
+		return o.printJSON(tasks)
+	}
+	return o.table(func(tw *tabwriter.Writer) {
+		fmt.Fprintln(tw, "ID\tNAME\tTYPE\tSTATE\tPROGRESS\tCREATED\tSTATUS")
+		for _, task := range tasks {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				task.ID, task.Name, task.Type, task.State, progress(task.Progress),
+				task.CreatedAt.Local().Format(time.DateTime), task.Status)
+		}
+	})
+}
+
+func (o output) task(task *client.Task) error {
+	if o.json {
+		return o.printJSON(task)
+	}
+	return o.tasks([]client.Task{*task})
+}
+
+// change печатает изменение задачи одной строкой: JSON Lines или время,
+// состояние, прогресс и статус
+func (o output) change(task *client.Task) error {
+	if o.json {
+		data, err := json.Marshal(task)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(o.w, string(data))
+		return err
+	}
+	_, err := fmt.Fprintf(o.w, "%s  %-8s  %-6s  %s\n", time.Now().Format(time.TimeOnly), task.State, progress(task.Progress), task.Status)
+	return err
+}
+
+// failedTasks - упавшие задачи с ошибкой вместо статуса
+func (o output) failedTasks(tasks []client.Task) error {
+	if o.json {
+		return o.printJSON(tasks)
+	}
+	return o.table(func(tw *tabwriter.Writer) {
+		fmt.Fprintln(tw, "ID\tNAME\tTYPE\tFINISHED\tCODE\tERROR")
+		for _, task := range tasks {
+			code, message := "-", ""
+			if task.Error != nil {
+				code, message = task.Error.Code, task.Error.Message
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n",
+				task.ID, task.Name, task.Type, timestamp(task.FinishedAt), code, message)
+		}
+	})
+}
+
+// deadLetter - задача, уведомление о которой не доставлено
+type deadLetter struct {
+	Task     client.Task     `json:"task"`
+	Delivery client.Delivery `json:"delivery"`
+}
+
+func (o output) deadLetters(letters []deadLetter) error {
+	if o.json {
+		return o.printJSON(letters)
+	}
+	return o.table(func(tw *tabwriter.Writer) {
+		fmt.Fprintln(tw, "ID\tNAME\tSTATE\tURL\tATTEMPTS\tLAST ERROR")
+		for _, letter := range letters {
+			lastErr := ""
+			if n := len(letter.Delivery.Attempts); n > 0 {
+				last := letter.Delivery.Attempts[n-1]
+				lastErr = last.Error
+				if lastErr == "" && last.StatusCode != 0 {
+					lastErr = fmt.Sprintf("HTTP %d", last.StatusCode)
+				}
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%s\n", letter.Task.ID, letter.Task.Name, letter.Task.State,
+				letter.Delivery.URL, len(letter.Delivery.Attempts), lastErr)
+		}
+	})
+}
+
+func (o output) queue(status *client.QueueStatus) error {
+	if o.json {
+		return o.printJSON(status)
+	}
+	return o.table(func(tw *tabwriter.Writer) {
+		fmt.Fprintln(tw, "QUEUED\tCAPACITY\tREMOTE\tLEASED\tIN FLIGHT\tUSED\tLIMIT")
+		fmt.Fprintf(tw, "%d\t%d\t%d\t%d\t%d\t%d\t%d\n", status.Length, status.Capacity, status.RemoteLength,
+			status.Leased, status.InFlight, status.UsedCapacity, status.ConcurrencyLimit)
+	})
+}
+
+func (o output) introspection(info *client.Introspection) error {
+	if o.json {
+		return o.printJSON(info)
+	}
+	if err := o.queue(&info.Queue); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(o.w, "\nThroughput: %d last minute, %.1f/min over 5m, avg wait %s\n\n",
+		info.Throughput.LastMinute, info.Throughput.PerMinute, info.Throughput.AvgWait)
+
+	types := make([]string, 0, len(info.PendingByType))
+	for taskType := range info.PendingByType {
+		types = append(types, taskType)
+	}
+	sort.Strings(types)
+	err := o.table(func(tw *tabwriter.Writer) {
+		fmt.Fprintln(tw, "TYPE\tPENDING\tREMOTE")
+		for _, taskType := range types {
+			fmt.Fprintf(tw, "%s\t%d\t%d\n", taskType, info.PendingByType[taskType], info.RemotePendingByType[taskType])
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(o.w)
+	return o.table(func(tw *tabwriter.Writer) {
+		fmt.Fprintln(tw, "WORKER\tBUSY\tTASK\tTYPE\tSTARTED")
+		for _, worker := range info.Workers {
+			fmt.Fprintf(tw, "%d\t%t\t%s\t%s\t%s\n", worker.ID, worker.Busy, worker.Task, worker.TaskType, timestamp(worker.StartedAt))
+		}
+	})
+}
+
+func progress(p *client.Progress) string {
+	if p == nil {
+		return "-"
+	}
+	if p.Total > 0 {
+		return fmt.Sprintf("%.0f%%", p.Percent)
+	}
+	return fmt.Sprintf("%d", p.Done)
+}
+
+func timestamp(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Local().Format(time.DateTime)
+}
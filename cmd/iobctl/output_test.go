@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"ioboundlimiter/client"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutput(t *testing.T) {
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.Local)
+	tasks := []client.Task{
+		{ID: "a", Name: "report", Type: "http", State: client.StateRunning, Status: "fetching", CreatedAt: created, Progress: &client.Progress{Done: 1, Total: 4, Percent: 25}},
+		{ID: "b", Name: "cleanup", Type: "shell", State: client.StateFailed, CreatedAt: created, FinishedAt: &created, Error: &client.TaskError{Code: "failed", Message: "exit status 1"}},
+	}
+
+	t.Run("unknown format", func(t *testing.T) {
+		_, err := newOutput("yaml")
+		assert.ErrorContains(t, err, `unknown output format "yaml"`)
+	})
+
+	t.Run("tasks table", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		assert.NoError(t, output{w: buf}.tasks(tasks))
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		if assert.Len(t, lines, 3) {
+			assert.Equal(t, []string{"ID", "NAME", "TYPE", "STATE", "PROGRESS", "CREATED", "STATUS"}, strings.Fields(lines[0]))
+			assert.Equal(t, []string{"a", "report", "http", "running", "25%", "2024-05-01", "12:00:00", "fetching"}, strings.Fields(lines[1]))
+			assert.Equal(t, []string{"b", "cleanup", "shell", "failed", "-", "2024-05-01", "12:00:00"}, strings.Fields(lines[2]))
+		}
+	})
+
+	t.Run("tasks json", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		assert.NoError(t, output{json: true, w: buf}.tasks(tasks))
+
+		decoded := []client.Task{}
+		assert.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+		assert.Equal(t, []string{"a", "b"}, []string{decoded[0].ID, decoded[1].ID})
+	})
+
+	t.Run("change is one line", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		assert.NoError(t, output{json: true, w: buf}.change(&tasks[0]))
+		assert.NoError(t, output{w: buf}.change(&tasks[0]))
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		if assert.Len(t, lines, 2) {
+			assert.True(t, json.Valid([]byte(lines[0])))
+			assert.Equal(t, []string{"running", "25%", "fetching"}, strings.Fields(lines[1])[1:])
+		}
+	})
+
+	t.Run("failed tasks show error", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		assert.NoError(t, output{w: buf}.failedTasks(tasks[1:]))
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		if assert.Len(t, lines, 2) {
+			assert.Equal(t, []string{"ID", "NAME", "TYPE", "FINISHED", "CODE", "ERROR"}, strings.Fields(lines[0]))
+			assert.Equal(t, []string{"b", "cleanup", "shell", "2024-05-01", "12:00:00", "failed", "exit", "status", "1"}, strings.Fields(lines[1]))
+		}
+	})
+
+	t.Run("dead letters show last attempt", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		letters := []deadLetter{{
+			Task: tasks[1],
+			Delivery: client.Delivery{TaskID: "b", URL: "http://hook", State: client.DeliveryFailed, Attempts: []client.DeliveryAttempt{
+				{N: 1, Error: "connection refused"},
+				{N: 2, StatusCode: 502},
+			}},
+		}}
+		assert.NoError(t, output{w: buf}.deadLetters(letters))
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		if assert.Len(t, lines, 2) {
+			assert.Equal(t, []string{"b", "cleanup", "failed", "http://hook", "2", "HTTP", "502"}, strings.Fields(lines[1]))
+		}
+	})
+
+	t.Run("progress", func(t *testing.T) {
+		assert.Equal(t, "-", progress(nil))
+		assert.Equal(t, "50%", progress(&client.Progress{Done: 2, Total: 4, Percent: 50}))
+		assert.Equal(t, "7", progress(&client.Progress{Done: 7}))
+	})
+}
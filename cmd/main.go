@@ -2,21 +2,30 @@ package main
 
 import (
 	"context"
+	"ioboundlimiter/internal/breaker"
+	"ioboundlimiter/internal/bulk"
+	"ioboundlimiter/internal/executors"
 	"ioboundlimiter/internal/handlers"
+	"ioboundlimiter/internal/limiter"
 	"ioboundlimiter/internal/middleware"
+	"ioboundlimiter/internal/router"
+	"ioboundlimiter/internal/rpc"
+	"ioboundlimiter/internal/storage"
+	"ioboundlimiter/internal/webhook"
 	"ioboundlimiter/internal/workers"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/swaggo/gin-swagger" // gin-swagger middleware
 	"github.com/swaggo/files" // swagger embed files
 	_ "ioboundlimiter/docs" 
-
-	"github.com/gin-gonic/gin"
 )
 
 //	@title			Tasks API
@@ -35,22 +44,110 @@ import (
 //	@in							header
 //	@name						Authorization
 func main() {
-	r := gin.Default()
+	if capacity, err := strconv.Atoi(os.Getenv("WORKER_CAPACITY")); err == nil {
+		workers.SetCapacity(capacity)
+	}
+	if os.Getenv("ADAPTIVE_LIMIT") == "true" {
+		workers.UseAdaptiveLimiter(limiter.DefaultConfig())
+	}
+	if action := os.Getenv("WATCHDOG_ACTION"); action != "" {
+		cfg := workers.WatchdogConfig{Interval: 15 * time.Second, StaleAfter: time.Minute, Action: action}
+		if staleAfter, err := time.ParseDuration(os.Getenv("WATCHDOG_STALE_AFTER")); err == nil {
+			cfg.StaleAfter = staleAfter
+		}
+		if err := workers.SetWatchdog(cfg); err != nil {
+			log.Fatalf("Watchdog config error: %v", err)
+		}
+	}
+	if threshold, err := strconv.Atoi(os.Getenv("BREAKER_THRESHOLD")); err == nil {
+		cfg := workers.BreakerConfig{Config: breaker.DefaultConfig(), Action: workers.BreakerFail}
+		cfg.FailureThreshold = threshold
+		if timeout, err := time.ParseDuration(os.Getenv("BREAKER_OPEN_TIMEOUT")); err == nil {
+			cfg.OpenTimeout = timeout
+		}
+		if action := os.Getenv("BREAKER_ACTION"); action != "" {
+			cfg.Action = action
+		}
+		if err := workers.SetBreaker(cfg); err != nil {
+			log.Fatalf("Circuit breaker config error: %v", err)
+		}
+	}
+	httpCfg := executors.DefaultHTTPConfig()
+	if rate, err := strconv.ParseFloat(os.Getenv("HTTP_RATE_PER_HOST"), 64); err == nil {
+		httpCfg.RatePerHost = rate
+		httpCfg.RateBurst = 1
+	}
+	if hosts := os.Getenv("HTTP_ALLOWED_HOSTS"); hosts != "" {
+		httpCfg.AllowedHosts = strings.Split(hosts, ",")
+	}
+	httpCfg.AllowPrivate = os.Getenv("HTTP_ALLOW_PRIVATE") == "true"
+	workers.RegisterExecutor(executors.TypeHTTP, executors.NewHTTP(httpCfg))
+
+	if commands := os.Getenv("SHELL_ALLOWED_COMMANDS"); commands != "" {
+		shellCfg := executors.DefaultShellConfig()
+		shellCfg.AllowedCommands = strings.Split(commands, ",")
+		if dirs := os.Getenv("SHELL_ALLOWED_DIRS"); dirs != "" {
+			shellCfg.AllowedDirs = strings.Split(dirs, ",")
+		}
+		if env := os.Getenv("SHELL_ALLOWED_ENV"); env != "" {
+			shellCfg.AllowedEnv = strings.Split(env, ",")
+		}
+		workers.RegisterExecutor(executors.TypeShell, executors.NewShell(shellCfg))
+	}
 
-	workers.InitWorkers()
+	if dirs := os.Getenv("FILE_ALLOWED_DIRS"); dirs != "" {
+		fileCfg := executors.DefaultFileConfig()
+		fileCfg.AllowedDirs = strings.Split(dirs, ",")
+		if bandwidth, err := strconv.ParseInt(os.Getenv("FILE_BANDWIDTH"), 10, 64); err == nil {
+			fileCfg.GlobalBandwidth = bandwidth
+		}
+		workers.RegisterExecutor(executors.TypeFile, executors.NewFile(fileCfg))
+	}
 
-	r.GET("/register", handlers.RegisterHandler)
-	r.POST("/status", handlers.GetHandle)
+	// типы задач удаленных воркеров, задачи других типов без локального исполнителя не принимаются
+	if types := os.Getenv("REMOTE_TASK_TYPES"); types != "" {
+		for _, taskType := range strings.Split(types, ",") {
+			workers.RegisterRemoteType(taskType)
+		}
+	}
+
+	resultCfg := storage.DefaultResultConfig()
+	resultCfg.Dir = os.Getenv("RESULT_DIR")
+	if maxSize, err := strconv.ParseInt(os.Getenv("RESULT_MAX_SIZE"), 10, 64); err == nil {
+		resultCfg.MaxSize = maxSize
+	}
+	if err := storage.SetResultConfig(resultCfg); err != nil {
+		log.Fatalf("Result storage config error: %v", err)
+	}
+
+	if ttl, err := time.ParseDuration(os.Getenv("MEMO_TTL")); err == nil {
+		storage.SetMemoTTL(ttl)
+	}
+
+	workers.InitWorkers()
 
-	api := r.Group("/api")
-	api.Use(middleware.AuthMiddleware()) //Только авторизованные пользователи могут удалять и создавать таски
-	{
-		api.POST("/add", handlers.AddHandle)
-		api.DELETE("/delete", handlers.DeleteHandle)
+	webhook.SetSecret(os.Getenv("WEBHOOK_SECRET"))
+	webhookCfg := webhook.DefaultConfig()
+	webhookCfg.AllowPrivate = os.Getenv("WEBHOOK_ALLOW_PRIVATE") == "true"
+	webhook.Init(webhookCfg)
 
-		api.POST("/refresh", handlers.RefreshHandler)
+	if limit, err := strconv.Atoi(os.Getenv("WS_MAX_SUBSCRIPTIONS")); err == nil {
+		handlers.SetWSMaxSubscriptions(limit)
+	}
+	middleware.SetAdminToken(os.Getenv("ADMIN_TOKEN"))
+	if tokens := os.Getenv("WORKER_TOKENS"); tokens != "" {
+		workerTokens := make(map[string]string)
+		for _, pair := range strings.Split(tokens, ",") {
+			workerID, token, ok := strings.Cut(pair, ":")
+			if !ok || workerID == "" || token == "" {
+				log.Fatalf("WORKER_TOKENS should be a list of worker_id:token, got %q", pair)
+			}
+			workerTokens[workerID] = token
+		}
+		middleware.SetWorkerTokens(workerTokens)
 	}
 
+	r := router.New()
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
 	srv := &http.Server{
@@ -58,6 +155,16 @@ func main() {
 		Handler: r,
 	}
 
+	grpcAddr := os.Getenv("GRPC_ADDR")
+	if grpcAddr == "" {
+		grpcAddr = ":9090"
+	}
+	grpcListener, err := net.Listen("tcp", grpcAddr)
+	if err != nil {
+		log.Fatalf("gRPC listen error: %v", err)
+	}
+	grpcSrv := rpc.NewServer()
+
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 
@@ -67,6 +174,12 @@ func main() {
 		}
 	}()
 
+	go func() {
+		if err := grpcSrv.Serve(grpcListener); err != nil {
+			log.Fatalf("gRPC server error: %v", err)
+		}
+	}()
+
 	<-quit
 	log.Println("Shutting down server...")
 
@@ -76,8 +189,11 @@ func main() {
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Printf("Server shutdown error: %v", err)
 	}
+	rpc.Stop(ctx, grpcSrv)
 
-	// Graceful shutdown воркеров
+	// Graceful shutdown воркеров, массовые задания отменяют задачи через них
+	bulk.Shutdown()
 	workers.Shutdown()
+	webhook.Shutdown()
 	log.Println("Server stopped gracefully")
 }
@@ -22,6 +22,251 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
+        "/admin/breakers": {
+            "get": {
+                "description": "Состояние автоматов по адресатам задач (тип:хост или тип:команда): closed, open или half-open",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Состояние circuit breakers",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Токен администратора",
+                        "name": "X-Admin-Token",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "$ref": "#/definitions/breaker.Snapshot"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "invalid_admin_token",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "admin_disabled",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/bulk": {
+            "get": {
+                "description": "Задания всех пользователей и админов от новых к старым",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Задания массовых операций",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Токен администратора",
+                        "name": "X-Admin-Token",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/bulk.Job"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "invalid_admin_token",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Как POST /v1/bulk, но по задачам всех пользователей или владельца из owner",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Массовая отмена или удаление задач любых пользователей",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Токен администратора",
+                        "name": "X-Admin-Token",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "Действие и фильтры",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.AdminBulkRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Пробный запуск",
+                        "schema": {
+                            "$ref": "#/definitions/bulk.Job"
+                        }
+                    },
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/bulk.Job"
+                        },
+                        "headers": {
+                            "Location": {
+                                "type": "string",
+                                "description": "/admin/bulk/{id}"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "bad_request, invalid_filter",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "invalid_admin_token",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "admin_disabled",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    },
+                    "503": {
+                        "description": "server_busy",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/bulk/{id}": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Задание массовой операции",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Токен администратора",
+                        "name": "X-Admin-Token",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ID задания",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/bulk.Job"
+                        }
+                    },
+                    "401": {
+                        "description": "invalid_admin_token",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "bulk_job_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/queues": {
+            "get": {
+                "description": "Длина очередей по типам, занятость воркеров и текущие задачи, пропускная способность и среднее время ожидания",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Состояние очередей и воркеров",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Токен администратора",
+                        "name": "X-Admin-Token",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/workers.Introspection"
+                        }
+                    },
+                    "401": {
+                        "description": "invalid_admin_token",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "admin_disabled",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    }
+                }
+            }
+        },
         "/api/add": {
             "post": {
                 "security": [
@@ -40,6 +285,7 @@ const docTemplate = `{
                     "tasks"
                 ],
                 "summary": "Добавить задачу",
+                "deprecated": true,
                 "parameters": [
                     {
                         "description": "Данные задачи",
@@ -53,22 +299,91 @@ const docTemplate = `{
                 ],
                 "responses": {
                     "200": {
-                        "description": "{\"status\":\"access\",\"uuid\":\"string\"}",
+                        "description": "{\"status\":\"access\",\"uuid\":\"string\",\"cache_hit\":false,\"cache\":\"miss|hit|coalesced\"}",
                         "schema": {
                             "type": "object"
                         }
                     },
                     "400": {
-                        "description": "{\"error\":\"should contain task\"}",
+                        "description": "invalid_task, cost_exceeds_capacity",
                         "schema": {
-                            "type": "object"
+                            "$ref": "#/definitions/apierr.Problem"
                         }
                     },
-                    "500": {
-                        "description": "{\"error\":\"server is busy\"}",
+                    "401": {
+                        "description": "unauthorized, invalid_token",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "memo_callback_conflict",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    },
+                    "503": {
+                        "description": "server_busy",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/batch": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Атомарно создает задачи одной группы: либо добавляются все, либо ни одной",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "groups"
+                ],
+                "summary": "Добавить пакет задач",
+                "parameters": [
+                    {
+                        "description": "Задачи",
+                        "name": "batch",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.Batch"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "{\"status\":\"access\",\"group_id\":\"string\",\"uuids\":[\"string\"]}",
                         "schema": {
                             "type": "object"
                         }
+                    },
+                    "400": {
+                        "description": "invalid_task, cost_exceeds_capacity",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "unauthorized, invalid_token",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    },
+                    "503": {
+                        "description": "server_busy",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
                     }
                 }
             }
@@ -80,7 +395,7 @@ const docTemplate = `{
                         "BearerAuth": []
                     }
                 ],
-                "description": "Удаляет задачу по UUID",
+                "description": "Удаляет задачу пользователя по UUID, незавершенная задача перед этим отменяется",
                 "consumes": [
                     "application/json"
                 ],
@@ -91,6 +406,7 @@ const docTemplate = `{
                     "tasks"
                 ],
                 "summary": "Удалить задачу",
+                "deprecated": true,
                 "parameters": [
                     {
                         "description": "UUID задачи",
@@ -110,28 +426,34 @@ const docTemplate = `{
                         }
                     },
                     "400": {
-                        "description": "{\"error\":\"string\"}",
+                        "description": "bad_request",
                         "schema": {
-                            "type": "object"
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "task_forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
                         }
                     },
                     "404": {
-                        "description": "{\"status\":\"Not\tfound\tcurrent\ttask\"}",
+                        "description": "task_not_found",
                         "schema": {
-                            "type": "object"
+                            "$ref": "#/definitions/apierr.Problem"
                         }
                     }
                 }
             }
         },
-        "/api/refresh": {
+        "/api/group/cancel": {
             "post": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Обновляет пару access и refresh токенов",
+                "description": "Отменяет все незавершенные задачи группы",
                 "consumes": [
                     "application/json"
                 ],
@@ -139,80 +461,81 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "auth"
+                    "groups"
                 ],
-                "summary": "Обновить токены",
+                "summary": "Отменить группу задач",
                 "parameters": [
                     {
-                        "description": "Refresh токен",
-                        "name": "refresh",
+                        "description": "ID группы",
+                        "name": "group",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/handlers.RefreshRequest"
+                            "$ref": "#/definitions/handlers.GroupID"
                         }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "{\"status\":\"string\"}",
+                        "description": "{\"status\":\"access\",\"canceled\":0}",
                         "schema": {
                             "type": "object"
                         }
                     },
                     "400": {
-                        "description": "{\"error\":\"string\"}",
+                        "description": "bad_request",
                         "schema": {
-                            "type": "object"
+                            "$ref": "#/definitions/apierr.Problem"
                         }
                     },
-                    "401": {
-                        "description": "{\"error\":\"invalid\tauthorization\tformat\"}",
+                    "403": {
+                        "description": "group_forbidden",
                         "schema": {
-                            "type": "object"
+                            "$ref": "#/definitions/apierr.Problem"
                         }
                     },
-                    "500": {
-                        "description": "{\"error\":\"string\"}",
+                    "404": {
+                        "description": "group_not_found",
                         "schema": {
-                            "type": "object"
+                            "$ref": "#/definitions/apierr.Problem"
                         }
                     }
                 }
             }
         },
-        "/register": {
+        "/api/queue": {
             "get": {
-                "description": "Создает нового пользователя и возвращает пару токенов",
-                "consumes": [
-                    "application/json"
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
                 ],
+                "description": "Возвращает длину очереди, количество выполняемых задач и текущий лимит конкурентности",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "auth"
+                    "tasks"
                 ],
-                "summary": "Зарегистрировать пользователя",
+                "summary": "Состояние очереди",
                 "responses": {
                     "200": {
-                        "description": "{\"status\":\"string\"}",
-                        "schema": {
-                            "type": "object"
-                        }
-                    },
-                    "500": {
-                        "description": "{\"error\":\"string\"}",
+                        "description": "OK",
                         "schema": {
-                            "type": "object"
+                            "$ref": "#/definitions/workers.QueueStatus"
                         }
                     }
                 }
             }
         },
-        "/status": {
+        "/api/refresh": {
             "post": {
-                "description": "Возвращает текущий статус задачи",
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Обновляет пару access и refresh токенов. Access токен в заголовке может быть истекшим",
                 "consumes": [
                     "application/json"
                 ],
@@ -220,50 +543,1692 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "tasks"
+                    "auth"
                 ],
-                "summary": "Получить статус задачи",
+                "summary": "Обновить токены",
                 "parameters": [
                     {
-                        "description": "UUID задачи",
-                        "name": "uuid",
+                        "description": "Refresh токен",
+                        "name": "refresh",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/handlers.TaskID"
+                            "$ref": "#/definitions/handlers.RefreshRequest"
                         }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "{\"status\":\"access\", \"task name\": \"string\", \"createdAt\": date, \"current status\": \"string\", \"working time\": \"diff time\" }",
+                        "description": "{\"status\":\"string\"}",
                         "schema": {
                             "type": "object"
                         }
                     },
-                    "204": {
-                        "description": "{\"status\":\"not found task\"}",
+                    "400": {
+                        "description": "bad_request",
                         "schema": {
-                            "type": "object"
+                            "$ref": "#/definitions/apierr.Problem"
                         }
                     },
-                    "400": {
-                        "description": "{\"error\":\"Bad request: should contain UUID\"}",
+                    "401": {
+                        "description": "unauthorized, invalid_token",
                         "schema": {
-                            "type": "object"
+                            "$ref": "#/definitions/apierr.Problem"
                         }
                     },
-                    "404": {
-                        "description": "{\"error\":\"Not\tfound\tcurrent\ttask\"}",
+                    "500": {
+                        "description": "internal",
                         "schema": {
-                            "type": "object"
+                            "$ref": "#/definitions/apierr.Problem"
                         }
                     }
                 }
             }
-        }
+        },
+        "/api/webhooks": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Возвращает состояние доставки callback-уведомления задачи и все попытки отправки",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "tasks"
+                ],
+                "summary": "Доставка уведомления о завершении",
+                "parameters": [
+                    {
+                        "description": "UUID задачи",
+                        "name": "uuid",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.TaskID"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/webhook.Delivery"
+                        }
+                    },
+                    "400": {
+                        "description": "bad_request",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "task_forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "task_not_found, delivery_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/group/status": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Возвращает количество задач группы по состояниям, общий прогресс и первую ошибку",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "groups"
+                ],
+                "summary": "Статус группы задач",
+                "parameters": [
+                    {
+                        "description": "ID группы",
+                        "name": "group",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.GroupID"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/storage.GroupStatus"
+                        }
+                    },
+                    "400": {
+                        "description": "bad_request",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "unauthorized, invalid_token",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "group_forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "group_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/metrics": {
+            "get": {
+                "description": "Метрики сервиса в текстовом формате Prometheus",
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "metrics"
+                ],
+                "summary": "Метрики",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/register": {
+            "get": {
+                "description": "Создает нового пользователя и возвращает пару токенов",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Зарегистрировать пользователя",
+                "responses": {
+                    "200": {
+                        "description": "{\"status\":\"string\"}",
+                        "schema": {
+                            "type": "object"
+                        }
+                    },
+                    "500": {
+                        "description": "internal",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/result/{uuid}": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Отдает результат завершенной задачи с его типом содержимого. Поддерживает заголовок Range для больших результатов.\nДля failed и canceled задач возвращает объект ошибки. Доступен только владельцу задачи.",
+                "produces": [
+                    "application/json",
+                    "application/octet-stream"
+                ],
+                "tags": [
+                    "tasks"
+                ],
+                "summary": "Результат задачи",
+                "deprecated": true,
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "UUID задачи",
+                        "name": "uuid",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Диапазон байт, например bytes=0-1023",
+                        "name": "Range",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Результат задачи",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "204": {
+                        "description": "Задача завершилась без результата"
+                    },
+                    "206": {
+                        "description": "Часть результата",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "401": {
+                        "description": "unauthorized, invalid_token",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "task_forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "task_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "result_not_ready, с полем state",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    },
+                    "422": {
+                        "description": "task_failed, с полями state, error (ошибка задачи) и result",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/status": {
+            "post": {
+                "description": "Возвращает текущий статус задачи без результата, ошибки и прогресса: они доступны владельцу через /v1/tasks/{id}",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "tasks"
+                ],
+                "summary": "Получить статус задачи",
+                "deprecated": true,
+                "parameters": [
+                    {
+                        "description": "UUID задачи",
+                        "name": "uuid",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.TaskID"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "{\"status\":\"access\", \"state\": \"string\", \"task name\": \"string\", \"createdAt\": date, \"current status\": \"string\", \"working time\": \"diff time\", \"heartbeat age\": \"diff time\" }",
+                        "schema": {
+                            "type": "object"
+                        }
+                    },
+                    "400": {
+                        "description": "bad_request",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "task_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/bulk": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Задания пользователя от новых к старым",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "v1"
+                ],
+                "summary": "Задания массовых операций",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/bulk.Job"
+                            }
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Отменяет или удаляет задачи пользователя по тем же фильтрам, что и список задач. Выполняется в фоне, ход задания - GET /v1/bulk/{id}.\nС dry_run только считает подходящие задачи. Нужен хотя бы один фильтр.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "v1"
+                ],
+                "summary": "Массовая отмена или удаление задач",
+                "parameters": [
+                    {
+                        "description": "Действие и фильтры",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.BulkRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Пробный запуск",
+                        "schema": {
+                            "$ref": "#/definitions/bulk.Job"
+                        }
+                    },
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/bulk.Job"
+                        },
+                        "headers": {
+                            "Location": {
+                                "type": "string",
+                                "description": "/v1/bulk/{id}"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "bad_request, invalid_filter",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "unauthorized, invalid_token",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    },
+                    "503": {
+                        "description": "server_busy",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/bulk/{id}": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "v1"
+                ],
+                "summary": "Задание массовой операции",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID задания",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/bulk.Job"
+                        }
+                    },
+                    "403": {
+                        "description": "bulk_forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "bulk_job_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/events": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Server-Sent Events: событие task с задачей (как в GET /v1/tasks/{id}) на каждую смену состояния, статуса или прогресса, событие deleted при удалении.\nБез параметров - все задачи пользователя. Поток одной задачи или группы закрывается, когда все ее задачи завершились.\nДля продолжения после обрыва передайте Last-Event-ID. Токен можно передать в access_token, так как EventSource не умеет ставить заголовки.",
+                "produces": [
+                    "text/event-stream"
+                ],
+                "tags": [
+                    "v1"
+                ],
+                "summary": "Поток изменений задач (SSE)",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "UUID задачи",
+                        "name": "task_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "ID группы",
+                        "name": "group_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Access токен вместо заголовка Authorization",
+                        "name": "access_token",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Номер последнего полученного события",
+                        "name": "Last-Event-ID",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "event: task",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "bad_request",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "task_forbidden, group_forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "task_not_found, group_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/tasks": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Задачи пользователя в порядке создания с фильтрами и постраничным выводом",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "v1"
+                ],
+                "summary": "Список задач",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "name": "created_after",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "name": "created_before",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "name": "group_id",
+                        "in": "query"
+                    },
+                    {
+                        "maximum": 500,
+                        "minimum": 1,
+                        "type": "integer",
+                        "example": 50,
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Подстрока названия",
+                        "name": "name",
+                        "in": "query"
+                    },
+                    {
+                        "minimum": 0,
+                        "type": "integer",
+                        "name": "offset",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "example": "pending,running",
+                        "description": "Состояния через запятую",
+                        "name": "state",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "name": "type",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.TaskList"
+                        }
+                    },
+                    "400": {
+                        "description": "bad_request",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "unauthorized, invalid_token",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Создает задачу и ставит ее в очередь. Для memoize при попадании в кэш возвращает существующую задачу с кодом 200 и заголовком X-Cache",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "v1"
+                ],
+                "summary": "Создать задачу",
+                "parameters": [
+                    {
+                        "description": "Данные задачи",
+                        "name": "task",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.Task"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Существующая задача (memoize)",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.TaskView"
+                        }
+                    },
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.TaskView"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Версия задачи"
+                            },
+                            "Location": {
+                                "type": "string",
+                                "description": "/v1/tasks/{id}"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "invalid_task, cost_exceeds_capacity",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "unauthorized, invalid_token",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "memo_callback_conflict",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    },
+                    "503": {
+                        "description": "server_busy",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/tasks/{id}": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "v1"
+                ],
+                "summary": "Получить задачу",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "UUID задачи",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.TaskView"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Версия задачи для If-Match"
+                            }
+                        }
+                    },
+                    "403": {
+                        "description": "task_forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "task_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Удаляет задачу, незавершенная задача перед этим отменяется",
+                "tags": [
+                    "v1"
+                ],
+                "summary": "Удалить задачу",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "UUID задачи",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "403": {
+                        "description": "task_forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "task_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Меняет название, приоритет, время запуска, метки или payload задачи, которая еще не начала выполняться.\nС заголовком If-Match задача меняется, только если ее версия (ETag) совпадает с переданной.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "v1"
+                ],
+                "summary": "Изменить задачу",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "UUID задачи",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag задачи, например \\",
+                        "name": "If-Match",
+                        "in": "header"
+                    },
+                    {
+                        "description": "Изменения",
+                        "name": "patch",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.TaskPatch"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.TaskView"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Новая версия задачи"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "bad_request",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "task_forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "task_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "task_started или task_finished, с полем state",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    },
+                    "412": {
+                        "description": "version_mismatch, с полем version",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/tasks/{id}/cancel": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Ожидающая задача отменяется сразу, у выполняемой отменяется контекст",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "v1"
+                ],
+                "summary": "Отменить задачу",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "UUID задачи",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.TaskView"
+                        }
+                    },
+                    "403": {
+                        "description": "task_forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "task_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "task_finished или state_conflict, с полем state",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/tasks/{id}/history": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Все смены состояния задачи по порядку",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "v1"
+                ],
+                "summary": "История задачи",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "UUID задачи",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/storage.Transition"
+                            }
+                        }
+                    },
+                    "403": {
+                        "description": "task_forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "task_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/tasks/{id}/result": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Отдает результат завершенной задачи с его типом содержимого. Поддерживает заголовок Range для больших результатов.\nДля failed и canceled задач возвращает объект ошибки.",
+                "produces": [
+                    "application/json",
+                    "application/octet-stream"
+                ],
+                "tags": [
+                    "v1"
+                ],
+                "summary": "Результат задачи",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "UUID задачи",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Диапазон байт, например bytes=0-1023",
+                        "name": "Range",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Результат задачи",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "204": {
+                        "description": "Задача завершилась без результата"
+                    },
+                    "206": {
+                        "description": "Часть результата",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "403": {
+                        "description": "task_forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "task_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "result_not_ready, с полем state",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    },
+                    "422": {
+                        "description": "task_failed, с полями state, error (ошибка задачи) и result",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/tasks/{id}/wait": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Держит запрос, пока задача не завершится или не истечет timeout (по умолчанию 30 секунд, не больше 120).\nЗавершенная задача возвращается с кодом 200 вместе с результатом, по таймауту - текущее состояние с кодом 202.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "v1"
+                ],
+                "summary": "Дождаться завершения задачи",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "UUID задачи",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Сколько секунд ждать",
+                        "name": "timeout",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Задача завершилась",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.TaskView"
+                        },
+                        "headers": {
+                            "X-Task-State": {
+                                "type": "string",
+                                "description": "Состояние задачи"
+                            }
+                        }
+                    },
+                    "202": {
+                        "description": "Задача еще не завершилась",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.TaskView"
+                        }
+                    },
+                    "400": {
+                        "description": "bad_request",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "task_forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "task_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/ws": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Одно соединение для отправки задач и подписки на их изменения. Сообщения клиента - WSRequest, сервера - WSMessage.\nТокен передается в заголовке Authorization или в access_token. Число подписок на соединение ограничено.",
+                "tags": [
+                    "v1"
+                ],
+                "summary": "WebSocket API",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Access токен вместо заголовка Authorization",
+                        "name": "access_token",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "101": {
+                        "description": "Switching Protocols",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.WSMessage"
+                        }
+                    },
+                    "401": {
+                        "description": "unauthorized, invalid_token",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/worker/ack": {
+            "post": {
+                "description": "Завершает аренду: задача становится done или failed",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "remote workers"
+                ],
+                "summary": "Подтвердить выполнение",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Токен удаленного воркера",
+                        "name": "X-Worker-Token",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "Результат",
+                        "name": "ack",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.LeaseAck"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "{\"status\":\"access\"}",
+                        "schema": {
+                            "type": "object"
+                        }
+                    },
+                    "400": {
+                        "description": "bad_request",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "invalid_worker_token",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "lease_forbidden, worker_api_disabled",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "lease_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/worker/heartbeat": {
+            "post": {
+                "description": "Продлевает аренду задачи на visibility timeout от текущего момента",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "remote workers"
+                ],
+                "summary": "Продлить аренду",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Токен удаленного воркера",
+                        "name": "X-Worker-Token",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "Аренда",
+                        "name": "heartbeat",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.LeaseHeartbeat"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "{\"status\":\"access\",\"expires_at\":\"string\"}",
+                        "schema": {
+                            "type": "object"
+                        }
+                    },
+                    "400": {
+                        "description": "bad_request",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "invalid_worker_token",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "lease_forbidden, worker_api_disabled",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "lease_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/worker/lease": {
+            "post": {
+                "description": "Выдает удаленному воркеру задачи указанных типов на время visibility timeout",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "remote workers"
+                ],
+                "summary": "Взять задачи в аренду",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Токен удаленного воркера",
+                        "name": "X-Worker-Token",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "Параметры аренды",
+                        "name": "lease",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.LeaseRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "{\"status\":\"access\",\"leases\":[]}",
+                        "schema": {
+                            "type": "object"
+                        }
+                    },
+                    "400": {
+                        "description": "bad_request",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "invalid_worker_token",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "worker_api_disabled",
+                        "schema": {
+                            "$ref": "#/definitions/apierr.Problem"
+                        }
+                    }
+                }
+            }
+        }
     },
     "definitions": {
+        "apierr.Problem": {
+            "description": "Ошибка в формате application/problem+json",
+            "type": "object",
+            "properties": {
+                "code": {
+                    "description": "Стабильный код ошибки",
+                    "type": "string",
+                    "example": "task_not_found"
+                },
+                "detail": {
+                    "type": "string",
+                    "example": "Not found current task"
+                },
+                "instance": {
+                    "description": "Путь запроса",
+                    "type": "string",
+                    "example": "/v1/tasks/6ba7b810-9dad-11d1-80b4-00c04fd430c8"
+                },
+                "request_id": {
+                    "type": "string",
+                    "example": "0b6f0d43-6c1d-4b8a-9f4e-3f1c2a7d9e10"
+                },
+                "status": {
+                    "type": "integer",
+                    "example": 404
+                },
+                "title": {
+                    "type": "string",
+                    "example": "Not Found"
+                },
+                "type": {
+                    "type": "string",
+                    "example": "about:blank"
+                }
+            }
+        },
+        "breaker.Snapshot": {
+            "type": "object",
+            "properties": {
+                "failures": {
+                    "type": "integer"
+                },
+                "opened_at": {
+                    "type": "string"
+                },
+                "retry_at": {
+                    "description": "RetryAt - когда открытый автомат пропустит пробную задачу",
+                    "type": "string"
+                },
+                "state": {
+                    "type": "string"
+                }
+            }
+        },
+        "bulk.Filter": {
+            "type": "object",
+            "properties": {
+                "created_after": {
+                    "type": "string"
+                },
+                "created_before": {
+                    "type": "string"
+                },
+                "group_id": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "owner": {
+                    "type": "string"
+                },
+                "states": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "type": {
+                    "type": "string"
+                }
+            }
+        },
+        "bulk.Job": {
+            "type": "object",
+            "properties": {
+                "action": {
+                    "type": "string",
+                    "example": "cancel"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "dry_run": {
+                    "description": "DryRun - только посчитать подходящие задачи",
+                    "type": "boolean"
+                },
+                "failed": {
+                    "type": "integer"
+                },
+                "filter": {
+                    "$ref": "#/definitions/bulk.Filter"
+                },
+                "finished_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string",
+                    "example": "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
+                },
+                "matched": {
+                    "description": "Matched - задач подошло под фильтр в момент запуска",
+                    "type": "integer"
+                },
+                "processed": {
+                    "description": "Processed - отменено или удалено",
+                    "type": "integer"
+                },
+                "requester": {
+                    "description": "Requester - пользователь, запустивший задание, у заданий админа пустой",
+                    "type": "string"
+                },
+                "skipped": {
+                    "description": "Skipped - уже завершенные (для отмены) или уже удаленные задачи",
+                    "type": "integer"
+                },
+                "state": {
+                    "type": "string",
+                    "example": "running"
+                }
+            }
+        },
+        "handlers.AdminBulkRequest": {
+            "type": "object",
+            "required": [
+                "action"
+            ],
+            "properties": {
+                "action": {
+                    "description": "cancel или delete",
+                    "type": "string",
+                    "enum": [
+                        "cancel",
+                        "delete"
+                    ],
+                    "example": "cancel"
+                },
+                "created_after": {
+                    "type": "string"
+                },
+                "created_before": {
+                    "type": "string"
+                },
+                "dry_run": {
+                    "description": "Только посчитать подходящие задачи",
+                    "type": "boolean",
+                    "example": true
+                },
+                "group_id": {
+                    "type": "string"
+                },
+                "name": {
+                    "description": "Подстрока названия",
+                    "type": "string"
+                },
+                "owner": {
+                    "description": "Владелец задач, пусто - все пользователи",
+                    "type": "string"
+                },
+                "state": {
+                    "description": "Состояния через запятую",
+                    "type": "string",
+                    "example": "pending,running"
+                },
+                "type": {
+                    "type": "string"
+                }
+            }
+        },
+        "handlers.Batch": {
+            "description": "Пакет задач, создаваемых одной группой",
+            "type": "object",
+            "required": [
+                "tasks"
+            ],
+            "properties": {
+                "tasks": {
+                    "type": "array",
+                    "maxItems": 100,
+                    "minItems": 1,
+                    "items": {
+                        "$ref": "#/definitions/handlers.Task"
+                    }
+                }
+            }
+        },
+        "handlers.BulkRequest": {
+            "type": "object",
+            "required": [
+                "action"
+            ],
+            "properties": {
+                "action": {
+                    "description": "cancel или delete",
+                    "type": "string",
+                    "enum": [
+                        "cancel",
+                        "delete"
+                    ],
+                    "example": "cancel"
+                },
+                "created_after": {
+                    "type": "string"
+                },
+                "created_before": {
+                    "type": "string"
+                },
+                "dry_run": {
+                    "description": "Только посчитать подходящие задачи",
+                    "type": "boolean",
+                    "example": true
+                },
+                "group_id": {
+                    "type": "string"
+                },
+                "name": {
+                    "description": "Подстрока названия",
+                    "type": "string"
+                },
+                "state": {
+                    "description": "Состояния через запятую",
+                    "type": "string",
+                    "example": "pending,running"
+                },
+                "type": {
+                    "type": "string"
+                }
+            }
+        },
+        "handlers.GroupID": {
+            "description": "Идентификатор группы задач",
+            "type": "object",
+            "required": [
+                "group_id"
+            ],
+            "properties": {
+                "group_id": {
+                    "type": "string",
+                    "example": "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
+                }
+            }
+        },
+        "handlers.LeaseAck": {
+            "description": "Результат выполнения арендованной задачи",
+            "type": "object",
+            "required": [
+                "lease_id"
+            ],
+            "properties": {
+                "error": {
+                    "type": "string",
+                    "example": "connection refused"
+                },
+                "lease_id": {
+                    "type": "string",
+                    "example": "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
+                },
+                "result": {
+                    "type": "object"
+                },
+                "success": {
+                    "type": "boolean"
+                }
+            }
+        },
+        "handlers.LeaseHeartbeat": {
+            "description": "Продление аренды задачи",
+            "type": "object",
+            "required": [
+                "lease_id"
+            ],
+            "properties": {
+                "lease_id": {
+                    "type": "string",
+                    "example": "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
+                },
+                "visibility_timeout": {
+                    "type": "integer",
+                    "maximum": 3600,
+                    "minimum": 1,
+                    "example": 60
+                }
+            }
+        },
+        "handlers.LeaseRequest": {
+            "description": "Запрос удаленного воркера на получение задач",
+            "type": "object",
+            "required": [
+                "types"
+            ],
+            "properties": {
+                "max": {
+                    "description": "Сколько задач выдать за раз, по умолчанию 1",
+                    "type": "integer",
+                    "maximum": 10,
+                    "minimum": 1,
+                    "example": 1
+                },
+                "types": {
+                    "description": "Типы задач, которые умеет выполнять воркер",
+                    "type": "array",
+                    "minItems": 1,
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "http"
+                    ]
+                },
+                "visibility_timeout": {
+                    "description": "Сколько секунд задача невидима для других воркеров, по умолчанию 60",
+                    "type": "integer",
+                    "maximum": 3600,
+                    "minimum": 1,
+                    "example": 60
+                }
+            }
+        },
         "handlers.RefreshRequest": {
             "type": "object",
             "required": [
@@ -284,10 +2249,65 @@ const docTemplate = `{
                 "taskname"
             ],
             "properties": {
+                "cache_ttl": {
+                    "description": "Сколько секунд переиспользовать результат, по умолчанию настройка сервиса",
+                    "type": "integer",
+                    "minimum": 1,
+                    "example": 300
+                },
+                "callback_secret": {
+                    "description": "Секрет подписи уведомления, по умолчанию используется секрет сервиса",
+                    "type": "string"
+                },
+                "callback_url": {
+                    "description": "Адрес, на который придет подписанное уведомление о завершении задачи",
+                    "type": "string",
+                    "example": "https://example.com/hooks/tasks"
+                },
+                "cost": {
+                    "description": "Вес задачи для семафора воркеров, по умолчанию 1",
+                    "type": "integer",
+                    "minimum": 1,
+                    "example": 1
+                },
+                "labels": {
+                    "description": "Метки задачи: до 16 штук, ключ до 64 символов, значение до 256",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "memoize": {
+                    "description": "Переиспользовать выполняющуюся или недавно завершенную задачу с тем же типом и payload",
+                    "type": "boolean",
+                    "example": false
+                },
+                "payload": {
+                    "description": "Входные данные исполнителя",
+                    "type": "object"
+                },
+                "priority": {
+                    "description": "Приоритет от -10 до 10: задачи с большим приоритетом выполняются раньше",
+                    "type": "integer",
+                    "maximum": 10,
+                    "minimum": -10,
+                    "example": 0
+                },
+                "scheduled_at": {
+                    "description": "Время, раньше которого задача не начнет выполняться",
+                    "type": "string",
+                    "example": "2026-01-02T15:04:05Z"
+                },
                 "taskname": {
                     "description": "Название задачи\n@Example \"Провести код-ревью\"",
                     "type": "string",
                     "example": "Какая то длинная io bound"
+                },
+                "type": {
+                    "description": "Тип задачи. Типы без локального исполнителя выполняются удаленными воркерами",
+                    "type": "string",
+                    "maxLength": 64,
+                    "example": "default"
                 }
             }
         },
@@ -304,6 +2324,404 @@ const docTemplate = `{
                     "example": "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
                 }
             }
+        },
+        "handlers.TaskList": {
+            "description": "Страница списка задач",
+            "type": "object",
+            "properties": {
+                "limit": {
+                    "type": "integer"
+                },
+                "offset": {
+                    "type": "integer"
+                },
+                "tasks": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/handlers.TaskView"
+                    }
+                },
+                "total": {
+                    "type": "integer"
+                }
+            }
+        },
+        "handlers.TaskPatch": {
+            "type": "object",
+            "properties": {
+                "labels": {
+                    "description": "Заменяют все метки задачи, {} - удалить метки",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "name": {
+                    "type": "string",
+                    "minLength": 1
+                },
+                "payload": {
+                    "type": "object"
+                },
+                "priority": {
+                    "description": "Приоритет от -10 до 10",
+                    "type": "integer",
+                    "maximum": 10,
+                    "minimum": -10,
+                    "example": 5
+                },
+                "scheduled_at": {
+                    "description": "Новое время запуска, прошедшее время - запустить как можно скорее",
+                    "type": "string",
+                    "example": "2026-01-02T15:04:05Z"
+                }
+            }
+        },
+        "handlers.TaskView": {
+            "description": "Задача в API v1",
+            "type": "object",
+            "properties": {
+                "blob": {
+                    "$ref": "#/definitions/storage.BlobInfo"
+                },
+                "cost": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "error": {
+                    "$ref": "#/definitions/storage.TaskError"
+                },
+                "finished_at": {
+                    "type": "string"
+                },
+                "group_id": {
+                    "type": "string"
+                },
+                "heartbeat": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string",
+                    "example": "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
+                },
+                "labels": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "name": {
+                    "type": "string"
+                },
+                "payload": {
+                    "type": "object"
+                },
+                "priority": {
+                    "type": "integer",
+                    "example": 0
+                },
+                "progress": {
+                    "$ref": "#/definitions/storage.Progress"
+                },
+                "result": {
+                    "type": "object"
+                },
+                "scheduled_at": {
+                    "type": "string"
+                },
+                "state": {
+                    "type": "string",
+                    "example": "running"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "type": {
+                    "type": "string",
+                    "example": "default"
+                },
+                "version": {
+                    "type": "integer",
+                    "example": 1
+                }
+            }
+        },
+        "handlers.WSMessage": {
+            "type": "object",
+            "properties": {
+                "cache": {
+                    "type": "string"
+                },
+                "code": {
+                    "description": "Code - код ошибки, как в ответах HTTP API",
+                    "type": "string",
+                    "example": "task_not_found"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "task": {
+                    "$ref": "#/definitions/handlers.TaskView"
+                },
+                "task_id": {
+                    "type": "string"
+                },
+                "task_ids": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "type": {
+                    "description": "submitted, subscribed, unsubscribed, task, deleted или error",
+                    "type": "string",
+                    "example": "task"
+                }
+            }
+        },
+        "storage.BlobInfo": {
+            "type": "object",
+            "properties": {
+                "content_type": {
+                    "type": "string"
+                },
+                "on_disk": {
+                    "type": "boolean"
+                },
+                "size": {
+                    "type": "integer"
+                }
+            }
+        },
+        "storage.GroupFailure": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string"
+                },
+                "failed_at": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "uuid": {
+                    "type": "string"
+                }
+            }
+        },
+        "storage.GroupStatus": {
+            "type": "object",
+            "properties": {
+                "completed": {
+                    "description": "Completed - количество задач в конечном состоянии, Progress - их доля в процентах",
+                    "type": "integer"
+                },
+                "counts": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "integer"
+                    }
+                },
+                "done": {
+                    "type": "boolean"
+                },
+                "first_failure": {
+                    "$ref": "#/definitions/storage.GroupFailure"
+                },
+                "group_id": {
+                    "type": "string"
+                },
+                "progress": {
+                    "type": "number"
+                },
+                "total": {
+                    "type": "integer"
+                }
+            }
+        },
+        "storage.Progress": {
+            "type": "object",
+            "properties": {
+                "done": {
+                    "type": "integer"
+                },
+                "percent": {
+                    "type": "number"
+                },
+                "total": {
+                    "type": "integer"
+                }
+            }
+        },
+        "storage.TaskError": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "description": "Code - panic, canceled или failed",
+                    "type": "string"
+                },
+                "message": {
+                    "type": "string"
+                },
+                "stack": {
+                    "type": "string"
+                }
+            }
+        },
+        "storage.Transition": {
+            "type": "object",
+            "properties": {
+                "at": {
+                    "type": "string"
+                },
+                "state": {
+                    "type": "string"
+                }
+            }
+        },
+        "webhook.Attempt": {
+            "type": "object",
+            "properties": {
+                "at": {
+                    "type": "string"
+                },
+                "attempt": {
+                    "type": "integer"
+                },
+                "duration_ms": {
+                    "type": "integer"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "status_code": {
+                    "type": "integer"
+                }
+            }
+        },
+        "webhook.Delivery": {
+            "type": "object",
+            "properties": {
+                "attempts": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/webhook.Attempt"
+                    }
+                },
+                "state": {
+                    "type": "string"
+                },
+                "url": {
+                    "type": "string"
+                },
+                "uuid": {
+                    "type": "string"
+                }
+            }
+        },
+        "workers.Introspection": {
+            "type": "object",
+            "properties": {
+                "pending_by_type": {
+                    "description": "PendingByType - ожидающие задачи по типам (локальные и удаленные)",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "integer"
+                    }
+                },
+                "queue": {
+                    "$ref": "#/definitions/workers.QueueStatus"
+                },
+                "remote_pending_by_type": {
+                    "description": "RemotePendingByType - задачи в очереди удаленных воркеров по типам",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "integer"
+                    }
+                },
+                "throughput": {
+                    "$ref": "#/definitions/workers.Throughput"
+                },
+                "workers": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/workers.WorkerInfo"
+                    }
+                }
+            }
+        },
+        "workers.QueueStatus": {
+            "type": "object",
+            "properties": {
+                "adaptive": {
+                    "type": "boolean"
+                },
+                "concurrency_limit": {
+                    "type": "integer"
+                },
+                "in_flight": {
+                    "type": "integer"
+                },
+                "leased": {
+                    "type": "integer"
+                },
+                "queue_capacity": {
+                    "type": "integer"
+                },
+                "queue_length": {
+                    "type": "integer"
+                },
+                "remote_queue_length": {
+                    "type": "integer"
+                },
+                "used_capacity": {
+                    "type": "integer"
+                }
+            }
+        },
+        "workers.Throughput": {
+            "type": "object",
+            "properties": {
+                "avg_wait": {
+                    "description": "AvgWait - среднее время от создания задачи до начала выполнения за последние 5 минут",
+                    "type": "string"
+                },
+                "last_minute": {
+                    "description": "LastMinute - задач завершено за последнюю минуту",
+                    "type": "integer"
+                },
+                "per_minute_5m": {
+                    "description": "PerMinute - среднее за последние 5 минут",
+                    "type": "number"
+                }
+            }
+        },
+        "workers.WorkerInfo": {
+            "type": "object",
+            "properties": {
+                "busy": {
+                    "type": "boolean"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "started_at": {
+                    "type": "string"
+                },
+                "task": {
+                    "type": "string"
+                },
+                "task_type": {
+                    "type": "string"
+                }
+            }
         }
     },
     "securityDefinitions": {
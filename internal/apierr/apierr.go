@@ -0,0 +1,212 @@
+// Package apierr - единая модель ошибок HTTP API: стабильные коды и ответы
+// в формате RFC 7807 (application/problem+json).
+package apierr
+
+import (
+	"encoding/json"
+	"errors"
+	"ioboundlimiter/internal/auth"
+	"ioboundlimiter/internal/bulk"
+	"ioboundlimiter/internal/storage"
+	"ioboundlimiter/internal/webhook"
+	"ioboundlimiter/internal/workers"
+	"log"
+	"maps"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const ContentType = "application/problem+json"
+
+// Error - ошибка API. Code не меняется между версиями, по нему клиенты
+// различают ошибки; Detail - описание для человека.
+type Error struct {
+	Status int
+	Code   string
+	Detail string
+	// Extra - дополнительные поля ответа, например state задачи
+	Extra map[string]any
+	// Err - причина, в ответ не попадает
+	Err error
+}
+
+func New(status int, code, detail string) *Error {
+	return &Error{Status: status, Code: code, Detail: detail}
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Detail + ": " + e.Err.Error()
+	}
+	return e.Detail
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is сравнивает ошибки по коду, чтобы errors.Is находил ошибку с
+// причиной или другим описанием
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// Wrap возвращает копию ошибки с причиной err
+func (e *Error) Wrap(err error) *Error {
+	c := *e
+	c.Err = err
+	return &c
+}
+
+// WithDetail возвращает копию ошибки с другим описанием
+func (e *Error) WithDetail(detail string) *Error {
+	c := *e
+	c.Detail = detail
+	return &c
+}
+
+// With возвращает копию ошибки с дополнительным полем ответа
+func (e *Error) With(key string, value any) *Error {
+	c := *e
+	c.Extra = maps.Clone(e.Extra)
+	if c.Extra == nil {
+		c.Extra = make(map[string]any)
+	}
+	c.Extra[key] = value
+	return &c
+}
+
+// Коды ошибок API
+var (
+	ErrBadRequest     = New(http.StatusBadRequest, "bad_request", "Bad request")
+	ErrInvalidTask    = New(http.StatusBadRequest, "invalid_task", "should contain task")
+	ErrCostTooHigh    = New(http.StatusBadRequest, "cost_exceeds_capacity", "task cost exceeds total capacity")
+	ErrUnknownType    = New(http.StatusBadRequest, "unknown_task_type", "no local executor or remote workers for task type")
+	ErrInvalidFilter  = New(http.StatusBadRequest, "invalid_filter", "invalid filters")
+	ErrUnauthorized   = New(http.StatusUnauthorized, "unauthorized", "Authorization header is required")
+	ErrInvalidToken   = New(http.StatusUnauthorized, "invalid_token", "Invalid token")
+	ErrAdminToken     = New(http.StatusUnauthorized, "invalid_admin_token", "Invalid admin token")
+	ErrWorkerToken    = New(http.StatusUnauthorized, "invalid_worker_token", "Invalid worker token")
+	ErrTaskForbidden  = New(http.StatusForbidden, "task_forbidden", "task belongs to another user")
+	ErrGroupForbidden = New(http.StatusForbidden, "group_forbidden", "group belongs to another user")
+	ErrLeaseForbidden = New(http.StatusForbidden, "lease_forbidden", "lease belongs to another worker")
+	ErrBulkForbidden  = New(http.StatusForbidden, "bulk_forbidden", "bulk job belongs to another user")
+	ErrAdminDisabled  = New(http.StatusForbidden, "admin_disabled", "Admin API is disabled")
+	ErrWorkerDisabled = New(http.StatusForbidden, "worker_api_disabled", "Remote worker API is disabled")
+	ErrRouteNotFound  = New(http.StatusNotFound, "route_not_found", "route not found")
+	ErrTaskNotFound   = New(http.StatusNotFound, "task_not_found", "Not found current task")
+	ErrGroupNotFound  = New(http.StatusNotFound, "group_not_found", "Not found current group")
+	ErrLeaseNotFound  = New(http.StatusNotFound, "lease_not_found", "lease not found or expired")
+	ErrBulkNotFound   = New(http.StatusNotFound, "bulk_job_not_found", "Not found current bulk job")
+	ErrNoDelivery     = New(http.StatusNotFound, "delivery_not_found", "task has no callback deliveries")
+	ErrConflict       = New(http.StatusConflict, "state_conflict", "task is in another state")
+	ErrTaskFinished   = New(http.StatusConflict, "task_finished", "task is already finished")
+	ErrNotReady       = New(http.StatusConflict, "result_not_ready", "result is not ready")
+	ErrTaskStarted    = New(http.StatusConflict, "task_started", "task has already started")
+	ErrMemoCallback   = New(http.StatusConflict, "memo_callback_conflict", "identical task is already submitted with another callback; submit without memoize to get a separate notification")
+	ErrStaleVersion   = New(http.StatusPreconditionFailed, "version_mismatch", "task was modified, reload it and retry")
+	ErrTooLarge       = New(http.StatusRequestEntityTooLarge, "result_too_large", "result exceeds size limit")
+	ErrTaskFailed     = New(http.StatusUnprocessableEntity, "task_failed", "task did not finish successfully")
+	ErrInternal       = New(http.StatusInternalServerError, "internal", "internal server error")
+	ErrBusy           = New(http.StatusServiceUnavailable, "server_busy", "server is busy")
+)
+
+// From переводит ошибку любого пакета сервиса в ошибку API
+func From(err error) *Error {
+	var apiErr *Error
+	switch {
+	case errors.As(err, &apiErr):
+		return apiErr
+	case errors.Is(err, storage.ErrNotFound):
+		return ErrTaskNotFound.Wrap(err)
+	case errors.Is(err, storage.ErrForbidden):
+		return ErrTaskForbidden.Wrap(err)
+	case errors.Is(err, storage.ErrGroupNotFound):
+		return ErrGroupNotFound.Wrap(err)
+	case errors.Is(err, storage.ErrStateConflict):
+		return ErrConflict.Wrap(err)
+	case errors.Is(err, storage.ErrVersionMismatch):
+		return ErrStaleVersion.Wrap(err)
+	case errors.Is(err, storage.ErrMemoCallback):
+		return ErrMemoCallback.Wrap(err)
+	case errors.Is(err, storage.ErrInvalidTask):
+		return ErrInvalidTask.Wrap(err)
+	case errors.Is(err, webhook.ErrNoSecret):
+		return ErrInvalidTask.Wrap(err).WithDetail(err.Error())
+	case errors.Is(err, storage.ErrResultTooLarge):
+		return ErrTooLarge.Wrap(err)
+	case errors.Is(err, bulk.ErrJobNotFound):
+		return ErrBulkNotFound.Wrap(err)
+	case errors.Is(err, bulk.ErrForbidden):
+		return ErrTaskForbidden.Wrap(err).WithDetail("tasks belong to another user")
+	case errors.Is(err, bulk.ErrEmptyFilter), errors.Is(err, bulk.ErrUnknownAction):
+		return ErrInvalidFilter.Wrap(err).WithDetail(err.Error())
+	case errors.Is(err, auth.ErrInvalidToken), errors.Is(err, auth.ErrUnknownToken):
+		return ErrInvalidToken.Wrap(err)
+	case errors.Is(err, workers.ErrCostTooHigh):
+		return ErrCostTooHigh.Wrap(err)
+	case errors.Is(err, workers.ErrUnknownType):
+		return ErrUnknownType.Wrap(err).WithDetail(err.Error())
+	case errors.Is(err, workers.ErrQueueFull), errors.Is(err, workers.ErrStopped), errors.Is(err, bulk.ErrStopped):
+		return ErrBusy.Wrap(err)
+	case errors.Is(err, workers.ErrLeaseNotFound):
+		return ErrLeaseNotFound.Wrap(err)
+	case errors.Is(err, workers.ErrLeaseOwner):
+		return ErrLeaseForbidden.Wrap(err)
+	default:
+		return ErrInternal.Wrap(err)
+	}
+}
+
+// Problem - тело ответа об ошибке (RFC 7807)
+// @Description Ошибка в формате application/problem+json
+type Problem struct {
+	Type   string `json:"type" example:"about:blank"`
+	Title  string `json:"title" example:"Not Found"`
+	Status int    `json:"status" example:"404"`
+	Detail string `json:"detail,omitempty" example:"Not found current task"`
+	// Путь запроса
+	Instance string `json:"instance,omitempty" example:"/v1/tasks/6ba7b810-9dad-11d1-80b4-00c04fd430c8"`
+	// Стабильный код ошибки
+	Code      string         `json:"code" example:"task_not_found"`
+	RequestID string         `json:"request_id" example:"0b6f0d43-6c1d-4b8a-9f4e-3f1c2a7d9e10"`
+	Extra     map[string]any `json:"-"`
+}
+
+func (p Problem) MarshalJSON() ([]byte, error) {
+	type problem Problem
+	data, err := json.Marshal(problem(p))
+	if err != nil || len(p.Extra) == 0 {
+		return data, err
+	}
+
+	fields := make(map[string]any, len(p.Extra))
+	maps.Copy(fields, p.Extra)
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return json.Marshal(fields)
+}
+
+// Abort отвечает на запрос ошибкой err и прерывает цепочку обработчиков.
+// Внутренние ошибки пишутся в лог, клиенту уходит только код и request_id.
+func Abort(c *gin.Context, err error) {
+	apiErr := From(err)
+	if apiErr.Status >= http.StatusInternalServerError {
+		log.Printf("ERROR: %s %s [%s]: %v", c.Request.Method, c.Request.URL.Path, c.GetString("request_id"), err)
+	}
+
+	c.Header("Content-Type", ContentType)
+	c.AbortWithStatusJSON(apiErr.Status, Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(apiErr.Status),
+		Status:    apiErr.Status,
+		Detail:    apiErr.Detail,
+		Instance:  c.Request.URL.Path,
+		Code:      apiErr.Code,
+		RequestID: c.GetString("request_id"),
+		Extra:     apiErr.Extra,
+	})
+}
@@ -0,0 +1,91 @@
+package apierr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"ioboundlimiter/internal/auth"
+	"ioboundlimiter/internal/bulk"
+	"ioboundlimiter/internal/storage"
+	"ioboundlimiter/internal/webhook"
+	"ioboundlimiter/internal/workers"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFrom(t *testing.T) {
+	cases := []struct {
+		err  error
+		code string
+	}{
+		{fmt.Errorf("task x: %w", storage.ErrNotFound), "task_not_found"},
+		{fmt.Errorf("task x: %w", storage.ErrForbidden), "task_forbidden"},
+		{fmt.Errorf("group x: %w", storage.ErrGroupNotFound), "group_not_found"},
+		{fmt.Errorf("cannot cancel task: %w", storage.ErrStateConflict), "state_conflict"},
+		{fmt.Errorf("task x: %w", storage.ErrVersionMismatch), "version_mismatch"},
+		{fmt.Errorf("task x: %w", storage.ErrMemoCallback), "memo_callback_conflict"},
+		{webhook.ErrNoSecret, "invalid_task"},
+		{fmt.Errorf("access token: %w", auth.ErrInvalidToken), "invalid_token"},
+		{auth.ErrUnknownToken, "invalid_token"},
+		{fmt.Errorf("cannot add task: %w", workers.ErrQueueFull), "server_busy"},
+		{workers.ErrLeaseOwner, "lease_forbidden"},
+		{fmt.Errorf("%w: ftp", workers.ErrUnknownType), "unknown_task_type"},
+		{fmt.Errorf("job x: %w", bulk.ErrJobNotFound), "bulk_job_not_found"},
+		{bulk.ErrEmptyFilter, "invalid_filter"},
+		{bulk.ErrStopped, "server_busy"},
+		{ErrTaskForbidden.WithDetail("custom"), "task_forbidden"},
+		{errors.New("disk is on fire"), "internal"},
+	}
+	for _, tc := range cases {
+		assert.Equal(t, tc.code, From(tc.err).Code, tc.err.Error())
+	}
+
+	assert.ErrorIs(t, ErrBadRequest.Wrap(errors.New("cause")).WithDetail("other"), ErrBadRequest)
+	assert.NotErrorIs(t, ErrBadRequest, ErrInvalidTask)
+}
+
+func TestAbort(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	render := func(err error) (*httptest.ResponseRecorder, map[string]any) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/v1/tasks/42", nil)
+		c.Set("request_id", "req-1")
+
+		Abort(c, err)
+
+		body := map[string]any{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		return w, body
+	}
+
+	t.Run("problem fields", func(t *testing.T) {
+		w, body := render(fmt.Errorf("task 42: %w", storage.ErrNotFound))
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, ContentType, w.Header().Get("Content-Type"))
+		assert.Equal(t, "task_not_found", body["code"])
+		assert.Equal(t, "req-1", body["request_id"])
+		assert.Equal(t, "/v1/tasks/42", body["instance"])
+		assert.Equal(t, "Not Found", body["title"])
+	})
+
+	t.Run("extra fields do not override standard ones", func(t *testing.T) {
+		_, body := render(ErrNotReady.With("state", "running").With("status", "oops"))
+
+		assert.Equal(t, "running", body["state"])
+		assert.Equal(t, float64(http.StatusConflict), body["status"])
+	})
+
+	t.Run("internal details are hidden", func(t *testing.T) {
+		w, body := render(errors.New("secret path /etc/x"))
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.Equal(t, "internal server error", body["detail"])
+	})
+}
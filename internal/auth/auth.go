@@ -3,11 +3,13 @@ package auth
 import (
 	"errors"
 	"fmt"
+	"ioboundlimiter/internal/clock"
 	"log"
 	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
 const (
@@ -21,6 +23,13 @@ type Claims struct {
 	jwt.RegisteredClaims
 }
 
+var (
+	// ErrInvalidToken - токен не подписан сервисом, истек или испорчен
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrUnknownToken - пары токенов нет среди выданных: она уже обновлена или не выдавалась
+	ErrUnknownToken = errors.New("unknown token")
+)
+
 var (
 	Tokens     = make(map[string]string) // key = refresh, value = access
 	lockTokens = &sync.RWMutex{}
@@ -30,7 +39,9 @@ func GenerateTokens(userID string) (accessToken string, refreshToken string, err
 	accessClaims := Claims{
 		UserID: userID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(AccessTokenExpire)),
+			// без ID пары, выданные в одну секунду, совпадали бы, и обновленная пара оставалась рабочей
+			ID:        uuid.New().String(),
+			ExpiresAt: jwt.NewNumericDate(clock.Now().Add(AccessTokenExpire)),
 		},
 	}
 
@@ -42,7 +53,8 @@ func GenerateTokens(userID string) (accessToken string, refreshToken string, err
 	refreshClaims := Claims{
 		UserID: userID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(RefreshTokenExpire)),
+			ID:        uuid.New().String(),
+			ExpiresAt: jwt.NewNumericDate(clock.Now().Add(RefreshTokenExpire)),
 		},
 	}
 
@@ -55,22 +67,28 @@ func GenerateTokens(userID string) (accessToken string, refreshToken string, err
 }
 
 func ParseToken(tokenString string) (*Claims, error) {
+	return parseToken(tokenString)
+}
+
+func parseToken(tokenString string, opts ...jwt.ParserOption) (*Claims, error) {
+	opts = append(opts, jwt.WithTimeFunc(clock.Now))
+
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
 		return []byte(SigningKey), nil
-	})
+	}, opts...)
 
 	if err != nil {
-		return nil, fmt.Errorf("token parsing error: %w", err)
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
 	}
 
 	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
 		return claims, nil
 	}
 
-	return nil, errors.New("invalid token")
+	return nil, ErrInvalidToken
 }
 
 func ValidateAccessToken(tokenString string) (*Claims, error) {
@@ -91,21 +109,22 @@ func ValidateRefreshToken(tokenString string) (*Claims, error) {
 
 func ValidateTokenPair(accessToken, refreshToken string) (string, error) {
 
-	accessClaims, err := ParseToken(accessToken)
-	if err != nil && !errors.Is(err, jwt.ErrTokenExpired) {
+	// истекший access токен допустим: именно его и обновляют
+	accessClaims, err := parseToken(accessToken, jwt.WithoutClaimsValidation())
+	if err != nil {
 		log.Printf("invalif access token %v", err)
-		return "", fmt.Errorf("invalid access token: %v", err)
+		return "", fmt.Errorf("access token: %w", err)
 	}
 
 	refreshClaims, err := ParseToken(refreshToken)
 	if err != nil {
 		log.Printf("invalif refresh token %v", err)
-		return "", fmt.Errorf("invalid refresh token: %v", err)
+		return "", fmt.Errorf("refresh token: %w", err)
 	}
 
 	if accessClaims.UserID != refreshClaims.UserID {
 		log.Printf("tokens belong to different users")
-		return "", errors.New("tokens belong to different users")
+		return "", fmt.Errorf("tokens belong to different users: %w", ErrInvalidToken)
 	}
 
 	return accessClaims.UserID, nil
@@ -115,11 +134,11 @@ func CheckTokensExists(access, refresh string) error {
 	value, exists := getTokens(access)
 
 	if !exists {
-		return fmt.Errorf("not exists token")
+		return ErrUnknownToken
 	}
 
 	if value != refresh {
-		return fmt.Errorf("refresh token not validate access")
+		return fmt.Errorf("refresh token does not match access token: %w", ErrUnknownToken)
 	}
 
 	return nil
@@ -140,7 +159,7 @@ func AddTokensToBd(access, refresh string) error {
 
 func DeleteTokens(oldAccess, oldRefresh string) error {
 	if err := CheckTokensExists(oldAccess, oldRefresh); err != nil {
-		return fmt.Errorf("cannot delete tokens: old tokens are not correct")
+		return fmt.Errorf("cannot delete tokens: %w", err)
 	}
 
 	lockTokens.Lock()
@@ -162,3 +181,27 @@ func setTokens(access, refresh string) {
 	Tokens[access] = refresh
 	lockTokens.Unlock()
 }
+
+// RotateTokens проверяет пару токенов и заменяет ее новой. Возвращает
+// пользователя и новую пару.
+func RotateTokens(access, refresh string) (string, string, string, error) {
+	userID, err := ValidateTokenPair(access, refresh)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	if err := DeleteTokens(access, refresh); err != nil {
+		return "", "", "", err
+	}
+
+	newAccess, newRefresh, err := GenerateTokens(userID)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	if err := AddTokensToBd(newAccess, newRefresh); err != nil {
+		return "", "", "", err
+	}
+
+	return userID, newAccess, newRefresh, nil
+}
@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"ioboundlimiter/internal/clock"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenExpiry(t *testing.T) {
+	fake := clock.NewFake(time.Now())
+	clock.Set(fake)
+	defer clock.Set(clock.Real{})
+
+	access, refresh, err := GenerateTokens("user")
+	assert.NoError(t, err)
+
+	_, err = ValidateAccessToken(access)
+	assert.NoError(t, err)
+
+	fake.Advance(AccessTokenExpire + time.Second)
+
+	_, err = ValidateAccessToken(access)
+	assert.ErrorIs(t, err, jwt.ErrTokenExpired)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	userID, err := ValidateTokenPair(access, refresh)
+	assert.NoError(t, err)
+	assert.Equal(t, "user", userID)
+
+	fake.Advance(RefreshTokenExpire)
+
+	_, err = ValidateRefreshToken(refresh)
+	assert.ErrorIs(t, err, jwt.ErrTokenExpired)
+}
+
+func TestRotateTokens(t *testing.T) {
+	access, refresh, err := GenerateTokens("rotated")
+	assert.NoError(t, err)
+	assert.NoError(t, AddTokensToBd(access, refresh))
+
+	_, _, _, err = RotateTokens(access, "junk")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	userID, _, _, err := RotateTokens(access, refresh)
+	assert.NoError(t, err)
+	assert.Equal(t, "rotated", userID)
+
+	// пару можно обменять только один раз
+	_, _, _, err = RotateTokens(access, refresh)
+	assert.ErrorIs(t, err, ErrUnknownToken)
+}
@@ -0,0 +1,159 @@
+package breaker
+
+import (
+	"errors"
+	"ioboundlimiter/internal/clock"
+	"sync"
+	"time"
+)
+
+// Состояния автомата
+const (
+	StateClosed   = "closed"
+	StateOpen     = "open"
+	StateHalfOpen = "half-open"
+)
+
+var ErrOpen = errors.New("circuit breaker is open")
+
+type Config struct {
+	// FailureThreshold - сколько ошибок подряд открывают автомат
+	FailureThreshold int
+	// OpenTimeout - сколько автомат открыт перед пробными запросами
+	OpenTimeout time.Duration
+	// HalfOpenProbes - сколько пробных задач выполняется одновременно
+	HalfOpenProbes int
+}
+
+func DefaultConfig() Config {
+	return Config{
+		FailureThreshold: 5,
+		OpenTimeout:      30 * time.Second,
+		HalfOpenProbes:   1,
+	}
+}
+
+// Breaker - circuit breaker одного внешнего адресата. Пока он открыт,
+// задачи не выполняются; после OpenTimeout пропускается HalfOpenProbes
+// пробных задач, и успех пробы закрывает автомат, а ошибка снова открывает.
+type Breaker struct {
+	mu  sync.Mutex
+	cfg Config
+
+	state    string
+	failures int
+	openedAt time.Time
+	probes   int
+	// generation меняется при каждой смене состояния, чтобы результаты
+	// задач, начатых до нее, не влияли на новое состояние
+	generation uint64
+}
+
+func New(cfg Config) *Breaker {
+	if cfg.FailureThreshold < 1 {
+		cfg.FailureThreshold = 1
+	}
+	if cfg.HalfOpenProbes < 1 {
+		cfg.HalfOpenProbes = 1
+	}
+	return &Breaker{cfg: cfg, state: StateClosed}
+}
+
+// Allow разрешает выполнение задачи. Возвращенное поколение нужно передать
+// в Record. Если автомат открыт, возвращает ErrOpen и время до пробы.
+func (b *Breaker) Allow() (uint64, time.Duration, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == StateOpen {
+		wait := b.cfg.OpenTimeout - clock.Since(b.openedAt)
+		if wait > 0 {
+			return 0, wait, ErrOpen
+		}
+		b.setState(StateHalfOpen)
+	}
+
+	if b.state == StateHalfOpen {
+		if b.probes >= b.cfg.HalfOpenProbes {
+			return 0, b.cfg.OpenTimeout, ErrOpen
+		}
+		b.probes++
+	}
+
+	return b.generation, 0, nil
+}
+
+// Record учитывает результат задачи, разрешенной Allow
+func (b *Breaker) Record(generation uint64, success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if generation != b.generation {
+		return
+	}
+
+	switch {
+	case success:
+		b.failures = 0
+		if b.state == StateHalfOpen {
+			b.setState(StateClosed)
+		}
+	case b.state == StateHalfOpen:
+		b.setState(StateOpen)
+	default:
+		b.failures++
+		if b.failures >= b.cfg.FailureThreshold {
+			b.setState(StateOpen)
+		}
+	}
+}
+
+// Abort освобождает пробу задачи, которая завершилась без результата (например, отменена)
+func (b *Breaker) Abort(generation uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if generation == b.generation && b.state == StateHalfOpen && b.probes > 0 {
+		b.probes--
+	}
+}
+
+// setState вызывается под b.mu
+func (b *Breaker) setState(state string) {
+	b.state = state
+	b.generation++
+	b.probes = 0
+	if state == StateOpen {
+		b.openedAt = clock.Now()
+	} else {
+		b.failures = 0
+	}
+}
+
+type Snapshot struct {
+	State    string     `json:"state"`
+	Failures int        `json:"failures"`
+	OpenedAt *time.Time `json:"opened_at,omitempty"`
+	// RetryAt - когда открытый автомат пропустит пробную задачу
+	RetryAt *time.Time `json:"retry_at,omitempty"`
+}
+
+func (b *Breaker) Snapshot() Snapshot {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	snapshot := Snapshot{State: b.state, Failures: b.failures}
+	if b.state != StateClosed {
+		openedAt := b.openedAt
+		retryAt := openedAt.Add(b.cfg.OpenTimeout)
+		snapshot.OpenedAt = &openedAt
+		snapshot.RetryAt = &retryAt
+	}
+	return snapshot
+}
+
+func (b *Breaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
@@ -0,0 +1,75 @@
+package breaker
+
+import (
+	"ioboundlimiter/internal/clock"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBreaker(t *testing.T) {
+	fake := clock.NewFake(time.Now())
+	clock.Set(fake)
+	defer clock.Set(clock.Real{})
+
+	fail := func(b *Breaker) {
+		generation, _, err := b.Allow()
+		assert.NoError(t, err)
+		b.Record(generation, false)
+	}
+
+	t.Run("opens after threshold and probes after timeout", func(t *testing.T) {
+		b := New(Config{FailureThreshold: 2, OpenTimeout: time.Minute, HalfOpenProbes: 1})
+
+		fail(b)
+		assert.Equal(t, StateClosed, b.State())
+		fail(b)
+		assert.Equal(t, StateOpen, b.State())
+
+		_, wait, err := b.Allow()
+		assert.ErrorIs(t, err, ErrOpen)
+		assert.Equal(t, time.Minute, wait)
+
+		fake.Advance(time.Minute)
+		probe, _, err := b.Allow()
+		assert.NoError(t, err)
+		assert.Equal(t, StateHalfOpen, b.State())
+
+		// пока проба выполняется, остальные задачи не пропускаются
+		_, _, err = b.Allow()
+		assert.ErrorIs(t, err, ErrOpen)
+
+		b.Record(probe, true)
+		assert.Equal(t, StateClosed, b.State())
+	})
+
+	t.Run("failed probe opens again", func(t *testing.T) {
+		b := New(Config{FailureThreshold: 1, OpenTimeout: time.Minute})
+		fail(b)
+
+		fake.Advance(time.Minute)
+		fail(b)
+		assert.Equal(t, StateOpen, b.State())
+		assert.NotNil(t, b.Snapshot().RetryAt)
+	})
+
+	t.Run("stale results are ignored", func(t *testing.T) {
+		b := New(Config{FailureThreshold: 1, OpenTimeout: time.Minute})
+
+		slow, _, _ := b.Allow()
+		fail(b)
+		b.Record(slow, true)
+		assert.Equal(t, StateOpen, b.State())
+	})
+
+	t.Run("success resets failures", func(t *testing.T) {
+		b := New(Config{FailureThreshold: 2, OpenTimeout: time.Minute})
+
+		fail(b)
+		generation, _, _ := b.Allow()
+		b.Record(generation, true)
+		fail(b)
+		assert.Equal(t, StateClosed, b.State())
+	})
+}
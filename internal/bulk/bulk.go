@@ -0,0 +1,279 @@
+// Package bulk - массовая отмена и удаление задач по фильтру списка.
+// Операция выполняется в фоне как задание, за ходом которого можно следить.
+package bulk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"ioboundlimiter/internal/clock"
+	"ioboundlimiter/internal/storage"
+	"ioboundlimiter/internal/workers"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ActionCancel = "cancel"
+	ActionDelete = "delete"
+)
+
+// Состояния задания
+const (
+	JobRunning = "running"
+	JobDone    = "done"
+	// JobStopped - задание прервано остановкой сервиса
+	JobStopped = "stopped"
+)
+
+// сколько заданий хранится, старые завершенные забываются
+const maxJobs = 100
+
+var (
+	ErrJobNotFound   = errors.New("bulk job not found")
+	ErrUnknownAction = errors.New("unknown bulk action")
+	ErrEmptyFilter   = errors.New("bulk filter should narrow the selection")
+	ErrForbidden     = errors.New("tasks belong to another user")
+	ErrStopped       = errors.New("bulk jobs are stopped")
+)
+
+// Filter - фильтр задания в ответе API
+type Filter struct {
+	Owner         string     `json:"owner,omitempty"`
+	States        []string   `json:"states,omitempty"`
+	Type          string     `json:"type,omitempty"`
+	GroupID       string     `json:"group_id,omitempty"`
+	Name          string     `json:"name,omitempty"`
+	CreatedAfter  *time.Time `json:"created_after,omitempty"`
+	CreatedBefore *time.Time `json:"created_before,omitempty"`
+}
+
+func newFilter(f storage.Filter) Filter {
+	view := Filter{Owner: f.Owner, States: f.States, Type: f.Type, GroupID: f.GroupID, Name: f.Name}
+	if !f.CreatedAfter.IsZero() {
+		view.CreatedAfter = &f.CreatedAfter
+	}
+	if !f.CreatedBefore.IsZero() {
+		view.CreatedBefore = &f.CreatedBefore
+	}
+	return view
+}
+
+type Job struct {
+	ID     string `json:"id" example:"6ba7b810-9dad-11d1-80b4-00c04fd430c8"`
+	Action string `json:"action" example:"cancel"`
+	// Requester - пользователь, запустивший задание, у заданий админа пустой
+	Requester string `json:"requester,omitempty"`
+	Filter    Filter `json:"filter"`
+	// DryRun - только посчитать подходящие задачи
+	DryRun bool   `json:"dry_run"`
+	State  string `json:"state" example:"running"`
+	// Matched - задач подошло под фильтр в момент запуска
+	Matched int `json:"matched"`
+	// Processed - отменено или удалено
+	Processed int `json:"processed"`
+	// Skipped - уже завершенные (для отмены) или уже удаленные задачи
+	Skipped    int        `json:"skipped"`
+	Failed     int        `json:"failed"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+var (
+	jobs     = make(map[string]*Job)
+	jobOrder []string
+	lockJobs = &sync.RWMutex{}
+
+	// задания в фоне прерываются при остановке сервиса, Shutdown ждет их
+	ctx, cancelFunc = context.WithCancel(context.Background())
+	wg              sync.WaitGroup
+)
+
+// narrowed сообщает, что фильтр задает что-то кроме владельца: задание
+// по пустому фильтру затронуло бы все задачи
+func narrowed(f storage.Filter) bool {
+	return len(f.States) > 0 || f.Type != "" || f.GroupID != "" || f.Name != "" ||
+		!f.CreatedAfter.IsZero() || !f.CreatedBefore.IsZero()
+}
+
+// Start отбирает задачи по фильтру и запускает задание. requester - кто
+// запускает: пользователь может затронуть только свои задачи, поэтому
+// владелец фильтра для него должен совпадать с ним. Пробный запуск
+// завершается сразу.
+func Start(action string, filter storage.Filter, dryRun bool, requester string) (Job, error) {
+	if action != ActionCancel && action != ActionDelete {
+		return Job{}, fmt.Errorf("%w: %q", ErrUnknownAction, action)
+	}
+	if !narrowed(filter) {
+		return Job{}, ErrEmptyFilter
+	}
+	if requester != "" && filter.Owner != requester {
+		return Job{}, fmt.Errorf("user %s cannot touch tasks of %q: %w", requester, filter.Owner, ErrForbidden)
+	}
+
+	records, total := storage.ListTasks(filter, 0, 0)
+	job := &Job{
+		ID:        uuid.New().String(),
+		Action:    action,
+		Requester: requester,
+		Filter:    newFilter(filter),
+		DryRun:    dryRun,
+		State:     JobRunning,
+		Matched:   total,
+		CreatedAt: clock.Now(),
+	}
+	if dryRun {
+		finish(job)
+	}
+
+	lockJobs.Lock()
+	// под lockJobs, чтобы задание не запустилось после Shutdown
+	if ctx.Err() != nil {
+		lockJobs.Unlock()
+		return Job{}, ErrStopped
+	}
+	jobs[job.ID] = job
+	jobOrder = append(jobOrder, job.ID)
+	forgetOld()
+	copied := *job
+	if !dryRun {
+		wg.Add(1)
+	}
+	lockJobs.Unlock()
+
+	if !dryRun {
+		log.Printf("Bulk %s %s started: %d tasks", action, job.ID, total)
+		go run(job, records)
+	}
+	return copied, nil
+}
+
+// forgetOld удаляет самые старые завершенные задания сверх maxJobs.
+// Вызывается под lockJobs.
+func forgetOld() {
+	for i := 0; len(jobOrder) > maxJobs && i < len(jobOrder); {
+		id := jobOrder[i]
+		if jobs[id].State == JobRunning {
+			i++
+			continue
+		}
+		delete(jobs, id)
+		jobOrder = slices.Delete(jobOrder, i, i+1)
+	}
+}
+
+func finish(job *Job) {
+	now := clock.Now()
+	job.State = JobDone
+	job.FinishedAt = &now
+}
+
+func run(job *Job, records []storage.Record) {
+	defer wg.Done()
+
+	for _, record := range records {
+		if ctx.Err() != nil {
+			break
+		}
+		processed, err := apply(job.Action, record.UUID)
+
+		lockJobs.Lock()
+		switch {
+		case err != nil:
+			log.Printf("Bulk %s %s: task %s: %v", job.Action, job.ID, record.UUID, err)
+			job.Failed++
+		case processed:
+			job.Processed++
+		default:
+			job.Skipped++
+		}
+		lockJobs.Unlock()
+	}
+
+	lockJobs.Lock()
+	finish(job)
+	if ctx.Err() != nil {
+		job.State = JobStopped
+	}
+	log.Printf("Bulk %s %s %s: %d processed, %d skipped, %d failed", job.Action, job.ID, job.State, job.Processed, job.Skipped, job.Failed)
+	lockJobs.Unlock()
+}
+
+// apply выполняет действие над задачей. Задача могла измениться после
+// отбора: завершенная задача при отмене и удаленная задача пропускаются.
+func apply(action, uuid string) (bool, error) {
+	stat, err := storage.GetResponse(uuid)
+	if errors.Is(err, storage.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	switch action {
+	case ActionCancel:
+		if storage.IsTerminal(stat.State) {
+			return false, nil
+		}
+		if err := workers.CancelTask(uuid); err != nil {
+			if current, err := storage.GetResponse(uuid); err != nil || storage.IsTerminal(current.State) {
+				return false, nil
+			}
+			return false, err
+		}
+		return true, nil
+	default:
+		if !storage.IsTerminal(stat.State) {
+			if err := workers.CancelTask(uuid); err != nil {
+				log.Printf("Task %s is not canceled before deletion: %v", uuid, err)
+			}
+		}
+		if err := storage.DeleteTask(uuid); err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				return false, nil
+			}
+			return false, err
+		}
+		return true, nil
+	}
+}
+
+// Shutdown прерывает задания в фоне и ждет их. Вызывается до остановки
+// воркеров: задания отменяют задачи через них.
+func Shutdown() {
+	lockJobs.Lock()
+	cancelFunc()
+	lockJobs.Unlock()
+
+	wg.Wait()
+}
+
+func Get(id string) (Job, error) {
+	lockJobs.RLock()
+	defer lockJobs.RUnlock()
+
+	job, ok := jobs[id]
+	if !ok {
+		return Job{}, fmt.Errorf("job %s: %w", id, ErrJobNotFound)
+	}
+	return *job, nil
+}
+
+// List возвращает задания от новых к старым. requester != "" - только его задания.
+func List(requester string) []Job {
+	lockJobs.RLock()
+	defer lockJobs.RUnlock()
+
+	list := []Job{}
+	for i := len(jobOrder) - 1; i >= 0; i-- {
+		job := jobs[jobOrder[i]]
+		if requester == "" || job.Requester == requester {
+			list = append(list, *job)
+		}
+	}
+	return list
+}
@@ -0,0 +1,107 @@
+package bulk
+
+import (
+	"context"
+	"ioboundlimiter/internal/storage"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBulk(t *testing.T) {
+	add := func(name, owner string) string {
+		id, err := storage.AddWithOptions(name, storage.TaskOptions{Owner: owner, Type: "bulk-test"})
+		assert.NoError(t, err)
+		return id
+	}
+
+	wait := func(t *testing.T, id string) Job {
+		var job Job
+		assert.Eventually(t, func() bool {
+			job, _ = Get(id)
+			return job.State == JobDone
+		}, 5*time.Second, time.Millisecond)
+		return job
+	}
+
+	t.Run("rejects unsafe requests", func(t *testing.T) {
+		_, err := Start("purge", storage.Filter{Name: "x"}, false, "")
+		assert.ErrorIs(t, err, ErrUnknownAction)
+
+		_, err = Start(ActionDelete, storage.Filter{Owner: "alice"}, false, "alice")
+		assert.ErrorIs(t, err, ErrEmptyFilter)
+
+		_, err = Start(ActionDelete, storage.Filter{Owner: "bob", Name: "x"}, false, "alice")
+		assert.ErrorIs(t, err, ErrForbidden)
+	})
+
+	t.Run("dry run only counts", func(t *testing.T) {
+		add("dry", "carol")
+		add("dry", "carol")
+		add("dry", "dave")
+
+		job, err := Start(ActionDelete, storage.Filter{Owner: "carol", Name: "dry"}, true, "carol")
+		assert.NoError(t, err)
+		assert.Equal(t, JobDone, job.State)
+		assert.Equal(t, 2, job.Matched)
+		assert.Equal(t, 0, job.Processed)
+
+		_, total := storage.ListTasks(storage.Filter{Name: "dry"}, 0, 0)
+		assert.Equal(t, 3, total)
+	})
+
+	t.Run("cancel skips finished tasks", func(t *testing.T) {
+		pending := add("cancel me", "erin")
+		finished := add("cancel me", "erin")
+		_, err := storage.CompareAndSetState(finished, storage.StatePending, storage.StateDone)
+		assert.NoError(t, err)
+		other := add("cancel me", "frank")
+
+		job, err := Start(ActionCancel, storage.Filter{Owner: "erin", Name: "cancel me"}, false, "erin")
+		assert.NoError(t, err)
+		job = wait(t, job.ID)
+		assert.Equal(t, 2, job.Matched)
+		assert.Equal(t, 1, job.Processed)
+		assert.Equal(t, 1, job.Skipped)
+
+		stat, _ := storage.GetResponse(pending)
+		assert.Equal(t, storage.StateCanceled, stat.State)
+		stat, _ = storage.GetResponse(other)
+		assert.Equal(t, storage.StatePending, stat.State)
+	})
+
+	t.Run("admin deletes tasks of all users", func(t *testing.T) {
+		add("cleanup", "gina")
+		add("cleanup", "hank")
+
+		job, err := Start(ActionDelete, storage.Filter{Name: "cleanup", States: []string{storage.StatePending}}, false, "")
+		assert.NoError(t, err)
+		job = wait(t, job.ID)
+		assert.Equal(t, 2, job.Processed)
+
+		_, total := storage.ListTasks(storage.Filter{Name: "cleanup"}, 0, 0)
+		assert.Equal(t, 0, total)
+
+		assert.Equal(t, job.ID, List("")[0].ID)
+		assert.Empty(t, List("gina"))
+	})
+
+	t.Run("shutdown stops jobs", func(t *testing.T) {
+		id := add("interrupted", "ivan")
+		records, _ := storage.ListTasks(storage.Filter{Name: "interrupted"}, 0, 0)
+		job := &Job{ID: "interrupted", Action: ActionCancel, State: JobRunning}
+		defer func() { ctx, cancelFunc = context.WithCancel(context.Background()) }()
+
+		Shutdown()
+		wg.Add(1)
+		run(job, records)
+		assert.Equal(t, JobStopped, job.State)
+		assert.Equal(t, 0, job.Processed)
+		stat, _ := storage.GetResponse(id)
+		assert.Equal(t, storage.StatePending, stat.State)
+
+		_, err := Start(ActionCancel, storage.Filter{Owner: "ivan", Name: "interrupted"}, false, "ivan")
+		assert.ErrorIs(t, err, ErrStopped)
+	})
+}
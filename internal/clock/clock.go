@@ -0,0 +1,99 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock абстрагирует время, чтобы таймауты, TTL и имитацию работы в
+// воркерах можно было проверять в тестах без реального ожидания.
+type Clock interface {
+	Now() time.Time
+	Since(t time.Time) time.Duration
+	NewTimer(d time.Duration) Timer
+	NewTicker(d time.Duration) Ticker
+	After(d time.Duration) <-chan time.Time
+}
+
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+}
+
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+var (
+	current     Clock = Real{}
+	lockCurrent       = &sync.RWMutex{}
+)
+
+// Set подменяет часы всего сервиса, используется в тестах
+func Set(c Clock) {
+	lockCurrent.Lock()
+	current = c
+	lockCurrent.Unlock()
+}
+
+func Get() Clock {
+	lockCurrent.RLock()
+	defer lockCurrent.RUnlock()
+	return current
+}
+
+func Now() time.Time {
+	return Get().Now()
+}
+
+func Since(t time.Time) time.Duration {
+	return Get().Since(t)
+}
+
+// Real - настоящее время
+type Real struct{}
+
+func (Real) Now() time.Time {
+	return time.Now()
+}
+
+func (Real) Since(t time.Time) time.Duration {
+	return time.Since(t)
+}
+
+func (Real) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+func (Real) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+func (Real) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+type realTimer struct {
+	t *time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time {
+	return t.t.C
+}
+
+func (t realTimer) Stop() bool {
+	return t.t.Stop()
+}
+
+type realTicker struct {
+	t *time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time {
+	return t.t.C
+}
+
+func (t realTicker) Stop() {
+	t.t.Stop()
+}
@@ -0,0 +1,73 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFake(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("advance moves now", func(t *testing.T) {
+		f := NewFake(start)
+		f.Advance(time.Hour)
+
+		assert.Equal(t, start.Add(time.Hour), f.Now())
+		assert.Equal(t, time.Hour, f.Since(start))
+	})
+
+	t.Run("timer fires once deadline passed", func(t *testing.T) {
+		f := NewFake(start)
+		timer := f.NewTimer(time.Minute)
+
+		f.Advance(59 * time.Second)
+		assert.Empty(t, timer.C())
+
+		f.Advance(time.Second)
+		assert.Equal(t, start.Add(time.Minute), <-timer.C())
+		assert.False(t, timer.Stop())
+	})
+
+	t.Run("stopped timer does not fire", func(t *testing.T) {
+		f := NewFake(start)
+		timer := f.NewTimer(time.Minute)
+
+		assert.True(t, timer.Stop())
+		f.Advance(time.Hour)
+		assert.Empty(t, timer.C())
+	})
+
+	t.Run("ticker fires every period and drops missed ticks", func(t *testing.T) {
+		f := NewFake(start)
+		ticker := f.NewTicker(10 * time.Second)
+		defer ticker.Stop()
+
+		f.Advance(10 * time.Second)
+		assert.Equal(t, start.Add(10*time.Second), <-ticker.C())
+
+		f.Advance(time.Minute)
+		assert.Equal(t, start.Add(20*time.Second), <-ticker.C())
+		assert.Empty(t, ticker.C())
+	})
+
+	t.Run("block until waiters registered", func(t *testing.T) {
+		f := NewFake(start)
+		done := make(chan struct{})
+
+		go func() {
+			<-f.After(time.Second)
+			close(done)
+		}()
+
+		f.BlockUntil(1)
+		f.Advance(time.Second)
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("timer did not fire")
+		}
+	})
+}
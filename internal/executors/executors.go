@@ -0,0 +1,32 @@
+package executors
+
+import (
+	"context"
+	"ioboundlimiter/internal/clock"
+	"ioboundlimiter/internal/workers"
+)
+
+// keepAlive отправляет heartbeat, пока исполнитель ждет внешний ресурс.
+// Возвращает функцию остановки.
+func keepAlive(ctx context.Context, beat func()) func() {
+	if beat == nil {
+		return func() {}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	ticker := clock.Get().NewTicker(workers.HeartbeatInterval)
+
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C():
+				beat()
+			}
+		}
+	}()
+
+	return cancel
+}
@@ -0,0 +1,309 @@
+package executors
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"ioboundlimiter/internal/clock"
+	"ioboundlimiter/internal/limiter"
+	"ioboundlimiter/internal/workers"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const TypeFile = "file"
+
+const (
+	modeCopy = "copy"
+	modeMove = "move"
+
+	partSuffix       = ".part"
+	progressInterval = time.Second
+)
+
+type FileConfig struct {
+	// AllowedDirs - источник и назначение должны лежать внутри этих директорий
+	AllowedDirs []string
+	// GlobalBandwidth - байт в секунду на все задачи вместе, 0 - без ограничения
+	GlobalBandwidth int64
+	ChunkSize       int
+}
+
+func DefaultFileConfig() FileConfig {
+	return FileConfig{ChunkSize: 64 << 10}
+}
+
+// FileTransfer - payload задачи типа file
+type FileTransfer struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	// Mode - copy (по умолчанию) или move
+	Mode string `json:"mode"`
+	// Bandwidth - байт в секунду для этой задачи, 0 - без ограничения
+	Bandwidth int64 `json:"bandwidth"`
+	// SHA256 - ожидаемая контрольная сумма в hex
+	SHA256 string `json:"sha256"`
+}
+
+// FileResult - результат задачи типа file
+type FileResult struct {
+	Bytes       int64  `json:"bytes"`
+	SHA256      string `json:"sha256"`
+	ResumedFrom int64  `json:"resumed_from"`
+	DurationMs  int64  `json:"duration_ms"`
+}
+
+type FileExecutor struct {
+	cfg    FileConfig
+	global *limiter.Rate
+}
+
+func NewFile(cfg FileConfig) *FileExecutor {
+	if cfg.ChunkSize <= 0 {
+		cfg.ChunkSize = DefaultFileConfig().ChunkSize
+	}
+
+	e := &FileExecutor{cfg: cfg}
+	if cfg.GlobalBandwidth > 0 {
+		e.global = limiter.NewRate(float64(cfg.GlobalBandwidth), cfg.ChunkSize)
+	}
+	return e
+}
+
+func (e *FileExecutor) Execute(ctx context.Context, job workers.Job) (json.RawMessage, error) {
+	transfer := FileTransfer{}
+	if err := json.Unmarshal(job.Task.Payload, &transfer); err != nil {
+		return nil, fmt.Errorf("invalid file payload: %w", err)
+	}
+	if err := e.validate(&transfer); err != nil {
+		return nil, err
+	}
+
+	start := clock.Now()
+
+	src, err := os.Open(transfer.Source)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open source: %w", err)
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("cannot stat source: %w", err)
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("source is not a regular file")
+	}
+
+	// копируем во временный .part файл, чтобы после обрыва продолжить с того же места
+	partPath := partName(transfer.Destination, job.UUID)
+	part, offset, hasher, err := openPart(partPath, src, info.Size())
+	if err != nil {
+		return nil, err
+	}
+	defer part.Close()
+
+	if _, err := src.Seek(offset, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("cannot seek source: %w", err)
+	}
+
+	var taskRate *limiter.Rate
+	if transfer.Bandwidth > 0 {
+		taskRate = limiter.NewRate(float64(transfer.Bandwidth), e.cfg.ChunkSize)
+	}
+
+	copied, err := e.copyChunks(ctx, job, io.MultiWriter(part, hasher), src, offset, info.Size(), taskRate)
+	if err != nil {
+		return nil, err
+	}
+	if err := part.Sync(); err != nil {
+		return nil, fmt.Errorf("cannot sync destination: %w", err)
+	}
+
+	sum := hex.EncodeToString(hasher.Sum(nil))
+	if err := verify(partPath, sum, transfer.SHA256); err != nil {
+		return nil, err
+	}
+
+	if err := os.Rename(partPath, transfer.Destination); err != nil {
+		return nil, fmt.Errorf("cannot finalize destination: %w", err)
+	}
+	if transfer.Mode == modeMove {
+		if err := os.Remove(transfer.Source); err != nil {
+			return nil, fmt.Errorf("cannot remove source after move: %w", err)
+		}
+	}
+
+	return json.Marshal(FileResult{
+		Bytes:       copied,
+		SHA256:      sum,
+		ResumedFrom: offset,
+		DurationMs:  clock.Since(start).Milliseconds(),
+	})
+}
+
+func (e *FileExecutor) validate(transfer *FileTransfer) error {
+	if transfer.Mode == "" {
+		transfer.Mode = modeCopy
+	}
+	if transfer.Mode != modeCopy && transfer.Mode != modeMove {
+		return fmt.Errorf("unknown mode %q", transfer.Mode)
+	}
+
+	for _, path := range []*string{&transfer.Source, &transfer.Destination} {
+		abs, err := filepath.Abs(*path)
+		if err != nil || *path == "" {
+			return fmt.Errorf("invalid path %q", *path)
+		}
+		*path = abs
+
+		allowed := false
+		for _, dir := range e.cfg.AllowedDirs {
+			allowed = allowed || within(dir, abs)
+		}
+		if !allowed {
+			return fmt.Errorf("path %q is not allowed", abs)
+		}
+	}
+
+	if transfer.Source == transfer.Destination {
+		return fmt.Errorf("source and destination are the same file")
+	}
+	return nil
+}
+
+// partName - свой .part файл у каждой задачи: две задачи с одним назначением
+// не пишут в один файл, а повтор той же задачи продолжает свою копию
+func partName(destination, uuid string) string {
+	if uuid == "" {
+		return destination + partSuffix
+	}
+	return destination + "." + uuid + partSuffix
+}
+
+// openPart открывает .part файл и досчитывает хеш уже скопированной части.
+// Если она не совпадает с началом источника (источник поменялся), копирование
+// начинается заново.
+func openPart(path string, src io.Reader, total int64) (*os.File, int64, hash.Hash, error) {
+	part, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, 0, nil, fmt.Errorf("cannot open destination: %w", err)
+	}
+
+	info, err := part.Stat()
+	if err != nil {
+		part.Close()
+		return nil, 0, nil, fmt.Errorf("cannot stat destination: %w", err)
+	}
+
+	offset := info.Size()
+	hasher := sha256.New()
+	if offset == 0 {
+		return part, 0, hasher, nil
+	}
+
+	if offset <= total {
+		if _, err := io.CopyN(hasher, part, offset); err != nil {
+			part.Close()
+			return nil, 0, nil, fmt.Errorf("cannot read partial destination: %w", err)
+		}
+		source := sha256.New()
+		if _, err := io.CopyN(source, src, offset); err != nil {
+			part.Close()
+			return nil, 0, nil, fmt.Errorf("cannot read source: %w", err)
+		}
+		if bytes.Equal(source.Sum(nil), hasher.Sum(nil)) {
+			return part, offset, hasher, nil
+		}
+	}
+
+	// источник поменялся - начинаем заново
+	if err := part.Truncate(0); err != nil {
+		part.Close()
+		return nil, 0, nil, fmt.Errorf("cannot truncate destination: %w", err)
+	}
+	if _, err := part.Seek(0, io.SeekStart); err != nil {
+		part.Close()
+		return nil, 0, nil, fmt.Errorf("cannot seek destination: %w", err)
+	}
+	return part, 0, sha256.New(), nil
+}
+
+func (e *FileExecutor) copyChunks(ctx context.Context, job workers.Job, dst io.Writer, src io.Reader, offset, total int64, taskRate *limiter.Rate) (int64, error) {
+	buf := make([]byte, e.cfg.ChunkSize)
+	done := offset
+	lastReport := time.Time{}
+
+	for {
+		n, readErr := src.Read(buf)
+		if n > 0 {
+			for _, rate := range []*limiter.Rate{e.global, taskRate} {
+				if rate == nil {
+					continue
+				}
+				if err := rate.WaitN(ctx, n); err != nil {
+					return done, err
+				}
+			}
+
+			if _, err := dst.Write(buf[:n]); err != nil {
+				return done, fmt.Errorf("cannot write destination: %w", err)
+			}
+			done += int64(n)
+		}
+
+		if now := clock.Now(); now.Sub(lastReport) >= progressInterval || readErr == io.EOF {
+			lastReport = now
+			if job.Progress != nil {
+				job.Progress(done, total)
+			}
+			if job.Beat != nil {
+				job.Beat()
+			}
+		}
+
+		if errors.Is(readErr, io.EOF) {
+			return done, nil
+		}
+		if readErr != nil {
+			return done, fmt.Errorf("cannot read source: %w", readErr)
+		}
+		if err := ctx.Err(); err != nil {
+			return done, err
+		}
+	}
+}
+
+// verify перечитывает записанный файл и сверяет контрольную сумму
+func verify(path, sum, expected string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("cannot open destination for verification: %w", err)
+	}
+	defer f.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, f); err != nil {
+		return fmt.Errorf("cannot read destination for verification: %w", err)
+	}
+
+	// при несовпадении копию удаляем, чтобы следующая попытка не продолжила ее
+	written := hex.EncodeToString(hasher.Sum(nil))
+	if written != sum {
+		os.Remove(path)
+		return fmt.Errorf("checksum mismatch after write: %s != %s", written, sum)
+	}
+	if expected != "" && !strings.EqualFold(expected, sum) {
+		os.Remove(path)
+		return fmt.Errorf("checksum mismatch: expected %s, got %s", expected, sum)
+	}
+	return nil
+}
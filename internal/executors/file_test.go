@@ -0,0 +1,158 @@
+package executors
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"ioboundlimiter/internal/storage"
+	"ioboundlimiter/internal/workers"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func fileJob(t *testing.T, transfer FileTransfer, progress func(done, total int64)) workers.Job {
+	payload, err := json.Marshal(transfer)
+	assert.NoError(t, err)
+	return workers.Job{Task: storage.Status{Type: TypeFile, Payload: payload}, Progress: progress}
+}
+
+func writeSource(t *testing.T, dir string, size int) (string, string) {
+	data := []byte(strings.Repeat("0123456789", size/10))
+	path := filepath.Join(dir, "source.bin")
+	assert.NoError(t, os.WriteFile(path, data, 0o644))
+
+	sum := sha256.Sum256(data)
+	return path, hex.EncodeToString(sum[:])
+}
+
+func TestFileExecutor(t *testing.T) {
+	dir := t.TempDir()
+	cfg := DefaultFileConfig()
+	cfg.AllowedDirs = []string{dir}
+	cfg.ChunkSize = 1000
+	exec := NewFile(cfg)
+
+	t.Run("copy with checksum and progress", func(t *testing.T) {
+		src, sum := writeSource(t, dir, 5000)
+		dst := filepath.Join(dir, "copy.bin")
+
+		var lastDone, lastTotal int64
+		raw, err := exec.Execute(context.Background(), fileJob(t, FileTransfer{Source: src, Destination: dst, SHA256: sum}, func(done, total int64) {
+			lastDone, lastTotal = done, total
+		}))
+		assert.NoError(t, err)
+
+		result := FileResult{}
+		assert.NoError(t, json.Unmarshal(raw, &result))
+		assert.Equal(t, int64(5000), result.Bytes)
+		assert.Equal(t, sum, result.SHA256)
+		assert.Equal(t, int64(5000), lastDone)
+		assert.Equal(t, int64(5000), lastTotal)
+
+		assert.FileExists(t, src)
+		assert.NoFileExists(t, dst+partSuffix)
+		copied, _ := os.ReadFile(dst)
+		original, _ := os.ReadFile(src)
+		assert.Equal(t, original, copied)
+	})
+
+	t.Run("resume partial copy", func(t *testing.T) {
+		src, sum := writeSource(t, dir, 5000)
+		dst := filepath.Join(dir, "resumed.bin")
+
+		original, _ := os.ReadFile(src)
+		assert.NoError(t, os.WriteFile(dst+partSuffix, original[:2000], 0o644))
+
+		raw, err := exec.Execute(context.Background(), fileJob(t, FileTransfer{Source: src, Destination: dst}, nil))
+		assert.NoError(t, err)
+
+		result := FileResult{}
+		assert.NoError(t, json.Unmarshal(raw, &result))
+		assert.Equal(t, int64(2000), result.ResumedFrom)
+		assert.Equal(t, sum, result.SHA256)
+
+		copied, _ := os.ReadFile(dst)
+		assert.Equal(t, original, copied)
+	})
+
+	t.Run("changed source restarts copy", func(t *testing.T) {
+		src, sum := writeSource(t, dir, 5000)
+		dst := filepath.Join(dir, "changed.bin")
+
+		assert.NoError(t, os.WriteFile(dst+partSuffix, []byte(strings.Repeat("x", 2000)), 0o644))
+
+		raw, err := exec.Execute(context.Background(), fileJob(t, FileTransfer{Source: src, Destination: dst, SHA256: sum}, nil))
+		assert.NoError(t, err)
+
+		result := FileResult{}
+		assert.NoError(t, json.Unmarshal(raw, &result))
+		assert.Equal(t, int64(0), result.ResumedFrom)
+		assert.Equal(t, sum, result.SHA256)
+	})
+
+	t.Run("part file is per task", func(t *testing.T) {
+		src, sum := writeSource(t, dir, 5000)
+		dst := filepath.Join(dir, "shared.bin")
+
+		// чужая недописанная копия того же назначения не продолжается и не портится
+		other := partName(dst, "other-task")
+		assert.NoError(t, os.WriteFile(other, []byte("0123"), 0o644))
+
+		job := fileJob(t, FileTransfer{Source: src, Destination: dst, SHA256: sum}, nil)
+		job.UUID = "this-task"
+		raw, err := exec.Execute(context.Background(), job)
+		assert.NoError(t, err)
+
+		result := FileResult{}
+		assert.NoError(t, json.Unmarshal(raw, &result))
+		assert.Equal(t, int64(0), result.ResumedFrom)
+		assert.NoFileExists(t, partName(dst, "this-task"))
+
+		data, _ := os.ReadFile(other)
+		assert.Equal(t, "0123", string(data))
+	})
+
+	t.Run("move removes source", func(t *testing.T) {
+		src, _ := writeSource(t, dir, 1000)
+		dst := filepath.Join(dir, "moved.bin")
+
+		_, err := exec.Execute(context.Background(), fileJob(t, FileTransfer{Source: src, Destination: dst, Mode: "move"}, nil))
+		assert.NoError(t, err)
+		assert.NoFileExists(t, src)
+		assert.FileExists(t, dst)
+	})
+
+	t.Run("checksum mismatch", func(t *testing.T) {
+		src, _ := writeSource(t, dir, 1000)
+		dst := filepath.Join(dir, "mismatch.bin")
+
+		_, err := exec.Execute(context.Background(), fileJob(t, FileTransfer{Source: src, Destination: dst, SHA256: strings.Repeat("0", 64)}, nil))
+		assert.ErrorContains(t, err, "checksum mismatch")
+		assert.NoFileExists(t, dst)
+		assert.NoFileExists(t, dst+partSuffix)
+	})
+
+	t.Run("path outside allowed dirs", func(t *testing.T) {
+		src, _ := writeSource(t, dir, 1000)
+
+		_, err := exec.Execute(context.Background(), fileJob(t, FileTransfer{Source: src, Destination: "/tmp/../etc/stolen"}, nil))
+		assert.ErrorContains(t, err, "not allowed")
+	})
+
+	t.Run("bandwidth limit", func(t *testing.T) {
+		src, _ := writeSource(t, dir, 3000)
+		dst := filepath.Join(dir, "throttled.bin")
+
+		start := time.Now()
+		_, err := exec.Execute(context.Background(), fileJob(t, FileTransfer{Source: src, Destination: dst, Bandwidth: 10000}, nil))
+		assert.NoError(t, err)
+		// первый чанк из запаса, оставшиеся 2000 байт при 10000 B/s - не меньше 200ms
+		assert.GreaterOrEqual(t, time.Since(start), 150*time.Millisecond)
+	})
+}
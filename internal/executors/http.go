@@ -0,0 +1,313 @@
+package executors
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"ioboundlimiter/internal/clock"
+	"ioboundlimiter/internal/limiter"
+	"ioboundlimiter/internal/netguard"
+	"ioboundlimiter/internal/storage"
+	"ioboundlimiter/internal/workers"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const TypeHTTP = "http"
+
+type HTTPConfig struct {
+	// DefaultTimeout и MaxTimeout ограничивают timeout из payload
+	DefaultTimeout time.Duration
+	MaxTimeout     time.Duration
+	// MaxBodyBytes - сколько байт ответа сохранить в результат
+	MaxBodyBytes int64
+	// RatePerHost - запросов в секунду к одному хосту, 0 - без ограничения
+	RatePerHost float64
+	RateBurst   int
+	// AllowedHosts - хосты, к которым можно обращаться: "api.example.com"
+	// или "*.example.com". Пусто - любые хосты
+	AllowedHosts []string
+	// AllowPrivate разрешает запросы на loopback, link-local (в том числе
+	// metadata облаков), RFC 1918 и другие внутренние адреса. По умолчанию
+	// такие адреса отклоняются уже после разрешения DNS
+	AllowPrivate bool
+
+	// Client заменяет клиент по умолчанию вместе с проверкой адресов
+	Client *http.Client
+}
+
+func DefaultHTTPConfig() HTTPConfig {
+	return HTTPConfig{
+		DefaultTimeout: 30 * time.Second,
+		MaxTimeout:     10 * time.Minute,
+		MaxBodyBytes:   64 << 10,
+	}
+}
+
+// HTTPRequest - payload задачи типа http
+type HTTPRequest struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body"`
+	// Timeout в секундах
+	Timeout int `json:"timeout"`
+	// ExpectStatus - коды, считающиеся успехом. По умолчанию 2xx и 3xx
+	ExpectStatus []int `json:"expect_status"`
+	// SaveBody сохраняет тело ответа целиком как бинарный результат задачи
+	// вместо усеченного Body в HTTPResult
+	SaveBody bool `json:"save_body"`
+}
+
+// HTTPResult - результат задачи типа http
+type HTTPResult struct {
+	StatusCode int                 `json:"status_code"`
+	Headers    map[string][]string `json:"headers"`
+	// Body заполняется для текстовых ответов, BodyBase64 - для бинарных
+	Body          string `json:"body,omitempty"`
+	BodyBase64    string `json:"body_base64,omitempty"`
+	BodyTruncated bool   `json:"body_truncated"`
+	DurationMs    int64  `json:"duration_ms"`
+}
+
+// Ведра RatePerHost хостов, к которым давно не обращались, удаляются, чтобы
+// задачи с разными хостами не копили их без предела
+const (
+	rateIdle       = 10 * time.Minute
+	rateSweepEvery = time.Minute
+)
+
+// trackedRate помнит, когда к хосту обращались в последний раз
+type trackedRate struct {
+	*limiter.Rate
+	lastUsed time.Time
+}
+
+type HTTPExecutor struct {
+	cfg HTTPConfig
+
+	rates         map[string]*trackedRate
+	lastRateSweep time.Time
+	lockRates     *sync.Mutex
+}
+
+func NewHTTP(cfg HTTPConfig) *HTTPExecutor {
+	e := &HTTPExecutor{cfg: cfg, rates: make(map[string]*trackedRate), lockRates: &sync.Mutex{}}
+	if e.cfg.Client == nil {
+		e.cfg.Client = e.newClient()
+	}
+	return e
+}
+
+// newClient создает клиент, который не ходит через прокси, проверяет хост
+// каждого редиректа и адрес каждого соединения
+func (e *HTTPExecutor) newClient() *http.Client {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if !e.cfg.AllowPrivate {
+		dialer.Control = netguard.Control
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return fmt.Errorf("stopped after 10 redirects")
+			}
+			return e.checkHost(req.URL.Hostname())
+		},
+	}
+}
+
+// checkHost проверяет хост по AllowedHosts
+func (e *HTTPExecutor) checkHost(host string) error {
+	if len(e.cfg.AllowedHosts) == 0 {
+		return nil
+	}
+
+	host = strings.ToLower(host)
+	for _, allowed := range e.cfg.AllowedHosts {
+		allowed = strings.ToLower(allowed)
+		if suffix, ok := strings.CutPrefix(allowed, "*."); ok && strings.HasSuffix(host, "."+suffix) {
+			return nil
+		}
+		if host == allowed {
+			return nil
+		}
+	}
+	return fmt.Errorf("host %s is not allowed", host)
+}
+
+func (e *HTTPExecutor) Execute(ctx context.Context, job workers.Job) (json.RawMessage, error) {
+	req := HTTPRequest{}
+	if err := json.Unmarshal(job.Task.Payload, &req); err != nil {
+		return nil, fmt.Errorf("invalid http payload: %w", err)
+	}
+
+	httpReq, timeout, err := e.buildRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// ожидание очереди к хосту тоже может быть долгим: heartbeat идет и в нем
+	stop := keepAlive(ctx, job.Beat)
+	defer stop()
+
+	if rate := e.rateFor(httpReq.URL.Host); rate != nil {
+		if err := rate.Wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := clock.Now()
+	resp, err := e.cfg.Client.Do(httpReq.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("http request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	result := HTTPResult{
+		StatusCode: resp.StatusCode,
+		Headers:    resp.Header,
+	}
+	if req.SaveBody && job.Output != nil {
+		if err := job.Output(resp.Header.Get("Content-Type"), resp.Body); err != nil {
+			return nil, fmt.Errorf("cannot save response body: %w", err)
+		}
+	} else if err := e.readBody(resp.Body, &result); err != nil {
+		return nil, err
+	}
+	result.DurationMs = clock.Since(start).Milliseconds()
+
+	raw, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+
+	if !expected(resp.StatusCode, req.ExpectStatus) {
+		err := fmt.Errorf("unexpected status code %d", resp.StatusCode)
+		if resp.StatusCode >= 500 {
+			// 5xx - сервер не справляется: адаптивный лимит уменьшится
+			err = limiter.Overload(err)
+		}
+		return raw, err
+	}
+	return raw, nil
+}
+
+// Target - хост запроса, для circuit breaker
+func (e *HTTPExecutor) Target(task storage.Status) string {
+	req := HTTPRequest{}
+	if err := json.Unmarshal(task.Payload, &req); err != nil {
+		return ""
+	}
+	u, err := url.Parse(req.URL)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+func (e *HTTPExecutor) readBody(r io.Reader, result *HTTPResult) error {
+	body, err := io.ReadAll(io.LimitReader(r, e.cfg.MaxBodyBytes+1))
+	if err != nil {
+		return fmt.Errorf("cannot read response body: %w", err)
+	}
+
+	if int64(len(body)) > e.cfg.MaxBodyBytes {
+		body = body[:e.cfg.MaxBodyBytes]
+		result.BodyTruncated = true
+	}
+	if utf8.Valid(body) {
+		result.Body = string(body)
+	} else {
+		result.BodyBase64 = base64.StdEncoding.EncodeToString(body)
+	}
+	return nil
+}
+
+func (e *HTTPExecutor) buildRequest(req HTTPRequest) (*http.Request, time.Duration, error) {
+	if req.Method == "" {
+		req.Method = http.MethodGet
+	}
+
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, 0, fmt.Errorf("invalid url: %q", req.URL)
+	}
+	if err := e.checkHost(u.Hostname()); err != nil {
+		return nil, 0, err
+	}
+
+	httpReq, err := http.NewRequest(req.Method, u.String(), bytes.NewBufferString(req.Body))
+	if err != nil {
+		return nil, 0, fmt.Errorf("cannot create request: %w", err)
+	}
+	for key, value := range req.Headers {
+		httpReq.Header.Set(key, value)
+	}
+
+	timeout := e.cfg.DefaultTimeout
+	if req.Timeout > 0 {
+		timeout = min(time.Duration(req.Timeout)*time.Second, e.cfg.MaxTimeout)
+	}
+
+	return httpReq, timeout, nil
+}
+
+func (e *HTTPExecutor) rateFor(host string) *limiter.Rate {
+	if e.cfg.RatePerHost <= 0 {
+		return nil
+	}
+
+	e.lockRates.Lock()
+	defer e.lockRates.Unlock()
+
+	now := clock.Now()
+	e.sweepRates(now)
+
+	rate, ok := e.rates[host]
+	if !ok {
+		rate = &trackedRate{Rate: limiter.NewRate(e.cfg.RatePerHost, e.cfg.RateBurst)}
+		e.rates[host] = rate
+	}
+	rate.lastUsed = now
+	return rate.Rate
+}
+
+// sweepRates удаляет ведра простаивающих хостов. Ведро с долгом удалять
+// нельзя: новое снова выдало бы burst. Вызывается под lockRates.
+func (e *HTTPExecutor) sweepRates(now time.Time) {
+	if now.Sub(e.lastRateSweep) < rateSweepEvery {
+		return
+	}
+	e.lastRateSweep = now
+
+	for host, rate := range e.rates {
+		if now.Sub(rate.lastUsed) > rateIdle && rate.Full() {
+			delete(e.rates, host)
+		}
+	}
+}
+
+func expected(code int, expect []int) bool {
+	if len(expect) == 0 {
+		return code >= 200 && code < 400
+	}
+	return slices.Contains(expect, code)
+}
@@ -0,0 +1,251 @@
+package executors
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"ioboundlimiter/internal/clock"
+	"ioboundlimiter/internal/limiter"
+	"ioboundlimiter/internal/storage"
+	"ioboundlimiter/internal/workers"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func httpJob(t *testing.T, req HTTPRequest) workers.Job {
+	payload, err := json.Marshal(req)
+	assert.NoError(t, err)
+	return workers.Job{Task: storage.Status{Type: TypeHTTP, Payload: payload}}
+}
+
+func TestHTTPExecutor(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/echo":
+			w.Header().Set("X-Method", r.Method)
+			w.Header().Set("X-Token", r.Header.Get("X-Token"))
+			body, _ := io.ReadAll(r.Body)
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write(append([]byte("echo:"), body...))
+		case "/big":
+			_, _ = w.Write([]byte(strings.Repeat("a", 100)))
+		case "/fail":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case "/slow":
+			time.Sleep(200 * time.Millisecond)
+		}
+	}))
+	defer srv.Close()
+
+	// тестовые серверы слушают loopback
+	cfg := DefaultHTTPConfig()
+	cfg.AllowPrivate = true
+	cfg.MaxBodyBytes = 10
+	exec := NewHTTP(cfg)
+
+	t.Run("request with method, headers and body", func(t *testing.T) {
+		raw, err := exec.Execute(context.Background(), httpJob(t, HTTPRequest{
+			Method:  http.MethodPost,
+			URL:     srv.URL + "/echo",
+			Headers: map[string]string{"X-Token": "secret"},
+			Body:    "hi",
+		}))
+		assert.NoError(t, err)
+
+		result := HTTPResult{}
+		assert.NoError(t, json.Unmarshal(raw, &result))
+		assert.Equal(t, http.StatusCreated, result.StatusCode)
+		assert.Equal(t, "echo:hi", result.Body)
+		assert.Equal(t, []string{"POST"}, result.Headers["X-Method"])
+		assert.Equal(t, []string{"secret"}, result.Headers["X-Token"])
+	})
+
+	t.Run("body is truncated", func(t *testing.T) {
+		raw, err := exec.Execute(context.Background(), httpJob(t, HTTPRequest{URL: srv.URL + "/big"}))
+		assert.NoError(t, err)
+
+		result := HTTPResult{}
+		assert.NoError(t, json.Unmarshal(raw, &result))
+		assert.Equal(t, strings.Repeat("a", 10), result.Body)
+		assert.True(t, result.BodyTruncated)
+	})
+
+	t.Run("body saved as blob", func(t *testing.T) {
+		var contentType string
+		saved := &strings.Builder{}
+
+		job := httpJob(t, HTTPRequest{URL: srv.URL + "/big", SaveBody: true})
+		job.Output = func(ct string, r io.Reader) error {
+			contentType = ct
+			_, err := io.Copy(saved, r)
+			return err
+		}
+
+		raw, err := exec.Execute(context.Background(), job)
+		assert.NoError(t, err)
+
+		result := HTTPResult{}
+		assert.NoError(t, json.Unmarshal(raw, &result))
+		assert.Empty(t, result.Body)
+		assert.False(t, result.BodyTruncated)
+		assert.Equal(t, strings.Repeat("a", 100), saved.String())
+		assert.Contains(t, contentType, "text/plain")
+	})
+
+	t.Run("unexpected status fails but keeps result", func(t *testing.T) {
+		raw, err := exec.Execute(context.Background(), httpJob(t, HTTPRequest{URL: srv.URL + "/fail"}))
+		assert.EqualError(t, err, "unexpected status code 503")
+		assert.True(t, limiter.Overloaded(err))
+
+		result := HTTPResult{}
+		assert.NoError(t, json.Unmarshal(raw, &result))
+		assert.Equal(t, http.StatusServiceUnavailable, result.StatusCode)
+
+		_, err = exec.Execute(context.Background(), httpJob(t, HTTPRequest{URL: srv.URL + "/fail", ExpectStatus: []int{503}}))
+		assert.NoError(t, err)
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		cfg := DefaultHTTPConfig()
+		cfg.AllowPrivate = true
+		cfg.DefaultTimeout = 50 * time.Millisecond
+
+		_, err := NewHTTP(cfg).Execute(context.Background(), httpJob(t, HTTPRequest{URL: srv.URL + "/slow"}))
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.True(t, limiter.Overloaded(err))
+	})
+
+	t.Run("invalid url", func(t *testing.T) {
+		_, err := exec.Execute(context.Background(), httpJob(t, HTTPRequest{URL: "file:///etc/passwd"}))
+		assert.Error(t, err)
+		assert.False(t, limiter.Overloaded(err))
+	})
+
+	t.Run("private addresses are rejected after DNS", func(t *testing.T) {
+		exec := NewHTTP(DefaultHTTPConfig())
+
+		for _, url := range []string{srv.URL, strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)} {
+			_, err := exec.Execute(context.Background(), httpJob(t, HTTPRequest{URL: url + "/echo"}))
+			if assert.Error(t, err, url) {
+				assert.Contains(t, err.Error(), "private network")
+			}
+		}
+	})
+
+	t.Run("host allowlist", func(t *testing.T) {
+		cfg := DefaultHTTPConfig()
+		cfg.AllowPrivate = true
+		cfg.AllowedHosts = []string{"127.0.0.1", "*.example.com"}
+		exec := NewHTTP(cfg)
+
+		_, err := exec.Execute(context.Background(), httpJob(t, HTTPRequest{URL: srv.URL + "/echo"}))
+		assert.NoError(t, err)
+
+		_, err = exec.Execute(context.Background(), httpJob(t, HTTPRequest{URL: strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)}))
+		assert.ErrorContains(t, err, "host localhost is not allowed")
+
+		// редирект на чужой хост тоже проверяется
+		redirect := httptest.NewServer(http.RedirectHandler("http://localhost/", http.StatusFound))
+		defer redirect.Close()
+		_, err = exec.Execute(context.Background(), httpJob(t, HTTPRequest{URL: redirect.URL}))
+		assert.ErrorContains(t, err, "host localhost is not allowed")
+
+		assert.NoError(t, exec.checkHost("api.example.com"))
+		assert.Error(t, exec.checkHost("example.com.evil.org"))
+	})
+
+	t.Run("rate per host", func(t *testing.T) {
+		var hits atomic.Int32
+		limited := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits.Add(1)
+		}))
+		defer limited.Close()
+
+		cfg := DefaultHTTPConfig()
+		cfg.AllowPrivate = true
+		cfg.RatePerHost = 1
+		cfg.RateBurst = 1
+		exec := NewHTTP(cfg)
+
+		_, err := exec.Execute(context.Background(), httpJob(t, HTTPRequest{URL: limited.URL}))
+		assert.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_, err = exec.Execute(ctx, httpJob(t, HTTPRequest{URL: limited.URL}))
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Equal(t, int32(1), hits.Load())
+	})
+}
+
+func TestHTTPRates(t *testing.T) {
+	fake := clock.NewFake(time.Now())
+	clock.Set(fake)
+	defer clock.Set(clock.Real{})
+
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	defer srv.Close()
+
+	cfg := DefaultHTTPConfig()
+	cfg.AllowPrivate = true
+	cfg.RatePerHost = 0.01
+	cfg.RateBurst = 1
+	exec := NewHTTP(cfg)
+
+	t.Run("task beats while waiting for its host", func(t *testing.T) {
+		_, err := exec.Execute(context.Background(), httpJob(t, HTTPRequest{URL: srv.URL}))
+		assert.NoError(t, err)
+
+		var beats atomic.Int32
+		job := httpJob(t, HTTPRequest{URL: srv.URL})
+		job.Beat = func() { beats.Add(1) }
+		done := make(chan error)
+		go func() {
+			_, err := exec.Execute(context.Background(), job)
+			done <- err
+		}()
+
+		// следующий запрос к хосту разрешен через 100 секунд
+		assert.Eventually(t, func() bool {
+			fake.Advance(time.Second)
+			return beats.Load() > 0
+		}, 5*time.Second, time.Millisecond)
+		assert.Equal(t, int32(1), hits.Load())
+
+		assert.Eventually(t, func() bool {
+			fake.Advance(10 * time.Second)
+			return hits.Load() == 2
+		}, 5*time.Second, time.Millisecond)
+		assert.NoError(t, <-done)
+	})
+
+	t.Run("idle hosts are evicted", func(t *testing.T) {
+		host := strings.TrimPrefix(srv.URL, "http://")
+		other := strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)
+
+		fake.Advance(time.Minute)
+		_, err := exec.Execute(context.Background(), httpJob(t, HTTPRequest{URL: other}))
+		assert.NoError(t, err)
+		// к хосту обращались недавно
+		exec.lockRates.Lock()
+		assert.Contains(t, exec.rates, host)
+		exec.lockRates.Unlock()
+
+		fake.Advance(time.Hour)
+		exec.rateFor("example.com")
+		exec.lockRates.Lock()
+		assert.NotContains(t, exec.rates, host)
+		assert.NotContains(t, exec.rates, strings.TrimPrefix(other, "http://"))
+		assert.Contains(t, exec.rates, "example.com")
+		exec.lockRates.Unlock()
+	})
+}
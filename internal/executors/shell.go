@@ -0,0 +1,246 @@
+package executors
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"ioboundlimiter/internal/clock"
+	"ioboundlimiter/internal/storage"
+	"ioboundlimiter/internal/workers"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const TypeShell = "shell"
+
+type ShellConfig struct {
+	// AllowedCommands - команды, которые разрешено запускать
+	AllowedCommands []string
+	// AllowedDirs - если задано, рабочая директория обязательна и должна быть
+	// внутри одной из них (после разрешения символических ссылок)
+	AllowedDirs []string
+	// Env - окружение по умолчанию. Окружение сервиса не наследуется,
+	// чтобы не отдавать скриптам секреты.
+	Env []string
+	// AllowedEnv - переменные окружения, которые может задать payload.
+	// Пусто - любые, кроме опасных (см. deniedEnv)
+	AllowedEnv []string
+
+	DefaultTimeout time.Duration
+	MaxTimeout     time.Duration
+	// MaxOutputBytes - сколько байт stdout и stderr сохранить в результат
+	MaxOutputBytes int
+}
+
+func DefaultShellConfig() ShellConfig {
+	return ShellConfig{
+		Env:            []string{"PATH=" + os.Getenv("PATH")},
+		DefaultTimeout: time.Minute,
+		MaxTimeout:     time.Hour,
+		MaxOutputBytes: 64 << 10,
+	}
+}
+
+// ShellCommand - payload задачи типа shell
+type ShellCommand struct {
+	Command string            `json:"command"`
+	Args    []string          `json:"args"`
+	Dir     string            `json:"dir"`
+	Env     map[string]string `json:"env"`
+	// Timeout в секундах
+	Timeout int `json:"timeout"`
+	// SuccessExitCodes - коды выхода, считающиеся успехом. По умолчанию только 0
+	SuccessExitCodes []int `json:"success_exit_codes"`
+}
+
+// ShellResult - результат задачи типа shell
+type ShellResult struct {
+	ExitCode        int    `json:"exit_code"`
+	Stdout          string `json:"stdout"`
+	Stderr          string `json:"stderr"`
+	StdoutTruncated bool   `json:"stdout_truncated"`
+	StderrTruncated bool   `json:"stderr_truncated"`
+	DurationMs      int64  `json:"duration_ms"`
+}
+
+type ShellExecutor struct {
+	cfg ShellConfig
+}
+
+func NewShell(cfg ShellConfig) *ShellExecutor {
+	return &ShellExecutor{cfg: cfg}
+}
+
+// Target - запускаемая программа, для circuit breaker. Аргументы в адресат
+// не входят, а неразрешенные команды автомата не получают: Execute их отклонит.
+func (e *ShellExecutor) Target(task storage.Status) string {
+	command := ShellCommand{}
+	if err := json.Unmarshal(task.Payload, &command); err != nil {
+		return ""
+	}
+	if !slices.Contains(e.cfg.AllowedCommands, command.Command) {
+		return ""
+	}
+	return command.Command
+}
+
+func (e *ShellExecutor) Execute(ctx context.Context, job workers.Job) (json.RawMessage, error) {
+	command := ShellCommand{}
+	if err := json.Unmarshal(job.Task.Payload, &command); err != nil {
+		return nil, fmt.Errorf("invalid shell payload: %w", err)
+	}
+
+	if !slices.Contains(e.cfg.AllowedCommands, command.Command) {
+		return nil, fmt.Errorf("command %q is not allowed", command.Command)
+	}
+	dir, err := e.checkDir(command.Dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.checkEnv(command.Env); err != nil {
+		return nil, err
+	}
+
+	timeout := e.cfg.DefaultTimeout
+	if command.Timeout > 0 {
+		timeout = min(time.Duration(command.Timeout)*time.Second, e.cfg.MaxTimeout)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, command.Command, command.Args...)
+	cmd.Dir = dir
+	cmd.Env = slices.Clone(e.cfg.Env)
+	for key, value := range command.Env {
+		cmd.Env = append(cmd.Env, key+"="+value)
+	}
+
+	stdout := &limitedBuffer{max: e.cfg.MaxOutputBytes}
+	stderr := &limitedBuffer{max: e.cfg.MaxOutputBytes}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	killProcessGroup(cmd)
+
+	stop := keepAlive(ctx, job.Beat)
+	defer stop()
+
+	start := clock.Now()
+	runErr := cmd.Run()
+
+	result := ShellResult{
+		ExitCode:        -1,
+		Stdout:          stdout.buf.String(),
+		Stderr:          stderr.buf.String(),
+		StdoutTruncated: stdout.truncated,
+		StderrTruncated: stderr.truncated,
+		DurationMs:      clock.Since(start).Milliseconds(),
+	}
+	if cmd.ProcessState != nil {
+		result.ExitCode = cmd.ProcessState.ExitCode()
+	}
+
+	raw, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+
+	if ctx.Err() != nil {
+		return raw, ctx.Err()
+	}
+
+	var exitErr *exec.ExitError
+	if runErr != nil && !errors.As(runErr, &exitErr) {
+		return raw, fmt.Errorf("cannot run command: %w", runErr)
+	}
+
+	successCodes := command.SuccessExitCodes
+	if len(successCodes) == 0 {
+		successCodes = []int{0}
+	}
+	if !slices.Contains(successCodes, result.ExitCode) {
+		return raw, fmt.Errorf("command exited with code %d", result.ExitCode)
+	}
+
+	return raw, nil
+}
+
+// checkDir возвращает рабочую директорию команды без символических ссылок,
+// чтобы ссылка внутри разрешенной директории не вывела за ее пределы
+func (e *ShellExecutor) checkDir(dir string) (string, error) {
+	if len(e.cfg.AllowedDirs) == 0 {
+		return dir, nil
+	}
+	if dir == "" {
+		return "", fmt.Errorf("dir is required")
+	}
+
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("invalid dir: %w", err)
+	}
+	if dir, err = filepath.EvalSymlinks(dir); err != nil {
+		return "", fmt.Errorf("invalid dir: %w", err)
+	}
+	for _, allowed := range e.cfg.AllowedDirs {
+		if root, err := filepath.EvalSymlinks(allowed); err == nil && within(root, dir) {
+			return dir, nil
+		}
+	}
+	return "", fmt.Errorf("dir %q is not allowed", dir)
+}
+
+// deniedEnv - переменные, через которые payload мог бы подменить запускаемую
+// программу или выполнить свой код
+var deniedEnv = []string{"PATH", "BASH_ENV", "ENV", "IFS", "SHELLOPTS", "BASHOPTS", "PS4", "PROMPT_COMMAND", "GCONV_PATH", "HOSTALIASES"}
+
+// deniedEnvPrefixes - префиксы переменных динамического загрузчика и функций bash
+var deniedEnvPrefixes = []string{"LD_", "DYLD_", "BASH_FUNC_"}
+
+func (e *ShellExecutor) checkEnv(env map[string]string) error {
+	for key := range env {
+		if key == "" || strings.ContainsAny(key, "=\x00") {
+			return fmt.Errorf("invalid env name %q", key)
+		}
+		if len(e.cfg.AllowedEnv) > 0 && !slices.Contains(e.cfg.AllowedEnv, key) {
+			return fmt.Errorf("env %s is not allowed", key)
+		}
+		if slices.Contains(deniedEnv, strings.ToUpper(key)) {
+			return fmt.Errorf("env %s is not allowed", key)
+		}
+		for _, prefix := range deniedEnvPrefixes {
+			if strings.HasPrefix(strings.ToUpper(key), prefix) {
+				return fmt.Errorf("env %s is not allowed", key)
+			}
+		}
+	}
+	return nil
+}
+
+// within проверяет, что path лежит внутри root
+func within(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// limitedBuffer сохраняет первые max байт и молча отбрасывает остальное,
+// чтобы болтливый скрипт не упирался в закрытый pipe.
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if free := b.max - b.buf.Len(); free < len(p) {
+		b.buf.Write(p[:max(free, 0)])
+		b.truncated = true
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package executors
+
+import (
+	"os/exec"
+	"time"
+)
+
+// killProcessGroup: вне unix групп процессов нет, убивается только сама команда
+func killProcessGroup(cmd *exec.Cmd) {
+	cmd.WaitDelay = time.Second
+}
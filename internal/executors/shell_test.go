@@ -0,0 +1,162 @@
+//go:build unix
+
+package executors
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"ioboundlimiter/internal/storage"
+	"ioboundlimiter/internal/workers"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func shellJob(t *testing.T, command ShellCommand) workers.Job {
+	payload, err := json.Marshal(command)
+	assert.NoError(t, err)
+	return workers.Job{Task: storage.Status{Type: TypeShell, Payload: payload}}
+}
+
+func shellResult(t *testing.T, raw json.RawMessage) ShellResult {
+	result := ShellResult{}
+	assert.NoError(t, json.Unmarshal(raw, &result))
+	return result
+}
+
+func TestShellExecutor(t *testing.T) {
+	cfg := DefaultShellConfig()
+	cfg.AllowedCommands = []string{"sh"}
+	cfg.AllowedDirs = []string{t.TempDir()}
+	exec := NewShell(cfg)
+
+	t.Run("captures output, env and dir", func(t *testing.T) {
+		raw, err := exec.Execute(context.Background(), shellJob(t, ShellCommand{
+			Command: "sh",
+			Args:    []string{"-c", `echo "$GREETING"; pwd; echo oops >&2`},
+			Dir:     cfg.AllowedDirs[0],
+			Env:     map[string]string{"GREETING": "hi"},
+		}))
+		assert.NoError(t, err)
+
+		result := shellResult(t, raw)
+		assert.Equal(t, 0, result.ExitCode)
+		assert.Equal(t, "hi\n"+cfg.AllowedDirs[0]+"\n", result.Stdout)
+		assert.Equal(t, "oops\n", result.Stderr)
+	})
+
+	t.Run("output is truncated", func(t *testing.T) {
+		cfg := cfg
+		cfg.MaxOutputBytes = 16
+
+		raw, err := NewShell(cfg).Execute(context.Background(), shellJob(t, ShellCommand{
+			Command: "sh",
+			Args:    []string{"-c", "yes | head -c 1000"},
+			Dir:     cfg.AllowedDirs[0],
+		}))
+		assert.NoError(t, err)
+
+		result := shellResult(t, raw)
+		assert.Len(t, result.Stdout, 16)
+		assert.True(t, result.StdoutTruncated)
+	})
+
+	t.Run("exit code maps to failure", func(t *testing.T) {
+		raw, err := exec.Execute(context.Background(), shellJob(t, ShellCommand{Command: "sh", Args: []string{"-c", "exit 3"}, Dir: cfg.AllowedDirs[0]}))
+		assert.Error(t, err)
+		assert.Equal(t, 3, shellResult(t, raw).ExitCode)
+
+		_, err = exec.Execute(context.Background(), shellJob(t, ShellCommand{Command: "sh", Args: []string{"-c", "exit 3"}, Dir: cfg.AllowedDirs[0], SuccessExitCodes: []int{0, 3}}))
+		assert.NoError(t, err)
+	})
+
+	t.Run("command outside allow-list", func(t *testing.T) {
+		_, err := exec.Execute(context.Background(), shellJob(t, ShellCommand{Command: "rm", Args: []string{"-rf", "/"}}))
+		assert.ErrorContains(t, err, "not allowed")
+	})
+
+	t.Run("dir outside allowed dirs", func(t *testing.T) {
+		_, err := exec.Execute(context.Background(), shellJob(t, ShellCommand{Command: "sh", Args: []string{"-c", "true"}, Dir: "/"}))
+		assert.ErrorContains(t, err, "not allowed")
+	})
+
+	t.Run("dir is required", func(t *testing.T) {
+		_, err := exec.Execute(context.Background(), shellJob(t, ShellCommand{Command: "sh", Args: []string{"-c", "true"}}))
+		assert.ErrorContains(t, err, "dir is required")
+	})
+
+	t.Run("symlink out of allowed dirs", func(t *testing.T) {
+		link := filepath.Join(cfg.AllowedDirs[0], "escape")
+		assert.NoError(t, os.Symlink("/", link))
+
+		_, err := exec.Execute(context.Background(), shellJob(t, ShellCommand{Command: "sh", Args: []string{"-c", "true"}, Dir: link}))
+		assert.ErrorContains(t, err, "not allowed")
+	})
+
+	t.Run("dangerous env is rejected", func(t *testing.T) {
+		for _, key := range []string{"LD_PRELOAD", "PATH", "BASH_ENV", "BASH_FUNC_ls%%"} {
+			_, err := exec.Execute(context.Background(), shellJob(t, ShellCommand{
+				Command: "sh",
+				Args:    []string{"-c", "true"},
+				Dir:     cfg.AllowedDirs[0],
+				Env:     map[string]string{key: "x"},
+			}))
+			assert.ErrorContains(t, err, "not allowed", key)
+		}
+	})
+
+	t.Run("env outside allow-list", func(t *testing.T) {
+		cfg := cfg
+		cfg.AllowedEnv = []string{"GREETING"}
+
+		_, err := NewShell(cfg).Execute(context.Background(), shellJob(t, ShellCommand{
+			Command: "sh",
+			Args:    []string{"-c", "true"},
+			Dir:     cfg.AllowedDirs[0],
+			Env:     map[string]string{"OTHER": "x"},
+		}))
+		assert.ErrorContains(t, err, "not allowed")
+	})
+
+	t.Run("breaker target is the program", func(t *testing.T) {
+		assert.Equal(t, "sh", exec.Target(shellJob(t, ShellCommand{Command: "sh", Args: []string{"-c", "exit 1"}}).Task))
+		assert.Equal(t, "", exec.Target(shellJob(t, ShellCommand{Command: "/tmp/random-1234"}).Task))
+	})
+
+	t.Run("cancel kills whole process group", func(t *testing.T) {
+		pidFile := filepath.Join(cfg.AllowedDirs[0], "child.pid")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+
+		_, err := exec.Execute(ctx, shellJob(t, ShellCommand{
+			Command: "sh",
+			Args:    []string{"-c", "sleep 30 & echo $! > " + pidFile + "; wait"},
+			Dir:     cfg.AllowedDirs[0],
+		}))
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+		data, err := os.ReadFile(pidFile)
+		assert.NoError(t, err)
+		pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+		assert.NoError(t, err)
+
+		assert.Eventually(t, func() bool { return !processAlive(pid) }, 2*time.Second, 10*time.Millisecond)
+	})
+}
+
+// processAlive считает зомби мертвым: в контейнере их может некому забрать
+func processAlive(pid int) bool {
+	if syscall.Kill(pid, 0) != nil {
+		return false
+	}
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	return err != nil || !strings.Contains(string(stat), ") Z ")
+}
@@ -0,0 +1,20 @@
+//go:build unix
+
+package executors
+
+import (
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// killProcessGroup запускает команду в отдельной группе процессов и при
+// отмене убивает всю группу, а не только первый процесс.
+func killProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	// дети могут держать stdout открытым, не ждем их бесконечно
+	cmd.WaitDelay = time.Second
+}
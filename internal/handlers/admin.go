@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"ioboundlimiter/internal/workers"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// IntrospectHandle godoc
+//	@Summary		Состояние очередей и воркеров
+//	@Description	Длина очередей по типам, занятость воркеров и текущие задачи, пропускная способность и среднее время ожидания
+//	@Tags			admin
+//	@Produce		json
+//	@Param			X-Admin-Token	header		string	true	"Токен администратора"
+//	@Success		200				{object}	workers.Introspection
+//	@Failure		401				{object}	apierr.Problem	"invalid_admin_token"
+//	@Failure		403				{object}	apierr.Problem	"admin_disabled"
+//	@Router			/admin/queues [get]
+func IntrospectHandle(c *gin.Context) {
+	c.JSON(http.StatusOK, workers.Introspect())
+}
+
+// BreakersHandle godoc
+//	@Summary		Состояние circuit breakers
+//	@Description	Состояние автоматов по адресатам задач (тип:хост или тип:команда): closed, open или half-open
+//	@Tags			admin
+//	@Produce		json
+//	@Param			X-Admin-Token	header		string	true	"Токен администратора"
+//	@Success		200				{object}	map[string]breaker.Snapshot
+//	@Failure		401				{object}	apierr.Problem	"invalid_admin_token"
+//	@Failure		403				{object}	apierr.Problem	"admin_disabled"
+//	@Router			/admin/breakers [get]
+func BreakersHandle(c *gin.Context) {
+	c.JSON(http.StatusOK, workers.Breakers())
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"ioboundlimiter/internal/apierr"
+	"ioboundlimiter/internal/bulk"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BulkRequest - массовая операция над задачами по фильтрам списка
+type BulkRequest struct {
+	// cancel или delete
+	Action string `json:"action" binding:"required,oneof=cancel delete" example:"cancel"`
+	// Только посчитать подходящие задачи
+	DryRun bool `json:"dry_run" example:"true"`
+	TaskFilter
+}
+
+// AdminBulkRequest - массовая операция над задачами любых пользователей
+type AdminBulkRequest struct {
+	BulkRequest
+	// Владелец задач, пусто - все пользователи
+	Owner string `json:"owner"`
+}
+
+// startBulk запускает задание и отвечает 200 с результатом пробного
+// запуска или 202 со ссылкой на задание
+func startBulk(c *gin.Context, req BulkRequest, owner, requester, location string) {
+	job, err := bulk.Start(req.Action, req.filter(owner), req.DryRun, requester)
+	if err != nil {
+		log.Printf("Bulk %s is not started: %v", req.Action, err)
+		apierr.Abort(c, err)
+		return
+	}
+
+	if job.DryRun {
+		c.JSON(http.StatusOK, job)
+		return
+	}
+	c.Header("Location", location+job.ID)
+	c.JSON(http.StatusAccepted, job)
+}
+
+// BulkHandle godoc
+//	@Summary		Массовая отмена или удаление задач
+//	@Description	Отменяет или удаляет задачи пользователя по тем же фильтрам, что и список задач. Выполняется в фоне, ход задания - GET /v1/bulk/{id}.
+//	@Description	С dry_run только считает подходящие задачи. Нужен хотя бы один фильтр.
+//	@Tags			v1
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			request	body		BulkRequest	true	"Действие и фильтры"
+//	@Success		202		{object}	bulk.Job
+//	@Success		200		{object}	bulk.Job	"Пробный запуск"
+//	@Header			202		{string}	Location	"/v1/bulk/{id}"
+//	@Failure		400		{object}	apierr.Problem	"bad_request, invalid_filter"
+//	@Failure		401		{object}	apierr.Problem	"unauthorized, invalid_token"
+//	@Failure		503		{object}	apierr.Problem	"server_busy"
+//	@Router			/v1/bulk [post]
+func BulkHandle(c *gin.Context) {
+	req := BulkRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Printf("Invalid bulk request: %v", err)
+		apierr.Abort(c, apierr.ErrBadRequest.Wrap(err).WithDetail("should contain action and filters"))
+		return
+	}
+
+	user := c.GetString("user_id")
+	startBulk(c, req, user, user, "/v1/bulk/")
+}
+
+// BulkJobHandle godoc
+//	@Summary		Задание массовой операции
+//	@Tags			v1
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			id	path		string	true	"ID задания"
+//	@Success		200	{object}	bulk.Job
+//	@Failure		403	{object}	apierr.Problem	"bulk_forbidden"
+//	@Failure		404	{object}	apierr.Problem	"bulk_job_not_found"
+//	@Router			/v1/bulk/{id} [get]
+func BulkJobHandle(c *gin.Context) {
+	job, err := bulk.Get(c.Param("id"))
+	if err != nil {
+		apierr.Abort(c, err)
+		return
+	}
+
+	if job.Requester != c.GetString("user_id") {
+		log.Printf("User %s cannot access bulk job %s", c.GetString("user_id"), job.ID)
+		apierr.Abort(c, apierr.ErrBulkForbidden)
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// BulkJobsHandle godoc
+//	@Summary		Задания массовых операций
+//	@Description	Задания пользователя от новых к старым
+//	@Tags			v1
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Success		200	{array}		bulk.Job
+//	@Router			/v1/bulk [get]
+func BulkJobsHandle(c *gin.Context) {
+	c.JSON(http.StatusOK, bulk.List(c.GetString("user_id")))
+}
+
+// AdminBulkHandle godoc
+//	@Summary		Массовая отмена или удаление задач любых пользователей
+//	@Description	Как POST /v1/bulk, но по задачам всех пользователей или владельца из owner
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			X-Admin-Token	header		string				true	"Токен администратора"
+//	@Param			request			body		AdminBulkRequest	true	"Действие и фильтры"
+//	@Success		202				{object}	bulk.Job
+//	@Success		200				{object}	bulk.Job	"Пробный запуск"
+//	@Header			202				{string}	Location	"/admin/bulk/{id}"
+//	@Failure		400				{object}	apierr.Problem	"bad_request, invalid_filter"
+//	@Failure		401				{object}	apierr.Problem	"invalid_admin_token"
+//	@Failure		403				{object}	apierr.Problem	"admin_disabled"
+//	@Failure		503				{object}	apierr.Problem	"server_busy"
+//	@Router			/admin/bulk [post]
+func AdminBulkHandle(c *gin.Context) {
+	req := AdminBulkRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Printf("Invalid bulk request: %v", err)
+		apierr.Abort(c, apierr.ErrBadRequest.Wrap(err).WithDetail("should contain action and filters"))
+		return
+	}
+
+	startBulk(c, req.BulkRequest, req.Owner, "", "/admin/bulk/")
+}
+
+// AdminBulkJobHandle godoc
+//	@Summary		Задание массовой операции
+//	@Tags			admin
+//	@Produce		json
+//	@Param			X-Admin-Token	header		string	true	"Токен администратора"
+//	@Param			id				path		string	true	"ID задания"
+//	@Success		200				{object}	bulk.Job
+//	@Failure		401				{object}	apierr.Problem	"invalid_admin_token"
+//	@Failure		404				{object}	apierr.Problem	"bulk_job_not_found"
+//	@Router			/admin/bulk/{id} [get]
+func AdminBulkJobHandle(c *gin.Context) {
+	job, err := bulk.Get(c.Param("id"))
+	if err != nil {
+		apierr.Abort(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// AdminBulkJobsHandle godoc
+//	@Summary		Задания массовых операций
+//	@Description	Задания всех пользователей и админов от новых к старым
+//	@Tags			admin
+//	@Produce		json
+//	@Param			X-Admin-Token	header		string	true	"Токен администратора"
+//	@Success		200				{array}		bulk.Job
+//	@Failure		401				{object}	apierr.Problem	"invalid_admin_token"
+//	@Router			/admin/bulk [get]
+func AdminBulkJobsHandle(c *gin.Context) {
+	c.JSON(http.StatusOK, bulk.List(""))
+}
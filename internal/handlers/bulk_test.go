@@ -0,0 +1,106 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"ioboundlimiter/internal/bulk"
+	"ioboundlimiter/internal/storage"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBulkV1(t *testing.T) {
+	url := startAPI(t)
+
+	// waitJob ждет завершения задания владельцем
+	waitJob := func(t *testing.T, token, id string) map[string]any {
+		var body map[string]any
+		assert.Eventually(t, func() bool {
+			var resp *http.Response
+			resp, body = call(t, http.MethodGet, url+"/v1/bulk/"+id, token, "")
+			return resp.StatusCode == http.StatusOK && body["state"] == bulk.JobDone
+		}, 5*time.Second, 10*time.Millisecond)
+		return body
+	}
+
+	t.Run("filter is scoped to the owner", func(t *testing.T) {
+		owner, other := register(t, url), register(t, url)
+		mine := []string{createTask(t, url, owner, "bulk scoped"), createTask(t, url, owner, "bulk scoped")}
+		foreign := createTask(t, url, other, "bulk scoped")
+
+		resp, body := call(t, http.MethodPost, url+"/v1/bulk", owner, `{"action": "cancel", "name": "bulk scoped", "dry_run": true}`)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, bulk.JobDone, body["state"])
+		assert.EqualValues(t, 2, body["matched"])
+
+		resp, body = call(t, http.MethodPost, url+"/v1/bulk", owner, `{"action": "cancel", "name": "bulk scoped"}`)
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+		id := body["id"].(string)
+		assert.Equal(t, "/v1/bulk/"+id, resp.Header.Get("Location"))
+
+		body = waitJob(t, owner, id)
+		assert.EqualValues(t, 2, body["processed"])
+
+		for _, task := range mine {
+			stat, _ := storage.GetResponse(task)
+			assert.Equal(t, storage.StateCanceled, stat.State)
+			assert.Equal(t, stat.Owner, body["filter"].(map[string]any)["owner"])
+		}
+		stat, _ := storage.GetResponse(foreign)
+		assert.Equal(t, storage.StatePending, stat.State)
+	})
+
+	t.Run("jobs of another user are forbidden", func(t *testing.T) {
+		owner, other := register(t, url), register(t, url)
+		createTask(t, url, owner, "bulk private")
+
+		resp, body := call(t, http.MethodPost, url+"/v1/bulk", owner, `{"action": "delete", "name": "bulk private"}`)
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+		id := body["id"].(string)
+		waitJob(t, owner, id)
+
+		resp, body = call(t, http.MethodGet, url+"/v1/bulk/"+id, other, "")
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+		assert.Equal(t, "bulk_forbidden", body["code"])
+
+		req, _ := http.NewRequest(http.MethodGet, url+"/v1/bulk", nil)
+		req.Header.Set("Authorization", "Bearer "+other)
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		var jobs []bulk.Job
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&jobs))
+		assert.Empty(t, jobs)
+	})
+
+	t.Run("missing job", func(t *testing.T) {
+		token := register(t, url)
+
+		resp, body := call(t, http.MethodGet, url+"/v1/bulk/missing", token, "")
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+		assert.Equal(t, "bulk_job_not_found", body["code"])
+	})
+
+	t.Run("invalid requests", func(t *testing.T) {
+		token := register(t, url)
+
+		tests := []struct {
+			body string
+			code string
+		}{
+			{`{"action": "purge", "name": "x"}`, "bad_request"},
+			{`{"name": "x"}`, "bad_request"},
+			{`{"action": "delete"}`, "invalid_filter"},
+		}
+		for _, tt := range tests {
+			resp, body := call(t, http.MethodPost, url+"/v1/bulk", token, tt.body)
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode, tt.body)
+			assert.Equal(t, tt.code, body["code"], tt.body)
+		}
+
+		resp, _ := call(t, http.MethodPost, url+"/v1/bulk", "", `{"action": "delete", "name": "x"}`)
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+}
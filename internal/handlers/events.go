@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"ioboundlimiter/internal/apierr"
+	"ioboundlimiter/internal/clock"
+	"ioboundlimiter/internal/storage"
+	"ioboundlimiter/internal/watch"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const sseHeartbeat = 15 * time.Second
+
+func lastEventID(c *gin.Context) uint64 {
+	id := c.GetHeader("Last-Event-ID")
+	if id == "" {
+		id = c.Query("last_event_id")
+	}
+	seq, _ := strconv.ParseUint(id, 10, 64)
+	return seq
+}
+
+func writeEvent(w io.Writer, change storage.Change) error {
+	if change.Deleted {
+		_, err := fmt.Fprintf(w, "id: %d\nevent: deleted\ndata: {\"id\":%q}\n\n", change.Seq, change.UUID)
+		return err
+	}
+
+	data, err := json.Marshal(newTaskView(change.UUID, change.Status))
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: task\ndata: %s\n\n", change.Seq, data)
+	return err
+}
+
+// EventsHandle godoc
+//	@Summary		Поток изменений задач (SSE)
+//	@Description	Server-Sent Events: событие task с задачей (как в GET /v1/tasks/{id}) на каждую смену состояния, статуса или прогресса, событие deleted при удалении.
+//	@Description	Без параметров - все задачи пользователя. Поток одной задачи или группы закрывается, когда все ее задачи завершились.
+//	@Description	Для продолжения после обрыва передайте Last-Event-ID. Токен можно передать в access_token, так как EventSource не умеет ставить заголовки.
+//	@Tags			v1
+//	@Produce		text/event-stream
+//	@Security		BearerAuth
+//	@Param			task_id			query		string	false	"UUID задачи"
+//	@Param			group_id		query		string	false	"ID группы"
+//	@Param			access_token	query		string	false	"Access токен вместо заголовка Authorization"
+//	@Param			Last-Event-ID	header		string	false	"Номер последнего полученного события"
+//	@Success		200				{string}	string	"event: task"
+//	@Failure		400				{object}	apierr.Problem	"bad_request"
+//	@Failure		403				{object}	apierr.Problem	"task_forbidden, group_forbidden"
+//	@Failure		404				{object}	apierr.Problem	"task_not_found, group_not_found"
+//	@Router			/v1/events [get]
+func EventsHandle(c *gin.Context) {
+	scope := watch.Scope{Owner: c.GetString("user_id"), TaskID: c.Query("task_id"), GroupID: c.Query("group_id")}
+	if err := scope.Check(); err != nil {
+		apierr.Abort(c, err)
+		return
+	}
+
+	sub, missed, tracker := watch.Subscribe(scope, lastEventID(c))
+	defer sub.Close()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	fmt.Fprint(c.Writer, "retry: 3000\n\n")
+
+	send := func(change storage.Change) bool {
+		if err := writeEvent(c.Writer, change); err != nil {
+			log.Printf("Cannot write event: %v", err)
+			return false
+		}
+		c.Writer.Flush()
+		tracker.Apply(change)
+		return !tracker.Done()
+	}
+
+	for _, change := range missed {
+		if !send(change) {
+			return
+		}
+	}
+	if tracker.Done() {
+		return
+	}
+	c.Writer.Flush()
+
+	ticker := clock.Get().NewTicker(sseHeartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case change, ok := <-sub.C:
+			if !ok || !send(change) {
+				return
+			}
+		case <-ticker.C():
+			fmt.Fprint(c.Writer, ": ping\n\n")
+			c.Writer.Flush()
+		}
+	}
+}
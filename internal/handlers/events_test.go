@@ -0,0 +1,161 @@
+package handlers_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"ioboundlimiter/internal/storage"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// syncBuffer - журнал доступа, в который пишут обработчики сервера
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+type sseEvent struct {
+	id    string
+	event string
+	task  map[string]any
+}
+
+// openEvents подключается к потоку событий и возвращает функцию чтения
+// следующего события; ok=false - поток закрыт
+func openEvents(t *testing.T, url string, headers ...string) (*http.Response, func() (sseEvent, bool)) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	assert.NoError(t, err)
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+
+	reader := bufio.NewReader(resp.Body)
+	return resp, func() (sseEvent, bool) {
+		event := sseEvent{}
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return event, false
+			}
+			line = strings.TrimSuffix(line, "\n")
+			switch {
+			case line == "" && event.event != "":
+				return event, true
+			case strings.HasPrefix(line, "id: "):
+				event.id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				event.event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event.task)
+			}
+		}
+	}
+}
+
+func TestEvents(t *testing.T) {
+	accessLog, stdout := &syncBuffer{}, gin.DefaultWriter
+	gin.DefaultWriter = accessLog
+	defer func() { gin.DefaultWriter = stdout }()
+	url := startAPI(t)
+
+	t.Run("task stream ends after terminal state", func(t *testing.T) {
+		token := register(t, url)
+		id := createTask(t, url, token, "streamed")
+
+		resp, next := openEvents(t, url+"/v1/events?task_id="+id+"&access_token="+token)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+		event, ok := next()
+		assert.True(t, ok)
+		assert.Equal(t, "task", event.event)
+		assert.Equal(t, id, event.task["id"])
+		assert.Equal(t, storage.StatePending, event.task["state"])
+
+		resp, _ = call(t, http.MethodPost, url+"/v1/tasks/"+id+"/cancel", token, "")
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+		event, ok = next()
+		assert.True(t, ok)
+		assert.Equal(t, storage.StateCanceled, event.task["state"])
+
+		_, ok = next()
+		assert.False(t, ok)
+	})
+
+	t.Run("resume with Last-Event-ID", func(t *testing.T) {
+		token := register(t, url)
+		id := createTask(t, url, token, "resumed")
+
+		_, next := openEvents(t, url+"/v1/events?task_id="+id, "Authorization", "Bearer "+token)
+		first, _ := next()
+
+		assert.NoError(t, storage.ChangeStatus(id, "half way"))
+		resp, _ := call(t, http.MethodPost, url+"/v1/tasks/"+id+"/cancel", token, "")
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+		// после переподключения пропущенные изменения приходят одним
+		// событием с текущим состоянием задачи
+		_, next = openEvents(t, url+"/v1/events?task_id="+id, "Authorization", "Bearer "+token, "Last-Event-ID", first.id)
+		event, _ := next()
+		assert.Equal(t, storage.StateCanceled, event.task["state"])
+		assert.Equal(t, "canceled", event.task["status"])
+		_, ok := next()
+		assert.False(t, ok)
+	})
+
+	t.Run("Last-Event-ID from before restart gets snapshot", func(t *testing.T) {
+		token := register(t, url)
+		id := createTask(t, url, token, "restarted")
+
+		_, next := openEvents(t, url+"/v1/events?task_id="+id, "Authorization", "Bearer "+token, "Last-Event-ID", "999999999")
+		event, ok := next()
+		assert.True(t, ok)
+		assert.Equal(t, id, event.task["id"])
+		assert.Equal(t, storage.StatePending, event.task["state"])
+	})
+
+	t.Run("other user's task is forbidden", func(t *testing.T) {
+		id := createTask(t, url, register(t, url), "private stream")
+
+		resp, _ := openEvents(t, url+"/v1/events?task_id="+id+"&access_token="+register(t, url))
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+
+	t.Run("query token is not logged", func(t *testing.T) {
+		token := register(t, url)
+		id := createTask(t, url, token, "logged")
+
+		resp, _ := openEvents(t, url+"/v1/events?task_id="+id+"&access_token="+token)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		resp.Body.Close()
+
+		assert.Eventually(t, func() bool { return strings.Contains(accessLog.String(), "task_id="+id) }, time.Second, time.Millisecond)
+		assert.NotContains(t, accessLog.String(), token)
+	})
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"ioboundlimiter/internal/apierr"
+	"ioboundlimiter/internal/storage"
+	"ioboundlimiter/internal/webhook"
+	"ioboundlimiter/internal/workers"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Batch represents a batch of tasks
+// @Description Пакет задач, создаваемых одной группой
+type Batch struct {
+	Tasks []Task `json:"tasks" binding:"required,min=1,max=100,dive"`
+}
+
+// GroupID represents group identifier
+// @Description Идентификатор группы задач
+type GroupID struct {
+	GroupID string `json:"group_id" binding:"required" example:"6ba7b810-9dad-11d1-80b4-00c04fd430c8"`
+}
+
+// BatchHandle godoc
+//	@Summary		Добавить пакет задач
+//	@Description	Атомарно создает задачи одной группы: либо добавляются все, либо ни одной
+//	@Tags			groups
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			batch	body		Batch	true	"Задачи"
+//	@Success		200		{object}	object	"{"status":"access","group_id":"string","uuids":["string"]}"
+//	@Failure		400		{object}	apierr.Problem	"invalid_task, cost_exceeds_capacity"
+//	@Failure		401		{object}	apierr.Problem	"unauthorized, invalid_token"
+//	@Failure		503		{object}	apierr.Problem	"server_busy"
+//	@Router			/api/batch [post]
+func BatchHandle(c *gin.Context) {
+	batch := Batch{}
+	if err := c.ShouldBindJSON(&batch); err != nil {
+		log.Printf("ERROR: Validation error: %v", err)
+		apierr.Abort(c, apierr.ErrInvalidTask.Wrap(err).WithDetail("should contain from 1 to 100 tasks"))
+		return
+	}
+
+	items := make([]storage.BatchItem, 0, len(batch.Tasks))
+	for _, task := range batch.Tasks {
+		if err := workers.CheckCost(task.Cost); err != nil {
+			log.Printf("ERROR: %v", err)
+			apierr.Abort(c, err)
+			return
+		}
+		if err := workers.CheckType(task.Type); err != nil {
+			log.Printf("ERROR: %v", err)
+			apierr.Abort(c, err)
+			return
+		}
+		if task.Memoize {
+			apierr.Abort(c, apierr.ErrInvalidTask.WithDetail("memoize is not supported in batches"))
+			return
+		}
+		if err := webhook.CheckCallback(task.CallbackURL, task.CallbackSecret); err != nil {
+			log.Printf("ERROR: %v", err)
+			apierr.Abort(c, err)
+			return
+		}
+		items = append(items, storage.BatchItem{Name: task.TaskName, TaskOptions: task.options()})
+	}
+
+	groupID, uuids, err := storage.AddBatch(items, c.GetString("user_id"))
+	if err != nil {
+		log.Printf("ERROR: cannot create batch: %v", err)
+		apierr.Abort(c, err)
+		return
+	}
+
+	if err := workers.AddBatchToChannel(uuids); err != nil {
+		log.Printf("Server is busy: %v", err)
+		storage.DeleteTasks(uuids)
+		apierr.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":   "tasks are created",
+		"group_id": groupID,
+		"uuids":    uuids,
+	})
+}
+
+// GroupStatusHandle godoc
+//	@Summary		Статус группы задач
+//	@Description	Возвращает количество задач группы по состояниям, общий прогресс и первую ошибку
+//	@Tags			groups
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			group	body		GroupID	true	"ID группы"
+//	@Success		200		{object}	storage.GroupStatus
+//	@Failure		400		{object}	apierr.Problem	"bad_request"
+//	@Failure		401		{object}	apierr.Problem	"unauthorized, invalid_token"
+//	@Failure		403		{object}	apierr.Problem	"group_forbidden"
+//	@Failure		404		{object}	apierr.Problem	"group_not_found"
+//	@Router			/group/status [post]
+func GroupStatusHandle(c *gin.Context) {
+	group := GroupID{}
+	if err := c.ShouldBindJSON(&group); err != nil {
+		log.Printf("Bad request: should contain group_id: %v", err)
+		apierr.Abort(c, apierr.ErrBadRequest.Wrap(err).WithDetail("Bad request: should contain group_id"))
+		return
+	}
+
+	status, err := storage.GetGroupStatus(group.GroupID)
+	if err != nil {
+		log.Printf("Cannot get group status: %v", err)
+		apierr.Abort(c, err)
+		return
+	}
+
+	if status.Owner != c.GetString("user_id") {
+		log.Printf("User %s cannot see group %s", c.GetString("user_id"), group.GroupID)
+		apierr.Abort(c, apierr.ErrGroupForbidden)
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// GroupCancelHandle godoc
+//	@Summary		Отменить группу задач
+//	@Description	Отменяет все незавершенные задачи группы
+//	@Tags			groups
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			group	body		GroupID	true	"ID группы"
+//	@Success		200		{object}	object	"{"status":"access","canceled":0}"
+//	@Failure		400		{object}	apierr.Problem	"bad_request"
+//	@Failure		403		{object}	apierr.Problem	"group_forbidden"
+//	@Failure		404		{object}	apierr.Problem	"group_not_found"
+//	@Router			/api/group/cancel [post]
+func GroupCancelHandle(c *gin.Context) {
+	group := GroupID{}
+	if err := c.ShouldBindJSON(&group); err != nil {
+		log.Printf("Bad request: should contain group_id: %v", err)
+		apierr.Abort(c, apierr.ErrBadRequest.Wrap(err).WithDetail("Bad request: should contain group_id"))
+		return
+	}
+
+	status, err := storage.GetGroupStatus(group.GroupID)
+	if err != nil {
+		log.Printf("Cannot get group status: %v", err)
+		apierr.Abort(c, err)
+		return
+	}
+
+	if status.Owner != c.GetString("user_id") {
+		log.Printf("User %s cannot cancel group %s", c.GetString("user_id"), group.GroupID)
+		apierr.Abort(c, apierr.ErrGroupForbidden)
+		return
+	}
+
+	canceled := 0
+	for _, uuid := range storage.GroupTasks(group.GroupID) {
+		if err := workers.CancelTask(uuid); err != nil {
+			log.Printf("Task %s is not canceled: %v", uuid, err)
+			continue
+		}
+		canceled++
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":   "access",
+		"canceled": canceled,
+	})
+}
@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"encoding/json"
+	"ioboundlimiter/internal/apierr"
 	"ioboundlimiter/internal/auth"
 	"ioboundlimiter/internal/storage"
 	"ioboundlimiter/internal/util"
@@ -8,6 +10,7 @@ import (
 	"log"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -20,7 +23,41 @@ type Task struct {
     // Название задачи
     // @Example "Провести код-ревью"
     TaskName string `json:"taskname" binding:"required" example:"Какая то длинная io bound"`
+    // Вес задачи для семафора воркеров, по умолчанию 1
+    Cost int `json:"cost" binding:"omitempty,min=1" example:"1"`
+    // Тип задачи. Типы без локального исполнителя выполняются удаленными воркерами
+    Type string `json:"type" binding:"omitempty,max=64" example:"default"`
+    // Входные данные исполнителя
+    Payload json.RawMessage `json:"payload" swaggertype:"object"`
+    // Приоритет от -10 до 10: задачи с большим приоритетом выполняются раньше
+    Priority int `json:"priority" binding:"omitempty,min=-10,max=10" example:"0"`
+    // Время, раньше которого задача не начнет выполняться
+    ScheduledAt time.Time `json:"scheduled_at" example:"2026-01-02T15:04:05Z"`
+    // Метки задачи: до 16 штук, ключ до 64 символов, значение до 256
+    Labels map[string]string `json:"labels" binding:"omitempty,max=16,dive,keys,min=1,max=64,endkeys,max=256"`
+    // Адрес, на который придет подписанное уведомление о завершении задачи
+    CallbackURL string `json:"callback_url" binding:"omitempty,url" example:"https://example.com/hooks/tasks"`
+    // Секрет подписи уведомления, по умолчанию используется секрет сервиса
+    CallbackSecret string `json:"callback_secret"`
+    // Переиспользовать выполняющуюся или недавно завершенную задачу с тем же типом и payload
+    Memoize bool `json:"memoize" example:"false"`
+    // Сколько секунд переиспользовать результат, по умолчанию настройка сервиса
+    CacheTTL int `json:"cache_ttl" binding:"omitempty,min=1" example:"300"`
 }
+
+func (t Task) options() storage.TaskOptions {
+	return storage.TaskOptions{
+		Cost:           t.Cost,
+		Type:           t.Type,
+		Payload:        t.Payload,
+		Priority:       t.Priority,
+		ScheduledAt:    t.ScheduledAt,
+		Labels:         t.Labels,
+		CallbackURL:    t.CallbackURL,
+		CallbackSecret: t.CallbackSecret,
+	}
+}
+
 // AddHandle godoc
 //	@Summary		Добавить задачу
 //	@Description	Добавляет новую задачу в систему обработки
@@ -29,38 +66,56 @@ type Task struct {
 //	@Produce		json
 //	@Security		BearerAuth
 //	@Param			task	body		Task	true				"Данные задачи"
-//	@Success		200		{object}	object	"{"status":"access","uuid":"string"}"
-//	@Failure		400		{object}	object	"{"error":"should contain task"}"
-//	@Failure		500		{object}	object	"{"error":"server is busy"}"
+//	@Success		200		{object}	object	"{"status":"access","uuid":"string","cache_hit":false,"cache":"miss|hit|coalesced"}"
+//	@Failure		400		{object}	apierr.Problem	"invalid_task, cost_exceeds_capacity"
+//	@Failure		401		{object}	apierr.Problem	"unauthorized, invalid_token"
+//	@Failure		409		{object}	apierr.Problem	"memo_callback_conflict"
+//	@Failure		503		{object}	apierr.Problem	"server_busy"
+//	@Deprecated
 //	@Router			/api/add [post]
 func AddHandle(c *gin.Context) {
 	task := Task{}
 	if err := c.ShouldBindJSON(&task); err != nil {
 		log.Printf("ERROR: Validation error: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "should contain task"})
-		return
-	}
-
-	uuid, err := storage.AddToStorage(task.TaskName)
-	if err != nil {
-		log.Printf("ERROR: cannot create task: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot create task"})
+		apierr.Abort(c, apierr.ErrInvalidTask.Wrap(err))
 		return
 	}
 
-	if err := workers.AddToChannel(uuid); err != nil {
-		log.Printf("Server is busy: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "server is busy"})
+	uuid, memo, ok := submit(c, task)
+	if !ok {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	response := gin.H{
 		"status": "task is created",
 		"uuid":   uuid,
-	})
+	}
+	if task.Memoize {
+		response["cache_hit"] = memo != storage.MemoMiss
+		response["cache"] = memo
+	}
+	c.JSON(http.StatusOK, response)
 
 }
 
+// submit создает задачу и ставит ее в очередь. При ошибке сам отвечает клиенту.
+func submit(c *gin.Context, task Task) (string, string, bool) {
+	uuid, memo, err := createTask(task, c.GetString("user_id"))
+	if err != nil {
+		apierr.Abort(c, err)
+		return "", "", false
+	}
+	return uuid, memo, true
+}
+
+// createTask создает задачу владельца owner и ставит ее в очередь.
+// Возвращает UUID и результат мемоизации.
+func createTask(task Task, owner string) (string, string, error) {
+	opts := task.options()
+	opts.Owner = owner
+	return workers.Submit(task.TaskName, opts, task.Memoize, time.Duration(task.CacheTTL)*time.Second)
+}
+
 // TaskID represents task identifier
 // @Description Идентификатор задачи в формате UUID
 type TaskID struct {
@@ -71,34 +126,34 @@ type TaskID struct {
 
 // DeleteHandle godoc
 //	@Summary		Удалить задачу
-//	@Description	Удаляет задачу по UUID
+//	@Description	Удаляет задачу пользователя по UUID, незавершенная задача перед этим отменяется
 //	@Tags			tasks
 //	@Accept			json
 //	@Produce		json
 //	@Security		BearerAuth
 //	@Param			uuid	body		TaskID	true							"UUID задачи"
 //	@Success		200		{object}	object	"{"status":"access","deleted	task":"string"}"
-//	@Failure		400		{object}	object	"{"error":"string"}"
-//	@Failure		404		{object}	object	"{"status":"Not	found	current	task"}"
+//	@Failure		400		{object}	apierr.Problem	"bad_request"
+//	@Failure		403		{object}	apierr.Problem	"task_forbidden"
+//	@Failure		404		{object}	apierr.Problem	"task_not_found"
+//	@Deprecated
 //	@Router			/api/delete [delete]
 func DeleteHandle(c *gin.Context) {
 	uuid := TaskID{}
 
 	if err := c.ShouldBindJSON(&uuid); err != nil {
 		log.Printf("Bad request: should contain UUID: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Bad request: should contain UUID"})
+		apierr.Abort(c, apierr.ErrBadRequest.Wrap(err).WithDetail("Bad request: should contain UUID"))
 		return
 	}
 
-	if !storage.IsExists(uuid.UUID) {
-		log.Printf("Task with this UUID: %s doesnt exists", uuid.UUID)
-		c.JSON(http.StatusNoContent, gin.H{"status": "Not found current task"})
+	status, ok := loadOwnTask(c, uuid.UUID)
+	if !ok {
 		return
 	}
 
-	if err := storage.DeleteTask(uuid.UUID); err != nil {
-		log.Printf("Task with this UUID doesnt exists")
-		c.JSON(http.StatusNoContent, gin.H{"error": "Task with this UUID doesnt exists"})
+	if err := deleteTask(uuid.UUID, status); err != nil {
+		apierr.Abort(c, err)
 		return
 	}
 
@@ -111,46 +166,47 @@ func DeleteHandle(c *gin.Context) {
 
 // GetHandle godoc
 //	@Summary		Получить статус задачи
-//	@Description	Возвращает текущий статус задачи
+//	@Description	Возвращает текущий статус задачи без результата, ошибки и прогресса: они доступны владельцу через /v1/tasks/{id}
 //	@Tags			tasks
 //	@Accept			json
 //	@Produce		json
 //	@Param			uuid	body		TaskID	true	"UUID задачи"
-//	@Success		200		{object}	object	"{"status":"access", "task name": "string", "createdAt": date, "current status": "string", "working time": "diff time" }"
-//	@Success		204		{object}	object	"{"status":"not found task"}"
-//	@Failure		400		{object}	object	"{"error":"Bad request: should contain UUID"}"
-//	@Failure		404		{object}	object	"{"error":"Not	found	current	task"}"
+//	@Success		200		{object}	object	"{"status":"access", "state": "string", "task name": "string", "createdAt": date, "current status": "string", "working time": "diff time", "heartbeat age": "diff time" }"
+//	@Failure		400		{object}	apierr.Problem	"bad_request"
+//	@Failure		404		{object}	apierr.Problem	"task_not_found"
+//	@Deprecated
 //	@Router			/status [post]
 func GetHandle(c *gin.Context) {
 	uuid := TaskID{}
 
 	if err := c.ShouldBindJSON(&uuid); err != nil {
 		log.Printf("Bad request: should contain UUID: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Bad request: should contain UUID"})
-		return
-	}
-
-	if !storage.IsExists(uuid.UUID) {
-		log.Printf("Task with this UUID: %s doesnt exists", uuid.UUID)
-		c.JSON(http.StatusNotFound, gin.H{"error": "Not found current task"})
+		apierr.Abort(c, apierr.ErrBadRequest.Wrap(err).WithDetail("Bad request: should contain UUID"))
 		return
 	}
 
 	status, err := storage.GetResponse(uuid.UUID)
-
 	if err != nil {
 		log.Printf("Task with this UUID: %s doesnt exists: %v", uuid.UUID, err)
-		c.JSON(http.StatusNoContent, gin.H{"status": "not found task"})
+		apierr.Abort(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	response := gin.H{
 		"status":         "access",
+		"state":          status.State,
 		"task name":      status.Name,
 		"created at":     status.DateOutput,
 		"current status": status.CurStatus,
 		"working time":   util.DifferenceTime(status.DateCreate),
-	})
+	}
+	// маршрут без авторизации: результат, ошибка и прогресс доступны только
+	// владельцу через /v1/tasks/{id}
+	if !status.Heartbeat.IsZero() {
+		response["heartbeat age"] = util.DifferenceTime(status.Heartbeat)
+	}
+
+	c.JSON(http.StatusOK, response)
 }
 
 type RefreshRequest struct {
@@ -160,23 +216,23 @@ type RefreshRequest struct {
 }
 // RefreshHandler godoc
 //	@Summary		Обновить токены
-//	@Description	Обновляет пару access и refresh токенов
+//	@Description	Обновляет пару access и refresh токенов. Access токен в заголовке может быть истекшим
 //	@Tags			auth
 //	@Accept			json
 //	@Produce		json
 //	@Security		BearerAuth
 //	@Param			refresh	body		RefreshRequest	true	"Refresh токен"
 //	@Success		200		{object}	object	"{"status":"string"}"
-//	@Failure		400		{object}	object	"{"error":"string"}"
-//	@Failure		401		{object}	object	"{"error":"invalid	authorization	format"}"
-//	@Failure		500		{object}	object	"{"error":"string"}"
+//	@Failure		400		{object}	apierr.Problem	"bad_request"
+//	@Failure		401		{object}	apierr.Problem	"unauthorized, invalid_token"
+//	@Failure		500		{object}	apierr.Problem	"internal"
 //	@Router			/api/refresh [post]
 func RefreshHandler(c *gin.Context) {
 
 	refresh := RefreshRequest{}
 	if err := c.ShouldBindJSON(&refresh); err != nil {
 		log.Printf("Should contain refresh token: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Should contain refresh token"})
+		apierr.Abort(c, apierr.ErrBadRequest.Wrap(err).WithDetail("Should contain refresh token"))
 		return
 	}
 
@@ -185,43 +241,16 @@ func RefreshHandler(c *gin.Context) {
 	tokenParts := strings.Split(authHeader, " ")
 	if len(tokenParts) != 2 || tokenParts[0] != "Bearer" {
 		log.Printf("invalid authorization format")
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid authorization format"})
+		apierr.Abort(c, apierr.ErrUnauthorized.WithDetail("invalid authorization format"))
 		return
 	}
 	accessToken := tokenParts[1]
 
-	userID, err := auth.ValidateTokenPair(accessToken, refresh.Refresh)
-
-	if err != nil {
-		log.Printf("Cannot validate tokens: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot validate tokens"})
-		return
-	}
-
-	// check in BD tokens
-	if err := auth.CheckTokensExists(accessToken, refresh.Refresh); err != nil {
-		log.Printf("Cannot find tokens in BD: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot find tokens in BD"})
-		return
-	}
-
-	if err := auth.DeleteTokens(accessToken, refresh.Refresh); err != nil {
-		log.Printf("Cannot delete tokens: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot delete tokens"})
-		return
-	}
-
-	newAccess, newRefresh, err := auth.GenerateTokens(userID)
-
+	// истекшую или уже обновленную пару нужно получить заново - это 401, а не ошибка сервера
+	_, newAccess, newRefresh, err := auth.RotateTokens(accessToken, refresh.Refresh)
 	if err != nil {
-		log.Printf("Cannot generate tokens: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot generate tokens"})
-		return
-	}
-
-	if err := auth.AddTokensToBd(newAccess, newRefresh); err != nil {
-		log.Printf("Cannot add tokens to BD: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot add tokens to BD"})
+		log.Printf("Cannot refresh tokens: %v", err)
+		apierr.Abort(c, err)
 		return
 	}
 
@@ -239,7 +268,7 @@ func RefreshHandler(c *gin.Context) {
 //	@Accept			json
 //	@Produce		json
 //	@Success		200	{object}	object	"{"status":"string"}"
-//	@Failure		500	{object}	object	"{"error":"string"}"
+//	@Failure		500	{object}	apierr.Problem	"internal"
 //	@Router			/register [get]
 func RegisterHandler(c *gin.Context) {
 	UserID := uuid.New().String()
@@ -248,13 +277,13 @@ func RegisterHandler(c *gin.Context) {
 
 	if err != nil {
 		log.Printf("Cannot create jwt tokens: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot create tokens"})
+		apierr.Abort(c, err)
 		return
 	}
 
 	if err := auth.AddTokensToBd(access, refresh); err != nil {
 		log.Printf("Cannot add tokens to BD: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot add tokens"})
+		apierr.Abort(c, err)
 		return
 	}
 
@@ -266,3 +295,15 @@ func RegisterHandler(c *gin.Context) {
 	})
 
 }
+
+// QueueHandle godoc
+//	@Summary		Состояние очереди
+//	@Description	Возвращает длину очереди, количество выполняемых задач и текущий лимит конкурентности
+//	@Tags			tasks
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Success		200	{object}	workers.QueueStatus
+//	@Router			/api/queue [get]
+func QueueHandle(c *gin.Context) {
+	c.JSON(http.StatusOK, workers.GetQueueStatus())
+}
@@ -0,0 +1,78 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"ioboundlimiter/internal/storage"
+	"ioboundlimiter/internal/workers"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLegacy(t *testing.T) {
+	url := startAPI(t)
+
+	t.Run("status hides result from anonymous callers", func(t *testing.T) {
+		token := register(t, url)
+		id := createTask(t, url, token, "legacy status")
+		assert.NoError(t, storage.SetProgress(id, 1, 2))
+		assert.NoError(t, storage.FailTask(id, "secret error", ""))
+		assert.NoError(t, storage.SetResult(id, json.RawMessage(`{"secret": true}`)))
+
+		resp, body := call(t, http.MethodPost, url+"/status", "", `{"uuid": "`+id+`"}`)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, storage.StateFailed, body["state"])
+		assert.Equal(t, "legacy status", body["task name"])
+		assert.NotContains(t, body, "result")
+		assert.NotContains(t, body, "error")
+		assert.NotContains(t, body, "progress")
+		assert.Equal(t, "true", resp.Header.Get("Deprecation"))
+	})
+
+	t.Run("group status requires the owner", func(t *testing.T) {
+		owner, other := register(t, url), register(t, url)
+		resp, body := call(t, http.MethodPost, url+"/api/batch", owner, `{"tasks": [{"taskname": "grouped", "type": "`+remoteType+`"}]}`)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		group := `{"group_id": "` + body["group_id"].(string) + `"}`
+
+		resp, body = call(t, http.MethodPost, url+"/group/status", owner, group)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.EqualValues(t, 1, body["total"])
+
+		resp, body = call(t, http.MethodPost, url+"/group/status", other, group)
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+		assert.Equal(t, "group_forbidden", body["code"])
+
+		resp, _ = call(t, http.MethodPost, url+"/group/status", "", group)
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+		resp, body = call(t, http.MethodPost, url+"/group/status", owner, `{"group_id": "missing"}`)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+		assert.Equal(t, "group_not_found", body["code"])
+	})
+
+	t.Run("delete requires the owner and cancels the task", func(t *testing.T) {
+		owner, other := register(t, url), register(t, url)
+		id := createTask(t, url, owner, "legacy delete")
+		task := `{"uuid": "` + id + `"}`
+
+		resp, body := call(t, http.MethodDelete, url+"/api/delete", other, task)
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+		assert.Equal(t, "task_forbidden", body["code"])
+		_, err := storage.GetResponse(id)
+		assert.NoError(t, err)
+
+		// задача ждет удаленного воркера: удаление снимает ее с очереди
+		queued := workers.Introspect().RemotePendingByType[remoteType]
+		resp, _ = call(t, http.MethodDelete, url+"/api/delete", owner, task)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		_, err = storage.GetResponse(id)
+		assert.Error(t, err)
+		assert.Equal(t, queued-1, workers.Introspect().RemotePendingByType[remoteType])
+
+		resp, body = call(t, http.MethodDelete, url+"/api/delete", owner, task)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+		assert.Equal(t, "task_not_found", body["code"])
+	})
+}
@@ -0,0 +1,89 @@
+package handlers_test
+
+import (
+	"ioboundlimiter/internal/auth"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// expiredPair выдает пользователю пару токенов, access токен которой уже
+// истек. Часы сервиса не трогаем: по ним работают воркеры запущенного API.
+func expiredPair(t *testing.T, userID string) (string, string) {
+	_, refresh, err := auth.GenerateTokens(userID)
+	assert.NoError(t, err)
+
+	claims := auth.Claims{
+		UserID: userID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Minute)),
+		},
+	}
+	access, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(auth.SigningKey))
+	assert.NoError(t, err)
+
+	assert.NoError(t, auth.AddTokensToBd(access, refresh))
+	return access, refresh
+}
+
+func TestRefresh(t *testing.T) {
+	url := startAPI(t)
+
+	t.Run("expired access token is refreshed", func(t *testing.T) {
+		access, refresh := expiredPair(t, "refreshed user")
+
+		// остальные маршруты /api истекший токен не пускает
+		resp, body := call(t, http.MethodGet, url+"/api/queue", access, "")
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+		assert.Equal(t, "invalid_token", body["code"])
+
+		resp, body = call(t, http.MethodPost, url+"/api/refresh", access, `{"refresh":"`+refresh+`"}`)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		newAccess, _ := body["access"].(string)
+		assert.NotEmpty(t, newAccess)
+		assert.NotEmpty(t, body["refresh"])
+
+		resp, _ = call(t, http.MethodGet, url+"/api/queue", newAccess, "")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("pair is refreshed once", func(t *testing.T) {
+		access, refresh := expiredPair(t, "refreshed user")
+
+		resp, _ := call(t, http.MethodPost, url+"/api/refresh", access, `{"refresh":"`+refresh+`"}`)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		resp, body := call(t, http.MethodPost, url+"/api/refresh", access, `{"refresh":"`+refresh+`"}`)
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+		assert.Equal(t, "invalid_token", body["code"])
+	})
+
+	t.Run("tokens of different users", func(t *testing.T) {
+		access, _ := expiredPair(t, "first user")
+		_, refresh := expiredPair(t, "second user")
+
+		resp, _ := call(t, http.MethodPost, url+"/api/refresh", access, `{"refresh":"`+refresh+`"}`)
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+
+	t.Run("requires access token", func(t *testing.T) {
+		_, refresh := expiredPair(t, "refreshed user")
+
+		resp, body := call(t, http.MethodPost, url+"/api/refresh", "", `{"refresh":"`+refresh+`"}`)
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+		assert.Equal(t, "unauthorized", body["code"])
+	})
+
+	t.Run("requires refresh token", func(t *testing.T) {
+		access, _ := expiredPair(t, "refreshed user")
+
+		resp, body := call(t, http.MethodPost, url+"/api/refresh", access, `{}`)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Equal(t, "bad_request", body["code"])
+	})
+}
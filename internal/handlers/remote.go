@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"encoding/json"
+	"ioboundlimiter/internal/apierr"
+	"ioboundlimiter/internal/workers"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LeaseRequest represents a lease request of remote worker
+// @Description Запрос удаленного воркера на получение задач
+type LeaseRequest struct {
+	// Типы задач, которые умеет выполнять воркер
+	Types []string `json:"types" binding:"required,min=1" example:"http"`
+	// Сколько секунд задача невидима для других воркеров, по умолчанию 60
+	VisibilityTimeout int `json:"visibility_timeout" binding:"omitempty,min=1,max=3600" example:"60"`
+	// Сколько задач выдать за раз, по умолчанию 1
+	Max int `json:"max" binding:"omitempty,min=1,max=10" example:"1"`
+}
+
+// LeaseHeartbeat represents a lease extension
+// @Description Продление аренды задачи
+type LeaseHeartbeat struct {
+	LeaseID           string `json:"lease_id" binding:"required" example:"6ba7b810-9dad-11d1-80b4-00c04fd430c8"`
+	VisibilityTimeout int    `json:"visibility_timeout" binding:"omitempty,min=1,max=3600" example:"60"`
+}
+
+// LeaseAck represents a result of leased task
+// @Description Результат выполнения арендованной задачи
+type LeaseAck struct {
+	LeaseID string          `json:"lease_id" binding:"required" example:"6ba7b810-9dad-11d1-80b4-00c04fd430c8"`
+	Success bool            `json:"success"`
+	Error   string          `json:"error" example:"connection refused"`
+	Result  json.RawMessage `json:"result" swaggertype:"object"`
+}
+
+// LeaseHandle godoc
+//	@Summary		Взять задачи в аренду
+//	@Description	Выдает удаленному воркеру задачи указанных типов на время visibility timeout
+//	@Tags			remote workers
+//	@Accept			json
+//	@Produce		json
+//	@Param			X-Worker-Token	header		string			true	"Токен удаленного воркера"
+//	@Param			lease			body		LeaseRequest	true	"Параметры аренды"
+//	@Success		200				{object}	object			"{"status":"access","leases":[]}"
+//	@Failure		400				{object}	apierr.Problem	"bad_request"
+//	@Failure		401				{object}	apierr.Problem	"invalid_worker_token"
+//	@Failure		403				{object}	apierr.Problem	"worker_api_disabled"
+//	@Router			/worker/lease [post]
+func LeaseHandle(c *gin.Context) {
+	req := LeaseRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Printf("Bad lease request: %v", err)
+		apierr.Abort(c, apierr.ErrBadRequest.Wrap(err).WithDetail("should contain task types"))
+		return
+	}
+
+	leases := workers.LeaseTasks(c.GetString("worker_id"), req.Types, time.Duration(req.VisibilityTimeout)*time.Second, req.Max)
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "access",
+		"leases": leases,
+	})
+}
+
+// LeaseHeartbeatHandle godoc
+//	@Summary		Продлить аренду
+//	@Description	Продлевает аренду задачи на visibility timeout от текущего момента
+//	@Tags			remote workers
+//	@Accept			json
+//	@Produce		json
+//	@Param			X-Worker-Token	header		string			true	"Токен удаленного воркера"
+//	@Param			heartbeat		body		LeaseHeartbeat	true	"Аренда"
+//	@Success		200				{object}	object			"{"status":"access","expires_at":"string"}"
+//	@Failure		400				{object}	apierr.Problem	"bad_request"
+//	@Failure		401				{object}	apierr.Problem	"invalid_worker_token"
+//	@Failure		403				{object}	apierr.Problem	"lease_forbidden, worker_api_disabled"
+//	@Failure		404				{object}	apierr.Problem	"lease_not_found"
+//	@Router			/worker/heartbeat [post]
+func LeaseHeartbeatHandle(c *gin.Context) {
+	req := LeaseHeartbeat{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Printf("Bad heartbeat request: %v", err)
+		apierr.Abort(c, apierr.ErrBadRequest.Wrap(err).WithDetail("should contain lease_id"))
+		return
+	}
+
+	expiresAt, err := workers.ExtendLease(c.GetString("worker_id"), req.LeaseID, time.Duration(req.VisibilityTimeout)*time.Second)
+	if err != nil {
+		leaseError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":     "access",
+		"expires_at": expiresAt,
+	})
+}
+
+// LeaseAckHandle godoc
+//	@Summary		Подтвердить выполнение
+//	@Description	Завершает аренду: задача становится done или failed
+//	@Tags			remote workers
+//	@Accept			json
+//	@Produce		json
+//	@Param			X-Worker-Token	header		string			true	"Токен удаленного воркера"
+//	@Param			ack				body		LeaseAck		true	"Результат"
+//	@Success		200				{object}	object			"{"status":"access"}"
+//	@Failure		400				{object}	apierr.Problem	"bad_request"
+//	@Failure		401				{object}	apierr.Problem	"invalid_worker_token"
+//	@Failure		403				{object}	apierr.Problem	"lease_forbidden, worker_api_disabled"
+//	@Failure		404				{object}	apierr.Problem	"lease_not_found"
+//	@Router			/worker/ack [post]
+func LeaseAckHandle(c *gin.Context) {
+	req := LeaseAck{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Printf("Bad ack request: %v", err)
+		apierr.Abort(c, apierr.ErrBadRequest.Wrap(err).WithDetail("should contain lease_id"))
+		return
+	}
+
+	if err := workers.AckLease(c.GetString("worker_id"), req.LeaseID, req.Success, req.Error, req.Result); err != nil {
+		leaseError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "access"})
+}
+
+func leaseError(c *gin.Context, err error) {
+	log.Printf("Lease error: %v", err)
+	apierr.Abort(c, err)
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"bytes"
+	"ioboundlimiter/internal/apierr"
+	"ioboundlimiter/internal/storage"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ResultHandle godoc
+//	@Summary		Результат задачи
+//	@Description	Отдает результат завершенной задачи с его типом содержимого. Поддерживает заголовок Range для больших результатов.
+//	@Description	Для failed и canceled задач возвращает объект ошибки. Доступен только владельцу задачи.
+//	@Tags			tasks
+//	@Security		BearerAuth
+//	@Produce		json
+//	@Produce		octet-stream
+//	@Param			uuid	path		string	true	"UUID задачи"
+//	@Param			Range	header		string	false	"Диапазон байт, например bytes=0-1023"
+//	@Success		200		{file}		file	"Результат задачи"
+//	@Success		204		"Задача завершилась без результата"
+//	@Success		206		{file}		file	"Часть результата"
+//	@Failure		401		{object}	apierr.Problem	"unauthorized, invalid_token"
+//	@Failure		403		{object}	apierr.Problem	"task_forbidden"
+//	@Failure		404		{object}	apierr.Problem	"task_not_found"
+//	@Failure		409		{object}	apierr.Problem	"result_not_ready, с полем state"
+//	@Failure		422		{object}	apierr.Problem	"task_failed, с полями state, error (ошибка задачи) и result"
+//	@Deprecated
+//	@Router			/result/{uuid} [get]
+func ResultHandle(c *gin.Context) {
+	uuid := c.Param("uuid")
+
+	status, ok := loadOwnTask(c, uuid)
+	if !ok {
+		return
+	}
+
+	serveResult(c, uuid, status)
+}
+
+func serveResult(c *gin.Context, uuid string, status storage.Status) {
+	if !storage.IsTerminal(status.State) {
+		apierr.Abort(c, apierr.ErrNotReady.With("state", status.State))
+		return
+	}
+
+	c.Header("X-Task-State", status.State)
+
+	if status.State != storage.StateDone {
+		apiErr := apierr.ErrTaskFailed.With("state", status.State).With("error", status.ErrorInfo())
+		if status.Result != nil {
+			apiErr = apiErr.With("result", status.Result)
+		}
+		apierr.Abort(c, apiErr)
+		return
+	}
+
+	switch {
+	case status.Blob != nil:
+		blob, modTime, err := storage.OpenBlob(uuid)
+		if err != nil {
+			log.Printf("Cannot open result of task %s: %v", uuid, err)
+			apierr.Abort(c, err)
+			return
+		}
+		defer blob.Close()
+
+		c.Header("Content-Type", status.Blob.ContentType)
+		http.ServeContent(c.Writer, c.Request, "", modTime, blob)
+	case status.Result != nil:
+		c.Header("Content-Type", "application/json")
+		http.ServeContent(c.Writer, c.Request, "", status.FinishedAt, bytes.NewReader(status.Result))
+	default:
+		c.Status(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,554 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"ioboundlimiter/internal/apierr"
+	"ioboundlimiter/internal/clock"
+	"ioboundlimiter/internal/storage"
+	"ioboundlimiter/internal/workers"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TaskView represents task resource
+// @Description Задача в API v1
+type TaskView struct {
+	ID         string             `json:"id" example:"6ba7b810-9dad-11d1-80b4-00c04fd430c8"`
+	Name       string             `json:"name"`
+	Type       string             `json:"type" example:"default"`
+	State      string             `json:"state" example:"running"`
+	Status     string             `json:"status"`
+	Cost       int                `json:"cost" example:"1"`
+	Priority   int                `json:"priority" example:"0"`
+	Version    int                `json:"version" example:"1"`
+	GroupID    string             `json:"group_id,omitempty"`
+	Labels     map[string]string  `json:"labels,omitempty"`
+	Payload    json.RawMessage    `json:"payload,omitempty" swaggertype:"object"`
+	CreatedAt  time.Time          `json:"created_at"`
+	Scheduled  *time.Time         `json:"scheduled_at,omitempty"`
+	FinishedAt *time.Time         `json:"finished_at,omitempty"`
+	Heartbeat  *time.Time         `json:"heartbeat,omitempty"`
+	Progress   *storage.Progress  `json:"progress,omitempty"`
+	Error      *storage.TaskError `json:"error,omitempty"`
+	Result     json.RawMessage    `json:"result,omitempty" swaggertype:"object"`
+	Blob       *storage.BlobInfo  `json:"blob,omitempty"`
+}
+
+func newTaskView(uuid string, status storage.Status) TaskView {
+	view := TaskView{
+		ID:        uuid,
+		Name:      status.Name,
+		Type:      status.Type,
+		State:     status.State,
+		Status:    status.CurStatus,
+		Cost:      status.Cost,
+		Priority:  status.Priority,
+		GroupID:   status.GroupID,
+		Labels:    status.Labels,
+		Payload:   status.Payload,
+		CreatedAt: status.DateCreate,
+		Version:   status.Version,
+		Progress:  status.Progress,
+		Error:     status.ErrorInfo(),
+		Result:    status.Result,
+		Blob:      status.Blob,
+	}
+	if !status.FinishedAt.IsZero() {
+		view.FinishedAt = &status.FinishedAt
+	}
+	if !status.Heartbeat.IsZero() {
+		view.Heartbeat = &status.Heartbeat
+	}
+	if !status.ScheduledAt.IsZero() {
+		view.Scheduled = &status.ScheduledAt
+	}
+	return view
+}
+
+// etag - ETag задачи по ее версии
+func etag(status storage.Status) string {
+	return `"` + strconv.Itoa(status.Version) + `"`
+}
+
+// ifMatch разбирает заголовок If-Match: "3", W/"3" или *.
+// 0 - версию не проверять.
+func ifMatch(c *gin.Context) (int, error) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" || header == "*" {
+		return 0, nil
+	}
+
+	version, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(header, "W/"), `"`))
+	if err != nil || version < 1 {
+		return 0, fmt.Errorf("invalid If-Match %q", header)
+	}
+	return version, nil
+}
+
+// TaskList represents page of tasks
+// @Description Страница списка задач
+type TaskList struct {
+	Tasks  []TaskView `json:"tasks"`
+	Total  int        `json:"total"`
+	Limit  int        `json:"limit"`
+	Offset int        `json:"offset"`
+}
+
+// TaskFilter - фильтры задач, общие для списка и массовых операций
+type TaskFilter struct {
+	// Состояния через запятую
+	State   string `form:"state" json:"state" example:"pending,running"`
+	Type    string `form:"type" json:"type"`
+	GroupID string `form:"group_id" json:"group_id"`
+	// Подстрока названия
+	Name          string    `form:"name" json:"name"`
+	CreatedAfter  time.Time `form:"created_after" json:"created_after" time_format:"2006-01-02T15:04:05Z07:00"`
+	CreatedBefore time.Time `form:"created_before" json:"created_before" time_format:"2006-01-02T15:04:05Z07:00"`
+}
+
+func (f TaskFilter) filter(owner string) storage.Filter {
+	filter := storage.Filter{
+		Owner:         owner,
+		Type:          f.Type,
+		GroupID:       f.GroupID,
+		Name:          f.Name,
+		CreatedAfter:  f.CreatedAfter,
+		CreatedBefore: f.CreatedBefore,
+	}
+	if f.State != "" {
+		filter.States = strings.Split(f.State, ",")
+	}
+	return filter
+}
+
+// ListQuery - фильтры списка задач
+type ListQuery struct {
+	TaskFilter
+	Limit  int `form:"limit" binding:"omitempty,min=1,max=500" example:"50"`
+	Offset int `form:"offset" binding:"omitempty,min=0"`
+}
+
+const defaultListLimit = 50
+
+const defaultWaitTimeout = 30
+
+// WaitQuery - параметры ожидания задачи
+type WaitQuery struct {
+	// Сколько секунд ждать завершения
+	Timeout int `form:"timeout" binding:"omitempty,min=1,max=120" example:"30"`
+}
+
+// ownTask загружает задачу из пути и проверяет, что она принадлежит пользователю.
+// При ошибке сам отвечает клиенту.
+func ownTask(c *gin.Context) (string, storage.Status, bool) {
+	uuid := c.Param("id")
+	status, ok := loadOwnTask(c, uuid)
+	return uuid, status, ok
+}
+
+// loadOwnTask - ownTask для задачи, UUID которой пришел не в пути
+func loadOwnTask(c *gin.Context, uuid string) (storage.Status, bool) {
+	status, err := storage.GetOwned(uuid, c.GetString("user_id"))
+	if err != nil {
+		log.Printf("User %s cannot access task %s: %v", c.GetString("user_id"), uuid, err)
+		apierr.Abort(c, err)
+		return storage.Status{}, false
+	}
+
+	return status, true
+}
+
+// CreateTaskHandle godoc
+//
+//	@Summary		Создать задачу
+//	@Description	Создает задачу и ставит ее в очередь. Для memoize при попадании в кэш возвращает существующую задачу с кодом 200 и заголовком X-Cache
+//	@Tags			v1
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			task	body		Task	true	"Данные задачи"
+//	@Success		201		{object}	TaskView
+//	@Success		200		{object}	TaskView	"Существующая задача (memoize)"
+//	@Header			201		{string}	Location	"/v1/tasks/{id}"
+//	@Header			201		{string}	ETag		"Версия задачи"
+//	@Failure		400		{object}	apierr.Problem	"invalid_task, cost_exceeds_capacity"
+//	@Failure		401		{object}	apierr.Problem	"unauthorized, invalid_token"
+//	@Failure		409		{object}	apierr.Problem	"memo_callback_conflict"
+//	@Failure		503		{object}	apierr.Problem	"server_busy"
+//	@Router			/v1/tasks [post]
+func CreateTaskHandle(c *gin.Context) {
+	task := Task{}
+	if err := c.ShouldBindJSON(&task); err != nil {
+		log.Printf("ERROR: Validation error: %v", err)
+		apierr.Abort(c, apierr.ErrInvalidTask.Wrap(err))
+		return
+	}
+
+	uuid, memo, ok := submit(c, task)
+	if !ok {
+		return
+	}
+
+	status, err := storage.GetResponse(uuid)
+	if err != nil {
+		log.Printf("Task %s disappeared after creation: %v", uuid, err)
+		apierr.Abort(c, err)
+		return
+	}
+
+	code := http.StatusCreated
+	if task.Memoize {
+		c.Header("X-Cache", memo)
+		if memo != storage.MemoMiss {
+			code = http.StatusOK
+		}
+	}
+	c.Header("Location", "/v1/tasks/"+uuid)
+	c.Header("ETag", etag(status))
+	c.JSON(code, newTaskView(uuid, status))
+}
+
+// ListTasksHandle godoc
+//
+//	@Summary		Список задач
+//	@Description	Задачи пользователя в порядке создания с фильтрами и постраничным выводом
+//	@Tags			v1
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			query	query		ListQuery	false	"Фильтры"
+//	@Success		200		{object}	TaskList
+//	@Failure		400		{object}	apierr.Problem	"bad_request"
+//	@Failure		401		{object}	apierr.Problem	"unauthorized, invalid_token"
+//	@Router			/v1/tasks [get]
+func ListTasksHandle(c *gin.Context) {
+	query := ListQuery{}
+	if err := c.ShouldBindQuery(&query); err != nil {
+		log.Printf("Invalid filters: %v", err)
+		apierr.Abort(c, apierr.ErrBadRequest.Wrap(err).WithDetail("invalid filters"))
+		return
+	}
+	if query.Limit == 0 {
+		query.Limit = defaultListLimit
+	}
+
+	records, total := storage.ListTasks(query.filter(c.GetString("user_id")), query.Offset, query.Limit)
+
+	list := TaskList{Tasks: make([]TaskView, 0, len(records)), Total: total, Limit: query.Limit, Offset: query.Offset}
+	for _, record := range records {
+		list.Tasks = append(list.Tasks, newTaskView(record.UUID, record.Status))
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// GetTaskHandle godoc
+//
+//	@Summary		Получить задачу
+//	@Tags			v1
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			id	path		string	true	"UUID задачи"
+//	@Success		200	{object}	TaskView
+//	@Header			200	{string}	ETag	"Версия задачи для If-Match"
+//	@Failure		403	{object}	apierr.Problem	"task_forbidden"
+//	@Failure		404	{object}	apierr.Problem	"task_not_found"
+//	@Router			/v1/tasks/{id} [get]
+func GetTaskHandle(c *gin.Context) {
+	uuid, status, ok := ownTask(c)
+	if !ok {
+		return
+	}
+
+	c.Header("ETag", etag(status))
+	c.JSON(http.StatusOK, newTaskView(uuid, status))
+}
+
+// TaskPatch - изменения ожидающей задачи, отсутствующие поля не меняются
+type TaskPatch struct {
+	Name *string `json:"name" binding:"omitempty,min=1"`
+	// Приоритет от -10 до 10
+	Priority *int `json:"priority" binding:"omitempty,min=-10,max=10" example:"5"`
+	// Новое время запуска, прошедшее время - запустить как можно скорее
+	ScheduledAt *time.Time `json:"scheduled_at" example:"2026-01-02T15:04:05Z"`
+	// Заменяют все метки задачи, {} - удалить метки
+	Labels  map[string]string `json:"labels" binding:"omitempty,max=16,dive,keys,min=1,max=64,endkeys,max=256"`
+	Payload json.RawMessage   `json:"payload" swaggertype:"object"`
+}
+
+func (p TaskPatch) patch() storage.TaskPatch {
+	return storage.TaskPatch{
+		Name:        p.Name,
+		Priority:    p.Priority,
+		ScheduledAt: p.ScheduledAt,
+		Labels:      p.Labels,
+		Payload:     p.Payload,
+	}
+}
+
+func (p TaskPatch) empty() bool {
+	return p.Name == nil && p.Priority == nil && p.ScheduledAt == nil && p.Labels == nil && p.Payload == nil
+}
+
+// PatchTaskHandle godoc
+//
+//	@Summary		Изменить задачу
+//	@Description	Меняет название, приоритет, время запуска, метки или payload задачи, которая еще не начала выполняться.
+//	@Description	С заголовком If-Match задача меняется, только если ее версия (ETag) совпадает с переданной.
+//	@Tags			v1
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			id			path		string		true	"UUID задачи"
+//	@Param			If-Match	header		string		false	"ETag задачи, например \"3\""
+//	@Param			patch		body		TaskPatch	true	"Изменения"
+//	@Success		200			{object}	TaskView
+//	@Header			200			{string}	ETag	"Новая версия задачи"
+//	@Failure		400			{object}	apierr.Problem	"bad_request"
+//	@Failure		403			{object}	apierr.Problem	"task_forbidden"
+//	@Failure		404			{object}	apierr.Problem	"task_not_found"
+//	@Failure		409			{object}	apierr.Problem	"task_started или task_finished, с полем state"
+//	@Failure		412			{object}	apierr.Problem	"version_mismatch, с полем version"
+//	@Router			/v1/tasks/{id} [patch]
+func PatchTaskHandle(c *gin.Context) {
+	req := TaskPatch{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Printf("Invalid task patch: %v", err)
+		apierr.Abort(c, apierr.ErrBadRequest.Wrap(err).WithDetail("invalid patch"))
+		return
+	}
+	if req.empty() {
+		apierr.Abort(c, apierr.ErrBadRequest.WithDetail("patch is empty"))
+		return
+	}
+	if req.Payload != nil && !json.Valid(req.Payload) {
+		apierr.Abort(c, apierr.ErrBadRequest.WithDetail("payload is not valid JSON"))
+		return
+	}
+	version, err := ifMatch(c)
+	if err != nil {
+		apierr.Abort(c, apierr.ErrBadRequest.Wrap(err).WithDetail(err.Error()))
+		return
+	}
+
+	uuid, _, ok := ownTask(c)
+	if !ok {
+		return
+	}
+
+	status, err := storage.UpdatePending(uuid, version, req.patch())
+	if err != nil {
+		log.Printf("Task %s is not updated: %v", uuid, err)
+		current, _ := storage.GetResponse(uuid)
+		switch {
+		case errors.Is(err, storage.ErrStateConflict) && storage.IsTerminal(current.State):
+			apierr.Abort(c, apierr.ErrTaskFinished.Wrap(err).With("state", current.State))
+		case errors.Is(err, storage.ErrStateConflict):
+			apierr.Abort(c, apierr.ErrTaskStarted.Wrap(err).With("state", current.State))
+		case errors.Is(err, storage.ErrVersionMismatch):
+			c.Header("ETag", etag(current))
+			apierr.Abort(c, apierr.ErrStaleVersion.Wrap(err).With("version", current.Version))
+		default:
+			apierr.Abort(c, err)
+		}
+		return
+	}
+	workers.TaskUpdated(uuid)
+
+	c.Header("ETag", etag(status))
+	c.JSON(http.StatusOK, newTaskView(uuid, status))
+}
+
+// DeleteTaskHandle godoc
+//
+//	@Summary		Удалить задачу
+//	@Description	Удаляет задачу, незавершенная задача перед этим отменяется
+//	@Tags			v1
+//	@Security		BearerAuth
+//	@Param			id	path	string	true	"UUID задачи"
+//	@Success		204
+//	@Failure		403	{object}	apierr.Problem	"task_forbidden"
+//	@Failure		404	{object}	apierr.Problem	"task_not_found"
+//	@Router			/v1/tasks/{id} [delete]
+func DeleteTaskHandle(c *gin.Context) {
+	uuid, status, ok := ownTask(c)
+	if !ok {
+		return
+	}
+
+	if err := deleteTask(uuid, status); err != nil {
+		apierr.Abort(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// deleteTask отменяет незавершенную задачу, чтобы воркер не писал в
+// удаленную, и удаляет ее
+func deleteTask(uuid string, status storage.Status) error {
+	if !storage.IsTerminal(status.State) {
+		if err := workers.CancelTask(uuid); err != nil {
+			log.Printf("Task %s is not canceled before deletion: %v", uuid, err)
+		}
+	}
+
+	if err := storage.DeleteTask(uuid); err != nil {
+		log.Printf("Cannot delete task %s: %v", uuid, err)
+		return err
+	}
+	return nil
+}
+
+// CancelTaskHandle godoc
+//
+//	@Summary		Отменить задачу
+//	@Description	Ожидающая задача отменяется сразу, у выполняемой отменяется контекст
+//	@Tags			v1
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			id	path		string	true	"UUID задачи"
+//	@Success		202	{object}	TaskView
+//	@Failure		403	{object}	apierr.Problem	"task_forbidden"
+//	@Failure		404	{object}	apierr.Problem	"task_not_found"
+//	@Failure		409	{object}	apierr.Problem	"task_finished или state_conflict, с полем state"
+//	@Router			/v1/tasks/{id}/cancel [post]
+func CancelTaskHandle(c *gin.Context) {
+	uuid, status, ok := ownTask(c)
+	if !ok {
+		return
+	}
+
+	if storage.IsTerminal(status.State) {
+		apierr.Abort(c, apierr.ErrTaskFinished.With("state", status.State))
+		return
+	}
+
+	if err := workers.CancelTask(uuid); err != nil {
+		log.Printf("Task %s is not canceled: %v", uuid, err)
+		status, _ = storage.GetResponse(uuid)
+		apierr.Abort(c, apierr.ErrConflict.WithDetail("task cannot be canceled").With("state", status.State))
+		return
+	}
+
+	status, _ = storage.GetResponse(uuid)
+	c.JSON(http.StatusAccepted, newTaskView(uuid, status))
+}
+
+// TaskResultHandle godoc
+//
+//	@Summary		Результат задачи
+//	@Description	Отдает результат завершенной задачи с его типом содержимого. Поддерживает заголовок Range для больших результатов.
+//	@Description	Для failed и canceled задач возвращает объект ошибки.
+//	@Tags			v1
+//	@Produce		json
+//	@Produce		octet-stream
+//	@Security		BearerAuth
+//	@Param			id		path		string	true	"UUID задачи"
+//	@Param			Range	header		string	false	"Диапазон байт, например bytes=0-1023"
+//	@Success		200		{file}		file	"Результат задачи"
+//	@Success		204		"Задача завершилась без результата"
+//	@Success		206		{file}		file	"Часть результата"
+//	@Failure		403		{object}	apierr.Problem	"task_forbidden"
+//	@Failure		404		{object}	apierr.Problem	"task_not_found"
+//	@Failure		409		{object}	apierr.Problem	"result_not_ready, с полем state"
+//	@Failure		422		{object}	apierr.Problem	"task_failed, с полями state, error (ошибка задачи) и result"
+//	@Router			/v1/tasks/{id}/result [get]
+func TaskResultHandle(c *gin.Context) {
+	uuid, status, ok := ownTask(c)
+	if !ok {
+		return
+	}
+
+	serveResult(c, uuid, status)
+}
+
+// TaskHistoryHandle godoc
+//
+//	@Summary		История задачи
+//	@Description	Все смены состояния задачи по порядку
+//	@Tags			v1
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			id	path		string	true	"UUID задачи"
+//	@Success		200	{array}		storage.Transition
+//	@Failure		403	{object}	apierr.Problem	"task_forbidden"
+//	@Failure		404	{object}	apierr.Problem	"task_not_found"
+//	@Router			/v1/tasks/{id}/history [get]
+func TaskHistoryHandle(c *gin.Context) {
+	_, status, ok := ownTask(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, status.History)
+}
+
+// WaitTaskHandle godoc
+//
+//	@Summary		Дождаться завершения задачи
+//	@Description	Держит запрос, пока задача не завершится или не истечет timeout (по умолчанию 30 секунд, не больше 120).
+//	@Description	Завершенная задача возвращается с кодом 200 вместе с результатом, по таймауту - текущее состояние с кодом 202.
+//	@Tags			v1
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			id		path		string	true	"UUID задачи"
+//	@Param			timeout	query		int		false	"Сколько секунд ждать"
+//	@Success		200		{object}	TaskView	"Задача завершилась"
+//	@Success		202		{object}	TaskView	"Задача еще не завершилась"
+//	@Header			200		{string}	X-Task-State	"Состояние задачи"
+//	@Failure		400		{object}	apierr.Problem	"bad_request"
+//	@Failure		403		{object}	apierr.Problem	"task_forbidden"
+//	@Failure		404		{object}	apierr.Problem	"task_not_found"
+//	@Router			/v1/tasks/{id}/wait [get]
+func WaitTaskHandle(c *gin.Context) {
+	query := WaitQuery{}
+	if err := c.ShouldBindQuery(&query); err != nil {
+		log.Printf("Invalid wait timeout: %v", err)
+		apierr.Abort(c, apierr.ErrBadRequest.Wrap(err).WithDetail("invalid timeout"))
+		return
+	}
+	if query.Timeout == 0 {
+		query.Timeout = defaultWaitTimeout
+	}
+
+	uuid, _, ok := ownTask(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+
+	timer := clock.Get().NewTimer(time.Duration(query.Timeout) * time.Second)
+	defer timer.Stop()
+	go func() {
+		select {
+		case <-timer.C():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	status, err := storage.WaitTerminal(ctx, uuid)
+	switch {
+	case c.Request.Context().Err() != nil:
+		// клиент ушел, отвечать некому
+		return
+	case errors.Is(err, context.Canceled):
+		c.Header("X-Task-State", status.State)
+		c.JSON(http.StatusAccepted, newTaskView(uuid, status))
+	case err != nil:
+		log.Printf("Task %s is gone while waiting: %v", uuid, err)
+		apierr.Abort(c, err)
+	default:
+		c.Header("X-Task-State", status.State)
+		c.JSON(http.StatusOK, newTaskView(uuid, status))
+	}
+}
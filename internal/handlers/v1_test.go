@@ -0,0 +1,303 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"io"
+	"ioboundlimiter/internal/clock"
+	"ioboundlimiter/internal/router"
+	"ioboundlimiter/internal/storage"
+	"ioboundlimiter/internal/workers"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// remoteType - задачи этого типа ждут удаленных воркеров и остаются в pending
+const remoteType = "handlers-remote"
+
+func startAPI(t *testing.T) string {
+	gin.SetMode(gin.TestMode)
+	workers.RegisterRemoteType(remoteType)
+	workers.InitWorkers()
+
+	srv := httptest.NewServer(router.New())
+	t.Cleanup(func() {
+		srv.Close()
+		workers.Shutdown()
+	})
+	return srv.URL
+}
+
+// register создает пользователя и возвращает его access токен
+func register(t *testing.T, url string) string {
+	resp, body := call(t, http.MethodGet, url+"/register", "", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	return body["access"].(string)
+}
+
+// call выполняет запрос и разбирает JSON ответа, если он есть
+func call(t *testing.T, method, url, token, body string, headers ...string) (*http.Response, map[string]any) {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	assert.NoError(t, err)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	defer resp.Body.Close()
+
+	data, _ := io.ReadAll(resp.Body)
+	decoded := map[string]any{}
+	json.Unmarshal(data, &decoded)
+	return resp, decoded
+}
+
+func createTask(t *testing.T, url, token, name string) string {
+	resp, body := call(t, http.MethodPost, url+"/v1/tasks", token, `{"taskname": "`+name+`", "type": "`+remoteType+`"}`)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	return body["id"].(string)
+}
+
+func TestTasksV1(t *testing.T) {
+	url := startAPI(t)
+
+	t.Run("tasks of another user are forbidden", func(t *testing.T) {
+		owner, other := register(t, url), register(t, url)
+		id := createTask(t, url, owner, "private")
+		task := url + "/v1/tasks/" + id
+
+		for _, req := range []struct{ method, path, body string }{
+			{http.MethodGet, task, ""},
+			{http.MethodPatch, task, `{"priority": 5}`},
+			{http.MethodDelete, task, ""},
+			{http.MethodPost, task + "/cancel", ""},
+			{http.MethodGet, task + "/result", ""},
+			{http.MethodGet, task + "/history", ""},
+			{http.MethodGet, task + "/wait?timeout=1", ""},
+		} {
+			resp, body := call(t, req.method, req.path, other, req.body)
+			assert.Equal(t, http.StatusForbidden, resp.StatusCode, req.method+" "+req.path)
+			assert.Equal(t, "task_forbidden", body["code"], req.method+" "+req.path)
+		}
+
+		resp, body := call(t, http.MethodGet, url+"/v1/tasks", other, "")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.EqualValues(t, 0, body["total"])
+
+		// задача не тронута чужими запросами
+		resp, body = call(t, http.MethodGet, task, owner, "")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, storage.StatePending, body["state"])
+		assert.EqualValues(t, 0, body["priority"])
+	})
+
+	t.Run("pagination", func(t *testing.T) {
+		token := register(t, url)
+		ids := []string{
+			createTask(t, url, token, "page 1"),
+			createTask(t, url, token, "page 2"),
+			createTask(t, url, token, "page 3"),
+		}
+
+		page := func(query string) ([]string, map[string]any) {
+			resp, body := call(t, http.MethodGet, url+"/v1/tasks?"+query, token, "")
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			result := []string{}
+			for _, task := range body["tasks"].([]any) {
+				result = append(result, task.(map[string]any)["id"].(string))
+			}
+			return result, body
+		}
+
+		first, body := page("limit=2")
+		assert.Equal(t, ids[:2], first)
+		assert.EqualValues(t, 3, body["total"])
+		assert.EqualValues(t, 2, body["limit"])
+
+		second, body := page("limit=2&offset=2")
+		assert.Equal(t, ids[2:], second)
+		assert.EqualValues(t, 2, body["offset"])
+
+		empty, _ := page("offset=10")
+		assert.Empty(t, empty)
+
+		for _, query := range []string{"limit=501", "limit=-1", "offset=-1"} {
+			resp, body := call(t, http.MethodGet, url+"/v1/tasks?"+query, token, "")
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode, query)
+			assert.Equal(t, "bad_request", body["code"], query)
+		}
+	})
+
+	t.Run("state conflicts", func(t *testing.T) {
+		token := register(t, url)
+
+		pending := createTask(t, url, token, "pending")
+		resp, body := call(t, http.MethodGet, url+"/v1/tasks/"+pending+"/result", token, "")
+		assert.Equal(t, http.StatusConflict, resp.StatusCode)
+		assert.Equal(t, "result_not_ready", body["code"])
+		assert.Equal(t, storage.StatePending, body["state"])
+
+		running := createTask(t, url, token, "running")
+		assert.NoError(t, storage.SetState(running, storage.StateRunning))
+		resp, body = call(t, http.MethodPatch, url+"/v1/tasks/"+running, token, `{"priority": 1}`)
+		assert.Equal(t, http.StatusConflict, resp.StatusCode)
+		assert.Equal(t, "task_started", body["code"])
+		assert.Equal(t, storage.StateRunning, body["state"])
+
+		canceled := createTask(t, url, token, "canceled")
+		resp, _ = call(t, http.MethodPost, url+"/v1/tasks/"+canceled+"/cancel", token, "")
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+		resp, body = call(t, http.MethodPost, url+"/v1/tasks/"+canceled+"/cancel", token, "")
+		assert.Equal(t, http.StatusConflict, resp.StatusCode)
+		assert.Equal(t, "task_finished", body["code"])
+		assert.Equal(t, storage.StateCanceled, body["state"])
+
+		resp, body = call(t, http.MethodPatch, url+"/v1/tasks/"+canceled, token, `{"priority": 1}`)
+		assert.Equal(t, http.StatusConflict, resp.StatusCode)
+		assert.Equal(t, "task_finished", body["code"])
+
+		resp, body = call(t, http.MethodGet, url+"/v1/tasks/"+canceled+"/result", token, "")
+		assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+		assert.Equal(t, "task_failed", body["code"])
+	})
+
+	t.Run("stale version", func(t *testing.T) {
+		token := register(t, url)
+		id := createTask(t, url, token, "versioned")
+
+		resp, _ := call(t, http.MethodPatch, url+"/v1/tasks/"+id, token, `{"priority": 1}`, "If-Match", `"1"`)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, `"2"`, resp.Header.Get("ETag"))
+
+		resp, body := call(t, http.MethodPatch, url+"/v1/tasks/"+id, token, `{"priority": 2}`, "If-Match", `"1"`)
+		assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+		assert.Equal(t, "version_mismatch", body["code"])
+		assert.EqualValues(t, 2, body["version"])
+	})
+
+	t.Run("requires token", func(t *testing.T) {
+		resp, body := call(t, http.MethodGet, url+"/v1/tasks", "", "")
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+		assert.Equal(t, "unauthorized", body["code"])
+	})
+}
+
+func TestWaitTask(t *testing.T) {
+	url := startAPI(t)
+	owner, other := register(t, url), register(t, url)
+	defer clock.Set(clock.Real{})
+
+	tests := []struct {
+		name    string
+		query   string
+		token   string
+		prepare func(t *testing.T, id string)
+		// while вызывается, когда запрос уже ждет задачу
+		while   func(t *testing.T, fake *clock.Fake, id string)
+		code    int
+		state   string
+		errCode string
+	}{
+		{
+			name:  "timeout expires",
+			query: "?timeout=5",
+			token: owner,
+			while: func(_ *testing.T, fake *clock.Fake, _ string) { fake.Advance(5 * time.Second) },
+			code:  http.StatusAccepted,
+			state: storage.StatePending,
+		},
+		{
+			name:  "already terminal",
+			token: owner,
+			prepare: func(t *testing.T, id string) {
+				assert.NoError(t, storage.CompleteTask(id, json.RawMessage(`{"ok": true}`)))
+			},
+			code:  http.StatusOK,
+			state: storage.StateDone,
+		},
+		{
+			name:  "finishes while waiting",
+			token: owner,
+			while: func(t *testing.T, _ *clock.Fake, id string) {
+				assert.NoError(t, storage.CompleteTask(id, json.RawMessage(`{"ok": true}`)))
+			},
+			code:  http.StatusOK,
+			state: storage.StateDone,
+		},
+		{
+			name:    "deleted while waiting",
+			token:   owner,
+			while:   func(t *testing.T, _ *clock.Fake, id string) { assert.NoError(t, storage.DeleteTask(id)) },
+			code:    http.StatusNotFound,
+			errCode: "task_not_found",
+		},
+		{
+			name:    "another user",
+			token:   other,
+			code:    http.StatusForbidden,
+			errCode: "task_forbidden",
+		},
+		{
+			name:    "invalid timeout",
+			query:   "?timeout=121",
+			token:   owner,
+			code:    http.StatusBadRequest,
+			errCode: "bad_request",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// у каждого случая свои часы: таймер прошлого запроса может остановиться позже
+			fake := clock.NewFake(time.Now())
+			clock.Set(fake)
+
+			id := createTask(t, url, owner, "wait "+tt.name)
+			if tt.prepare != nil {
+				tt.prepare(t, id)
+			}
+
+			type response struct {
+				resp *http.Response
+				body map[string]any
+			}
+			done := make(chan response, 1)
+			go func() {
+				resp, body := call(t, http.MethodGet, url+"/v1/tasks/"+id+"/wait"+tt.query, tt.token, "")
+				done <- response{resp, body}
+			}()
+			if tt.while != nil {
+				fake.BlockUntil(1)
+				tt.while(t, fake, id)
+			}
+
+			var got response
+			select {
+			case got = <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("wait request did not return")
+			}
+			assert.Equal(t, tt.code, got.resp.StatusCode)
+			if tt.errCode != "" {
+				assert.Equal(t, tt.errCode, got.body["code"])
+				return
+			}
+			assert.Equal(t, tt.state, got.body["state"])
+			assert.Equal(t, tt.state, got.resp.Header.Get("X-Task-State"))
+		})
+	}
+}
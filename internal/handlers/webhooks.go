@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"ioboundlimiter/internal/apierr"
+	"ioboundlimiter/internal/webhook"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WebhookHandle godoc
+//	@Summary		Доставка уведомления о завершении
+//	@Description	Возвращает состояние доставки callback-уведомления задачи и все попытки отправки
+//	@Tags			tasks
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			uuid	body		TaskID	true	"UUID задачи"
+//	@Success		200		{object}	webhook.Delivery
+//	@Failure		400		{object}	apierr.Problem	"bad_request"
+//	@Failure		403		{object}	apierr.Problem	"task_forbidden"
+//	@Failure		404		{object}	apierr.Problem	"task_not_found, delivery_not_found"
+//	@Router			/api/webhooks [post]
+func WebhookHandle(c *gin.Context) {
+	uuid := TaskID{}
+	if err := c.ShouldBindJSON(&uuid); err != nil {
+		log.Printf("Bad request: should contain UUID: %v", err)
+		apierr.Abort(c, apierr.ErrBadRequest.Wrap(err).WithDetail("Bad request: should contain UUID"))
+		return
+	}
+
+	if _, ok := loadOwnTask(c, uuid.UUID); !ok {
+		return
+	}
+
+	delivery, ok := webhook.GetDelivery(uuid.UUID)
+	if !ok {
+		apierr.Abort(c, apierr.ErrNoDelivery)
+		return
+	}
+
+	c.JSON(http.StatusOK, delivery)
+}
@@ -0,0 +1,260 @@
+package handlers
+
+import (
+	"ioboundlimiter/internal/apierr"
+	"ioboundlimiter/internal/storage"
+	"log"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"golang.org/x/net/websocket"
+)
+
+// Протокол WebSocket: клиент и сервер обмениваются JSON сообщениями.
+// Запросы клиента - submit, subscribe, unsubscribe; ответ на запрос
+// содержит его id. Изменения задач из подписки приходят сообщениями task
+// и deleted. После завершения задачи подписка на нее снимается.
+
+const (
+	DefaultWSMaxSubscriptions = 100
+	wsMaxMessageBytes         = 64 << 10
+)
+
+var wsMaxSubscriptions = DefaultWSMaxSubscriptions
+
+var (
+	errWSUnknownMessage     = apierr.New(http.StatusBadRequest, "unknown_message", "unknown message type")
+	errWSTooManySubscribers = apierr.New(http.StatusBadRequest, "too_many_subscriptions", "too many subscriptions")
+	errWSSlowClient         = apierr.New(http.StatusServiceUnavailable, "client_too_slow", "client is too slow, reconnect and subscribe again")
+)
+
+// SetWSMaxSubscriptions ограничивает число задач, на которые подписано одно
+// соединение. Вызывать до запуска сервера.
+func SetWSMaxSubscriptions(n int) {
+	if n > 0 {
+		wsMaxSubscriptions = n
+	}
+}
+
+// WSRequest - сообщение клиента
+type WSRequest struct {
+	// submit, subscribe или unsubscribe
+	Type    string   `json:"type" example:"subscribe"`
+	ID      string   `json:"id,omitempty" example:"1"`
+	Task    *Task    `json:"task,omitempty"`
+	TaskIDs []string `json:"task_ids,omitempty"`
+}
+
+// WSMessage - сообщение сервера
+type WSMessage struct {
+	// submitted, subscribed, unsubscribed, task, deleted или error
+	Type    string    `json:"type" example:"task"`
+	ID      string    `json:"id,omitempty"`
+	Task    *TaskView `json:"task,omitempty"`
+	TaskID  string    `json:"task_id,omitempty"`
+	TaskIDs []string  `json:"task_ids,omitempty"`
+	Cache   string    `json:"cache,omitempty"`
+	// Code - код ошибки, как в ответах HTTP API
+	Code  string `json:"code,omitempty" example:"task_not_found"`
+	Error string `json:"error,omitempty"`
+}
+
+type wsConn struct {
+	ws    *websocket.Conn
+	owner string
+
+	// subscribed читается при каждом изменении в storage под его блокировкой,
+	// поэтому набор не меняется, а заменяется целиком
+	subscribed atomic.Pointer[map[string]bool]
+	lockSubs   *sync.Mutex
+
+	lockWrite *sync.Mutex
+	closed    atomic.Bool
+}
+
+// WebSocketHandle godoc
+//	@Summary		WebSocket API
+//	@Description	Одно соединение для отправки задач и подписки на их изменения. Сообщения клиента - WSRequest, сервера - WSMessage.
+//	@Description	Токен передается в заголовке Authorization или в access_token. Число подписок на соединение ограничено.
+//	@Tags			v1
+//	@Security		BearerAuth
+//	@Param			access_token	query	string	false	"Access токен вместо заголовка Authorization"
+//	@Success		101				{object}	WSMessage
+//	@Failure		401				{object}	apierr.Problem	"unauthorized, invalid_token"
+//	@Router			/v1/ws [get]
+func WebSocketHandle(c *gin.Context) {
+	owner := c.GetString("user_id")
+
+	server := websocket.Server{
+		// токен передается явно, а не в cookie, поэтому Origin не проверяем
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler: func(ws *websocket.Conn) {
+			conn := &wsConn{ws: ws, owner: owner, lockSubs: &sync.Mutex{}, lockWrite: &sync.Mutex{}}
+			conn.subscribed.Store(&map[string]bool{})
+			conn.serve()
+		},
+	}
+	server.ServeHTTP(c.Writer, c.Request)
+}
+
+func (conn *wsConn) serve() {
+	conn.ws.MaxPayloadBytes = wsMaxMessageBytes
+
+	sub, _, _ := storage.Subscribe(conn.match, 0)
+	defer sub.Close()
+	defer conn.closed.Store(true)
+
+	go conn.push(sub)
+
+	for {
+		req := WSRequest{}
+		if err := websocket.JSON.Receive(conn.ws, &req); err != nil {
+			return
+		}
+
+		switch req.Type {
+		case "submit":
+			conn.submit(req)
+		case "subscribe":
+			conn.subscribe(req)
+		case "unsubscribe":
+			conn.unsubscribe(req)
+		default:
+			conn.fail(req.ID, "", errWSUnknownMessage)
+		}
+	}
+}
+
+func (conn *wsConn) match(change storage.Change) bool {
+	return (*conn.subscribed.Load())[change.UUID]
+}
+
+// push пересылает клиенту изменения задач из подписки
+func (conn *wsConn) push(sub *storage.Subscription) {
+	for change := range sub.C {
+		if change.Deleted {
+			conn.setSubscribed([]string{change.UUID}, false)
+			conn.send(WSMessage{Type: "deleted", TaskID: change.UUID})
+			continue
+		}
+
+		conn.sendTask(change.UUID, change.Status)
+	}
+
+	// подписка закрыта, а соединение нет - клиент не успевал читать изменения
+	if !conn.closed.Load() {
+		conn.fail("", "", errWSSlowClient)
+		conn.ws.Close()
+	}
+}
+
+func (conn *wsConn) send(msg WSMessage) {
+	conn.lockWrite.Lock()
+	defer conn.lockWrite.Unlock()
+
+	if err := websocket.JSON.Send(conn.ws, msg); err != nil {
+		log.Printf("Cannot send websocket message: %v", err)
+	}
+}
+
+// fail сообщает клиенту об ошибке запроса id
+func (conn *wsConn) fail(id, taskID string, err error) {
+	apiErr := apierr.From(err)
+	conn.send(WSMessage{Type: "error", ID: id, TaskID: taskID, Code: apiErr.Code, Error: apiErr.Detail})
+}
+
+func (conn *wsConn) submit(req WSRequest) {
+	if req.Task == nil {
+		conn.fail(req.ID, "", apierr.ErrInvalidTask)
+		return
+	}
+	if err := binding.Validator.ValidateStruct(req.Task); err != nil {
+		log.Printf("ERROR: Validation error: %v", err)
+		conn.fail(req.ID, "", apierr.ErrInvalidTask.Wrap(err))
+		return
+	}
+
+	uuid, memo, err := createTask(*req.Task, conn.owner)
+	if err != nil {
+		conn.fail(req.ID, "", err)
+		return
+	}
+
+	msg := WSMessage{Type: "submitted", ID: req.ID, TaskID: uuid}
+	if req.Task.Memoize {
+		msg.Cache = memo
+	}
+	if status, err := storage.GetResponse(uuid); err == nil {
+		view := newTaskView(uuid, status)
+		msg.Task = &view
+	}
+	conn.send(msg)
+}
+
+func (conn *wsConn) subscribe(req WSRequest) {
+	for _, uuid := range req.TaskIDs {
+		status, err := storage.GetResponse(uuid)
+		if err != nil || status.Owner != conn.owner {
+			conn.fail(req.ID, uuid, apierr.ErrTaskNotFound)
+			return
+		}
+	}
+
+	if !conn.setSubscribed(req.TaskIDs, true) {
+		conn.fail(req.ID, "", errWSTooManySubscribers)
+		return
+	}
+	conn.send(WSMessage{Type: "subscribed", ID: req.ID, TaskIDs: req.TaskIDs})
+
+	// текущее состояние читается уже после подписки, чтобы не пропустить изменения
+	for _, uuid := range req.TaskIDs {
+		if status, err := storage.GetResponse(uuid); err == nil {
+			conn.sendTask(uuid, status)
+		}
+	}
+}
+
+// sendTask отправляет состояние задачи. Завершенная задача больше не
+// меняется, поэтому подписка на нее снимается.
+func (conn *wsConn) sendTask(uuid string, status storage.Status) {
+	if storage.IsTerminal(status.State) {
+		conn.setSubscribed([]string{uuid}, false)
+	}
+
+	view := newTaskView(uuid, status)
+	conn.send(WSMessage{Type: "task", Task: &view})
+}
+
+func (conn *wsConn) unsubscribe(req WSRequest) {
+	conn.setSubscribed(req.TaskIDs, false)
+	conn.send(WSMessage{Type: "unsubscribed", ID: req.ID, TaskIDs: req.TaskIDs})
+}
+
+// setSubscribed добавляет или убирает задачи из подписки. Возвращает false,
+// если после добавления подписок стало бы больше лимита.
+func (conn *wsConn) setSubscribed(uuids []string, on bool) bool {
+	conn.lockSubs.Lock()
+	defer conn.lockSubs.Unlock()
+
+	subscribed := make(map[string]bool)
+	for uuid := range *conn.subscribed.Load() {
+		if on || !slices.Contains(uuids, uuid) {
+			subscribed[uuid] = true
+		}
+	}
+	if on {
+		for _, uuid := range uuids {
+			subscribed[uuid] = true
+		}
+		if len(subscribed) > wsMaxSubscriptions {
+			return false
+		}
+	}
+
+	conn.subscribed.Store(&subscribed)
+	return true
+}
@@ -0,0 +1,111 @@
+package handlers_test
+
+import (
+	"ioboundlimiter/internal/handlers"
+	"ioboundlimiter/internal/storage"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/websocket"
+)
+
+func dialWS(t *testing.T, url, token string) *websocket.Conn {
+	wsURL := "ws" + strings.TrimPrefix(url, "http") + "/v1/ws?access_token=" + token
+	ws, err := websocket.Dial(wsURL, "", url)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(func() { ws.Close() })
+	return ws
+}
+
+func receiveWS(t *testing.T, ws *websocket.Conn) handlers.WSMessage {
+	msg := handlers.WSMessage{}
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	assert.NoError(t, websocket.JSON.Receive(ws, &msg))
+	return msg
+}
+
+func TestWebSocket(t *testing.T) {
+	url := startAPI(t)
+
+	t.Run("submit and follow task to the end", func(t *testing.T) {
+		token := register(t, url)
+		ws := dialWS(t, url, token)
+
+		assert.NoError(t, websocket.JSON.Send(ws, handlers.WSRequest{
+			Type: "submit",
+			ID:   "1",
+			Task: &handlers.Task{TaskName: "ws task", Type: remoteType},
+		}))
+		submitted := receiveWS(t, ws)
+		assert.Equal(t, "submitted", submitted.Type)
+		assert.Equal(t, "1", submitted.ID)
+		if assert.NotNil(t, submitted.Task) {
+			assert.Equal(t, storage.StatePending, submitted.Task.State)
+		}
+		id := submitted.TaskID
+
+		assert.NoError(t, websocket.JSON.Send(ws, handlers.WSRequest{Type: "subscribe", ID: "2", TaskIDs: []string{id}}))
+		assert.Equal(t, "subscribed", receiveWS(t, ws).Type)
+		assert.Equal(t, storage.StatePending, receiveWS(t, ws).Task.State)
+
+		resp, _ := call(t, http.MethodPost, url+"/v1/tasks/"+id+"/cancel", token, "")
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+		msg := receiveWS(t, ws)
+		assert.Equal(t, "task", msg.Type)
+		assert.Equal(t, storage.StateCanceled, msg.Task.State)
+
+		// подписка на завершенную задачу снята: об удалении сообщения уже нет,
+		// следующим приходит ответ на неизвестный запрос
+		resp, _ = call(t, http.MethodDelete, url+"/v1/tasks/"+id, token, "")
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+		assert.NoError(t, websocket.JSON.Send(ws, handlers.WSRequest{Type: "ping", ID: "3"}))
+
+		// отмена может опубликовать несколько изменений, все они уже canceled
+		for msg = receiveWS(t, ws); msg.Type == "task"; msg = receiveWS(t, ws) {
+			assert.Equal(t, storage.StateCanceled, msg.Task.State)
+		}
+		assert.Equal(t, "error", msg.Type)
+		assert.Equal(t, "unknown_message", msg.Code)
+	})
+
+	t.Run("subscribe to finished task", func(t *testing.T) {
+		token := register(t, url)
+		ws := dialWS(t, url, token)
+
+		id := createTask(t, url, token, "finished before subscribe")
+		resp, _ := call(t, http.MethodPost, url+"/v1/tasks/"+id+"/cancel", token, "")
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+		assert.NoError(t, websocket.JSON.Send(ws, handlers.WSRequest{Type: "subscribe", ID: "1", TaskIDs: []string{id}}))
+		assert.Equal(t, "subscribed", receiveWS(t, ws).Type)
+		assert.Equal(t, storage.StateCanceled, receiveWS(t, ws).Task.State)
+
+		assert.NoError(t, storage.DeleteTask(id))
+		assert.NoError(t, websocket.JSON.Send(ws, handlers.WSRequest{Type: "ping", ID: "2"}))
+		msg := receiveWS(t, ws)
+		assert.Equal(t, "error", msg.Type)
+		assert.Equal(t, "2", msg.ID)
+	})
+
+	t.Run("tasks of another user are hidden", func(t *testing.T) {
+		id := createTask(t, url, register(t, url), "private ws")
+		ws := dialWS(t, url, register(t, url))
+
+		assert.NoError(t, websocket.JSON.Send(ws, handlers.WSRequest{Type: "subscribe", ID: "1", TaskIDs: []string{id}}))
+		msg := receiveWS(t, ws)
+		assert.Equal(t, "error", msg.Type)
+		assert.Equal(t, "task_not_found", msg.Code)
+		assert.Equal(t, id, msg.TaskID)
+	})
+
+	t.Run("requires token", func(t *testing.T) {
+		_, err := websocket.Dial("ws"+strings.TrimPrefix(url, "http")+"/v1/ws", "", url)
+		assert.Error(t, err)
+	})
+}
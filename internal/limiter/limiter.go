@@ -0,0 +1,270 @@
+package limiter
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"ioboundlimiter/internal/clock"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limiter ограничивает суммарный вес одновременно выполняемых задач.
+// Release получает время выполнения задачи и ее ошибку, чтобы адаптивные
+// реализации могли подстраивать лимит. Уменьшают лимит только признаки
+// перегрузки, см. Overloaded.
+type Limiter interface {
+	Acquire(ctx context.Context, cost int) error
+	Release(cost int, latency time.Duration, err error)
+	// Limit - текущий лимит, Used - занятая часть лимита.
+	Limit() int
+	Used() int
+	// Capacity - максимальный вес задачи, который лимитер способен принять.
+	Capacity() int
+}
+
+// ErrOverload - внешняя система не справляется с нагрузкой, например
+// ответила 5xx. Исполнители помечают такие ошибки через Overload.
+var ErrOverload = errors.New("downstream is overloaded")
+
+type overloadError struct {
+	error
+}
+
+func (e overloadError) Unwrap() error { return e.error }
+
+func (e overloadError) Is(target error) bool { return target == ErrOverload }
+
+// Overload помечает ошибку как признак перегрузки, не меняя ее текста
+func Overload(err error) error {
+	if err == nil {
+		return nil
+	}
+	return overloadError{err}
+}
+
+// Overloaded - ошибка говорит о перегрузке: таймаут или ErrOverload.
+// Отмена, ошибки в payload, неизвестный тип задачи и отказы breaker
+// ничего не говорят о нагрузке и лимит не меняют.
+func Overloaded(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrOverload)
+}
+
+type waiter struct {
+	cost  int
+	ready chan struct{}
+}
+
+// sem - взвешенный семафор с FIFO очередью ожидающих, чтобы тяжелые
+// задачи не голодали за потоком легких.
+type sem struct {
+	mu      sync.Mutex
+	size    int
+	cur     int
+	waiters list.List
+}
+
+func (s *sem) acquire(ctx context.Context, cost int) error {
+	s.mu.Lock()
+	if s.fits(cost) && s.waiters.Len() == 0 {
+		s.cur += cost
+		s.mu.Unlock()
+		return nil
+	}
+
+	ready := make(chan struct{})
+	elem := s.waiters.PushBack(waiter{cost: cost, ready: ready})
+	s.mu.Unlock()
+
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		select {
+		case <-ready:
+			// слот выдали одновременно с отменой - возвращаем его
+			s.cur -= cost
+			s.notifyWaiters()
+		default:
+			isFront := s.waiters.Front() == elem
+			s.waiters.Remove(elem)
+			if isFront {
+				s.notifyWaiters()
+			}
+		}
+		s.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// fits разрешает задачу тяжелее текущего лимита, если больше ничего не
+// выполняется: адаптивный лимит может опуститься ниже веса задачи.
+func (s *sem) fits(cost int) bool {
+	return s.cur+cost <= s.size || s.cur == 0
+}
+
+// release и notifyWaiters вызываются под s.mu
+func (s *sem) release(cost int) {
+	s.cur -= cost
+	s.notifyWaiters()
+}
+
+func (s *sem) notifyWaiters() {
+	for {
+		next := s.waiters.Front()
+		if next == nil {
+			return
+		}
+
+		w := next.Value.(waiter)
+		if !s.fits(w.cost) {
+			return
+		}
+
+		s.cur += w.cost
+		s.waiters.Remove(next)
+		close(w.ready)
+	}
+}
+
+// Fixed - взвешенный семафор с постоянной емкостью.
+type Fixed struct {
+	sem
+}
+
+func NewFixed(capacity int) *Fixed {
+	return &Fixed{sem: sem{size: capacity}}
+}
+
+func (f *Fixed) Acquire(ctx context.Context, cost int) error {
+	return f.acquire(ctx, cost)
+}
+
+func (f *Fixed) Release(cost int, _ time.Duration, _ error) {
+	f.mu.Lock()
+	f.release(cost)
+	f.mu.Unlock()
+}
+
+func (f *Fixed) Limit() int {
+	return f.size
+}
+
+func (f *Fixed) Used() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.cur
+}
+
+func (f *Fixed) Capacity() int {
+	return f.size
+}
+
+type Config struct {
+	InitialLimit int
+	MinLimit     int
+	MaxLimit     int
+
+	// TargetLatency - пока задачи укладываются в это время, лимит растет.
+	TargetLatency time.Duration
+	// SpikeFactor - во сколько раз задача должна превысить TargetLatency,
+	// чтобы это считалось всплеском и лимит уменьшился.
+	SpikeFactor float64
+	// Backoff - множитель лимита при перегрузке или всплеске задержки.
+	Backoff float64
+}
+
+func DefaultConfig() Config {
+	return Config{
+		InitialLimit:  5,
+		MinLimit:      1,
+		MaxLimit:      20,
+		TargetLatency: 4 * time.Minute,
+		SpikeFactor:   2,
+		Backoff:       0.7,
+	}
+}
+
+// Adaptive - AIMD лимитер: аддитивно увеличивает лимит, пока задачи
+// выполняются быстрее TargetLatency, и мультипликативно уменьшает его
+// при перегрузке и всплесках задержки. Как TCP, уменьшает не чаще раза за
+// "RTT": сигналы задач, начатых до последнего уменьшения, уже учтены.
+type Adaptive struct {
+	sem
+	cfg   Config
+	limit float64
+
+	lastDecrease time.Time
+}
+
+func NewAdaptive(cfg Config) *Adaptive {
+	if cfg.MinLimit < 1 {
+		cfg.MinLimit = 1
+	}
+	if cfg.MaxLimit < cfg.MinLimit {
+		cfg.MaxLimit = cfg.MinLimit
+	}
+	if cfg.SpikeFactor < 1 {
+		cfg.SpikeFactor = 1
+	}
+	if cfg.Backoff <= 0 || cfg.Backoff >= 1 {
+		cfg.Backoff = 0.7
+	}
+
+	limit := clamp(float64(cfg.InitialLimit), cfg.MinLimit, cfg.MaxLimit)
+	return &Adaptive{
+		sem:   sem{size: int(limit)},
+		cfg:   cfg,
+		limit: limit,
+	}
+}
+
+func (a *Adaptive) Acquire(ctx context.Context, cost int) error {
+	return a.acquire(ctx, cost)
+}
+
+func (a *Adaptive) Release(cost int, latency time.Duration, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	spike := time.Duration(float64(a.cfg.TargetLatency) * a.cfg.SpikeFactor)
+	now := clock.Now()
+
+	switch {
+	case Overloaded(err) || latency > spike:
+		if now.Add(-latency).Before(a.lastDecrease) {
+			break
+		}
+		a.limit = clamp(math.Floor(a.limit*a.cfg.Backoff), a.cfg.MinLimit, a.cfg.MaxLimit)
+		a.lastDecrease = now
+	case err == nil && latency <= a.cfg.TargetLatency && a.cur >= a.size/2:
+		// растем только когда лимит реально используется, иначе
+		// после простоя он окажется сильно завышен
+		a.limit = clamp(a.limit+1/a.limit, a.cfg.MinLimit, a.cfg.MaxLimit)
+	}
+
+	a.size = int(a.limit)
+	a.release(cost)
+}
+
+func (a *Adaptive) Limit() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.size
+}
+
+func (a *Adaptive) Used() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.cur
+}
+
+func (a *Adaptive) Capacity() int {
+	return a.cfg.MaxLimit
+}
+
+func clamp(v float64, lo, hi int) float64 {
+	return math.Max(float64(lo), math.Min(float64(hi), v))
+}
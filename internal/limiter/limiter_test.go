@@ -0,0 +1,238 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"ioboundlimiter/internal/clock"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testConfig() Config {
+	return Config{
+		InitialLimit:  4,
+		MinLimit:      1,
+		MaxLimit:      10,
+		TargetLatency: time.Second,
+		SpikeFactor:   2,
+		Backoff:       0.5,
+	}
+}
+
+func TestAdaptive(t *testing.T) {
+	t.Run("grows while latency is under target", func(t *testing.T) {
+		a := NewAdaptive(testConfig())
+
+		for i := 0; i < 50; i++ {
+			for j := 0; j < a.Limit(); j++ {
+				assert.NoError(t, a.Acquire(context.Background(), 1))
+			}
+			for j := a.Used(); j > 0; j-- {
+				a.Release(1, 100*time.Millisecond, nil)
+			}
+		}
+
+		assert.Equal(t, 10, a.Limit())
+		assert.Equal(t, 0, a.Used())
+	})
+
+	t.Run("shrinks on overload", func(t *testing.T) {
+		for _, err := range []error{
+			Overload(errors.New("unexpected status code 503")),
+			fmt.Errorf("http request failed: %w", context.DeadlineExceeded),
+		} {
+			a := NewAdaptive(testConfig())
+
+			assert.NoError(t, a.Acquire(context.Background(), 1))
+			a.Release(1, 100*time.Millisecond, err)
+
+			assert.Equal(t, 2, a.Limit(), err.Error())
+		}
+		assert.EqualError(t, Overload(errors.New("unexpected status code 503")), "unexpected status code 503")
+	})
+
+	t.Run("ignores errors that are not overload", func(t *testing.T) {
+		a := NewAdaptive(testConfig())
+
+		for _, err := range []error{context.Canceled, errors.New("invalid http payload"), errors.New("circuit breaker is open")} {
+			assert.NoError(t, a.Acquire(context.Background(), 1))
+			a.Release(1, 100*time.Millisecond, err)
+		}
+
+		assert.Equal(t, 4, a.Limit())
+	})
+
+	t.Run("shrinks once per window", func(t *testing.T) {
+		fake := clock.NewFake(time.Now())
+		clock.Set(fake)
+		defer clock.Set(clock.Real{})
+		a := NewAdaptive(testConfig())
+
+		// три задачи, начатые до уменьшения, сообщают об одной перегрузке
+		for i := 0; i < 3; i++ {
+			assert.NoError(t, a.Acquire(context.Background(), 1))
+		}
+		for i := 0; i < 3; i++ {
+			a.Release(1, 100*time.Millisecond, Overload(errors.New("503")))
+		}
+		assert.Equal(t, 2, a.Limit())
+
+		// задача, начатая после уменьшения, уменьшает снова
+		assert.NoError(t, a.Acquire(context.Background(), 1))
+		fake.Advance(time.Second)
+		a.Release(1, 500*time.Millisecond, Overload(errors.New("503")))
+		assert.Equal(t, 1, a.Limit())
+	})
+
+	t.Run("shrinks on latency spike", func(t *testing.T) {
+		a := NewAdaptive(testConfig())
+
+		assert.NoError(t, a.Acquire(context.Background(), 1))
+		a.Release(1, 3*time.Second, nil)
+
+		assert.Equal(t, 2, a.Limit())
+	})
+
+	t.Run("never drops below min limit", func(t *testing.T) {
+		a := NewAdaptive(testConfig())
+
+		for i := 0; i < 10; i++ {
+			assert.NoError(t, a.Acquire(context.Background(), 1))
+			a.Release(1, 0, Overload(errors.New("fail")))
+		}
+
+		assert.Equal(t, 1, a.Limit())
+	})
+
+	t.Run("acquire blocks at limit until release", func(t *testing.T) {
+		cfg := testConfig()
+		cfg.InitialLimit = 1
+		a := NewAdaptive(cfg)
+
+		assert.NoError(t, a.Acquire(context.Background(), 1))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, a.Acquire(ctx, 1), context.DeadlineExceeded)
+
+		acquired := make(chan struct{})
+		go func() {
+			assert.NoError(t, a.Acquire(context.Background(), 1))
+			close(acquired)
+		}()
+
+		a.Release(1, 2*time.Second, nil)
+		select {
+		case <-acquired:
+		case <-time.After(time.Second):
+			t.Fatal("acquire was not unblocked by release")
+		}
+	})
+}
+
+func TestFixed(t *testing.T) {
+	f := NewFixed(2)
+
+	assert.NoError(t, f.Acquire(context.Background(), 1))
+	assert.NoError(t, f.Acquire(context.Background(), 1))
+	assert.Equal(t, 2, f.Used())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.Error(t, f.Acquire(ctx, 1))
+
+	f.Release(1, 0, nil)
+	assert.Equal(t, 1, f.Used())
+	assert.Equal(t, 2, f.Limit())
+}
+
+func TestWeighted(t *testing.T) {
+	t.Run("cost is counted against capacity", func(t *testing.T) {
+		f := NewFixed(10)
+
+		assert.NoError(t, f.Acquire(context.Background(), 7))
+		assert.NoError(t, f.Acquire(context.Background(), 3))
+		assert.Equal(t, 10, f.Used())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		assert.Error(t, f.Acquire(ctx, 1))
+
+		f.Release(7, 0, nil)
+		assert.Equal(t, 3, f.Used())
+	})
+
+	t.Run("heavy waiter is not starved by light tasks", func(t *testing.T) {
+		f := NewFixed(10)
+		assert.NoError(t, f.Acquire(context.Background(), 5))
+
+		heavy := make(chan struct{})
+		go func() {
+			assert.NoError(t, f.Acquire(context.Background(), 10))
+			close(heavy)
+		}()
+		assert.Eventually(t, func() bool {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			return f.waiters.Len() == 1
+		}, time.Second, time.Millisecond)
+
+		// свободная емкость есть, но легкая задача встает в очередь за тяжелой
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		assert.Error(t, f.Acquire(ctx, 1))
+
+		f.Release(5, 0, nil)
+		select {
+		case <-heavy:
+		case <-time.After(time.Second):
+			t.Fatal("heavy task was not admitted")
+		}
+		assert.Equal(t, 10, f.Used())
+	})
+
+	t.Run("task heavier than shrunk adaptive limit runs alone", func(t *testing.T) {
+		cfg := testConfig()
+		cfg.InitialLimit = 2
+		a := NewAdaptive(cfg)
+
+		assert.NoError(t, a.Acquire(context.Background(), 5))
+		assert.Equal(t, 5, a.Used())
+		assert.Equal(t, 10, a.Capacity())
+	})
+}
+
+func TestRate(t *testing.T) {
+	fake := clock.NewFake(time.Now())
+	clock.Set(fake)
+	defer clock.Set(clock.Real{})
+
+	r := NewRate(10, 2)
+
+	// запас burst выдается сразу
+	assert.NoError(t, r.Wait(context.Background()))
+	assert.NoError(t, r.Wait(context.Background()))
+
+	done := make(chan error)
+	go func() {
+		done <- r.WaitN(context.Background(), 5)
+	}()
+
+	fake.BlockUntil(1)
+	fake.Advance(400 * time.Millisecond)
+	select {
+	case <-done:
+		t.Fatal("tokens were given too early")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	fake.Advance(100 * time.Millisecond)
+	assert.NoError(t, <-done)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, r.WaitN(ctx, 100), context.Canceled)
+}
@@ -0,0 +1,71 @@
+package limiter
+
+import (
+	"context"
+	"ioboundlimiter/internal/clock"
+	"sync"
+	"time"
+)
+
+// Rate - token bucket: perSecond единиц в секунду с запасом burst.
+// Единицами могут быть запросы или байты.
+type Rate struct {
+	mu        sync.Mutex
+	perSecond float64
+	burst     float64
+	tokens    float64
+	last      time.Time
+}
+
+func NewRate(perSecond float64, burst int) *Rate {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Rate{
+		perSecond: perSecond,
+		burst:     float64(burst),
+		tokens:    float64(burst),
+		last:      clock.Now(),
+	}
+}
+
+// Full - запас восполнен до burst: новый Rate вел бы себя так же, поэтому
+// такое ведро можно удалить без потери ограничения
+func (r *Rate) Full() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.tokens+clock.Since(r.last).Seconds()*r.perSecond >= r.burst
+}
+
+func (r *Rate) Wait(ctx context.Context) error {
+	return r.WaitN(ctx, 1)
+}
+
+// WaitN резервирует n единиц и ждет, пока они станут доступны. n может быть
+// больше burst - тогда ожидание просто дольше.
+func (r *Rate) WaitN(ctx context.Context, n int) error {
+	r.mu.Lock()
+	now := clock.Now()
+	r.tokens = min(r.burst, r.tokens+now.Sub(r.last).Seconds()*r.perSecond)
+	r.last = now
+	r.tokens -= float64(n)
+	deficit := -r.tokens
+	r.mu.Unlock()
+
+	if deficit <= 0 {
+		return nil
+	}
+
+	timer := clock.Get().NewTimer(time.Duration(deficit / r.perSecond * float64(time.Second)))
+	defer timer.Stop()
+
+	select {
+	case <-timer.C():
+		return nil
+	case <-ctx.Done():
+		r.mu.Lock()
+		r.tokens += float64(n)
+		r.mu.Unlock()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,111 @@
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Минимальная реализация метрик в текстовом формате Prometheus,
+// чтобы не тянуть клиентскую библиотеку ради пары счетчиков.
+
+type metric interface {
+	write(sb *strings.Builder)
+}
+
+var (
+	registry     = make(map[string]metric)
+	lockRegistry = &sync.RWMutex{}
+)
+
+type Counter struct {
+	name  string
+	help  string
+	value atomic.Int64
+}
+
+func NewCounter(name, help string) *Counter {
+	c := &Counter{name: name, help: help}
+	register(name, c)
+	return c
+}
+
+func (c *Counter) Inc() {
+	c.value.Add(1)
+}
+
+func (c *Counter) Add(n int64) {
+	c.value.Add(n)
+}
+
+func (c *Counter) Value() int64 {
+	return c.value.Load()
+}
+
+func (c *Counter) write(sb *strings.Builder) {
+	writeHeader(sb, c.name, c.help, "counter")
+	fmt.Fprintf(sb, "%s %d\n", c.name, c.value.Load())
+}
+
+// GaugeFunc считывает значение в момент запроса метрик.
+type GaugeFunc struct {
+	name string
+	help string
+	fn   func() float64
+}
+
+func NewGaugeFunc(name, help string, fn func() float64) *GaugeFunc {
+	g := &GaugeFunc{name: name, help: help, fn: fn}
+	register(name, g)
+	return g
+}
+
+func (g *GaugeFunc) write(sb *strings.Builder) {
+	writeHeader(sb, g.name, g.help, "gauge")
+	fmt.Fprintf(sb, "%s %g\n", g.name, g.fn())
+}
+
+func register(name string, m metric) {
+	lockRegistry.Lock()
+	registry[name] = m
+	lockRegistry.Unlock()
+}
+
+func writeHeader(sb *strings.Builder, name, help, kind string) {
+	fmt.Fprintf(sb, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(sb, "# TYPE %s %s\n", name, kind)
+}
+
+func Render() string {
+	lockRegistry.RLock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	sb := &strings.Builder{}
+	for _, name := range names {
+		registry[name].write(sb)
+	}
+	lockRegistry.RUnlock()
+
+	return sb.String()
+}
+
+// Handler godoc
+//
+//	@Summary		Метрики
+//	@Description	Метрики сервиса в текстовом формате Prometheus
+//	@Tags			metrics
+//	@Produce		plain
+//	@Success		200	{string}	string
+//	@Router			/metrics [get]
+func Handler(c *gin.Context) {
+	c.String(http.StatusOK, Render())
+}
@@ -1,33 +1,81 @@
 package middleware
 
 import (
+	"crypto/subtle"
+	"fmt"
+	"ioboundlimiter/internal/apierr"
 	"ioboundlimiter/internal/auth"
-	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
+const maxRequestIDLength = 128
+
+// RequestID берет X-Request-ID клиента или создает новый. ID возвращается в
+// заголовке ответа и попадает в каждую ошибку API.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader("X-Request-ID")
+		if id == "" || len(id) > maxRequestIDLength {
+			id = uuid.New().String()
+		}
+
+		c.Set("request_id", id)
+		c.Header("X-Request-ID", id)
+		c.Next()
+	}
+}
+
+// queryTokenKey - токен из параметра access_token, вынутый StripQueryToken
+const queryTokenKey = "query_access_token"
+
+// StripQueryToken убирает access_token из строки запроса до логирования,
+// чтобы токен не попал в журнал доступа. Ставится перед gin.Logger,
+// сам токен проверяет StreamAuthMiddleware.
+func StripQueryToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query := c.Request.URL.Query()
+		if query.Has("access_token") {
+			c.Set(queryTokenKey, query.Get("access_token"))
+			query.Del("access_token")
+			c.Request.URL.RawQuery = query.Encode()
+		}
+		c.Next()
+	}
+}
+
 func AuthMiddleware() gin.HandlerFunc {
+	return authenticate(false)
+}
+
+// StreamAuthMiddleware дополнительно принимает токен в параметре access_token:
+// браузерные EventSource и WebSocket не умеют передавать заголовок Authorization
+func StreamAuthMiddleware() gin.HandlerFunc {
+	return authenticate(true)
+}
+
+func authenticate(allowQuery bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
+		if token := c.GetString(queryTokenKey); authHeader == "" && allowQuery && token != "" {
+			authHeader = "Bearer " + token
+		}
 		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header is required"})
-			c.Abort()
+			apierr.Abort(c, apierr.ErrUnauthorized)
 			return
 		}
 
 		tokenParts := strings.Split(authHeader, " ")
 		if len(tokenParts) != 2 || tokenParts[0] != "Bearer" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization format. Expected: Bearer <token>"})
-			c.Abort()
+			apierr.Abort(c, apierr.ErrUnauthorized.WithDetail("Invalid authorization format. Expected: Bearer <token>"))
 			return
 		}
 
 		claims, err := auth.ValidateAccessToken(tokenParts[1])
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token", "details": err.Error()})
-			c.Abort()
+			apierr.Abort(c, apierr.ErrInvalidToken.Wrap(err).WithDetail("Invalid token: "+err.Error()))
 			return
 		}
 
@@ -35,3 +83,69 @@ func AuthMiddleware() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// Deprecated помечает устаревший маршрут заголовком Deprecation и ссылкой
+// на маршрут, который его заменяет
+func Deprecated(successor string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Deprecation", "true")
+		c.Header("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", successor))
+		c.Next()
+	}
+}
+
+var adminToken string
+
+// SetAdminToken задает токен для админских ручек. Пока токен пустой,
+// админские ручки отключены.
+func SetAdminToken(token string) {
+	adminToken = token
+}
+
+// workerTokens - токены удаленных воркеров: ID воркера -> токен
+var workerTokens map[string]string
+
+// SetWorkerTokens задает токены удаленных воркеров. Пока токенов нет,
+// протокол удаленных воркеров отключен.
+func SetWorkerTokens(tokens map[string]string) {
+	workerTokens = tokens
+}
+
+// WorkerMiddleware пускает к /worker/* только удаленных воркеров по
+// X-Worker-Token, токены пользователей здесь не подходят
+func WorkerMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if len(workerTokens) == 0 {
+			apierr.Abort(c, apierr.ErrWorkerDisabled)
+			return
+		}
+
+		token := c.GetHeader("X-Worker-Token")
+		for workerID, workerToken := range workerTokens {
+			if token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(workerToken)) == 1 {
+				c.Set("worker_id", workerID)
+				c.Next()
+				return
+			}
+		}
+
+		apierr.Abort(c, apierr.ErrWorkerToken)
+	}
+}
+
+func AdminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if adminToken == "" {
+			apierr.Abort(c, apierr.ErrAdminDisabled)
+			return
+		}
+
+		token := c.GetHeader("X-Admin-Token")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+			apierr.Abort(c, apierr.ErrAdminToken)
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,39 @@
+// Package netguard не дает исходящим запросам сервиса уйти во внутреннюю сеть
+package netguard
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"syscall"
+)
+
+// cgnat - общий адресный блок провайдеров (RFC 6598)
+var cgnat = netip.MustParsePrefix("100.64.0.0/10")
+
+// Control - net.Dialer.Control, который не дает соединиться с внутренним
+// адресом. Вызывается после разрешения DNS, поэтому имя, указывающее на
+// внутренний адрес, не поможет
+func Control(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return fmt.Errorf("cannot parse dial address %q: %w", address, err)
+	}
+	if IsPrivate(addr) {
+		return fmt.Errorf("address %s is not allowed: private network", addr)
+	}
+	return nil
+}
+
+// IsPrivate - loopback, link-local (в том числе metadata облаков), RFC 1918
+// и другие внутренние адреса
+func IsPrivate(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() || cgnat.Contains(addr)
+}
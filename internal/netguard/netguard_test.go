@@ -0,0 +1,24 @@
+package netguard
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsPrivate(t *testing.T) {
+	for _, addr := range []string{"127.0.0.1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254", "100.64.0.1", "0.0.0.0", "::1", "fe80::1", "fd00::1", "::ffff:127.0.0.1"} {
+		assert.True(t, IsPrivate(netip.MustParseAddr(addr)), addr)
+	}
+	for _, addr := range []string{"8.8.8.8", "1.1.1.1", "2606:4700::1111"} {
+		assert.False(t, IsPrivate(netip.MustParseAddr(addr)), addr)
+	}
+}
+
+func TestControl(t *testing.T) {
+	assert.ErrorContains(t, Control("tcp", "127.0.0.1:80", nil), "private network")
+	assert.ErrorContains(t, Control("tcp6", "[::1]:443", nil), "private network")
+	assert.NoError(t, Control("tcp", "8.8.8.8:53", nil))
+	assert.Error(t, Control("tcp", "no port", nil))
+}
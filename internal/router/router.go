@@ -0,0 +1,93 @@
+// Package router собирает HTTP API сервиса: middleware и маршруты.
+// Настройка воркеров и хранилища остается вызывающему.
+package router
+
+import (
+	"fmt"
+	"ioboundlimiter/internal/apierr"
+	"ioboundlimiter/internal/handlers"
+	"ioboundlimiter/internal/metrics"
+	"ioboundlimiter/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// New создает gin.Engine со всеми маршрутами API
+func New() *gin.Engine {
+	r := gin.New()
+	// access_token потоков убирается из URL до того, как его увидит журнал
+	r.Use(middleware.StripQueryToken(), gin.Logger(), middleware.RequestID())
+	// паника в обработчике - тоже ошибка API с request_id
+	r.Use(gin.CustomRecovery(func(c *gin.Context, recovered any) {
+		apierr.Abort(c, fmt.Errorf("panic: %v", recovered))
+	}))
+	r.NoRoute(func(c *gin.Context) {
+		apierr.Abort(c, apierr.ErrRouteNotFound)
+	})
+
+	r.GET("/register", handlers.RegisterHandler)
+	r.POST("/status", middleware.Deprecated("/v1/tasks/{id}"), handlers.GetHandle)
+	r.POST("/group/status", middleware.AuthMiddleware(), handlers.GroupStatusHandle)
+	r.GET("/result/:uuid", middleware.AuthMiddleware(), middleware.Deprecated("/v1/tasks/{id}/result"), handlers.ResultHandle)
+	r.GET("/metrics", metrics.Handler)
+
+	// обновляют как раз истекший access токен, поэтому без AuthMiddleware:
+	// пару проверяет сам обработчик
+	r.POST("/api/refresh", handlers.RefreshHandler)
+
+	api := r.Group("/api")
+	api.Use(middleware.AuthMiddleware()) //Только авторизованные пользователи могут удалять и создавать таски
+	{
+		api.POST("/add", middleware.Deprecated("/v1/tasks"), handlers.AddHandle)
+		api.DELETE("/delete", middleware.Deprecated("/v1/tasks/{id}"), handlers.DeleteHandle)
+		api.POST("/batch", handlers.BatchHandle)
+		api.POST("/group/cancel", handlers.GroupCancelHandle)
+		api.GET("/queue", handlers.QueueHandle)
+		api.POST("/webhooks", handlers.WebhookHandle)
+	}
+
+	v1 := r.Group("/v1")
+	v1.Use(middleware.AuthMiddleware())
+	{
+		tasks := v1.Group("/tasks")
+		tasks.POST("", handlers.CreateTaskHandle)
+		tasks.GET("", handlers.ListTasksHandle)
+		tasks.GET("/:id", handlers.GetTaskHandle)
+		tasks.PATCH("/:id", handlers.PatchTaskHandle)
+		tasks.DELETE("/:id", handlers.DeleteTaskHandle)
+		tasks.POST("/:id/cancel", handlers.CancelTaskHandle)
+		tasks.GET("/:id/result", handlers.TaskResultHandle)
+		tasks.GET("/:id/history", handlers.TaskHistoryHandle)
+		tasks.GET("/:id/wait", handlers.WaitTaskHandle)
+
+		v1.POST("/bulk", handlers.BulkHandle)
+		v1.GET("/bulk", handlers.BulkJobsHandle)
+		v1.GET("/bulk/:id", handlers.BulkJobHandle)
+	}
+
+	// EventSource и WebSocket в браузере не умеют передавать заголовки,
+	// поэтому токен можно передать в запросе
+	r.GET("/v1/events", middleware.StreamAuthMiddleware(), handlers.EventsHandle)
+	r.GET("/v1/ws", middleware.StreamAuthMiddleware(), handlers.WebSocketHandle)
+
+	// Протокол удаленных воркеров: аренда задач, продление и подтверждение
+	remote := r.Group("/worker")
+	remote.Use(middleware.WorkerMiddleware())
+	{
+		remote.POST("/lease", handlers.LeaseHandle)
+		remote.POST("/heartbeat", handlers.LeaseHeartbeatHandle)
+		remote.POST("/ack", handlers.LeaseAckHandle)
+	}
+
+	admin := r.Group("/admin")
+	admin.Use(middleware.AdminMiddleware())
+	{
+		admin.GET("/queues", handlers.IntrospectHandle)
+		admin.GET("/breakers", handlers.BreakersHandle)
+		admin.POST("/bulk", handlers.AdminBulkHandle)
+		admin.GET("/bulk", handlers.AdminBulkJobsHandle)
+		admin.GET("/bulk/:id", handlers.AdminBulkJobHandle)
+	}
+
+	return r
+}
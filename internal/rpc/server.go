@@ -0,0 +1,143 @@
+// Package rpc - gRPC API сервиса поверх тех же хранилища, воркеров и JWT,
+// что и HTTP API.
+package rpc
+
+//go:generate protoc -I . --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative pb/tasks.proto
+
+import (
+	"context"
+	"ioboundlimiter/internal/auth"
+	"ioboundlimiter/internal/rpc/pb"
+	"log"
+	"strings"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+)
+
+// NewServer создает gRPC сервер с сервисами Tasks и Auth
+func NewServer() *grpc.Server {
+	srv := grpc.NewServer(
+		grpc.UnaryInterceptor(unaryAuth),
+		grpc.StreamInterceptor(streamAuth),
+	)
+	pb.RegisterTasksServer(srv, &tasksServer{})
+	pb.RegisterAuthServer(srv, &authServer{})
+	// чтобы grpcurl и подобные клиенты работали без .proto файла
+	reflection.Register(srv)
+	return srv
+}
+
+// Stop дожидается завершения вызовов, но не дольше ctx: потоки Watch сами
+// не заканчиваются, поэтому по истечении ctx соединения обрываются.
+func Stop(ctx context.Context, srv *grpc.Server) {
+	done := make(chan struct{})
+	go func() {
+		srv.GracefulStop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Printf("gRPC graceful stop timed out: %v", ctx.Err())
+		srv.Stop()
+		<-done
+	}
+}
+
+type userKey struct{}
+
+func userID(ctx context.Context) string {
+	id, _ := ctx.Value(userKey{}).(string)
+	return id
+}
+
+// authenticate проверяет access токен из метаданных authorization для
+// методов сервиса Tasks, остальные методы доступны без токена
+func authenticate(ctx context.Context, method string) (context.Context, error) {
+	if !strings.HasPrefix(method, "/"+pb.Tasks_ServiceDesc.ServiceName+"/") {
+		return ctx, nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return nil, status.Error(codes.Unauthenticated, "authorization metadata is required")
+	}
+
+	token, ok := strings.CutPrefix(values[0], "Bearer ")
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "invalid authorization format. Expected: Bearer <token>")
+	}
+
+	claims, err := auth.ValidateAccessToken(token)
+	if err != nil {
+		return nil, status.Errorf(codes.Unauthenticated, "invalid token: %v", err)
+	}
+
+	return context.WithValue(ctx, userKey{}, claims.UserID), nil
+}
+
+func unaryAuth(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, err := authenticate(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// authStream подменяет контекст потока контекстом с пользователем
+type authStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s authStream) Context() context.Context {
+	return s.ctx
+}
+
+func streamAuth(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := authenticate(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, authStream{ServerStream: ss, ctx: ctx})
+}
+
+type authServer struct {
+	pb.UnimplementedAuthServer
+}
+
+func (s *authServer) Register(ctx context.Context, req *pb.RegisterRequest) (*pb.Tokens, error) {
+	id := uuid.New().String()
+
+	access, refresh, err := auth.GenerateTokens(id)
+	if err != nil {
+		log.Printf("Cannot create jwt tokens: %v", err)
+		return nil, status.Error(codes.Internal, "cannot create tokens")
+	}
+
+	if err := auth.AddTokensToBd(access, refresh); err != nil {
+		log.Printf("Cannot add tokens to BD: %v", err)
+		return nil, status.Error(codes.Internal, "cannot add tokens")
+	}
+	return &pb.Tokens{UserId: id, Access: access, Refresh: refresh}, nil
+}
+
+func (s *authServer) Refresh(ctx context.Context, req *pb.RefreshRequest) (*pb.Tokens, error) {
+	if req.Access == "" || req.Refresh == "" {
+		return nil, status.Error(codes.InvalidArgument, "access and refresh tokens are required")
+	}
+
+	id, access, refresh, err := auth.RotateTokens(req.Access, req.Refresh)
+	if err != nil {
+		log.Printf("Cannot refresh tokens: %v", err)
+		return nil, status.Error(codes.Unauthenticated, "cannot refresh tokens")
+	}
+	return &pb.Tokens{UserId: id, Access: access, Refresh: refresh}, nil
+}
@@ -0,0 +1,194 @@
+package rpc
+
+import (
+	"context"
+	"ioboundlimiter/internal/rpc/pb"
+	"ioboundlimiter/internal/storage"
+	"ioboundlimiter/internal/workers"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestServer(t *testing.T) {
+	workers.RegisterRemoteType("rpc-remote")
+	workers.InitWorkers()
+	defer workers.Shutdown()
+
+	listener := bufconn.Listen(1 << 20)
+	srv := NewServer()
+	go srv.Serve(listener)
+	defer Stop(context.Background(), srv)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	authClient := pb.NewAuthClient(conn)
+	tasks := pb.NewTasksClient(conn)
+
+	login := func() (context.Context, *pb.Tokens) {
+		tokens, err := authClient.Register(context.Background(), &pb.RegisterRequest{})
+		assert.NoError(t, err)
+		return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+tokens.Access), tokens
+	}
+
+	// задачи удаленного типа только ставятся в очередь и не выполняются
+	submit := func(ctx context.Context, name string) *pb.Task {
+		resp, err := tasks.Submit(ctx, &pb.SubmitRequest{Name: name, Type: "rpc-remote", Payload: []byte(`{"n":1}`)})
+		assert.NoError(t, err)
+		return resp.Task
+	}
+
+	t.Run("requires token", func(t *testing.T) {
+		_, err := tasks.List(context.Background(), &pb.ListRequest{})
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	})
+
+	t.Run("submit, get, list, cancel", func(t *testing.T) {
+		ctx, _ := login()
+
+		task := submit(ctx, "grpc task")
+		assert.Equal(t, storage.StatePending, task.State)
+		assert.JSONEq(t, `{"n":1}`, string(task.Payload))
+
+		got, err := tasks.Get(ctx, &pb.GetRequest{Id: task.Id})
+		assert.NoError(t, err)
+		assert.Equal(t, "grpc task", got.Name)
+
+		list, err := tasks.List(ctx, &pb.ListRequest{States: []string{storage.StatePending}})
+		assert.NoError(t, err)
+		assert.Equal(t, int32(1), list.Total)
+
+		canceled, err := tasks.Cancel(ctx, &pb.CancelRequest{Id: task.Id})
+		assert.NoError(t, err)
+		assert.Equal(t, storage.StateCanceled, canceled.State)
+
+		_, err = tasks.Cancel(ctx, &pb.CancelRequest{Id: task.Id})
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	})
+
+	t.Run("submit with priority, schedule and labels", func(t *testing.T) {
+		ctx, _ := login()
+		at := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+
+		resp, err := tasks.Submit(ctx, &pb.SubmitRequest{
+			Name:        "scheduled",
+			Type:        "rpc-remote",
+			Priority:    5,
+			ScheduledAt: timestamppb.New(at),
+			Labels:      map[string]string{"team": "core"},
+		})
+		assert.NoError(t, err)
+
+		stat, err := storage.GetResponse(resp.Task.Id)
+		assert.NoError(t, err)
+		assert.Equal(t, 5, stat.Priority)
+		assert.True(t, at.Equal(stat.ScheduledAt))
+		assert.Equal(t, map[string]string{"team": "core"}, stat.Labels)
+	})
+
+	t.Run("other user's task", func(t *testing.T) {
+		owner, _ := login()
+		other, _ := login()
+
+		task := submit(owner, "private")
+		_, err := tasks.Get(other, &pb.GetRequest{Id: task.Id})
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+		_, err = tasks.Get(other, &pb.GetRequest{Id: "missing"})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	})
+
+	t.Run("invalid task", func(t *testing.T) {
+		ctx, _ := login()
+
+		_, err := tasks.Submit(ctx, &pb.SubmitRequest{})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+		_, err = tasks.Submit(ctx, &pb.SubmitRequest{Name: "bad", Payload: []byte("{")})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+		for _, req := range []*pb.SubmitRequest{
+			{Name: "bad", Type: "rpc-remote", Cost: -1},
+			{Name: "bad", Type: "rpc-remote", CacheTtl: -1},
+			{Name: "bad", Type: "rpc-remote", CallbackUrl: "not a url", CallbackSecret: "s"},
+			{Name: "bad", Type: "no-such-type"},
+			{Name: "bad", Type: "rpc-remote", Priority: 11},
+			{Name: "bad", Type: "rpc-remote", Labels: map[string]string{"": "empty key"}},
+		} {
+			_, err = tasks.Submit(ctx, req)
+			assert.Equal(t, codes.InvalidArgument, status.Code(err), req.String())
+		}
+	})
+
+	t.Run("watch ends when task finishes", func(t *testing.T) {
+		ctx, _ := login()
+		task := submit(ctx, "watched")
+
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		stream, err := tasks.Watch(ctx, &pb.WatchRequest{TaskId: task.Id})
+		assert.NoError(t, err)
+
+		first, err := stream.Recv()
+		assert.NoError(t, err)
+		assert.Equal(t, storage.StatePending, first.Task.State)
+
+		_, err = tasks.Cancel(ctx, &pb.CancelRequest{Id: task.Id})
+		assert.NoError(t, err)
+
+		var last *pb.TaskEvent
+		for {
+			event, err := stream.Recv()
+			if err != nil {
+				break
+			}
+			last = event
+		}
+		if assert.NotNil(t, last) {
+			assert.Equal(t, storage.StateCanceled, last.Task.State)
+			assert.Greater(t, last.Seq, first.Seq)
+		}
+	})
+
+	t.Run("refresh", func(t *testing.T) {
+		_, tokens := login()
+
+		refreshed, err := authClient.Refresh(context.Background(), &pb.RefreshRequest{Access: tokens.Access, Refresh: tokens.Refresh})
+		assert.NoError(t, err)
+		assert.Equal(t, tokens.UserId, refreshed.UserId)
+
+		_, err = authClient.Refresh(context.Background(), &pb.RefreshRequest{Access: tokens.Access, Refresh: "bad"})
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	})
+}
+
+func TestGrpcCode(t *testing.T) {
+	cases := map[int]codes.Code{
+		http.StatusBadRequest:            codes.InvalidArgument,
+		http.StatusForbidden:             codes.PermissionDenied,
+		http.StatusConflict:              codes.FailedPrecondition,
+		http.StatusPreconditionFailed:    codes.FailedPrecondition,
+		http.StatusRequestEntityTooLarge: codes.ResourceExhausted,
+		http.StatusUnprocessableEntity:   codes.FailedPrecondition,
+		http.StatusServiceUnavailable:    codes.Unavailable,
+		http.StatusTeapot:                codes.Internal,
+	}
+	for httpStatus, code := range cases {
+		assert.Equal(t, code, grpcCode(httpStatus), http.StatusText(httpStatus))
+	}
+}
@@ -0,0 +1,280 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"ioboundlimiter/internal/apierr"
+	"ioboundlimiter/internal/rpc/pb"
+	"ioboundlimiter/internal/storage"
+	"ioboundlimiter/internal/watch"
+	"ioboundlimiter/internal/workers"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 500
+	maxTypeLength    = 64
+	maxPriority      = 10
+	maxLabels        = 16
+	maxLabelKey      = 64
+	maxLabelValue    = 256
+)
+
+type tasksServer struct {
+	pb.UnimplementedTasksServer
+}
+
+func toTask(uuid string, stat storage.Status) *pb.Task {
+	task := &pb.Task{
+		Id:        uuid,
+		Name:      stat.Name,
+		Type:      stat.Type,
+		State:     stat.State,
+		Status:    stat.CurStatus,
+		Cost:      int32(stat.Cost),
+		GroupId:   stat.GroupID,
+		Payload:   stat.Payload,
+		CreatedAt: timestamppb.New(stat.DateCreate),
+		Result:    stat.Result,
+	}
+	if !stat.FinishedAt.IsZero() {
+		task.FinishedAt = timestamppb.New(stat.FinishedAt)
+	}
+	if !stat.Heartbeat.IsZero() {
+		task.Heartbeat = timestamppb.New(stat.Heartbeat)
+	}
+	if stat.Progress != nil {
+		task.Progress = &pb.Progress{Done: stat.Progress.Done, Total: stat.Progress.Total, Percent: stat.Progress.Percent}
+	}
+	if info := stat.ErrorInfo(); info != nil {
+		task.Error = &pb.TaskError{Code: info.Code, Message: info.Message, Stack: info.Stack}
+	}
+	if stat.Blob != nil {
+		task.Blob = &pb.Blob{ContentType: stat.Blob.ContentType, Size: stat.Blob.Size}
+	}
+	return task
+}
+
+// toStatus переводит ошибку общей с HTTP API логики в ошибку gRPC
+func toStatus(err error) error {
+	apiErr := apierr.From(err)
+	return status.Error(grpcCode(apiErr.Status), apiErr.Detail)
+}
+
+func grpcCode(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict, http.StatusPreconditionFailed, http.StatusUnprocessableEntity:
+		return codes.FailedPrecondition
+	case http.StatusRequestEntityTooLarge:
+		return codes.ResourceExhausted
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	default:
+		return codes.Internal
+	}
+}
+
+// ownTask загружает задачу и проверяет, что она принадлежит пользователю
+func ownTask(ctx context.Context, uuid string) (storage.Status, error) {
+	stat, err := storage.GetOwned(uuid, userID(ctx))
+	if err != nil {
+		log.Printf("User %s cannot access task %s: %v", userID(ctx), uuid, err)
+		return storage.Status{}, toStatus(err)
+	}
+	return stat, nil
+}
+
+// validateSubmit проверяет запрос так же, как HTTP API проверяет тело POST /v1/tasks
+func validateSubmit(req *pb.SubmitRequest) error {
+	switch {
+	case req.Name == "":
+		return status.Error(codes.InvalidArgument, "name is required")
+	case req.Cost < 0:
+		return status.Error(codes.InvalidArgument, "cost should be positive")
+	case len(req.Type) > maxTypeLength:
+		return status.Errorf(codes.InvalidArgument, "type is longer than %d", maxTypeLength)
+	case req.CacheTtl < 0:
+		return status.Error(codes.InvalidArgument, "cache_ttl should be positive")
+	case len(req.Payload) > 0 && !json.Valid(req.Payload):
+		return status.Error(codes.InvalidArgument, "payload should be JSON")
+	case req.Priority < -maxPriority || req.Priority > maxPriority:
+		return status.Errorf(codes.InvalidArgument, "priority should be from %d to %d", -maxPriority, maxPriority)
+	case req.ScheduledAt != nil && !req.ScheduledAt.IsValid():
+		return status.Error(codes.InvalidArgument, "scheduled_at is invalid")
+	case len(req.Labels) > maxLabels:
+		return status.Errorf(codes.InvalidArgument, "labels are more than %d", maxLabels)
+	}
+
+	for key, value := range req.Labels {
+		if key == "" || len(key) > maxLabelKey || len(value) > maxLabelValue {
+			return status.Errorf(codes.InvalidArgument, "label key should be 1-%d characters, value up to %d", maxLabelKey, maxLabelValue)
+		}
+	}
+
+	if req.CallbackUrl != "" {
+		if u, err := url.Parse(req.CallbackUrl); err != nil || u.Scheme == "" || u.Host == "" {
+			return status.Error(codes.InvalidArgument, "callback_url should be an absolute URL")
+		}
+	}
+	return nil
+}
+
+func (s *tasksServer) Submit(ctx context.Context, req *pb.SubmitRequest) (*pb.SubmitResponse, error) {
+	if err := validateSubmit(req); err != nil {
+		return nil, err
+	}
+
+	opts := storage.TaskOptions{
+		Owner:          userID(ctx),
+		Cost:           int(req.Cost),
+		Type:           req.Type,
+		Payload:        req.Payload,
+		Priority:       int(req.Priority),
+		Labels:         req.Labels,
+		CallbackURL:    req.CallbackUrl,
+		CallbackSecret: req.CallbackSecret,
+	}
+	if req.ScheduledAt != nil {
+		opts.ScheduledAt = req.ScheduledAt.AsTime()
+	}
+
+	uuid, memo, err := workers.Submit(req.Name, opts, req.Memoize, time.Duration(req.CacheTtl)*time.Second)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	stat, err := storage.GetResponse(uuid)
+	if err != nil {
+		log.Printf("Task %s disappeared after creation: %v", uuid, err)
+		return nil, status.Error(codes.NotFound, "Not found current task")
+	}
+
+	resp := &pb.SubmitResponse{Task: toTask(uuid, stat)}
+	if req.Memoize {
+		resp.Cache = memo
+	}
+	return resp, nil
+}
+
+func (s *tasksServer) Get(ctx context.Context, req *pb.GetRequest) (*pb.Task, error) {
+	stat, err := ownTask(ctx, req.Id)
+	if err != nil {
+		return nil, err
+	}
+	return toTask(req.Id, stat), nil
+}
+
+func (s *tasksServer) List(ctx context.Context, req *pb.ListRequest) (*pb.ListResponse, error) {
+	limit := int(req.Limit)
+	if limit == 0 {
+		limit = defaultListLimit
+	}
+	if limit < 0 || limit > maxListLimit || req.Offset < 0 {
+		return nil, status.Error(codes.InvalidArgument, "invalid filters")
+	}
+
+	filter := storage.Filter{
+		Owner:   userID(ctx),
+		States:  req.States,
+		Type:    req.Type,
+		GroupID: req.GroupId,
+		Name:    req.Name,
+	}
+	if req.CreatedAfter != nil {
+		filter.CreatedAfter = req.CreatedAfter.AsTime()
+	}
+	if req.CreatedBefore != nil {
+		filter.CreatedBefore = req.CreatedBefore.AsTime()
+	}
+
+	records, total := storage.ListTasks(filter, int(req.Offset), limit)
+
+	resp := &pb.ListResponse{Tasks: make([]*pb.Task, 0, len(records)), Total: int32(total)}
+	for _, record := range records {
+		resp.Tasks = append(resp.Tasks, toTask(record.UUID, record.Status))
+	}
+	return resp, nil
+}
+
+func (s *tasksServer) Cancel(ctx context.Context, req *pb.CancelRequest) (*pb.Task, error) {
+	stat, err := ownTask(ctx, req.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	if storage.IsTerminal(stat.State) {
+		return nil, status.Errorf(codes.FailedPrecondition, "task is already finished: %s", stat.State)
+	}
+
+	if err := workers.CancelTask(req.Id); err != nil {
+		log.Printf("Task %s is not canceled: %v", req.Id, err)
+		return nil, status.Error(codes.FailedPrecondition, "task cannot be canceled")
+	}
+
+	stat, _ = storage.GetResponse(req.Id)
+	return toTask(req.Id, stat), nil
+}
+
+func (s *tasksServer) Watch(req *pb.WatchRequest, stream grpc.ServerStreamingServer[pb.TaskEvent]) error {
+	scope := watch.Scope{Owner: userID(stream.Context()), TaskID: req.TaskId, GroupID: req.GroupId}
+	if err := scope.Check(); err != nil {
+		return toStatus(err)
+	}
+
+	sub, missed, tracker := watch.Subscribe(scope, req.Since)
+	defer sub.Close()
+
+	send := func(change storage.Change) bool {
+		event := &pb.TaskEvent{Seq: change.Seq, TaskId: change.UUID, Deleted: change.Deleted}
+		if !change.Deleted {
+			event.Task = toTask(change.UUID, change.Status)
+		}
+		if err := stream.Send(event); err != nil {
+			log.Printf("Cannot send task event: %v", err)
+			return false
+		}
+
+		tracker.Apply(change)
+		return !tracker.Done()
+	}
+
+	for _, change := range missed {
+		if !send(change) {
+			return nil
+		}
+	}
+	if tracker.Done() {
+		return nil
+	}
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case change, ok := <-sub.C:
+			if !ok {
+				return status.Error(codes.ResourceExhausted, "client is too slow, resume with since")
+			}
+			if !send(change) {
+				return nil
+			}
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// Каждое изменение задачи (создание, смена состояния, прогресса, удаление)
+// получает возрастающий номер и рассылается подписчикам. Последние
+// changeLogSize изменений хранятся, чтобы подписчик мог продолжить с
+// известного номера после переподключения. Журнал помнит только номер и
+// версию задачи: полное состояние при продолжении читается из хранилища.
+
+const (
+	changeLogSize      = 10000
+	subscriptionBuffer = 256
+)
+
+// Change - изменение задачи. Status - состояние задачи после изменения,
+// у удаленной задачи - последнее состояние перед удалением.
+type Change struct {
+	Seq     uint64
+	UUID    string
+	Deleted bool
+	Status  Status
+}
+
+type Subscription struct {
+	// C закрывается при Close или если подписчик не успевает читать изменения
+	C     <-chan Change
+	ch    chan Change
+	match func(Change) bool
+	// Start - номер последнего изменения на момент подписки
+	Start uint64
+}
+
+// loggedChange - запись журнала: поля для отбора подписчиком и версия
+// задачи после изменения
+type loggedChange struct {
+	seq     uint64
+	uuid    string
+	deleted bool
+	state   string
+	version int
+	owner   string
+	groupID string
+}
+
+func newLoggedChange(change Change) loggedChange {
+	return loggedChange{
+		seq:     change.Seq,
+		uuid:    change.UUID,
+		deleted: change.Deleted,
+		state:   change.Status.State,
+		version: change.Status.Version,
+		owner:   change.Status.Owner,
+		groupID: change.Status.GroupID,
+	}
+}
+
+// change - изменение с урезанным Status, достаточным для match
+func (l loggedChange) change() Change {
+	return Change{Seq: l.seq, UUID: l.uuid, Deleted: l.deleted, Status: Status{
+		State:   l.state,
+		Version: l.version,
+		Owner:   l.owner,
+		GroupID: l.groupID,
+	}}
+}
+
+var (
+	changeSeq uint64
+	// changeLog - кольцевой буфер, изменение seq лежит в (seq-1) % changeLogSize
+	changeLog   = make([]loggedChange, changeLogSize)
+	subscribers = make(map[*Subscription]struct{})
+	lockChanges = &sync.Mutex{}
+)
+
+// Subscribe подписывает на изменения задач, для которых match возвращает true.
+// Если since > 0, также возвращает задачи, изменившиеся после since: по
+// одному изменению на задачу с ее текущим состоянием. false означает, что
+// часть изменений уже вытеснена из журнала или since из журнала до
+// перезапуска сервиса.
+func Subscribe(match func(Change) bool, since uint64) (*Subscription, []Change, bool) {
+	lockChanges.Lock()
+
+	ch := make(chan Change, subscriptionBuffer)
+	sub := &Subscription{C: ch, ch: ch, match: match, Start: changeSeq}
+	subscribers[sub] = struct{}{}
+
+	if since == 0 || since == changeSeq {
+		lockChanges.Unlock()
+		return sub, nil, true
+	}
+	if since > changeSeq {
+		lockChanges.Unlock()
+		return sub, nil, false
+	}
+
+	oldest := uint64(1)
+	if changeSeq > changeLogSize {
+		oldest = changeSeq - changeLogSize + 1
+	}
+
+	// последнее изменение каждой задачи, в порядке номеров
+	logged := []loggedChange{}
+	seen := make(map[string]bool)
+	for seq := changeSeq; seq >= max(since+1, oldest); seq-- {
+		record := changeLog[(seq-1)%changeLogSize]
+		if seen[record.uuid] || !match(record.change()) {
+			continue
+		}
+		seen[record.uuid] = true
+		logged = append(logged, record)
+	}
+	lockChanges.Unlock()
+	slices.Reverse(logged)
+
+	// хранилище читается без lockChanges: publish берет его под lockIOBound
+	missed := []Change{}
+	for _, record := range logged {
+		if record.deleted {
+			missed = append(missed, record.change())
+			continue
+		}
+		// задачу изменили или удалили после подписки - это придет в C
+		stat, err := GetResponse(record.uuid)
+		if err != nil || stat.Version != record.version {
+			continue
+		}
+		missed = append(missed, Change{Seq: record.seq, UUID: record.uuid, Status: stat})
+	}
+	return sub, missed, since+1 >= oldest
+}
+
+func (s *Subscription) Close() {
+	lockChanges.Lock()
+	defer lockChanges.Unlock()
+
+	if _, ok := subscribers[s]; ok {
+		delete(subscribers, s)
+		close(s.ch)
+	}
+}
+
+// publish вызывается под lockIOBound, чтобы номера шли в порядке изменений
+func publish(uuid string, stat Status, deleted bool) {
+	lockChanges.Lock()
+	defer lockChanges.Unlock()
+
+	changeSeq++
+	change := Change{Seq: changeSeq, UUID: uuid, Deleted: deleted, Status: stat}
+
+	changeLog[(changeSeq-1)%changeLogSize] = newLoggedChange(change)
+
+	for sub := range subscribers {
+		if !sub.match(change) {
+			continue
+		}
+		select {
+		case sub.ch <- change:
+		default:
+			// медленный подписчик переподключится с последнего полученного номера
+			delete(subscribers, sub)
+			close(sub.ch)
+		}
+	}
+}
+
+// WaitTerminal ждет, пока задача перейдет в конечное состояние. Если ctx
+// завершился раньше, возвращает текущее состояние задачи и ошибку ctx.
+func WaitTerminal(ctx context.Context, uuid string) (Status, error) {
+	sub, _, _ := Subscribe(func(change Change) bool { return change.UUID == uuid }, 0)
+	defer sub.Close()
+
+	// состояние читается после подписки, чтобы не пропустить переход
+	stat, err := GetResponse(uuid)
+	if err != nil {
+		return Status{}, err
+	}
+
+	for !IsTerminal(stat.State) {
+		select {
+		case <-ctx.Done():
+			return stat, ctx.Err()
+		case change, ok := <-sub.C:
+			if !ok {
+				// подписка переполнена - продолжаем с новой
+				return WaitTerminal(ctx, uuid)
+			}
+			if change.Deleted {
+				return Status{}, fmt.Errorf("task %s was deleted: %w", uuid, ErrNotFound)
+			}
+			stat = change.Status
+		}
+	}
+
+	return stat, nil
+}
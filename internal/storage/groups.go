@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type BatchItem struct {
+	Name string
+	TaskOptions
+}
+
+// AddBatch атомарно создает задачи одной группы: либо добавляются все,
+// либо ни одной.
+func AddBatch(items []BatchItem, owner string) (groupID string, uuids []string, err error) {
+	if len(items) == 0 {
+		return "", nil, fmt.Errorf("batch is empty: %w", ErrInvalidTask)
+	}
+
+	groupID = uuid.New().String()
+
+	stats := make([]Status, 0, len(items))
+	for i, item := range items {
+		opts := item.TaskOptions
+		opts.GroupID = groupID
+		opts.Owner = owner
+
+		stat, err := newStatus(item.Name, opts)
+		if err != nil {
+			return "", nil, fmt.Errorf("task %d: %w", i, err)
+		}
+		stats = append(stats, stat)
+	}
+
+	uuids = make([]string, len(stats))
+	for i := range uuids {
+		uuids[i] = uuid.New().String()
+	}
+
+	lockIOBound.Lock()
+	defer lockIOBound.Unlock()
+
+	for _, id := range uuids {
+		if _, exists := ioBound[id]; exists {
+			log.Printf("cannot create task with this UUID: %s", id)
+			return "", nil, fmt.Errorf("cannot create task with this UUID: %s: %w", id, ErrExists)
+		}
+	}
+	for i, id := range uuids {
+		ioBound[id] = stats[i]
+		publish(id, stats[i], false)
+	}
+
+	return groupID, uuids, nil
+}
+
+// DeleteTasks удаляет задачи пачкой, используется для отката неудачного AddBatch
+func DeleteTasks(uuids []string) {
+	lockIOBound.Lock()
+	for _, id := range uuids {
+		if stat, exists := ioBound[id]; exists {
+			delete(ioBound, id)
+			publish(id, stat, true)
+		}
+	}
+	lockIOBound.Unlock()
+
+	for _, id := range uuids {
+		removeBlob(id)
+		forgetMemo(id)
+	}
+}
+
+// GroupTasks возвращает UUID задач группы в порядке создания
+func GroupTasks(groupID string) []string {
+	lockIOBound.RLock()
+	defer lockIOBound.RUnlock()
+
+	uuids := []string{}
+	for id, stat := range ioBound {
+		if stat.GroupID == groupID {
+			uuids = append(uuids, id)
+		}
+	}
+	sort.Slice(uuids, func(i, j int) bool {
+		return ioBound[uuids[i]].DateCreate.Before(ioBound[uuids[j]].DateCreate)
+	})
+
+	return uuids
+}
+
+type GroupFailure struct {
+	UUID     string    `json:"uuid"`
+	Name     string    `json:"name"`
+	Error    string    `json:"error"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+type GroupStatus struct {
+	GroupID string         `json:"group_id"`
+	Owner   string         `json:"-"`
+	Total   int            `json:"total"`
+	Counts  map[string]int `json:"counts"`
+	// Completed - количество задач в конечном состоянии, Progress - их доля в процентах
+	Completed    int           `json:"completed"`
+	Progress     float64       `json:"progress"`
+	Done         bool          `json:"done"`
+	FirstFailure *GroupFailure `json:"first_failure,omitempty"`
+}
+
+func GetGroupStatus(groupID string) (GroupStatus, error) {
+	lockIOBound.RLock()
+	defer lockIOBound.RUnlock()
+
+	group := GroupStatus{GroupID: groupID, Counts: make(map[string]int)}
+	for id, stat := range ioBound {
+		if stat.GroupID != groupID {
+			continue
+		}
+
+		group.Owner = stat.Owner
+		group.Total++
+		group.Counts[stat.State]++
+		if IsTerminal(stat.State) {
+			group.Completed++
+		}
+
+		if stat.State == StateFailed && (group.FirstFailure == nil || stat.FinishedAt.Before(group.FirstFailure.FailedAt)) {
+			group.FirstFailure = &GroupFailure{UUID: id, Name: stat.Name, Error: stat.Error, FailedAt: stat.FinishedAt}
+		}
+	}
+
+	if group.Total == 0 {
+		return GroupStatus{}, fmt.Errorf("group %s: %w", groupID, ErrGroupNotFound)
+	}
+
+	group.Progress = float64(group.Completed) * 100 / float64(group.Total)
+	group.Done = group.Completed == group.Total
+
+	return group, nil
+}
@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// Filter отбирает задачи для списка. Пустые поля не ограничивают выборку.
+type Filter struct {
+	Owner   string
+	States  []string
+	Type    string
+	GroupID string
+	// Name - подстрока названия задачи
+	Name          string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+}
+
+func (f Filter) Match(stat Status) bool {
+	switch {
+	case f.Owner != "" && stat.Owner != f.Owner:
+		return false
+	case len(f.States) > 0 && !slices.Contains(f.States, stat.State):
+		return false
+	case f.Type != "" && stat.Type != f.Type:
+		return false
+	case f.GroupID != "" && stat.GroupID != f.GroupID:
+		return false
+	case f.Name != "" && !strings.Contains(stat.Name, f.Name):
+		return false
+	case !f.CreatedAfter.IsZero() && stat.DateCreate.Before(f.CreatedAfter):
+		return false
+	case !f.CreatedBefore.IsZero() && !stat.DateCreate.Before(f.CreatedBefore):
+		return false
+	}
+	return true
+}
+
+type Record struct {
+	UUID   string
+	Status Status
+}
+
+// ListTasks возвращает задачи по фильтру в порядке создания начиная с offset
+// (не больше limit, limit <= 0 - все) и общее число подходящих задач
+func ListTasks(f Filter, offset, limit int) ([]Record, int) {
+	lockIOBound.RLock()
+	records := []Record{}
+	for id, stat := range ioBound {
+		if f.Match(stat) {
+			records = append(records, Record{UUID: id, Status: stat})
+		}
+	}
+	lockIOBound.RUnlock()
+
+	slices.SortFunc(records, func(a, b Record) int {
+		if c := a.Status.DateCreate.Compare(b.Status.DateCreate); c != 0 {
+			return c
+		}
+		return strings.Compare(a.UUID, b.UUID)
+	})
+
+	total := len(records)
+	records = records[min(offset, total):]
+	if limit > 0 && len(records) > limit {
+		records = records[:limit]
+	}
+	return records, total
+}
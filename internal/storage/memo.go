@@ -0,0 +1,177 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"ioboundlimiter/internal/clock"
+	"sync"
+	"time"
+)
+
+// Мемоизация: задачи с одинаковым владельцем, типом и payload выполняются
+// один раз. Пока задача выполняется, повторные отправки получают ее UUID,
+// после успешного завершения результат переиспользуется в течение TTL.
+
+// Результат AddMemoized
+const (
+	MemoMiss      = "miss"
+	MemoHit       = "hit"
+	MemoCoalesced = "coalesced"
+)
+
+const DefaultMemoTTL = 5 * time.Minute
+
+const memoSweepInterval = time.Minute
+
+type memoEntry struct {
+	uuid      string
+	ttl       time.Duration
+	expiresAt time.Time // заполняется после завершения задачи
+}
+
+var (
+	memoTTL    = DefaultMemoTTL
+	memo       = make(map[string]*memoEntry)
+	memoByTask = make(map[string]string)
+	lastSweep  time.Time
+	lockMemo   = &sync.Mutex{}
+)
+
+func init() {
+	OnTerminal(finishMemo)
+}
+
+// SetMemoTTL задает TTL для задач, которые не указали свой
+func SetMemoTTL(ttl time.Duration) {
+	lockMemo.Lock()
+	memoTTL = ttl
+	lockMemo.Unlock()
+}
+
+// InputHash - ключ мемоизации. Payload нормализуется, поэтому порядок
+// ключей и пробелы в JSON не влияют на результат.
+func InputHash(owner, taskType string, payload json.RawMessage) (string, error) {
+	if taskType == "" {
+		taskType = DefaultType
+	}
+
+	normalized := []byte("null")
+	if len(bytes.TrimSpace(payload)) > 0 {
+		var value any
+		decoder := json.NewDecoder(bytes.NewReader(payload))
+		decoder.UseNumber()
+		if err := decoder.Decode(&value); err != nil {
+			return "", fmt.Errorf("invalid payload: %w", err)
+		}
+
+		var err error
+		if normalized, err = json.Marshal(value); err != nil {
+			return "", fmt.Errorf("invalid payload: %w", err)
+		}
+	}
+
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\x00%s\x00", owner, taskType)
+	hash.Write(normalized)
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// AddMemoized создает задачу, если такая же задача не выполняется и не
+// завершилась успешно в пределах TTL. Иначе возвращает UUID существующей.
+// ttl <= 0 - TTL по умолчанию. Уведомление у существующей задачи одно, поэтому
+// отправка с другими callback_url или callback_secret получает ErrMemoCallback.
+func AddMemoized(nameTask string, opts TaskOptions, ttl time.Duration) (string, string, error) {
+	key, err := InputHash(opts.Owner, opts.Type, opts.Payload)
+	if err != nil {
+		return "", "", err
+	}
+
+	lockMemo.Lock()
+	defer lockMemo.Unlock()
+
+	if ttl <= 0 {
+		ttl = memoTTL
+	}
+	sweepMemo()
+
+	if entry, ok := memo[key]; ok {
+		if stat, result := checkMemo(key, entry); result != MemoMiss {
+			if opts.CallbackURL != "" && (opts.CallbackURL != stat.CallbackURL || opts.CallbackSecret != stat.CallbackSecret) {
+				return "", "", fmt.Errorf("task %s: %w", entry.uuid, ErrMemoCallback)
+			}
+			return entry.uuid, result, nil
+		}
+	}
+
+	uuid, err := AddWithOptions(nameTask, opts)
+	if err != nil {
+		return "", "", err
+	}
+
+	memo[key] = &memoEntry{uuid: uuid, ttl: ttl}
+	memoByTask[uuid] = key
+
+	return uuid, MemoMiss, nil
+}
+
+// checkMemo вызывается под lockMemo и удаляет устаревшую запись
+func checkMemo(key string, entry *memoEntry) (Status, string) {
+	stat, err := GetResponse(entry.uuid)
+	switch {
+	case err != nil:
+	case !IsTerminal(stat.State):
+		return stat, MemoCoalesced
+	case stat.State == StateDone && clock.Now().Before(entry.expiresAt):
+		return stat, MemoHit
+	}
+
+	delete(memo, key)
+	delete(memoByTask, entry.uuid)
+	return Status{}, MemoMiss
+}
+
+// sweepMemo вызывается под lockMemo
+func sweepMemo() {
+	now := clock.Now()
+	if now.Sub(lastSweep) < memoSweepInterval {
+		return
+	}
+	lastSweep = now
+
+	for key, entry := range memo {
+		if !entry.expiresAt.IsZero() && !now.Before(entry.expiresAt) {
+			delete(memo, key)
+			delete(memoByTask, entry.uuid)
+		}
+	}
+}
+
+// finishMemo начинает отсчет TTL для успешной задачи и забывает неуспешную
+func finishMemo(uuid string, stat Status) {
+	lockMemo.Lock()
+	defer lockMemo.Unlock()
+
+	key, ok := memoByTask[uuid]
+	if !ok {
+		return
+	}
+
+	if stat.State == StateDone {
+		memo[key].expiresAt = stat.FinishedAt.Add(memo[key].ttl)
+		return
+	}
+	delete(memo, key)
+	delete(memoByTask, uuid)
+}
+
+func forgetMemo(uuid string) {
+	lockMemo.Lock()
+	if key, ok := memoByTask[uuid]; ok {
+		delete(memo, key)
+		delete(memoByTask, uuid)
+	}
+	lockMemo.Unlock()
+}
@@ -0,0 +1,253 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"ioboundlimiter/internal/clock"
+	"os"
+	"sync"
+	"time"
+)
+
+var ErrResultTooLarge = errors.New("result exceeds size limit")
+
+// ResultConfig ограничивает размер результатов задач
+type ResultConfig struct {
+	// MaxSize - максимальный размер результата, больше - ErrResultTooLarge
+	MaxSize int64
+	// InlineSize - результаты крупнее хранятся не в памяти, а в файлах Dir.
+	// Если Dir пустой, все результаты до MaxSize хранятся в памяти.
+	InlineSize int64
+	Dir        string
+}
+
+func DefaultResultConfig() ResultConfig {
+	return ResultConfig{
+		MaxSize:    64 << 20,
+		InlineSize: 256 << 10,
+	}
+}
+
+// BlobInfo описывает бинарный результат задачи. Сами данные отдаются через OpenBlob.
+type BlobInfo struct {
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	OnDisk      bool   `json:"on_disk"`
+}
+
+// TaskError - ошибка задачи в виде объекта
+type TaskError struct {
+	// Code - panic, canceled или failed
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Stack   string `json:"stack,omitempty"`
+}
+
+// ErrorInfo возвращает ошибку задачи или nil, если задача не завершилась неудачей
+func (s Status) ErrorInfo() *TaskError {
+	switch {
+	case s.State == StateCanceled:
+		return &TaskError{Code: "canceled", Message: "task was canceled"}
+	case s.State != StateFailed:
+		return nil
+	case s.Stack != "":
+		return &TaskError{Code: "panic", Message: s.Error, Stack: s.Stack}
+	default:
+		return &TaskError{Code: "failed", Message: s.Error}
+	}
+}
+
+type blob struct {
+	data    []byte
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+func (b *blob) remove() {
+	if b.path != "" {
+		os.Remove(b.path)
+	}
+}
+
+var (
+	resultCfg     = DefaultResultConfig()
+	lockResultCfg = &sync.RWMutex{}
+
+	blobs     = make(map[string]*blob)
+	lockBlobs = &sync.RWMutex{}
+)
+
+func SetResultConfig(cfg ResultConfig) error {
+	if cfg.MaxSize <= 0 {
+		return fmt.Errorf("result max size must be positive")
+	}
+	if cfg.Dir != "" {
+		if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+			return fmt.Errorf("cannot create result dir: %w", err)
+		}
+	}
+
+	lockResultCfg.Lock()
+	resultCfg = cfg
+	lockResultCfg.Unlock()
+	return nil
+}
+
+func getResultConfig() ResultConfig {
+	lockResultCfg.RLock()
+	defer lockResultCfg.RUnlock()
+	return resultCfg
+}
+
+// WriteBlob сохраняет бинарный результат задачи, заменяя предыдущий
+func WriteBlob(uuid, contentType string, r io.Reader) error {
+	if !IsExists(uuid) {
+		return fmt.Errorf("task %s: %w", uuid, ErrNotFound)
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	b, err := readBlob(uuid+"-output-*", r)
+	if err != nil {
+		return err
+	}
+
+	info := &BlobInfo{ContentType: contentType, Size: b.size, OnDisk: b.path != ""}
+	if err := updateTask(uuid, func(stat *Status) { stat.Blob = info }); err != nil {
+		b.remove()
+		return err
+	}
+
+	return keepBlob(uuid, b)
+}
+
+// keepBlob заменяет бинарный результат задачи. Если задачу удалили, пока
+// результат писался, DeleteTask его уже не увидит: тогда он удаляется здесь.
+func keepBlob(uuid string, b *blob) error {
+	lockBlobs.Lock()
+	defer lockBlobs.Unlock()
+
+	if old, ok := blobs[uuid]; ok {
+		old.remove()
+	}
+	blobs[uuid] = b
+
+	// DeleteTask удаляет задачу раньше, чем ее результат: если задача еще
+	// есть, ее результат удалит DeleteTask
+	if !IsExists(uuid) {
+		b.remove()
+		delete(blobs, uuid)
+		return fmt.Errorf("task %s: %w", uuid, ErrNotFound)
+	}
+	return nil
+}
+
+// readBlob читает результат в память, а если он больше InlineSize - в файл
+// с именем по шаблону pattern, как у os.CreateTemp
+func readBlob(pattern string, r io.Reader) (*blob, error) {
+	cfg := getResultConfig()
+
+	inline := cfg.MaxSize
+	if cfg.Dir != "" {
+		inline = min(cfg.InlineSize, cfg.MaxSize)
+	}
+
+	buf := &bytes.Buffer{}
+	n, err := io.Copy(buf, io.LimitReader(r, inline+1))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read result: %w", err)
+	}
+	if n <= inline {
+		return &blob{data: buf.Bytes(), size: n, modTime: clock.Now()}, nil
+	}
+	if cfg.Dir == "" {
+		return nil, ErrResultTooLarge
+	}
+
+	f, err := os.CreateTemp(cfg.Dir, pattern)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create result file: %w", err)
+	}
+	b := &blob{path: f.Name(), modTime: clock.Now()}
+
+	b.size, err = io.Copy(f, io.MultiReader(buf, io.LimitReader(r, cfg.MaxSize-n+1)))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	switch {
+	case err != nil:
+		b.remove()
+		return nil, fmt.Errorf("cannot write result file: %w", err)
+	case b.size > cfg.MaxSize:
+		b.remove()
+		return nil, ErrResultTooLarge
+	}
+
+	return b, nil
+}
+
+// storeResult проверяет размер JSON результата и крупный результат
+// сохраняет как бинарный с типом application/json
+func storeResult(uuid string, result json.RawMessage) (json.RawMessage, *BlobInfo, error) {
+	cfg := getResultConfig()
+
+	size := int64(len(result))
+	if size > cfg.MaxSize {
+		return nil, nil, ErrResultTooLarge
+	}
+	if cfg.Dir == "" || size <= cfg.InlineSize {
+		return result, nil, nil
+	}
+
+	b, err := readBlob(uuid+"-result-*.json", bytes.NewReader(result))
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := keepBlob(uuid, b); err != nil {
+		return nil, nil, err
+	}
+
+	return nil, &BlobInfo{ContentType: "application/json", Size: b.size, OnDisk: b.path != ""}, nil
+}
+
+type memoryBlob struct {
+	*bytes.Reader
+}
+
+func (memoryBlob) Close() error {
+	return nil
+}
+
+// OpenBlob открывает бинарный результат задачи на чтение
+func OpenBlob(uuid string) (io.ReadSeekCloser, time.Time, error) {
+	lockBlobs.RLock()
+	b, ok := blobs[uuid]
+	lockBlobs.RUnlock()
+
+	if !ok {
+		return nil, time.Time{}, fmt.Errorf("task %s has no blob result", uuid)
+	}
+	if b.path == "" {
+		return memoryBlob{bytes.NewReader(b.data)}, b.modTime, nil
+	}
+
+	f, err := os.Open(b.path)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("cannot open result file: %w", err)
+	}
+	return f, b.modTime, nil
+}
+
+func removeBlob(uuid string) {
+	lockBlobs.Lock()
+	if b, ok := blobs[uuid]; ok {
+		b.remove()
+		delete(blobs, uuid)
+	}
+	lockBlobs.Unlock()
+}
@@ -1,9 +1,12 @@
 package storage
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"ioboundlimiter/internal/util"
 	"log"
+	"slices"
 	"sync"
 	"time"
 
@@ -13,38 +16,156 @@ import (
 var (
 	ioBound     = make(map[string]Status)
 	lockIOBound = &sync.RWMutex{}
+
+	terminalHooks     []func(uuid string, stat Status)
+	lockTerminalHooks = &sync.RWMutex{}
+)
+
+// Состояния задачи
+const (
+	StatePending  = "pending"
+	StateRunning  = "running"
+	StateDone     = "done"
+	StateFailed   = "failed"
+	StateCanceled = "canceled"
 )
 
 type Status struct {
+	State      string    `json:"state"`
 	CurStatus  string    `json:"status"`
 	DateCreate time.Time `json:"date"`
 	Name       string    `json:"name"`
 
 	DateOutput string `json:"dateout"`
+
+	Cost int `json:"cost"`
+
+	// Heartbeat - последний сигнал от воркера, выполняющего задачу
+	Heartbeat time.Time `json:"heartbeat"`
+
+	// Error и Stack заполняются, когда задача завершилась с ошибкой или паникой
+	Error string `json:"error,omitempty"`
+	Stack string `json:"stack,omitempty"`
+
+	// FinishedAt - момент перехода в конечное состояние
+	FinishedAt time.Time `json:"finished_at"`
+
+	GroupID string `json:"group_id,omitempty"`
+	Owner   string `json:"owner,omitempty"`
+
+	// CallbackURL получает уведомление о завершении задачи, подписанное CallbackSecret
+	CallbackURL    string `json:"callback_url,omitempty"`
+	CallbackSecret string `json:"-"`
+
+	// Type определяет исполнителя задачи, Payload - его входные данные
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	// Blob - бинарный или слишком большой для Result результат, см. OpenBlob
+	Blob *BlobInfo `json:"blob,omitempty"`
+
+	Progress *Progress `json:"progress,omitempty"`
+
+	// Priority - среди ожидающих задач раньше выполняются задачи с большим приоритетом
+	Priority int `json:"priority"`
+	// ScheduledAt - задача не начнет выполняться раньше этого момента
+	ScheduledAt time.Time         `json:"scheduled_at"`
+	Labels      map[string]string `json:"labels,omitempty"`
+
+	// Version растет при каждом изменении задачи, из нее строится ETag
+	Version int `json:"version"`
+
+	// History - все смены состояния задачи по порядку
+	History []Transition `json:"history"`
 }
 
-func AddToStorage(nameTask string) (string, error) {
-	if nameTask == ""{
-		log.Printf("task name is empty")
-		return "", fmt.Errorf("task name is empty")
+type Transition struct {
+	State string    `json:"state"`
+	At    time.Time `json:"at"`
+}
+
+type Progress struct {
+	Done    int64   `json:"done"`
+	Total   int64   `json:"total"`
+	Percent float64 `json:"percent"`
+}
+
+// OnTerminal регистрирует функцию, которая вызывается при переходе задачи
+// в конечное состояние. Функция не должна блокироваться надолго.
+func OnTerminal(hook func(uuid string, stat Status)) {
+	lockTerminalHooks.Lock()
+	terminalHooks = append(terminalHooks, hook)
+	lockTerminalHooks.Unlock()
+}
+
+func notifyTerminal(uuid string, stat Status) {
+	lockTerminalHooks.RLock()
+	hooks := terminalHooks
+	lockTerminalHooks.RUnlock()
+
+	for _, hook := range hooks {
+		hook(uuid, stat)
 	}
+}
+
+func IsTerminal(state string) bool {
+	return state == StateDone || state == StateFailed || state == StateCanceled
+}
+
+// TaskOptions - необязательные параметры задачи
+type TaskOptions struct {
+	// Cost - вес задачи для семафора воркеров, по умолчанию 1
+	Cost int
+	// GroupID - группа, в которую входит задача при пакетном добавлении
+	GroupID string
+	// Owner - ID пользователя, создавшего задачу
+	Owner string
+	// Type - тип задачи, по умолчанию DefaultType
+	Type    string
+	Payload json.RawMessage
+
+	Priority    int
+	ScheduledAt time.Time
+	Labels      map[string]string
+
+	CallbackURL    string
+	CallbackSecret string
+}
+
+const DefaultType = "default"
+
+// Ошибки хранилища, по которым API выбирает ответ
+var (
+	ErrNotFound      = errors.New("task not found")
+	ErrGroupNotFound = errors.New("group not found")
+	ErrExists        = errors.New("task already exists")
+	ErrInvalidTask   = errors.New("invalid task")
+	ErrStateConflict = errors.New("task is in another state")
+	// ErrVersionMismatch - задачу изменили после того, как клиент ее прочитал
+	ErrVersionMismatch = errors.New("task version mismatch")
+	// ErrMemoCallback - такая же задача уже есть, но уведомляет другой адрес
+	ErrMemoCallback = errors.New("identical task is already submitted with another callback")
+	// ErrForbidden - задача принадлежит другому пользователю
+	ErrForbidden = errors.New("task belongs to another user")
+)
+
+func AddToStorage(nameTask string) (string, error) {
+	return AddWithOptions(nameTask, TaskOptions{})
+}
+
+func AddWithOptions(nameTask string, opts TaskOptions) (string, error) {
 	if IsExists(nameTask) {
 		log.Printf("task %s already exists", nameTask)
-		return "", fmt.Errorf("task %s already exists", nameTask)
+		return "", fmt.Errorf("task %s: %w", nameTask, ErrExists)
 	}
 
-	currTime := util.TimeNow()
-
-	dateOut, err := util.TimeFormat()
+	stat, err := newStatus(nameTask, opts)
 	if err != nil {
-		log.Printf("something go wrong: %v", err)
-		return "", fmt.Errorf("something go wrong: %v", err)
+		return "", err
 	}
 
 	uuid := uuid.New().String()
 
-	stat := Status{CurStatus: "pending", DateCreate: currTime, Name: nameTask, DateOutput: dateOut}
-
 	if err := setTask(stat, uuid); err != nil {
 		log.Printf("Something go wrong with setting task: %v", err)
 		return "", fmt.Errorf("something go wrong: %v", err)
@@ -53,6 +174,51 @@ func AddToStorage(nameTask string) (string, error) {
 	return uuid, nil
 }
 
+func newStatus(nameTask string, opts TaskOptions) (Status, error) {
+	if nameTask == "" {
+		log.Printf("task name is empty")
+		return Status{}, fmt.Errorf("task name is empty: %w", ErrInvalidTask)
+	}
+
+	currTime := util.TimeNow()
+
+	dateOut, err := util.TimeFormat()
+	if err != nil {
+		log.Printf("something go wrong: %v", err)
+		return Status{}, fmt.Errorf("something go wrong: %v", err)
+	}
+
+	if opts.Cost < 1 {
+		opts.Cost = 1
+	}
+	if opts.Type == "" {
+		opts.Type = DefaultType
+	}
+
+	return Status{
+		State:      StatePending,
+		CurStatus:  "pending",
+		DateCreate: currTime,
+		Name:       nameTask,
+		DateOutput: dateOut,
+		Cost:       opts.Cost,
+		GroupID:    opts.GroupID,
+		Owner:      opts.Owner,
+		Type:       opts.Type,
+		Payload:    opts.Payload,
+
+		Priority:    opts.Priority,
+		ScheduledAt: opts.ScheduledAt,
+		Labels:      opts.Labels,
+
+		CallbackURL:    opts.CallbackURL,
+		CallbackSecret: opts.CallbackSecret,
+
+		History: []Transition{{State: StatePending, At: currTime}},
+		Version: 1,
+	}, nil
+}
+
 func IsExists(uuid string) bool {
 	lockIOBound.RLock()
 	_, exists := ioBound[uuid]
@@ -64,45 +230,228 @@ func IsExists(uuid string) bool {
 func setTask(stat Status, uuid string) error {
 	if IsExists(uuid) {
 		log.Printf("cannot create task with this UUID: %s", uuid)
-		return fmt.Errorf("cannot create task with this UUID: %s", uuid)
+		return fmt.Errorf("cannot create task with this UUID: %s: %w", uuid, ErrExists)
 	}
 
 	lockIOBound.Lock()
 	ioBound[uuid] = stat
+	publish(uuid, stat, false)
 	lockIOBound.Unlock()
 
 	return nil
 }
 
 func ChangeStatus(uuid, status string) error {
-	if !IsExists(uuid) {
-		return fmt.Errorf("task %s is not exists", uuid)
+	return updateTask(uuid, func(stat *Status) {
+		stat.CurStatus = status
+	})
+}
+
+func SetState(uuid, state string) error {
+	return updateTask(uuid, func(stat *Status) {
+		setState(stat, state)
+	})
+}
+
+// CompareAndSetState меняет состояние, только если задача сейчас в состоянии from.
+// Нужно, чтобы воркер и отмена не могли одновременно забрать одну задачу.
+// Возвращает задачу после смены состояния - перечитывать ее не нужно.
+func CompareAndSetState(uuid, from, to string) (Status, error) {
+	return mutateTask(uuid, func(stat *Status) error {
+		if stat.State != from {
+			return fmt.Errorf("task %s is %s, not %s: %w", uuid, stat.State, from, ErrStateConflict)
+		}
+		setState(stat, to)
+		return nil
+	})
+}
+
+func setState(stat *Status, state string) {
+	now := util.TimeNow()
+
+	stat.State = state
+	if IsTerminal(state) {
+		stat.FinishedAt = now
 	}
+	// копия, чтобы не менять History у ранее выданных копий задачи
+	stat.History = append(slices.Clip(stat.History), Transition{State: state, At: now})
+}
+
+// FailTask переводит задачу в failed с сообщением об ошибке и, если есть, стеком паники
+func FailTask(uuid, errMsg, stack string) error {
+	return updateTask(uuid, func(stat *Status) {
+		setState(stat, StateFailed)
+		stat.Error = errMsg
+		stat.Stack = stack
+	})
+}
 
+// CompleteTask переводит задачу в done и сохраняет результат.
+// Результат больше лимита не сохраняется, и задача остается в прежнем состоянии.
+func CompleteTask(uuid string, result json.RawMessage) error {
+	result, info, err := storeResult(uuid, result)
+	if err != nil {
+		return err
+	}
+
+	return updateTask(uuid, func(stat *Status) {
+		setState(stat, StateDone)
+		setResult(stat, result, info)
+	})
+}
+
+func SetResult(uuid string, result json.RawMessage) error {
+	result, info, err := storeResult(uuid, result)
+	if err != nil {
+		return err
+	}
+
+	return updateTask(uuid, func(stat *Status) {
+		setResult(stat, result, info)
+	})
+}
+
+func setResult(stat *Status, result json.RawMessage, info *BlobInfo) {
+	stat.Result = result
+	if info != nil {
+		stat.Blob = info
+	}
+}
+
+func SetProgress(uuid string, done, total int64) error {
+	progress := &Progress{Done: done, Total: total}
+	if total > 0 {
+		progress.Percent = float64(done) * 100 / float64(total)
+	}
+
+	return updateTask(uuid, func(stat *Status) {
+		stat.Progress = progress
+	})
+}
+
+// Heartbeat не рассылается подписчикам изменений: это служебный сигнал для watchdog
+func Heartbeat(uuid string) error {
 	lockIOBound.Lock()
+	defer lockIOBound.Unlock()
 
-	stat := ioBound[uuid]
-	stat.CurStatus = status
+	stat, exists := ioBound[uuid]
+	if !exists {
+		return fmt.Errorf("task %s: %w", uuid, ErrNotFound)
+	}
+	stat.Heartbeat = util.TimeNow()
 	ioBound[uuid] = stat
 
+	return nil
+}
+
+func updateTask(uuid string, update func(stat *Status)) error {
+	_, err := mutateTask(uuid, func(stat *Status) error {
+		update(stat)
+		return nil
+	})
+	return err
+}
+
+// mutateTask меняет задачу под блокировкой, если mutate не вернул ошибку,
+// и оповещает подписчиков о переходе в конечное состояние.
+// Возвращает измененную задачу.
+func mutateTask(uuid string, mutate func(stat *Status) error) (Status, error) {
+	lockIOBound.Lock()
+
+	stat, exists := ioBound[uuid]
+	if !exists {
+		lockIOBound.Unlock()
+		return Status{}, fmt.Errorf("task %s: %w", uuid, ErrNotFound)
+	}
+
+	wasTerminal := IsTerminal(stat.State)
+	if err := mutate(&stat); err != nil {
+		lockIOBound.Unlock()
+		return Status{}, err
+	}
+	stat.Version++
+	ioBound[uuid] = stat
+	publish(uuid, stat, false)
+
 	lockIOBound.Unlock()
 
-	return nil
+	if !wasTerminal && IsTerminal(stat.State) {
+		notifyTerminal(uuid, stat)
+	}
+
+	return stat, nil
+}
+
+// TaskPatch - изменения ожидающей задачи, пустые поля не меняются
+type TaskPatch struct {
+	Name        *string
+	Priority    *int
+	ScheduledAt *time.Time
+	// Labels заменяют все метки задачи
+	Labels  map[string]string
+	Payload json.RawMessage
+}
+
+// UpdatePending меняет задачу, которая еще не начала выполняться.
+// version - ожидаемая версия задачи, 0 - без проверки.
+func UpdatePending(uuid string, version int, patch TaskPatch) (Status, error) {
+	stat, err := mutateTask(uuid, func(stat *Status) error {
+		if stat.State != StatePending {
+			return fmt.Errorf("task %s is %s: %w", uuid, stat.State, ErrStateConflict)
+		}
+		if version != 0 && stat.Version != version {
+			return fmt.Errorf("task %s has version %d, not %d: %w", uuid, stat.Version, version, ErrVersionMismatch)
+		}
+
+		if patch.Name != nil {
+			stat.Name = *patch.Name
+		}
+		if patch.Priority != nil {
+			stat.Priority = *patch.Priority
+		}
+		if patch.ScheduledAt != nil {
+			stat.ScheduledAt = *patch.ScheduledAt
+		}
+		if patch.Labels != nil {
+			stat.Labels = patch.Labels
+		}
+		if patch.Payload != nil {
+			stat.Payload = patch.Payload
+		}
+		return nil
+	})
+	if err != nil {
+		return Status{}, err
+	}
+
+	// задача с другим payload больше не подходит для мемоизации
+	if patch.Payload != nil {
+		forgetMemo(uuid)
+	}
+	return stat, nil
 }
 
 func DeleteTask(uuid string) error {
-	if !IsExists(uuid) {
-		return fmt.Errorf("task %s doesnt exist", uuid)
+	lockIOBound.Lock()
+	stat, exists := ioBound[uuid]
+	if !exists {
+		lockIOBound.Unlock()
+		return fmt.Errorf("task %s: %w", uuid, ErrNotFound)
 	}
 
 	delete(ioBound, uuid)
+	publish(uuid, stat, true)
+	lockIOBound.Unlock()
+
+	removeBlob(uuid)
+	forgetMemo(uuid)
 
 	return nil
 }
 
 func GetResponse(uuid string) (Status, error) {
 	if !IsExists(uuid) {
-		return Status{}, fmt.Errorf("task %s doesnt exists", uuid)
+		return Status{}, fmt.Errorf("task %s: %w", uuid, ErrNotFound)
 	}
 	lockIOBound.RLock()
 	response := ioBound[uuid]
@@ -110,3 +459,29 @@ func GetResponse(uuid string) (Status, error) {
 
 	return response, nil
 }
+
+// GetOwned возвращает задачу, только если она принадлежит owner
+func GetOwned(uuid, owner string) (Status, error) {
+	response, err := GetResponse(uuid)
+	if err != nil {
+		return Status{}, err
+	}
+	if response.Owner != owner {
+		return Status{}, fmt.Errorf("task %s: %w", uuid, ErrForbidden)
+	}
+	return response, nil
+}
+
+// CountByType считает задачи в указанном состоянии по типам
+func CountByType(state string) map[string]int {
+	lockIOBound.RLock()
+	defer lockIOBound.RUnlock()
+
+	counts := make(map[string]int)
+	for _, stat := range ioBound {
+		if stat.State == state {
+			counts[stat.Type]++
+		}
+	}
+	return counts
+}
@@ -1,7 +1,14 @@
 package storage
 
 import (
+	"context"
+	"encoding/json"
+	"io"
+	"ioboundlimiter/internal/clock"
 	"ioboundlimiter/internal/util"
+	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -84,6 +91,66 @@ func TestChangeStatus(t *testing.T) {
 	})
 }
 
+func TestSetState(t *testing.T) {
+	t.Run("new task is pending", func(t *testing.T) {
+		id, _ := AddToStorage("state_test")
+
+		task, _ := GetResponse(id)
+		assert.Equal(t, StatePending, task.State)
+	})
+
+	t.Run("state change", func(t *testing.T) {
+		id, _ := AddToStorage("state_change_test")
+		assert.NoError(t, SetState(id, StateRunning))
+
+		task, _ := GetResponse(id)
+		assert.Equal(t, StateRunning, task.State)
+	})
+
+	t.Run("non-existent task", func(t *testing.T) {
+		assert.Error(t, SetState(uuid.New().String(), StateDone))
+	})
+}
+
+func TestCompareAndSetState(t *testing.T) {
+	t.Run("returns task after change", func(t *testing.T) {
+		id, _ := AddWithOptions("cas_test", TaskOptions{Cost: 3, Priority: 2})
+
+		task, err := CompareAndSetState(id, StatePending, StateRunning)
+		assert.NoError(t, err)
+		assert.Equal(t, StateRunning, task.State)
+		assert.Equal(t, 3, task.Cost)
+		assert.Equal(t, 2, task.Priority)
+
+		stored, _ := GetResponse(id)
+		assert.Equal(t, stored.Version, task.Version)
+	})
+
+	t.Run("state conflict", func(t *testing.T) {
+		id, _ := AddToStorage("cas_conflict_test")
+		assert.NoError(t, SetState(id, StateCanceled))
+
+		task, err := CompareAndSetState(id, StatePending, StateRunning)
+		assert.ErrorIs(t, err, ErrStateConflict)
+		assert.Equal(t, Status{}, task)
+	})
+
+	t.Run("non-existent task", func(t *testing.T) {
+		_, err := CompareAndSetState(uuid.New().String(), StatePending, StateRunning)
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
+
+func TestFailTask(t *testing.T) {
+	id, _ := AddToStorage("fail_test")
+	assert.NoError(t, FailTask(id, "panic: boom", "goroutine 1 [running]"))
+
+	task, _ := GetResponse(id)
+	assert.Equal(t, StateFailed, task.State)
+	assert.Equal(t, "panic: boom", task.Error)
+	assert.Equal(t, "goroutine 1 [running]", task.Stack)
+}
+
 func TestDeleteTask(t *testing.T) {
 	t.Run("delete existing task", func(t *testing.T) {
 		id, _ := AddToStorage("to_delete")
@@ -115,6 +182,66 @@ func TestGetResponse(t *testing.T) {
 		_, err := GetResponse(uuid.New().String())
 		assert.Error(t, err)
 	})
+
+	t.Run("get owned task", func(t *testing.T) {
+		id, _ := AddWithOptions("owned_task", TaskOptions{Owner: "owner"})
+
+		task, err := GetOwned(id, "owner")
+		assert.NoError(t, err)
+		assert.Equal(t, "owned_task", task.Name)
+
+		_, err = GetOwned(id, "other")
+		assert.ErrorIs(t, err, ErrForbidden)
+		_, err = GetOwned(uuid.New().String(), "owner")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
+
+func TestAddBatch(t *testing.T) {
+	t.Run("all tasks share group", func(t *testing.T) {
+		items := []BatchItem{{Name: "batch_1"}, {Name: "batch_2", TaskOptions: TaskOptions{Cost: 3}}}
+
+		groupID, ids, err := AddBatch(items, "owner")
+		assert.NoError(t, err)
+		assert.Len(t, ids, 2)
+		assert.ElementsMatch(t, ids, GroupTasks(groupID))
+
+		task, _ := GetResponse(ids[1])
+		assert.Equal(t, groupID, task.GroupID)
+		assert.Equal(t, "owner", task.Owner)
+		assert.Equal(t, 3, task.Cost)
+	})
+
+	t.Run("invalid task rejects whole batch", func(t *testing.T) {
+		items := []BatchItem{{Name: "batch_ok"}, {Name: ""}}
+
+		_, _, err := AddBatch(items, "owner")
+		assert.Error(t, err)
+	})
+}
+
+func TestGetGroupStatus(t *testing.T) {
+	t.Run("aggregates states", func(t *testing.T) {
+		groupID, ids, _ := AddBatch([]BatchItem{{Name: "g1"}, {Name: "g2"}, {Name: "g3"}, {Name: "g4"}}, "owner")
+
+		assert.NoError(t, SetState(ids[0], StateDone))
+		assert.NoError(t, FailTask(ids[1], "first", ""))
+		assert.NoError(t, FailTask(ids[2], "second", ""))
+
+		group, err := GetGroupStatus(groupID)
+		assert.NoError(t, err)
+		assert.Equal(t, 4, group.Total)
+		assert.Equal(t, 3, group.Completed)
+		assert.Equal(t, 75.0, group.Progress)
+		assert.False(t, group.Done)
+		assert.Equal(t, map[string]int{StateDone: 1, StateFailed: 2, StatePending: 1}, group.Counts)
+		assert.Equal(t, ids[1], group.FirstFailure.UUID)
+	})
+
+	t.Run("unknown group", func(t *testing.T) {
+		_, err := GetGroupStatus(uuid.New().String())
+		assert.Error(t, err)
+	})
 }
 
 func TestConcurrentAccess(t *testing.T) {
@@ -162,4 +289,382 @@ func TestEdgeCases(t *testing.T) {
 		_, err := AddToStorage(string(longName))
 		assert.NoError(t, err)
 	})
-}
\ No newline at end of file
+}
+func TestResults(t *testing.T) {
+	defer SetResultConfig(DefaultResultConfig())
+
+	dir := t.TempDir()
+	assert.NoError(t, SetResultConfig(ResultConfig{MaxSize: 100, InlineSize: 10, Dir: dir}))
+
+	readBlob := func(t *testing.T, id string) string {
+		blob, _, err := OpenBlob(id)
+		assert.NoError(t, err)
+		defer blob.Close()
+
+		data, err := io.ReadAll(blob)
+		assert.NoError(t, err)
+		return string(data)
+	}
+
+	t.Run("small blob stays in memory", func(t *testing.T) {
+		id, _ := AddToStorage("small blob")
+		assert.NoError(t, WriteBlob(id, "text/plain", strings.NewReader("hello")))
+
+		task, _ := GetResponse(id)
+		assert.Equal(t, &BlobInfo{ContentType: "text/plain", Size: 5}, task.Blob)
+		assert.Equal(t, "hello", readBlob(t, id))
+	})
+
+	t.Run("large blob spills to disk", func(t *testing.T) {
+		id, _ := AddToStorage("large blob")
+		data := strings.Repeat("x", 50)
+		assert.NoError(t, WriteBlob(id, "", strings.NewReader(data)))
+
+		task, _ := GetResponse(id)
+		assert.Equal(t, &BlobInfo{ContentType: "application/octet-stream", Size: 50, OnDisk: true}, task.Blob)
+		assert.Equal(t, data, readBlob(t, id))
+
+		assert.NoError(t, DeleteTask(id))
+		files, _ := os.ReadDir(dir)
+		assert.Empty(t, files)
+	})
+
+	t.Run("too large result", func(t *testing.T) {
+		id, _ := AddToStorage("too large")
+		assert.ErrorIs(t, WriteBlob(id, "", strings.NewReader(strings.Repeat("x", 101))), ErrResultTooLarge)
+		assert.ErrorIs(t, CompleteTask(id, json.RawMessage(`"`+strings.Repeat("x", 100)+`"`)), ErrResultTooLarge)
+
+		task, _ := GetResponse(id)
+		assert.Equal(t, StatePending, task.State)
+		assert.Nil(t, task.Blob)
+
+		files, _ := os.ReadDir(dir)
+		assert.Empty(t, files)
+	})
+
+	t.Run("large JSON result is stored as blob", func(t *testing.T) {
+		id, _ := AddToStorage("large json")
+		result := `{"data":"` + strings.Repeat("x", 20) + `"}`
+		assert.NoError(t, CompleteTask(id, json.RawMessage(result)))
+
+		task, _ := GetResponse(id)
+		assert.Equal(t, StateDone, task.State)
+		assert.Nil(t, task.Result)
+		assert.Equal(t, "application/json", task.Blob.ContentType)
+		assert.Equal(t, result, readBlob(t, id))
+		assert.NoError(t, DeleteTask(id))
+	})
+
+	t.Run("result and output files are named apart", func(t *testing.T) {
+		output, _ := AddToStorage("output file")
+		assert.NoError(t, WriteBlob(output, "", strings.NewReader(strings.Repeat("x", 50))))
+		result, _ := AddToStorage("result file")
+		assert.NoError(t, CompleteTask(result, json.RawMessage(`"`+strings.Repeat("x", 50)+`"`)))
+
+		outputs, _ := filepath.Glob(filepath.Join(dir, output+"-output-*"))
+		assert.Len(t, outputs, 1)
+		results, _ := filepath.Glob(filepath.Join(dir, result+"-result-*.json"))
+		assert.Len(t, results, 1)
+
+		assert.NoError(t, DeleteTask(output))
+		assert.NoError(t, DeleteTask(result))
+	})
+
+	t.Run("result of deleted task is not kept", func(t *testing.T) {
+		id, _ := AddToStorage("deleted while writing")
+		f, err := os.CreateTemp(dir, id+"-output-*")
+		assert.NoError(t, err)
+		f.Close()
+		assert.NoError(t, DeleteTask(id))
+
+		assert.ErrorIs(t, keepBlob(id, &blob{path: f.Name()}), ErrNotFound)
+		_, _, err = OpenBlob(id)
+		assert.Error(t, err)
+		files, _ := os.ReadDir(dir)
+		assert.Empty(t, files)
+	})
+
+	t.Run("error object", func(t *testing.T) {
+		id, _ := AddToStorage("panicked")
+		assert.NoError(t, FailTask(id, "panic: boom", "goroutine 1"))
+
+		task, _ := GetResponse(id)
+		assert.Equal(t, &TaskError{Code: "panic", Message: "panic: boom", Stack: "goroutine 1"}, task.ErrorInfo())
+	})
+}
+
+func TestMemoize(t *testing.T) {
+	fake := clock.NewFake(time.Now())
+	clock.Set(fake)
+	defer clock.Set(clock.Real{})
+
+	opts := TaskOptions{Owner: "user", Type: "http", Payload: json.RawMessage(`{"url": "https://example.com", "method": "GET"}`)}
+
+	t.Run("normalized payload", func(t *testing.T) {
+		a, err := InputHash("user", "http", json.RawMessage(`{"a": 1, "b": [1, 2]}`))
+		assert.NoError(t, err)
+		b, err := InputHash("user", "http", json.RawMessage(`{"b":[1,2],"a":1}`))
+		assert.NoError(t, err)
+		c, err := InputHash("other", "http", json.RawMessage(`{"a": 1, "b": [1, 2]}`))
+		assert.NoError(t, err)
+
+		assert.Equal(t, a, b)
+		assert.NotEqual(t, a, c)
+	})
+
+	t.Run("coalesce, reuse and expire", func(t *testing.T) {
+		id, result, err := AddMemoized("first", opts, time.Minute)
+		assert.NoError(t, err)
+		assert.Equal(t, MemoMiss, result)
+
+		same, result, err := AddMemoized("second", opts, time.Minute)
+		assert.NoError(t, err)
+		assert.Equal(t, MemoCoalesced, result)
+		assert.Equal(t, id, same)
+
+		assert.NoError(t, CompleteTask(id, nil))
+		fake.Advance(30 * time.Second)
+
+		same, result, _ = AddMemoized("third", opts, time.Minute)
+		assert.Equal(t, MemoHit, result)
+		assert.Equal(t, id, same)
+
+		fake.Advance(time.Minute)
+
+		other, result, _ := AddMemoized("fourth", opts, time.Minute)
+		assert.Equal(t, MemoMiss, result)
+		assert.NotEqual(t, id, other)
+		assert.NoError(t, DeleteTask(other))
+	})
+
+	t.Run("another callback is rejected", func(t *testing.T) {
+		withCallback := opts
+		withCallback.Payload = json.RawMessage(`{"url": "https://example.com/callback"}`)
+		withCallback.CallbackURL = "https://hooks.example.com/a"
+
+		id, _, err := AddMemoized("callback", withCallback, time.Minute)
+		assert.NoError(t, err)
+
+		same, result, err := AddMemoized("same callback", withCallback, time.Minute)
+		assert.NoError(t, err)
+		assert.Equal(t, MemoCoalesced, result)
+		assert.Equal(t, id, same)
+
+		noCallback := withCallback
+		noCallback.CallbackURL = ""
+		_, result, err = AddMemoized("no callback", noCallback, time.Minute)
+		assert.NoError(t, err)
+		assert.Equal(t, MemoCoalesced, result)
+
+		other := withCallback
+		other.CallbackURL = "https://hooks.example.com/b"
+		_, _, err = AddMemoized("other callback", other, time.Minute)
+		assert.ErrorIs(t, err, ErrMemoCallback)
+
+		other = withCallback
+		other.CallbackSecret = "another secret"
+		_, _, err = AddMemoized("other secret", other, time.Minute)
+		assert.ErrorIs(t, err, ErrMemoCallback)
+	})
+
+	t.Run("failed task is not reused", func(t *testing.T) {
+		failing := opts
+		failing.Payload = json.RawMessage(`{"url": "https://example.com/fail"}`)
+
+		id, _, _ := AddMemoized("failing", failing, time.Minute)
+		assert.NoError(t, FailTask(id, "boom", ""))
+
+		other, result, _ := AddMemoized("retry", failing, time.Minute)
+		assert.Equal(t, MemoMiss, result)
+		assert.NotEqual(t, id, other)
+	})
+}
+
+func TestListTasks(t *testing.T) {
+	owner := uuid.New().String()
+	first, _ := AddWithOptions("list first", TaskOptions{Owner: owner, Type: "http"})
+	second, _ := AddWithOptions("list second", TaskOptions{Owner: owner})
+	third, _ := AddWithOptions("list third", TaskOptions{Owner: owner})
+	AddWithOptions("list other owner", TaskOptions{Owner: uuid.New().String()})
+	assert.NoError(t, SetState(third, StateRunning))
+
+	ids := func(records []Record) []string {
+		result := []string{}
+		for _, record := range records {
+			result = append(result, record.UUID)
+		}
+		return result
+	}
+
+	t.Run("owner only in creation order", func(t *testing.T) {
+		records, total := ListTasks(Filter{Owner: owner}, 0, 0)
+		assert.Equal(t, 3, total)
+		assert.Equal(t, []string{first, second, third}, ids(records))
+	})
+
+	t.Run("filters", func(t *testing.T) {
+		records, _ := ListTasks(Filter{Owner: owner, States: []string{StatePending}, Name: "list"}, 0, 0)
+		assert.Equal(t, []string{first, second}, ids(records))
+
+		records, _ = ListTasks(Filter{Owner: owner, Type: "http"}, 0, 0)
+		assert.Equal(t, []string{first}, ids(records))
+	})
+
+	t.Run("pagination", func(t *testing.T) {
+		records, total := ListTasks(Filter{Owner: owner}, 1, 1)
+		assert.Equal(t, 3, total)
+		assert.Equal(t, []string{second}, ids(records))
+
+		records, _ = ListTasks(Filter{Owner: owner}, 5, 1)
+		assert.Empty(t, records)
+	})
+
+	t.Run("history", func(t *testing.T) {
+		task, _ := GetResponse(third)
+		assert.Len(t, task.History, 2)
+		assert.Equal(t, StatePending, task.History[0].State)
+		assert.Equal(t, StateRunning, task.History[1].State)
+	})
+}
+
+func TestChanges(t *testing.T) {
+	id, _ := AddToStorage("watched")
+	onlyWatched := func(change Change) bool { return change.UUID == id }
+
+	sub, missed, complete := Subscribe(onlyWatched, 0)
+	defer sub.Close()
+	assert.Empty(t, missed)
+	assert.True(t, complete)
+
+	t.Run("state and progress changes are published", func(t *testing.T) {
+		assert.NoError(t, SetState(id, StateRunning))
+		assert.NoError(t, Heartbeat(id))
+		assert.NoError(t, SetProgress(id, 1, 2))
+
+		change := <-sub.C
+		assert.Equal(t, StateRunning, change.Status.State)
+		change = <-sub.C
+		assert.Equal(t, int64(1), change.Status.Progress.Done)
+		assert.Empty(t, sub.C)
+	})
+
+	t.Run("resume from sequence number", func(t *testing.T) {
+		resumed, missed, complete := Subscribe(onlyWatched, sub.Start)
+		defer resumed.Close()
+
+		// два пропущенных изменения приходят одним, с текущим состоянием
+		assert.True(t, complete)
+		if assert.Len(t, missed, 1) {
+			assert.Equal(t, sub.Start+2, missed[0].Seq)
+			assert.Equal(t, StateRunning, missed[0].Status.State)
+			assert.Equal(t, int64(1), missed[0].Status.Progress.Done)
+			assert.Equal(t, "watched", missed[0].Status.Name)
+		}
+	})
+
+	t.Run("journal keeps only trimmed changes", func(t *testing.T) {
+		lockChanges.Lock()
+		record := changeLog[(changeSeq-1)%changeLogSize]
+		lockChanges.Unlock()
+
+		assert.Equal(t, loggedChange{seq: sub.Start + 2, uuid: id, state: StateRunning, version: 3}, record)
+	})
+
+	t.Run("sequence from before restart", func(t *testing.T) {
+		// номер больше текущего остался от прошлого запуска: что пропущено, неизвестно
+		resumed, missed, complete := Subscribe(onlyWatched, sub.Start+changeLogSize)
+		defer resumed.Close()
+
+		assert.False(t, complete)
+		assert.Empty(t, missed)
+	})
+
+	t.Run("deletion", func(t *testing.T) {
+		assert.NoError(t, DeleteTask(id))
+
+		change := <-sub.C
+		assert.True(t, change.Deleted)
+		assert.Equal(t, "watched", change.Status.Name)
+
+		resumed, missed, _ := Subscribe(onlyWatched, sub.Start)
+		defer resumed.Close()
+		if assert.Len(t, missed, 1) {
+			assert.True(t, missed[0].Deleted)
+			assert.Equal(t, change.Seq, missed[0].Seq)
+		}
+	})
+}
+
+func TestWaitTerminal(t *testing.T) {
+	t.Run("returns final state", func(t *testing.T) {
+		id, _ := AddToStorage("waited")
+
+		go func() {
+			SetState(id, StateRunning)
+			CompleteTask(id, json.RawMessage(`{"ok":true}`))
+		}()
+
+		task, err := WaitTerminal(context.Background(), id)
+		assert.NoError(t, err)
+		assert.Equal(t, StateDone, task.State)
+		assert.JSONEq(t, `{"ok":true}`, string(task.Result))
+	})
+
+	t.Run("timeout returns current state", func(t *testing.T) {
+		id, _ := AddToStorage("never finishes")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		task, err := WaitTerminal(ctx, id)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Equal(t, StatePending, task.State)
+	})
+
+	t.Run("deleted task", func(t *testing.T) {
+		id, _ := AddToStorage("deleted while waiting")
+		go DeleteTask(id)
+
+		_, err := WaitTerminal(context.Background(), id)
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
+
+func TestUpdatePending(t *testing.T) {
+	id, _ := AddWithOptions("queued", TaskOptions{Payload: json.RawMessage(`{"n":1}`)})
+	task, _ := GetResponse(id)
+	assert.Equal(t, 1, task.Version)
+
+	t.Run("changes fields and version", func(t *testing.T) {
+		name, priority := "renamed", 5
+		task, err := UpdatePending(id, 1, TaskPatch{
+			Name:     &name,
+			Priority: &priority,
+			Labels:   map[string]string{"env": "prod"},
+			Payload:  json.RawMessage(`{"n":2}`),
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "renamed", task.Name)
+		assert.Equal(t, 5, task.Priority)
+		assert.Equal(t, map[string]string{"env": "prod"}, task.Labels)
+		assert.JSONEq(t, `{"n":2}`, string(task.Payload))
+		assert.Equal(t, 2, task.Version)
+	})
+
+	t.Run("stale version", func(t *testing.T) {
+		name := "lost update"
+		_, err := UpdatePending(id, 1, TaskPatch{Name: &name})
+		assert.ErrorIs(t, err, ErrVersionMismatch)
+
+		task, _ := GetResponse(id)
+		assert.Equal(t, "renamed", task.Name)
+	})
+
+	t.Run("started task", func(t *testing.T) {
+		SetState(id, StateRunning)
+
+		name := "too late"
+		_, err := UpdatePending(id, 0, TaskPatch{Name: &name})
+		assert.ErrorIs(t, err, ErrStateConflict)
+	})
+}
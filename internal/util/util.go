@@ -2,11 +2,12 @@ package util
 
 import (
 	"fmt"
+	"ioboundlimiter/internal/clock"
 	"time"
 )
 
 func TimeFormat() (string, error) {
-    now := time.Now()
+    now := clock.Now()
     
     moscowTZ, err := time.LoadLocation("Europe/Moscow")
     if err != nil {
@@ -19,13 +20,13 @@ func TimeFormat() (string, error) {
 }
 
 func TimeNow() time.Time {
-	return time.Now()
+	return clock.Now()
 }
 
 //new Date('2025-12-07T12:00:00Z');
 
 func DifferenceTime(timeCreation time.Time) string { // hh : mm : ss
-	diff := time.Since(timeCreation)
+	diff := clock.Since(timeCreation)
 	result := diff.Round(time.Second)
 
 	h := result / time.Hour
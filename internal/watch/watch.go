@@ -0,0 +1,107 @@
+// Package watch - подписка на изменения задач одной задачи, группы или всех
+// задач пользователя. Общая для SSE, WebSocket и gRPC потоков.
+package watch
+
+import (
+	"ioboundlimiter/internal/apierr"
+	"ioboundlimiter/internal/storage"
+)
+
+// Scope - задачи, за которыми следит клиент: одна задача, группа или
+// все задачи пользователя
+type Scope struct {
+	Owner   string
+	TaskID  string
+	GroupID string
+}
+
+func (s Scope) Match(change storage.Change) bool {
+	switch {
+	case s.TaskID != "":
+		return change.UUID == s.TaskID
+	case s.GroupID != "":
+		return change.Status.GroupID == s.GroupID
+	default:
+		return change.Status.Owner == s.Owner
+	}
+}
+
+// Check проверяет, что задача или группа существует и принадлежит
+// пользователю. Ошибку можно перевести в ответ через apierr.From.
+func (s Scope) Check() error {
+	switch {
+	case s.TaskID != "" && s.GroupID != "":
+		return apierr.ErrBadRequest.WithDetail("use either task_id or group_id")
+	case s.TaskID != "":
+		if _, err := storage.GetOwned(s.TaskID, s.Owner); err != nil {
+			return err
+		}
+	case s.GroupID != "":
+		status, err := storage.GetGroupStatus(s.GroupID)
+		if err != nil {
+			return err
+		}
+		if status.Owner != s.Owner {
+			return apierr.ErrGroupForbidden
+		}
+	}
+	return nil
+}
+
+// Snapshot - текущее состояние задач области в виде изменений с номером seq.
+// Для всех задач пользователя - только незавершенные.
+func (s Scope) Snapshot(seq uint64) []storage.Change {
+	filter := storage.Filter{Owner: s.Owner, GroupID: s.GroupID}
+	if s.TaskID == "" && s.GroupID == "" {
+		filter.States = []string{storage.StatePending, storage.StateRunning}
+	}
+
+	records, _ := storage.ListTasks(filter, 0, 0)
+	changes := []storage.Change{}
+	for _, record := range records {
+		if s.TaskID == "" || record.UUID == s.TaskID {
+			changes = append(changes, storage.Change{Seq: seq, UUID: record.UUID, Status: record.Status})
+		}
+	}
+	return changes
+}
+
+// Subscribe подписывается на изменения области после since и возвращает
+// изменения, которые нужно отправить сразу. При первом подключении или если
+// журнал уже не помнит пропущенное, это текущее состояние задач.
+func Subscribe(scope Scope, since uint64) (*storage.Subscription, []storage.Change, *Tracker) {
+	sub, missed, complete := storage.Subscribe(scope.Match, since)
+
+	snapshot := scope.Snapshot(sub.Start)
+	tracker := &Tracker{scope: scope, open: make(map[string]bool)}
+	for _, change := range snapshot {
+		tracker.Apply(change)
+	}
+
+	if since == 0 || !complete {
+		missed = snapshot
+	}
+	return sub, missed, tracker
+}
+
+// Tracker определяет, когда все задачи области завершились и поток
+// можно закрывать. Поток всех задач пользователя не закрывается.
+type Tracker struct {
+	scope Scope
+	open  map[string]bool
+}
+
+func (t *Tracker) Apply(change storage.Change) {
+	if change.Deleted || storage.IsTerminal(change.Status.State) {
+		delete(t.open, change.UUID)
+	} else {
+		t.open[change.UUID] = true
+	}
+}
+
+func (t *Tracker) Done() bool {
+	if t.scope.TaskID == "" && t.scope.GroupID == "" {
+		return false
+	}
+	return len(t.open) == 0
+}
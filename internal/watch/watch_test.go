@@ -0,0 +1,50 @@
+package watch
+
+import (
+	"ioboundlimiter/internal/apierr"
+	"ioboundlimiter/internal/storage"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScope(t *testing.T) {
+	owner := uuid.New().String()
+	groupID, ids, err := storage.AddBatch([]storage.BatchItem{{Name: "first"}, {Name: "second"}}, owner)
+	assert.NoError(t, err)
+
+	t.Run("check ownership", func(t *testing.T) {
+		assert.NoError(t, Scope{Owner: owner, TaskID: ids[0]}.Check())
+		assert.NoError(t, Scope{Owner: owner, GroupID: groupID}.Check())
+		assert.ErrorIs(t, Scope{Owner: "other", TaskID: ids[0]}.Check(), storage.ErrForbidden)
+		assert.ErrorIs(t, Scope{Owner: "other", GroupID: groupID}.Check(), apierr.ErrGroupForbidden)
+		assert.ErrorIs(t, Scope{Owner: owner, TaskID: "missing"}.Check(), storage.ErrNotFound)
+		assert.ErrorIs(t, Scope{Owner: owner, TaskID: ids[0], GroupID: groupID}.Check(), apierr.ErrBadRequest)
+	})
+
+	t.Run("group stream is done when all tasks finish", func(t *testing.T) {
+		sub, missed, tracker := Subscribe(Scope{Owner: owner, GroupID: groupID}, 0)
+		defer sub.Close()
+
+		assert.Len(t, missed, 2)
+		assert.False(t, tracker.Done())
+
+		assert.NoError(t, storage.CompleteTask(ids[0], nil))
+		tracker.Apply(<-sub.C)
+		assert.False(t, tracker.Done())
+
+		assert.NoError(t, storage.SetState(ids[1], storage.StateCanceled))
+		tracker.Apply(<-sub.C)
+		assert.True(t, tracker.Done())
+	})
+
+	t.Run("user stream never ends", func(t *testing.T) {
+		sub, missed, tracker := Subscribe(Scope{Owner: owner}, 0)
+		defer sub.Close()
+
+		// в начале только незавершенные задачи
+		assert.Empty(t, missed)
+		assert.False(t, tracker.Done())
+	})
+}
@@ -0,0 +1,443 @@
+package webhook
+
+import (
+	"bytes"
+	"container/heap"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"ioboundlimiter/internal/clock"
+	"ioboundlimiter/internal/netguard"
+	"ioboundlimiter/internal/storage"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Уведомления о завершении задач. Тело подписывается HMAC-SHA256:
+//
+//	X-Webhook-Signature: sha256=hex(hmac(secret, X-Webhook-Timestamp + "." + body))
+//
+// Секрет - callback_secret задачи или общий WEBHOOK_SECRET сервиса.
+
+const (
+	HeaderSignature = "X-Webhook-Signature"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+
+	EventTaskFinished = "task.finished"
+)
+
+// Состояния доставки
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+type Config struct {
+	MaxAttempts int
+	// BaseDelay удваивается после каждой неудачной попытки, но не больше MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	Timeout   time.Duration
+	Senders   int
+	// Retention - сколько хранить завершенные доставки, 0 - не удалять
+	Retention time.Duration
+	// AllowPrivate разрешает уведомления на loopback, link-local, RFC 1918
+	// и другие внутренние адреса. По умолчанию такие соединения отклоняются
+	AllowPrivate bool
+}
+
+func DefaultConfig() Config {
+	return Config{
+		MaxAttempts: 6,
+		BaseDelay:   time.Second,
+		MaxDelay:    time.Minute,
+		Timeout:     10 * time.Second,
+		Senders:     2,
+		Retention:   time.Hour,
+	}
+}
+
+type Event struct {
+	Event      string          `json:"event"`
+	UUID       string          `json:"uuid"`
+	Name       string          `json:"name"`
+	State      string          `json:"state"`
+	Error      string          `json:"error,omitempty"`
+	Result     json.RawMessage `json:"result,omitempty" swaggertype:"object"`
+	GroupID    string          `json:"group_id,omitempty"`
+	FinishedAt time.Time       `json:"finished_at"`
+}
+
+type Attempt struct {
+	N          int       `json:"attempt"`
+	At         time.Time `json:"at"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+}
+
+type Delivery struct {
+	UUID     string    `json:"uuid"`
+	URL      string    `json:"url"`
+	State    string    `json:"state"`
+	Attempts []Attempt `json:"attempts"`
+
+	finishedAt time.Time
+}
+
+type job struct {
+	uuid   string
+	url    string
+	secret string
+	body   []byte
+
+	attempt int
+	delay   time.Duration
+	due     time.Time
+}
+
+// retryQueue - повторы, ждущие своего срока, с ближайшим сверху
+type retryQueue []job
+
+func (q retryQueue) Len() int           { return len(q) }
+func (q retryQueue) Less(i, j int) bool { return q[i].due.Before(q[j].due) }
+func (q retryQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q *retryQueue) Push(x any)        { *q = append(*q, x.(job)) }
+
+func (q *retryQueue) Pop() any {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
+
+type finishedDelivery struct {
+	uuid string
+	at   time.Time
+}
+
+var (
+	cfg          = DefaultConfig()
+	serverSecret string
+	client       *http.Client
+
+	queue      chan job
+	wg         sync.WaitGroup
+	ctx        context.Context
+	cancelFunc context.CancelFunc
+
+	deliveries     = make(map[string]*Delivery)
+	finished       []finishedDelivery
+	lockDeliveries = &sync.RWMutex{}
+
+	// повторы ждут своего срока в одной горутине, не занимая отправителей
+	retries     retryQueue
+	retryWake   chan struct{}
+	lockRetries = &sync.Mutex{}
+)
+
+// ErrNoSecret - уведомление нечем подписать
+var ErrNoSecret = errors.New("callback_secret is required: server has no webhook secret")
+
+// SetSecret задает общий секрет подписи для задач без callback_secret
+func SetSecret(secret string) {
+	serverSecret = secret
+}
+
+func HasSecret() bool {
+	return serverSecret != ""
+}
+
+// CheckCallback не дает зарегистрировать уведомление, которое нечем подписать
+func CheckCallback(url, secret string) error {
+	if url != "" && secret == "" && !HasSecret() {
+		return ErrNoSecret
+	}
+	return nil
+}
+
+// Init запускает отправителей и подписывается на завершение задач
+func Init(c Config) {
+	cfg = c
+	client = newClient(cfg.AllowPrivate)
+	ctx, cancelFunc = context.WithCancel(context.Background())
+	queue = make(chan job, 1000)
+	retryWake = make(chan struct{}, 1)
+	retries = nil
+
+	for i := 0; i < cfg.Senders; i++ {
+		wg.Add(1)
+		go sender()
+	}
+	wg.Add(1)
+	go retrier()
+
+	storage.OnTerminal(enqueue)
+}
+
+// newClient создает клиент, который не ходит через прокси и по редиректам
+// и проверяет адрес каждого соединения: callback_url задает пользователь
+func newClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if !allowPrivate {
+		dialer.Control = netguard.Control
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func Shutdown() {
+	cancelFunc()
+	wg.Wait()
+}
+
+func GetDelivery(uuid string) (Delivery, bool) {
+	lockDeliveries.RLock()
+	defer lockDeliveries.RUnlock()
+
+	delivery, ok := deliveries[uuid]
+	if !ok {
+		return Delivery{}, false
+	}
+
+	copied := *delivery
+	copied.Attempts = append([]Attempt{}, delivery.Attempts...)
+	return copied, true
+}
+
+// Sign возвращает подпись тела так же, как ее считает получатель
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func enqueue(uuid string, stat storage.Status) {
+	if stat.CallbackURL == "" {
+		return
+	}
+
+	secret := stat.CallbackSecret
+	if secret == "" {
+		secret = serverSecret
+	}
+
+	body, err := json.Marshal(Event{
+		Event:      EventTaskFinished,
+		UUID:       uuid,
+		Name:       stat.Name,
+		State:      stat.State,
+		Error:      stat.Error,
+		Result:     stat.Result,
+		GroupID:    stat.GroupID,
+		FinishedAt: stat.FinishedAt,
+	})
+	if err != nil {
+		log.Printf("Webhook: cannot marshal event for task %s: %v", uuid, err)
+		return
+	}
+
+	lockDeliveries.Lock()
+	pruneDeliveries(clock.Now())
+	deliveries[uuid] = &Delivery{UUID: uuid, URL: stat.CallbackURL, State: DeliveryPending, Attempts: []Attempt{}}
+	lockDeliveries.Unlock()
+
+	select {
+	case queue <- job{uuid: uuid, url: stat.CallbackURL, secret: secret, body: body}:
+	default:
+		log.Printf("Webhook: queue is full, dropping notification for task %s", uuid)
+		record(uuid, Attempt{At: clock.Now(), Error: "webhook queue is full"}, DeliveryFailed)
+	}
+}
+
+func sender() {
+	defer wg.Done()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case j := <-queue:
+			deliver(j)
+		}
+	}
+}
+
+// deliver делает очередную попытку и при ошибке откладывает повтор
+// с экспоненциальной задержкой
+func deliver(j job) {
+	j.attempt++
+	attempt := send(j, j.attempt)
+
+	switch {
+	case attempt.Error == "":
+		record(j.uuid, attempt, DeliveryDelivered)
+	case j.attempt >= cfg.MaxAttempts:
+		log.Printf("Webhook: giving up on task %s after %d attempts", j.uuid, j.attempt)
+		record(j.uuid, attempt, DeliveryFailed)
+	default:
+		record(j.uuid, attempt, DeliveryPending)
+		retryLater(j)
+	}
+}
+
+func retryLater(j job) {
+	if j.delay == 0 {
+		j.delay = cfg.BaseDelay
+	} else {
+		j.delay = min(j.delay*2, cfg.MaxDelay)
+	}
+	j.due = clock.Now().Add(j.delay)
+
+	lockRetries.Lock()
+	heap.Push(&retries, j)
+	lockRetries.Unlock()
+
+	select {
+	case retryWake <- struct{}{}:
+	default:
+	}
+}
+
+// retrier возвращает в очередь повторы, срок которых пришел. Таймер
+// заводится на ближайший срок и перезаводится при каждом новом повторе.
+func retrier() {
+	defer wg.Done()
+
+	for {
+		var timer clock.Timer
+		var wait <-chan time.Time
+		lockRetries.Lock()
+		if len(retries) > 0 {
+			timer = clock.Get().NewTimer(retries[0].due.Sub(clock.Now()))
+			wait = timer.C()
+		}
+		lockRetries.Unlock()
+
+		select {
+		case <-ctx.Done():
+		case <-retryWake:
+		case <-wait:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		for _, j := range dueRetries(clock.Now()) {
+			select {
+			case <-ctx.Done():
+				return
+			case queue <- j:
+			}
+		}
+	}
+}
+
+func dueRetries(now time.Time) []job {
+	lockRetries.Lock()
+	defer lockRetries.Unlock()
+
+	due := []job{}
+	for len(retries) > 0 && !retries[0].due.After(now) {
+		due = append(due, heap.Pop(&retries).(job))
+	}
+	return due
+}
+
+func send(j job, n int) Attempt {
+	start := clock.Now()
+	attempt := Attempt{N: n, At: start}
+
+	reqCtx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodPost, j.url, bytes.NewReader(j.body))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+
+	timestamp := strconv.FormatInt(start.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(j.secret, timestamp, j.body))
+
+	resp, err := client.Do(req)
+	attempt.DurationMs = clock.Since(start).Milliseconds()
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	resp.Body.Close()
+
+	attempt.StatusCode = resp.StatusCode
+	switch {
+	case resp.StatusCode >= 300 && resp.StatusCode < 400:
+		attempt.Error = fmt.Sprintf("redirect is not followed: status code %d", resp.StatusCode)
+	case resp.StatusCode < 200 || resp.StatusCode >= 300:
+		attempt.Error = fmt.Sprintf("unexpected status code %d", resp.StatusCode)
+	}
+	return attempt
+}
+
+func record(uuid string, attempt Attempt, state string) {
+	lockDeliveries.Lock()
+	defer lockDeliveries.Unlock()
+
+	delivery, ok := deliveries[uuid]
+	if !ok {
+		return
+	}
+	if attempt.N > 0 {
+		delivery.Attempts = append(delivery.Attempts, attempt)
+	}
+	delivery.State = state
+
+	if state != DeliveryPending {
+		delivery.finishedAt = clock.Now()
+		finished = append(finished, finishedDelivery{uuid: uuid, at: delivery.finishedAt})
+		pruneDeliveries(delivery.finishedAt)
+	}
+}
+
+// pruneDeliveries удаляет доставки, завершенные раньше cfg.Retention.
+// Вызывается под lockDeliveries.
+func pruneDeliveries(now time.Time) {
+	if cfg.Retention <= 0 {
+		return
+	}
+
+	i := sort.Search(len(finished), func(i int) bool {
+		return now.Sub(finished[i].at) <= cfg.Retention
+	})
+	for _, old := range finished[:i] {
+		// задачу могли перезапустить, и у нее уже новая доставка
+		if delivery, ok := deliveries[old.uuid]; ok && delivery.finishedAt.Equal(old.at) {
+			delete(deliveries, old.uuid)
+		}
+	}
+	finished = finished[i:]
+}
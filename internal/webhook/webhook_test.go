@@ -0,0 +1,172 @@
+package webhook
+
+import (
+	"container/heap"
+	"encoding/json"
+	"io"
+	"ioboundlimiter/internal/clock"
+	"ioboundlimiter/internal/storage"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhook(t *testing.T) {
+	Init(Config{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond, Timeout: time.Second, Senders: 1, Retention: time.Minute, AllowPrivate: true})
+	defer Shutdown()
+
+	waitDelivery := func(uuid string) Delivery {
+		var delivery Delivery
+		assert.Eventually(t, func() bool {
+			delivery, _ = GetDelivery(uuid)
+			return delivery.State != "" && delivery.State != DeliveryPending
+		}, time.Second, time.Millisecond)
+		return delivery
+	}
+
+	t.Run("signed payload with retry", func(t *testing.T) {
+		var calls atomic.Int32
+		var event Event
+		receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			if calls.Add(1) == 1 {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			expected := Sign("task-secret", r.Header.Get(HeaderTimestamp), body)
+			if r.Header.Get(HeaderSignature) != expected {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			json.Unmarshal(body, &event)
+		}))
+		defer receiver.Close()
+
+		uuid, err := storage.AddWithOptions("webhook task", storage.TaskOptions{
+			CallbackURL:    receiver.URL,
+			CallbackSecret: "task-secret",
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, storage.CompleteTask(uuid, json.RawMessage(`{"ok":true}`)))
+
+		delivery := waitDelivery(uuid)
+		assert.Equal(t, DeliveryDelivered, delivery.State)
+		assert.Len(t, delivery.Attempts, 2)
+		assert.Equal(t, http.StatusInternalServerError, delivery.Attempts[0].StatusCode)
+		assert.Equal(t, http.StatusOK, delivery.Attempts[1].StatusCode)
+
+		assert.Equal(t, EventTaskFinished, event.Event)
+		assert.Equal(t, uuid, event.UUID)
+		assert.Equal(t, storage.StateDone, event.State)
+		assert.JSONEq(t, `{"ok":true}`, string(event.Result))
+	})
+
+	t.Run("server secret and give up", func(t *testing.T) {
+		SetSecret("server-secret")
+		defer SetSecret("")
+
+		receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			assert.Equal(t, Sign("server-secret", r.Header.Get(HeaderTimestamp), body), r.Header.Get(HeaderSignature))
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer receiver.Close()
+
+		uuid, err := storage.AddWithOptions("failing webhook task", storage.TaskOptions{CallbackURL: receiver.URL})
+		assert.NoError(t, err)
+		assert.NoError(t, storage.FailTask(uuid, "boom", ""))
+
+		delivery := waitDelivery(uuid)
+		assert.Equal(t, DeliveryFailed, delivery.State)
+		assert.Len(t, delivery.Attempts, 3)
+	})
+
+	t.Run("redirect is not followed", func(t *testing.T) {
+		var followed atomic.Bool
+		target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			followed.Store(true)
+		}))
+		defer target.Close()
+		receiver := httptest.NewServer(http.RedirectHandler(target.URL, http.StatusTemporaryRedirect))
+		defer receiver.Close()
+
+		uuid, err := storage.AddWithOptions("redirected webhook task", storage.TaskOptions{CallbackURL: receiver.URL, CallbackSecret: "task-secret"})
+		assert.NoError(t, err)
+		assert.NoError(t, storage.CompleteTask(uuid, nil))
+
+		delivery := waitDelivery(uuid)
+		assert.Equal(t, DeliveryFailed, delivery.State)
+		assert.Equal(t, http.StatusTemporaryRedirect, delivery.Attempts[0].StatusCode)
+		assert.Contains(t, delivery.Attempts[0].Error, "redirect is not followed")
+		assert.False(t, followed.Load())
+	})
+
+	t.Run("private addresses are refused by default", func(t *testing.T) {
+		receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		defer receiver.Close()
+
+		_, err := newClient(false).Post(receiver.URL, "application/json", nil)
+		assert.ErrorContains(t, err, "private network")
+
+		resp, err := newClient(true).Post(receiver.URL, "application/json", nil)
+		if assert.NoError(t, err) {
+			resp.Body.Close()
+		}
+	})
+
+	t.Run("finished deliveries are pruned", func(t *testing.T) {
+		receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		defer receiver.Close()
+
+		uuid, err := storage.AddWithOptions("pruned webhook task", storage.TaskOptions{CallbackURL: receiver.URL})
+		assert.NoError(t, err)
+		assert.NoError(t, storage.CompleteTask(uuid, nil))
+		assert.Equal(t, DeliveryDelivered, waitDelivery(uuid).State)
+
+		lockDeliveries.Lock()
+		pruneDeliveries(clock.Now().Add(30 * time.Second))
+		lockDeliveries.Unlock()
+		_, ok := GetDelivery(uuid)
+		assert.True(t, ok)
+
+		lockDeliveries.Lock()
+		pruneDeliveries(clock.Now().Add(2 * time.Minute))
+		lockDeliveries.Unlock()
+		_, ok = GetDelivery(uuid)
+		assert.False(t, ok)
+	})
+
+	t.Run("retry waits without a sender", func(t *testing.T) {
+		lockRetries.Lock()
+		heap.Push(&retries, job{uuid: "not-a-task", attempt: 1, due: clock.Now().Add(time.Hour)})
+		lockRetries.Unlock()
+		retryWake <- struct{}{}
+
+		// отложенный на час повтор не мешает другим доставкам единственного отправителя
+		receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		defer receiver.Close()
+
+		uuid, err := storage.AddWithOptions("webhook after retry", storage.TaskOptions{CallbackURL: receiver.URL})
+		assert.NoError(t, err)
+		assert.NoError(t, storage.CompleteTask(uuid, nil))
+		assert.Equal(t, DeliveryDelivered, waitDelivery(uuid).State)
+
+		lockRetries.Lock()
+		assert.Len(t, retries, 1)
+		lockRetries.Unlock()
+	})
+
+	t.Run("no callback", func(t *testing.T) {
+		uuid, err := storage.AddToStorage("task without callback")
+		assert.NoError(t, err)
+		assert.NoError(t, storage.SetState(uuid, storage.StateCanceled))
+
+		_, ok := GetDelivery(uuid)
+		assert.False(t, ok)
+	})
+}
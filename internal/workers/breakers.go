@@ -0,0 +1,205 @@
+package workers
+
+import (
+	"fmt"
+	"ioboundlimiter/internal/breaker"
+	"ioboundlimiter/internal/clock"
+	"ioboundlimiter/internal/metrics"
+	"ioboundlimiter/internal/storage"
+	"log"
+	"sync"
+	"time"
+)
+
+// Что делать с задачей, адресат которой отключен автоматом
+const (
+	BreakerFail  = "fail"
+	BreakerDelay = "delay"
+)
+
+type BreakerConfig struct {
+	breaker.Config
+	Action string
+}
+
+// Targeter реализуют исполнители, задачи которых обращаются к внешним
+// системам. Target - адресат задачи (хост, команда), для каждого адресата
+// заводится свой circuit breaker. Пустой Target - задача без автомата.
+type Targeter interface {
+	Target(task storage.Status) string
+}
+
+// trackedBreaker помнит, когда к адресату обращались в последний раз
+type trackedBreaker struct {
+	*breaker.Breaker
+	lastUsed time.Time
+}
+
+// Адресаты задают пользователи, поэтому автоматы адресатов, к которым давно
+// не обращались, удаляются. Открытый автомат живет не меньше OpenTimeout.
+const (
+	breakerIdle       = 10 * time.Minute
+	breakerSweepEvery = time.Minute
+)
+
+var (
+	breakerCfg       *BreakerConfig
+	breakers         = make(map[string]*trackedBreaker)
+	lastBreakerSweep time.Time
+	lockBreakers     = &sync.RWMutex{}
+
+	breakerRejected = metrics.NewCounter("ioboundlimiter_breaker_rejected_total", "Number of tasks rejected or delayed by open circuit breakers")
+)
+
+func init() {
+	metrics.NewGaugeFunc("ioboundlimiter_breakers_open", "Number of open circuit breakers", func() float64 {
+		return float64(countBreakers(breaker.StateOpen))
+	})
+	metrics.NewGaugeFunc("ioboundlimiter_breakers_half_open", "Number of half-open circuit breakers", func() float64 {
+		return float64(countBreakers(breaker.StateHalfOpen))
+	})
+}
+
+// SetBreaker включает circuit breakers для локальных задач. Вызывать до InitWorkers.
+func SetBreaker(cfg BreakerConfig) error {
+	if cfg.Action != BreakerFail && cfg.Action != BreakerDelay {
+		return fmt.Errorf("unknown breaker action %q", cfg.Action)
+	}
+	breakerCfg = &cfg
+	return nil
+}
+
+// Breakers возвращает состояние автоматов по адресатам
+func Breakers() map[string]breaker.Snapshot {
+	lockBreakers.RLock()
+	defer lockBreakers.RUnlock()
+
+	snapshots := make(map[string]breaker.Snapshot, len(breakers))
+	for target, b := range breakers {
+		snapshots[target] = b.Snapshot()
+	}
+	return snapshots
+}
+
+func countBreakers(state string) int {
+	lockBreakers.RLock()
+	defer lockBreakers.RUnlock()
+
+	count := 0
+	for _, b := range breakers {
+		if b.State() == state {
+			count++
+		}
+	}
+	return count
+}
+
+func breakerFor(task storage.Status) (*breaker.Breaker, string) {
+	if breakerCfg == nil {
+		return nil, ""
+	}
+
+	executor, ok := getExecutor(task.Type)
+	if !ok {
+		return nil, ""
+	}
+	targeter, ok := executor.(Targeter)
+	if !ok {
+		return nil, ""
+	}
+	target := targeter.Target(task)
+	if target == "" {
+		return nil, ""
+	}
+	target = task.Type + ":" + target
+
+	lockBreakers.Lock()
+	defer lockBreakers.Unlock()
+
+	now := clock.Now()
+	sweepBreakers(now)
+
+	b, ok := breakers[target]
+	if !ok {
+		b = &trackedBreaker{Breaker: breaker.New(breakerCfg.Config)}
+		breakers[target] = b
+	}
+	b.lastUsed = now
+	return b.Breaker, target
+}
+
+// sweepBreakers вызывается под lockBreakers
+func sweepBreakers(now time.Time) {
+	if now.Sub(lastBreakerSweep) < breakerSweepEvery {
+		return
+	}
+	lastBreakerSweep = now
+
+	idle := max(breakerIdle, breakerCfg.OpenTimeout)
+	for target, b := range breakers {
+		if now.Sub(b.lastUsed) > idle {
+			delete(breakers, target)
+		}
+	}
+}
+
+// admit проверяет автомат адресата уже забранной воркером задачи. Если
+// автомат открыт, задача сразу завершается с ошибкой или откладывается
+// до пробы. finish после выполнения задачи передает автомату ее итог.
+func admit(id int, uuid string, task storage.Status) (finish func(), ok bool) {
+	b, target := breakerFor(task)
+	if b == nil {
+		return func() {}, true
+	}
+
+	generation, wait, err := b.Allow()
+	if err != nil {
+		breakerRejected.Inc()
+		reject(id, uuid, target, wait)
+		return nil, false
+	}
+
+	return func() {
+		stat, err := storage.GetResponse(uuid)
+		switch {
+		case err != nil:
+			b.Abort(generation)
+		case stat.State == storage.StateDone:
+			b.Record(generation, true)
+		case stat.State == storage.StateFailed:
+			b.Record(generation, false)
+		default:
+			// отменена или возвращена в очередь - об адресате ничего не известно
+			b.Abort(generation)
+		}
+	}, true
+}
+
+func reject(id int, uuid, target string, wait time.Duration) {
+	errMsg := fmt.Sprintf("circuit breaker for %s is open", target)
+
+	if breakerCfg.Action == BreakerFail {
+		if err := storage.FailTask(uuid, errMsg, ""); err != nil {
+			log.Printf("Worker %d: cannot fail task %s: %v", id, uuid, err)
+		}
+		return
+	}
+
+	if err := storage.SetState(uuid, storage.StatePending); err != nil {
+		log.Printf("Worker %d: cannot delay task %s: %v", id, uuid, err)
+		return
+	}
+	if err := storage.ChangeStatus(uuid, errMsg+", task is delayed"); err != nil {
+		log.Printf("Worker %d: cannot delay task %s: %v", id, uuid, err)
+	}
+
+	go func() {
+		select {
+		case <-shutdownCtx.Done():
+		case <-clock.Get().After(wait):
+			if err := AddToChannel(uuid); err != nil {
+				log.Printf("Cannot requeue delayed task %s: %v", uuid, err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,92 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"ioboundlimiter/internal/storage"
+	"sync"
+)
+
+// Job - задача в том виде, в котором ее получает исполнитель
+type Job struct {
+	WorkerID int
+	UUID     string
+	Task     storage.Status
+	// Beat сообщает watchdog, что задача жива. Долгие исполнители должны
+	// вызывать его не реже HeartbeatInterval.
+	Beat func()
+	// Progress сохраняет прогресс задачи в единицах исполнителя (например, байтах)
+	Progress func(done, total int64)
+	// Output сохраняет бинарный результат задачи, например тело ответа или файл.
+	// Размер ограничен storage.ResultConfig.
+	Output func(contentType string, r io.Reader) error
+}
+
+// Executor выполняет задачу своего типа. Результат сохраняется в задаче
+// и при ошибке, если исполнитель его вернул.
+type Executor interface {
+	Execute(ctx context.Context, job Job) (json.RawMessage, error)
+}
+
+type ExecutorFunc func(ctx context.Context, job Job) (json.RawMessage, error)
+
+func (f ExecutorFunc) Execute(ctx context.Context, job Job) (json.RawMessage, error) {
+	return f(ctx, job)
+}
+
+var (
+	executors = map[string]Executor{
+		storage.DefaultType: ExecutorFunc(func(ctx context.Context, job Job) (json.RawMessage, error) {
+			return nil, processTask(ctx, job.WorkerID, job.UUID, job.Beat)
+		}),
+	}
+	// типы задач, которые выполняют удаленные воркеры
+	remoteTypes   = make(map[string]bool)
+	lockExecutors = &sync.RWMutex{}
+)
+
+var ErrUnknownType = errors.New("unknown task type")
+
+// RegisterExecutor добавляет локального исполнителя для типа задач.
+// Задачи типов без локального исполнителя уходят удаленным воркерам,
+// если тип зарегистрирован через RegisterRemoteType.
+func RegisterExecutor(taskType string, executor Executor) {
+	lockExecutors.Lock()
+	executors[taskType] = executor
+	lockExecutors.Unlock()
+}
+
+// RegisterRemoteType разрешает задачи типа, который выполняют удаленные воркеры
+func RegisterRemoteType(taskType string) {
+	lockExecutors.Lock()
+	remoteTypes[taskType] = true
+	lockExecutors.Unlock()
+}
+
+// CheckType проверяет, что задачи такого типа есть кому выполнить.
+// Иначе задача навсегда осталась бы в очереди.
+func CheckType(taskType string) error {
+	if taskType == "" {
+		taskType = storage.DefaultType
+	}
+
+	lockExecutors.RLock()
+	_, local := executors[taskType]
+	known := local || remoteTypes[taskType]
+	lockExecutors.RUnlock()
+
+	if !known {
+		return fmt.Errorf("%w: %s", ErrUnknownType, taskType)
+	}
+	return nil
+}
+
+func getExecutor(taskType string) (Executor, bool) {
+	lockExecutors.RLock()
+	executor, ok := executors[taskType]
+	lockExecutors.RUnlock()
+	return executor, ok
+}
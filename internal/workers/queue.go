@@ -0,0 +1,302 @@
+package workers
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"ioboundlimiter/internal/clock"
+	"ioboundlimiter/internal/storage"
+	"log"
+	"sync"
+	"time"
+)
+
+// localQueue - задачи для локальных воркеров: сначала с большим приоритетом,
+// при равном - в порядке поступления. На каждую задачу в очереди приходится
+// один токен в tasksChan: канал ограничивает длину очереди и будит воркеров.
+type localQueue struct {
+	mu    sync.Mutex
+	items queueItems
+	seq   uint64
+}
+
+type queueItem struct {
+	uuid     string
+	priority int
+	seq      uint64
+}
+
+type queueItems []queueItem
+
+func (q queueItems) Len() int { return len(q) }
+
+func (q queueItems) Less(i, j int) bool {
+	if q[i].priority != q[j].priority {
+		return q[i].priority > q[j].priority
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q queueItems) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *queueItems) Push(x any) { *q = append(*q, x.(queueItem)) }
+
+func (q *queueItems) Pop() any {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
+
+var localTasks = &localQueue{}
+
+// push вызывается под lockEnqueue перед отправкой токена
+func (q *localQueue) push(uuid string, priority int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.seq++
+	heap.Push(&q.items, queueItem{uuid: uuid, priority: priority, seq: q.seq})
+}
+
+// pop вызывается воркером, получившим токен
+func (q *localQueue) pop() (string, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.items) == 0 {
+		return "", false
+	}
+	return heap.Pop(&q.items).(queueItem).uuid, true
+}
+
+// reprioritize меняет приоритет задачи, которая уже стоит в очереди
+func (q *localQueue) reprioritize(uuid string, priority int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i := range q.items {
+		if q.items[i].uuid == uuid {
+			q.items[i].priority = priority
+			heap.Fix(&q.items, i)
+			return
+		}
+	}
+}
+
+// Отложенные задачи ждут своего времени вне очередей, в куче по сроку.
+// Новых отложенных задач принимается не больше queueSize.
+var (
+	scheduled     = newDueQueue()
+	lockScheduled = &sync.Mutex{}
+	scheduleWake  = make(chan struct{}, 1)
+)
+
+// enqueueDelay - через сколько повторить постановку созревшей задачи, если очередь полна
+const enqueueDelay = time.Second
+
+type dueItem struct {
+	uuid string
+	at   time.Time
+}
+
+// dueQueue - отложенные задачи с ближайшим сроком сверху. index помнит
+// место задачи в куче, чтобы перенос срока обходился без поиска.
+type dueQueue struct {
+	items []dueItem
+	index map[string]int
+}
+
+func newDueQueue() *dueQueue {
+	return &dueQueue{index: make(map[string]int)}
+}
+
+func (q *dueQueue) Len() int           { return len(q.items) }
+func (q *dueQueue) Less(i, j int) bool { return q.items[i].at.Before(q.items[j].at) }
+
+func (q *dueQueue) Swap(i, j int) {
+	q.items[i], q.items[j] = q.items[j], q.items[i]
+	q.index[q.items[i].uuid] = i
+	q.index[q.items[j].uuid] = j
+}
+
+func (q *dueQueue) Push(x any) {
+	item := x.(dueItem)
+	q.index[item.uuid] = len(q.items)
+	q.items = append(q.items, item)
+}
+
+func (q *dueQueue) Pop() any {
+	item := q.items[len(q.items)-1]
+	q.items = q.items[:len(q.items)-1]
+	delete(q.index, item.uuid)
+	return item
+}
+
+// set ставит задаче срок at, уже отложенной - переносит. Вызывается под lockScheduled.
+func (q *dueQueue) set(uuid string, at time.Time) {
+	if i, ok := q.index[uuid]; ok {
+		q.items[i].at = at
+		heap.Fix(q, i)
+		return
+	}
+	heap.Push(q, dueItem{uuid: uuid, at: at})
+}
+
+// schedule откладывает новую задачу до момента at
+func schedule(uuid string, at time.Time) error {
+	lockScheduled.Lock()
+	if _, ok := scheduled.index[uuid]; !ok && scheduled.Len() >= queueSize {
+		lockScheduled.Unlock()
+		return fmt.Errorf("cannot schedule task %s: %w", uuid, ErrQueueFull)
+	}
+	scheduled.set(uuid, at)
+	lockScheduled.Unlock()
+
+	wakeScheduler()
+	return nil
+}
+
+// postpone откладывает уже принятую задачу без проверки места: она только
+// что вышла из очереди или из отложенных и не должна потеряться
+func postpone(uuid string, at time.Time) {
+	lockScheduled.Lock()
+	scheduled.set(uuid, at)
+	lockScheduled.Unlock()
+
+	wakeScheduler()
+}
+
+// moveDue переносит срок задачи, если она отложена
+func moveDue(uuid string, at time.Time) bool {
+	lockScheduled.Lock()
+	_, ok := scheduled.index[uuid]
+	if ok {
+		scheduled.set(uuid, at)
+	}
+	lockScheduled.Unlock()
+
+	if ok {
+		wakeScheduler()
+	}
+	return ok
+}
+
+// unschedule убирает задачу из отложенных. false - ее там уже нет, например
+// планировщик только что поставил ее в очередь.
+func unschedule(uuid string) bool {
+	lockScheduled.Lock()
+	defer lockScheduled.Unlock()
+
+	i, ok := scheduled.index[uuid]
+	if ok {
+		heap.Remove(scheduled, i)
+	}
+	return ok
+}
+
+func scheduledCount() int {
+	lockScheduled.Lock()
+	defer lockScheduled.Unlock()
+	return scheduled.Len()
+}
+
+func wakeScheduler() {
+	select {
+	case scheduleWake <- struct{}{}:
+	default:
+	}
+}
+
+// scheduler ставит в очередь задачи, срок которых пришел. Таймер заводится
+// на ближайший срок и перезаводится при каждом новом сроке.
+func scheduler() {
+	defer wg.Done()
+
+	for {
+		var timer clock.Timer
+		var wait <-chan time.Time
+		lockScheduled.Lock()
+		if scheduled.Len() > 0 {
+			timer = clock.Get().NewTimer(scheduled.items[0].at.Sub(clock.Now()))
+			wait = timer.C()
+		}
+		lockScheduled.Unlock()
+
+		select {
+		case <-shutdownCtx.Done():
+		case <-scheduleWake:
+		case <-wait:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if shutdownCtx.Err() != nil {
+			return
+		}
+
+		for _, uuid := range dueTasks(clock.Now()) {
+			enqueueDue(uuid)
+		}
+	}
+}
+
+func dueTasks(now time.Time) []string {
+	lockScheduled.Lock()
+	defer lockScheduled.Unlock()
+
+	due := []string{}
+	for scheduled.Len() > 0 && !scheduled.items[0].at.After(now) {
+		due = append(due, heap.Pop(scheduled).(dueItem).uuid)
+	}
+	return due
+}
+
+// enqueueDue ставит в очередь задачу, время которой пришло.
+// Отмененные и удаленные за время ожидания задачи пропускаются.
+func enqueueDue(uuid string) {
+	if task, err := storage.GetResponse(uuid); err != nil || task.State != storage.StatePending {
+		return
+	}
+	err := AddToChannel(uuid)
+	switch {
+	case errors.Is(err, ErrQueueFull):
+		log.Printf("Queue is full, scheduled task %s waits %s more", uuid, enqueueDelay)
+		postpone(uuid, clock.Now().Add(enqueueDelay))
+	case err != nil:
+		log.Printf("Cannot enqueue scheduled task %s: %v", uuid, err)
+	}
+}
+
+// isScheduled сообщает, что задача ждет своего времени вне очереди
+func isScheduled(uuid string) bool {
+	lockScheduled.Lock()
+	defer lockScheduled.Unlock()
+	_, ok := scheduled.index[uuid]
+	return ok
+}
+
+// notDue сообщает, что время задачи еще не пришло
+func notDue(task storage.Status) bool {
+	return task.ScheduledAt.After(clock.Now())
+}
+
+// TaskUpdated применяет к очередям новые приоритет и время запуска
+// ожидающей задачи
+func TaskUpdated(uuid string) {
+	task, err := storage.GetResponse(uuid)
+	if err != nil || task.State != storage.StatePending {
+		return
+	}
+
+	switch {
+	case notDue(task) && moveDue(uuid, task.ScheduledAt):
+	case !notDue(task) && unschedule(uuid):
+		// срок перенесли на сейчас
+		enqueueDue(uuid)
+	case remote.update(uuid, task.Priority, task.ScheduledAt):
+	default:
+		// задачи в очереди, время которых отодвинули, воркер отложит сам
+		localTasks.reprioritize(uuid, task.Priority)
+	}
+}
@@ -0,0 +1,412 @@
+package workers
+
+import (
+	"container/heap"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"ioboundlimiter/internal/clock"
+	"ioboundlimiter/internal/storage"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Удаленные воркеры забирают задачи по HTTP: берут аренду (lease) на время
+// visibility timeout, продлевают ее heartbeat'ами и подтверждают результат.
+// Если аренда истекла без подтверждения, задача возвращается в очередь.
+
+const (
+	DefaultVisibility = time.Minute
+	MaxVisibility     = time.Hour
+	MaxLeaseBatch     = 10
+
+	reapInterval = time.Second
+)
+
+var (
+	ErrLeaseNotFound = errors.New("lease not found or expired")
+	ErrLeaseOwner    = errors.New("lease belongs to another worker")
+)
+
+type Lease struct {
+	ID        string          `json:"lease_id"`
+	UUID      string          `json:"uuid"`
+	Type      string          `json:"type"`
+	Name      string          `json:"name"`
+	Payload   json.RawMessage `json:"payload,omitempty" swaggertype:"object"`
+	ExpiresAt time.Time       `json:"expires_at"`
+
+	workerID string
+}
+
+type remoteQueue struct {
+	mu      sync.Mutex
+	pending map[string]*typeQueue  // type -> ожидающие задачи
+	items   map[string]*remoteItem // uuid -> задача в очереди
+	seq     uint64
+	leases  map[string]*Lease // lease id -> аренда
+	byTask  map[string]string // uuid -> lease id
+}
+
+// typeQueue - ожидающие задачи одного типа. Созревшие лежат в куче по
+// приоритету, отложенные - в куче по сроку и переходят в первую, когда
+// срок пришел. Так выбор задачи не перечитывает всю очередь из хранилища.
+type typeQueue struct {
+	ready   remoteHeap
+	waiting remoteHeap
+}
+
+type remoteItem struct {
+	uuid     string
+	taskType string
+	priority int
+	at       time.Time
+	// seq - порядок поступления, при равном приоритете раньше выдается
+	// поступившая раньше задача. У возвращенных после аренды - 0.
+	seq     uint64
+	waiting bool
+	index   int
+}
+
+// remoteHeap - куча задач, less задает порядок. index задачи обновляется
+// при каждом перемещении, чтобы убирать и менять ее без поиска.
+type remoteHeap struct {
+	items []*remoteItem
+	less  func(a, b *remoteItem) bool
+}
+
+func (h *remoteHeap) Len() int           { return len(h.items) }
+func (h *remoteHeap) Less(i, j int) bool { return h.less(h.items[i], h.items[j]) }
+
+func (h *remoteHeap) Swap(i, j int) {
+	h.items[i], h.items[j] = h.items[j], h.items[i]
+	h.items[i].index = i
+	h.items[j].index = j
+}
+
+func (h *remoteHeap) Push(x any) {
+	item := x.(*remoteItem)
+	item.index = len(h.items)
+	h.items = append(h.items, item)
+}
+
+func (h *remoteHeap) Pop() any {
+	item := h.items[len(h.items)-1]
+	h.items[len(h.items)-1] = nil
+	h.items = h.items[:len(h.items)-1]
+	return item
+}
+
+func newTypeQueue() *typeQueue {
+	return &typeQueue{
+		ready: remoteHeap{less: func(a, b *remoteItem) bool {
+			if a.priority != b.priority {
+				return a.priority > b.priority
+			}
+			return a.seq < b.seq
+		}},
+		waiting: remoteHeap{less: func(a, b *remoteItem) bool { return a.at.Before(b.at) }},
+	}
+}
+
+func (tq *typeQueue) heapOf(item *remoteItem) *remoteHeap {
+	if item.waiting {
+		return &tq.waiting
+	}
+	return &tq.ready
+}
+
+func (tq *typeQueue) len() int {
+	return tq.ready.Len() + tq.waiting.Len()
+}
+
+var remote = &remoteQueue{
+	pending: make(map[string]*typeQueue),
+	items:   make(map[string]*remoteItem),
+	leases:  make(map[string]*Lease),
+	byTask:  make(map[string]string),
+}
+
+func (q *remoteQueue) push(uuid string, task storage.Status) error {
+	return q.pushAll(map[string]storage.Status{uuid: task})
+}
+
+func (q *remoteQueue) pushAll(tasks map[string]storage.Status) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if free := queueSize - len(q.items); free < len(tasks) {
+		return fmt.Errorf("cannot add %d tasks, only %d free places in remote queue: %w", len(tasks), free, ErrQueueFull)
+	}
+
+	for uuid, task := range tasks {
+		q.seq++
+		q.add(&remoteItem{uuid: uuid, taskType: task.Type, priority: task.Priority, at: task.ScheduledAt, seq: q.seq})
+		log.Printf("task received for remote workers: %s", uuid)
+	}
+	return nil
+}
+
+// add кладет задачу в кучу ее типа, вызывается под q.mu
+func (q *remoteQueue) add(item *remoteItem) {
+	tq, ok := q.pending[item.taskType]
+	if !ok {
+		tq = newTypeQueue()
+		q.pending[item.taskType] = tq
+	}
+	item.waiting = item.at.After(clock.Now())
+	heap.Push(tq.heapOf(item), item)
+	q.items[item.uuid] = item
+}
+
+// remove убирает задачу из очереди, вызывается под q.mu
+func (q *remoteQueue) remove(item *remoteItem) {
+	tq := q.pending[item.taskType]
+	heap.Remove(tq.heapOf(item), item.index)
+	delete(q.items, item.uuid)
+	if tq.len() == 0 {
+		delete(q.pending, item.taskType)
+	}
+}
+
+// update применяет новые приоритет и время запуска задачи в очереди
+func (q *remoteQueue) update(uuid string, priority int, at time.Time) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	item, ok := q.items[uuid]
+	if !ok {
+		return false
+	}
+	q.remove(item)
+	item.priority, item.at = priority, at
+	q.add(item)
+	return true
+}
+
+func (q *remoteQueue) length() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+func (q *remoteQueue) lengthByType() map[string]int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	counts := make(map[string]int)
+	for taskType, tq := range q.pending {
+		counts[taskType] = tq.len()
+	}
+	return counts
+}
+
+func (q *remoteQueue) leased() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.leases)
+}
+
+// cancel отменяет задачу, если она в удаленной очереди или в аренде
+func (q *remoteQueue) cancel(uuid string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if leaseID, ok := q.byTask[uuid]; ok {
+		delete(q.leases, leaseID)
+		delete(q.byTask, uuid)
+		return storage.SetState(uuid, storage.StateCanceled) == nil
+	}
+
+	if item, ok := q.items[uuid]; ok {
+		q.remove(item)
+		_, err := storage.CompareAndSetState(uuid, storage.StatePending, storage.StateCanceled)
+		return err == nil
+	}
+	return false
+}
+
+// next убирает из очереди типа задачу с наибольшим приоритетом среди тех,
+// время которых пришло. Состояние задачи проверяет вызывающий.
+// Вызывается под q.mu.
+func (q *remoteQueue) next(taskType string, now time.Time) (string, bool) {
+	tq, ok := q.pending[taskType]
+	if !ok {
+		return "", false
+	}
+
+	for tq.waiting.Len() > 0 && !tq.waiting.items[0].at.After(now) {
+		item := heap.Pop(&tq.waiting).(*remoteItem)
+		item.waiting = false
+		heap.Push(&tq.ready, item)
+	}
+	if tq.ready.Len() == 0 {
+		return "", false
+	}
+
+	item := tq.ready.items[0]
+	q.remove(item)
+	return item.uuid, true
+}
+
+// LeaseTasks выдает воркеру до count задач указанных типов
+func LeaseTasks(workerID string, types []string, visibility time.Duration, count int) []Lease {
+	visibility = clampVisibility(visibility)
+	if count < 1 || count > MaxLeaseBatch {
+		count = 1
+	}
+
+	remote.mu.Lock()
+	defer remote.mu.Unlock()
+
+	now := clock.Now()
+	leases := []Lease{}
+	for _, taskType := range types {
+		for len(leases) < count {
+			taskID, ok := remote.next(taskType, now)
+			if !ok {
+				break
+			}
+
+			// отмененные и удаленные задачи выбрасываются
+			task, err := storage.CompareAndSetState(taskID, storage.StatePending, storage.StateRunning)
+			if err != nil {
+				continue
+			}
+
+			lease := &Lease{
+				ID:        uuid.New().String(),
+				UUID:      taskID,
+				Type:      taskType,
+				Name:      task.Name,
+				Payload:   task.Payload,
+				ExpiresAt: now.Add(visibility),
+				workerID:  workerID,
+			}
+			remote.leases[lease.ID] = lease
+			remote.byTask[taskID] = lease.ID
+			recordStart(task.DateCreate)
+
+			if err := storage.Heartbeat(taskID); err != nil {
+				log.Printf("Remote worker %s: heartbeat for task %s failed: %v", workerID, taskID, err)
+			}
+			if err := storage.ChangeStatus(taskID, fmt.Sprintf("leased by remote worker %s", workerID)); err != nil {
+				log.Printf("Remote worker %s: cannot change status of task %s: %v", workerID, taskID, err)
+			}
+
+			leases = append(leases, *lease)
+		}
+	}
+
+	return leases
+}
+
+// ExtendLease продлевает аренду на visibility от текущего момента
+func ExtendLease(workerID, leaseID string, visibility time.Duration) (time.Time, error) {
+	remote.mu.Lock()
+	defer remote.mu.Unlock()
+
+	lease, err := remote.ownLease(workerID, leaseID)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	lease.ExpiresAt = clock.Now().Add(clampVisibility(visibility))
+	if err := storage.Heartbeat(lease.UUID); err != nil {
+		return time.Time{}, err
+	}
+
+	return lease.ExpiresAt, nil
+}
+
+// AckLease завершает аренду результатом удаленного воркера
+func AckLease(workerID, leaseID string, success bool, errMsg string, result json.RawMessage) error {
+	remote.mu.Lock()
+	defer remote.mu.Unlock()
+
+	lease, err := remote.ownLease(workerID, leaseID)
+	if err != nil {
+		return err
+	}
+
+	delete(remote.leases, leaseID)
+	delete(remote.byTask, lease.UUID)
+	recordFinish()
+
+	if !success {
+		if errMsg == "" {
+			errMsg = "remote worker reported failure"
+		}
+		return storage.FailTask(lease.UUID, errMsg, "")
+	}
+	err = storage.CompleteTask(lease.UUID, result)
+	if errors.Is(err, storage.ErrResultTooLarge) {
+		storage.FailTask(lease.UUID, err.Error(), "")
+	}
+	return err
+}
+
+// ownLease вызывается под remote.mu
+func (q *remoteQueue) ownLease(workerID, leaseID string) (*Lease, error) {
+	lease, ok := q.leases[leaseID]
+	if !ok || clock.Now().After(lease.ExpiresAt) {
+		return nil, ErrLeaseNotFound
+	}
+	if lease.workerID != workerID {
+		return nil, ErrLeaseOwner
+	}
+	return lease, nil
+}
+
+// reapLeases возвращает в очередь задачи с истекшей арендой
+func reapLeases() {
+	defer wg.Done()
+
+	ticker := clock.Get().NewTicker(reapInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-shutdownCtx.Done():
+			return
+		case now := <-ticker.C():
+			remote.reap(now)
+		}
+	}
+}
+
+func (q *remoteQueue) reap(now time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for id, lease := range q.leases {
+		if now.Before(lease.ExpiresAt) {
+			continue
+		}
+
+		delete(q.leases, id)
+		delete(q.byTask, lease.UUID)
+
+		task, err := storage.CompareAndSetState(lease.UUID, storage.StateRunning, storage.StatePending)
+		if err != nil {
+			continue
+		}
+		if err := storage.ChangeStatus(lease.UUID, "pending"); err != nil {
+			log.Printf("Cannot change status of task %s: %v", lease.UUID, err)
+		}
+
+		log.Printf("Lease %s of task %s expired, returning task to queue", id, lease.UUID)
+		// возвращенная задача выдается первой среди задач с тем же приоритетом
+		q.add(&remoteItem{uuid: lease.UUID, taskType: lease.Type, priority: task.Priority, at: task.ScheduledAt})
+	}
+}
+
+func clampVisibility(visibility time.Duration) time.Duration {
+	if visibility <= 0 {
+		return DefaultVisibility
+	}
+	return min(visibility, MaxVisibility)
+}
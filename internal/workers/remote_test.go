@@ -0,0 +1,168 @@
+package workers
+
+import (
+	"encoding/json"
+	"ioboundlimiter/internal/storage"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func addRemoteTask(t *testing.T, taskType string) string {
+	return pushRemoteTask(t, "remote_task", storage.TaskOptions{Type: taskType})
+}
+
+func pushRemoteTask(t *testing.T, name string, opts storage.TaskOptions) string {
+	id, err := storage.AddWithOptions(name, opts)
+	assert.NoError(t, err)
+	task, err := storage.GetResponse(id)
+	assert.NoError(t, err)
+	assert.NoError(t, remote.push(id, task))
+	return id
+}
+
+func TestLeaseTasks(t *testing.T) {
+	t.Run("lease and ack success", func(t *testing.T) {
+		id := addRemoteTask(t, "remote_ack")
+
+		leases := LeaseTasks("worker-1", []string{"remote_ack"}, time.Minute, 5)
+		assert.Len(t, leases, 1)
+		assert.Equal(t, id, leases[0].UUID)
+
+		task, _ := storage.GetResponse(id)
+		assert.Equal(t, storage.StateRunning, task.State)
+
+		assert.ErrorIs(t, AckLease("worker-2", leases[0].ID, true, "", nil), ErrLeaseOwner)
+		assert.NoError(t, AckLease("worker-1", leases[0].ID, true, "", json.RawMessage(`{"ok":true}`)))
+
+		task, _ = storage.GetResponse(id)
+		assert.Equal(t, storage.StateDone, task.State)
+		assert.JSONEq(t, `{"ok":true}`, string(task.Result))
+
+		assert.ErrorIs(t, AckLease("worker-1", leases[0].ID, true, "", nil), ErrLeaseNotFound)
+	})
+
+	t.Run("ack failure", func(t *testing.T) {
+		id := addRemoteTask(t, "remote_fail")
+
+		leases := LeaseTasks("worker-1", []string{"remote_fail"}, time.Minute, 1)
+		assert.NoError(t, AckLease("worker-1", leases[0].ID, false, "boom", nil))
+
+		task, _ := storage.GetResponse(id)
+		assert.Equal(t, storage.StateFailed, task.State)
+		assert.Equal(t, "boom", task.Error)
+	})
+
+	t.Run("expired lease returns task to queue", func(t *testing.T) {
+		id := addRemoteTask(t, "remote_expire")
+
+		leases := LeaseTasks("worker-1", []string{"remote_expire"}, time.Minute, 1)
+		assert.Len(t, leases, 1)
+		assert.Empty(t, LeaseTasks("worker-2", []string{"remote_expire"}, time.Minute, 1))
+
+		remote.reap(time.Now().Add(2 * time.Minute))
+
+		task, _ := storage.GetResponse(id)
+		assert.Equal(t, storage.StatePending, task.State)
+
+		_, err := ExtendLease("worker-1", leases[0].ID, time.Minute)
+		assert.ErrorIs(t, err, ErrLeaseNotFound)
+
+		leases = LeaseTasks("worker-2", []string{"remote_expire"}, time.Minute, 1)
+		assert.Len(t, leases, 1)
+		assert.Equal(t, id, leases[0].UUID)
+	})
+
+	t.Run("canceled task is not leased", func(t *testing.T) {
+		id := addRemoteTask(t, "remote_cancel")
+		assert.True(t, remote.cancel(id))
+
+		assert.Empty(t, LeaseTasks("worker-1", []string{"remote_cancel"}, time.Minute, 1))
+
+		task, _ := storage.GetResponse(id)
+		assert.Equal(t, storage.StateCanceled, task.State)
+	})
+}
+
+func TestLeasePriority(t *testing.T) {
+	low := addRemoteTask(t, "remote_priority")
+	high := pushRemoteTask(t, "urgent", storage.TaskOptions{Type: "remote_priority", Priority: 5})
+	later := pushRemoteTask(t, "later", storage.TaskOptions{Type: "remote_priority", Priority: 10, ScheduledAt: time.Now().Add(time.Hour)})
+
+	leases := LeaseTasks("worker-1", []string{"remote_priority"}, time.Minute, 5)
+	assert.Len(t, leases, 2)
+	assert.Equal(t, high, leases[0].UUID)
+	assert.Equal(t, low, leases[1].UUID)
+
+	task, _ := storage.GetResponse(later)
+	assert.Equal(t, storage.StatePending, task.State)
+	remote.cancel(later)
+}
+
+func TestRemoteQueueUpdates(t *testing.T) {
+	const taskType = "remote_update"
+
+	t.Run("priority change reorders queue", func(t *testing.T) {
+		first := addRemoteTask(t, taskType)
+		second := addRemoteTask(t, taskType)
+
+		priority := 3
+		_, err := storage.UpdatePending(second, 0, storage.TaskPatch{Priority: &priority})
+		assert.NoError(t, err)
+		TaskUpdated(second)
+
+		leases := LeaseTasks("worker-1", []string{taskType}, time.Minute, 2)
+		if assert.Len(t, leases, 2) {
+			assert.Equal(t, second, leases[0].UUID)
+			assert.Equal(t, first, leases[1].UUID)
+		}
+	})
+
+	t.Run("postponed task waits", func(t *testing.T) {
+		id := addRemoteTask(t, taskType)
+
+		at := time.Now().Add(time.Hour)
+		_, err := storage.UpdatePending(id, 0, storage.TaskPatch{ScheduledAt: &at})
+		assert.NoError(t, err)
+		TaskUpdated(id)
+		assert.Empty(t, LeaseTasks("worker-1", []string{taskType}, time.Minute, 1))
+		assert.Equal(t, 1, remote.lengthByType()[taskType])
+
+		now := time.Now()
+		_, err = storage.UpdatePending(id, 0, storage.TaskPatch{ScheduledAt: &now})
+		assert.NoError(t, err)
+		TaskUpdated(id)
+		leases := LeaseTasks("worker-1", []string{taskType}, time.Minute, 1)
+		if assert.Len(t, leases, 1) {
+			assert.Equal(t, id, leases[0].UUID)
+		}
+	})
+
+	t.Run("deleted task is skipped", func(t *testing.T) {
+		deleted := addRemoteTask(t, taskType)
+		kept := addRemoteTask(t, taskType)
+		assert.NoError(t, storage.DeleteTask(deleted))
+
+		leases := LeaseTasks("worker-1", []string{taskType}, time.Minute, 2)
+		if assert.Len(t, leases, 1) {
+			assert.Equal(t, kept, leases[0].UUID)
+		}
+		assert.Zero(t, remote.lengthByType()[taskType])
+	})
+
+	t.Run("expired lease goes before queued tasks", func(t *testing.T) {
+		leased := addRemoteTask(t, "remote_reap")
+		leases := LeaseTasks("worker-1", []string{"remote_reap"}, time.Minute, 1)
+		assert.Len(t, leases, 1)
+		queued := addRemoteTask(t, "remote_reap")
+
+		remote.reap(time.Now().Add(2 * time.Minute))
+
+		leases = LeaseTasks("worker-2", []string{"remote_reap"}, time.Minute, 2)
+		if assert.Len(t, leases, 2) {
+			assert.Equal(t, leased, leases[0].UUID)
+			assert.Equal(t, queued, leases[1].UUID)
+		}
+	})
+}
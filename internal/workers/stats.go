@@ -0,0 +1,91 @@
+package workers
+
+import (
+	"ioboundlimiter/internal/clock"
+	"sort"
+	"sync"
+	"time"
+)
+
+const statsWindow = 5 * time.Minute
+
+type startSample struct {
+	at   time.Time
+	wait time.Duration
+}
+
+// stats хранит старты и завершения задач за последние statsWindow
+// для подсчета пропускной способности и времени ожидания.
+var (
+	starts    []startSample
+	finishes  []time.Time
+	lockStats = &sync.Mutex{}
+)
+
+func recordStart(createdAt time.Time) {
+	now := clock.Now()
+
+	lockStats.Lock()
+	starts = append(trimStarts(now), startSample{at: now, wait: now.Sub(createdAt)})
+	lockStats.Unlock()
+}
+
+func recordFinish() {
+	now := clock.Now()
+
+	lockStats.Lock()
+	finishes = append(trimFinishes(now), now)
+	lockStats.Unlock()
+}
+
+// trimStarts и trimFinishes вызываются под lockStats
+func trimStarts(now time.Time) []startSample {
+	i := sort.Search(len(starts), func(i int) bool {
+		return now.Sub(starts[i].at) <= statsWindow
+	})
+	return starts[i:]
+}
+
+func trimFinishes(now time.Time) []time.Time {
+	i := sort.Search(len(finishes), func(i int) bool {
+		return now.Sub(finishes[i]) <= statsWindow
+	})
+	return finishes[i:]
+}
+
+type Throughput struct {
+	// LastMinute - задач завершено за последнюю минуту
+	LastMinute int `json:"last_minute"`
+	// PerMinute - среднее за последние 5 минут
+	PerMinute float64 `json:"per_minute_5m"`
+	// AvgWait - среднее время от создания задачи до начала выполнения за последние 5 минут
+	AvgWait string `json:"avg_wait"`
+}
+
+func getThroughput() Throughput {
+	now := clock.Now()
+
+	lockStats.Lock()
+	defer lockStats.Unlock()
+
+	starts = trimStarts(now)
+	finishes = trimFinishes(now)
+
+	t := Throughput{PerMinute: float64(len(finishes)) / statsWindow.Minutes()}
+	for _, finish := range finishes {
+		if now.Sub(finish) <= time.Minute {
+			t.LastMinute++
+		}
+	}
+
+	var totalWait time.Duration
+	for _, start := range starts {
+		totalWait += start.wait
+	}
+	if len(starts) > 0 {
+		totalWait /= time.Duration(len(starts))
+	}
+	t.AvgWait = totalWait.Round(time.Millisecond).String()
+
+	return t
+}
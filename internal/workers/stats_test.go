@@ -0,0 +1,37 @@
+package workers
+
+import (
+	"ioboundlimiter/internal/clock"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThroughput(t *testing.T) {
+	fake := clock.NewFake(time.Now())
+	clock.Set(fake)
+	defer clock.Set(clock.Real{})
+
+	lockStats.Lock()
+	starts, finishes = nil, nil
+	lockStats.Unlock()
+
+	recordStart(fake.Now().Add(-10 * time.Second))
+	recordStart(fake.Now().Add(-30 * time.Second))
+	recordFinish()
+	fake.Advance(2 * time.Minute)
+	recordFinish()
+
+	tp := getThroughput()
+	assert.Equal(t, 1, tp.LastMinute)
+	assert.Equal(t, 2/statsWindow.Minutes(), tp.PerMinute)
+	assert.Equal(t, "20s", tp.AvgWait)
+
+	// старые записи выпадают из окна
+	fake.Advance(statsWindow + time.Second)
+	tp = getThroughput()
+	assert.Equal(t, 0, tp.LastMinute)
+	assert.Equal(t, 0.0, tp.PerMinute)
+	assert.Equal(t, "0s", tp.AvgWait)
+}
@@ -0,0 +1,51 @@
+package workers
+
+import (
+	"fmt"
+	"ioboundlimiter/internal/storage"
+	"ioboundlimiter/internal/webhook"
+	"log"
+	"time"
+)
+
+// Submit создает задачу и ставит ее в очередь - общая часть всех API
+// сервиса. С memoize повторная отправка получает уже существующую задачу,
+// memoTTL <= 0 - TTL по умолчанию. Возвращает UUID и результат мемоизации.
+func Submit(name string, opts storage.TaskOptions, memoize bool, memoTTL time.Duration) (string, string, error) {
+	if err := CheckCost(opts.Cost); err != nil {
+		log.Printf("ERROR: %v", err)
+		return "", "", err
+	}
+	if err := CheckType(opts.Type); err != nil {
+		log.Printf("ERROR: %v", err)
+		return "", "", err
+	}
+	if err := webhook.CheckCallback(opts.CallbackURL, opts.CallbackSecret); err != nil {
+		log.Printf("ERROR: %v", err)
+		return "", "", err
+	}
+
+	var uuid string
+	var err error
+	memo := storage.MemoMiss
+	if memoize {
+		uuid, memo, err = storage.AddMemoized(name, opts, memoTTL)
+	} else {
+		uuid, err = storage.AddWithOptions(name, opts)
+	}
+	if err != nil {
+		log.Printf("ERROR: cannot create task: %v", err)
+		return "", "", fmt.Errorf("cannot create task: %w", err)
+	}
+
+	if memo == storage.MemoMiss {
+		if err := AddToChannel(uuid); err != nil {
+			log.Printf("Server is busy: %v", err)
+			// иначе повторные отправки будут ждать задачу, которая не запустится
+			storage.DeleteTask(uuid)
+			return "", "", err
+		}
+	}
+
+	return uuid, memo, nil
+}
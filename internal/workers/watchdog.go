@@ -0,0 +1,170 @@
+package workers
+
+import (
+	"context"
+	"fmt"
+	"ioboundlimiter/internal/clock"
+	"ioboundlimiter/internal/metrics"
+	"ioboundlimiter/internal/storage"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Действие watchdog над зависшей задачей
+const (
+	ActionAlert   = "alert"
+	ActionCancel  = "cancel"
+	ActionRequeue = "requeue"
+)
+
+// HeartbeatInterval - как часто выполняемая задача должна отправлять heartbeat
+const HeartbeatInterval = 10 * time.Second
+
+type WatchdogConfig struct {
+	// Interval - как часто проверять выполняемые задачи
+	Interval time.Duration
+	// StaleAfter - задача считается зависшей, если heartbeat старше
+	StaleAfter time.Duration
+	Action     string
+}
+
+var (
+	watchdogCfg = WatchdogConfig{
+		Interval:   15 * time.Second,
+		StaleAfter: time.Minute,
+		Action:     ActionAlert,
+	}
+
+	running     = make(map[string]*runningTask)
+	lockRunning = &sync.RWMutex{}
+
+	stuckTasks = metrics.NewCounter("ioboundlimiter_stuck_tasks_total", "Number of tasks flagged by the watchdog as stuck")
+)
+
+func init() {
+	metrics.NewGaugeFunc("ioboundlimiter_stale_tasks", "Number of running tasks with a stale heartbeat", func() float64 {
+		return float64(len(staleTasks(clock.Now())))
+	})
+}
+
+type runningTask struct {
+	uuid      string
+	taskType  string
+	workerID  int
+	startedAt time.Time
+	heartbeat atomic.Int64 // unix nano
+	cancel    context.CancelFunc
+
+	flagged atomic.Bool
+	requeue atomic.Bool
+}
+
+func (rt *runningTask) beat() {
+	rt.heartbeat.Store(clock.Now().UnixNano())
+	if err := storage.Heartbeat(rt.uuid); err != nil {
+		log.Printf("Worker %d: heartbeat for task %s failed: %v", rt.workerID, rt.uuid, err)
+	}
+}
+
+func (rt *runningTask) lastBeat() time.Time {
+	return time.Unix(0, rt.heartbeat.Load())
+}
+
+// SetWatchdog задает настройки watchdog. Вызывать до InitWorkers.
+func SetWatchdog(cfg WatchdogConfig) error {
+	switch cfg.Action {
+	case ActionAlert, ActionCancel, ActionRequeue:
+	default:
+		return fmt.Errorf("unknown watchdog action: %s", cfg.Action)
+	}
+	if cfg.Interval <= 0 || cfg.StaleAfter <= 0 {
+		return fmt.Errorf("watchdog interval and stale timeout should be positive")
+	}
+
+	watchdogCfg = cfg
+	return nil
+}
+
+// claimTask переводит задачу из pending в running и регистрирует ее в running
+// под одной блокировкой: CancelTask видит задачу либо ожидающей, либо с
+// функцией отмены. Возвращает задачу в том виде, в каком ее забрали.
+func claimTask(id int, uuid string, cancel context.CancelFunc) (*runningTask, storage.Status, error) {
+	lockRunning.Lock()
+	task, err := storage.CompareAndSetState(uuid, storage.StatePending, storage.StateRunning)
+	if err != nil {
+		lockRunning.Unlock()
+		return nil, storage.Status{}, err
+	}
+	rt := &runningTask{uuid: uuid, workerID: id, taskType: task.Type, startedAt: clock.Now(), cancel: cancel}
+	running[uuid] = rt
+	lockRunning.Unlock()
+
+	rt.beat()
+	return rt, task, nil
+}
+
+// stopRunning снимает задачу с учета, только если запись все еще ее:
+// после requeue задачу может забрать другой воркер раньше, чем этот
+// закончит выполнение, и его запись удалять нельзя.
+func stopRunning(rt *runningTask) {
+	lockRunning.Lock()
+	if running[rt.uuid] == rt {
+		delete(running, rt.uuid)
+	}
+	lockRunning.Unlock()
+}
+
+func staleTasks(now time.Time) []*runningTask {
+	lockRunning.RLock()
+	defer lockRunning.RUnlock()
+
+	stale := []*runningTask{}
+	for _, rt := range running {
+		if now.Sub(rt.lastBeat()) > watchdogCfg.StaleAfter {
+			stale = append(stale, rt)
+		}
+	}
+	return stale
+}
+
+func watchdog() {
+	defer wg.Done()
+
+	ticker := clock.Get().NewTicker(watchdogCfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-shutdownCtx.Done():
+			return
+		case now := <-ticker.C():
+			for _, rt := range staleTasks(now) {
+				handleStale(rt, now)
+			}
+		}
+	}
+}
+
+func handleStale(rt *runningTask, now time.Time) {
+	if rt.flagged.Swap(true) {
+		return
+	}
+
+	stuckTasks.Inc()
+	log.Printf("Watchdog: task %s on worker %d has no heartbeat for %v", rt.uuid, rt.workerID, now.Sub(rt.lastBeat()).Round(time.Second))
+
+	switch watchdogCfg.Action {
+	case ActionCancel:
+		log.Printf("Watchdog: cancelling task %s", rt.uuid)
+		rt.cancel()
+		if err := storage.ChangeStatus(rt.uuid, "canceled by watchdog: heartbeat is stale"); err != nil {
+			log.Printf("Watchdog: cannot change status of task %s: %v", rt.uuid, err)
+		}
+	case ActionRequeue:
+		log.Printf("Watchdog: requeueing task %s", rt.uuid)
+		rt.requeue.Store(true)
+		rt.cancel()
+	}
+}
@@ -0,0 +1,141 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"ioboundlimiter/internal/clock"
+	"ioboundlimiter/internal/storage"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// trackStale регистрирует задачу в running с последним heartbeat в момент at
+func trackStale(t *testing.T, uuid string, at time.Time) (*runningTask, context.Context) {
+	ctx, cancel := context.WithCancel(context.Background())
+	rt := &runningTask{uuid: uuid, cancel: cancel}
+	rt.heartbeat.Store(at.UnixNano())
+
+	lockRunning.Lock()
+	running[uuid] = rt
+	lockRunning.Unlock()
+	t.Cleanup(func() {
+		cancel()
+		stopRunning(rt)
+	})
+	return rt, ctx
+}
+
+func TestHandleStale(t *testing.T) {
+	now := time.Now()
+	defer func(cfg WatchdogConfig) { watchdogCfg = cfg }(watchdogCfg)
+	watchdogCfg = WatchdogConfig{Interval: time.Second, StaleAfter: time.Minute, Action: ActionAlert}
+
+	t.Run("stale detection", func(t *testing.T) {
+		fresh, _ := trackStale(t, "watchdog fresh", now)
+		stale, _ := trackStale(t, "watchdog stale", now.Add(-2*time.Minute))
+
+		found := staleTasks(now)
+		assert.Contains(t, found, stale)
+		assert.NotContains(t, found, fresh)
+		assert.Contains(t, staleTasks(now.Add(2*time.Minute)), fresh)
+	})
+
+	t.Run("alert flags task once", func(t *testing.T) {
+		stuck := stuckTasks.Value()
+		rt, ctx := trackStale(t, "watchdog alert", now.Add(-2*time.Minute))
+
+		handleStale(rt, now)
+		handleStale(rt, now)
+		assert.True(t, rt.flagged.Load())
+		assert.Equal(t, stuck+1, stuckTasks.Value())
+		assert.NoError(t, ctx.Err())
+		assert.False(t, rt.requeue.Load())
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		watchdogCfg.Action = ActionCancel
+		id, _ := storage.AddToStorage("watchdog cancel")
+		rt, ctx := trackStale(t, id, now.Add(-2*time.Minute))
+
+		handleStale(rt, now)
+		assert.ErrorIs(t, ctx.Err(), context.Canceled)
+		assert.False(t, rt.requeue.Load())
+		task, _ := storage.GetResponse(id)
+		assert.Equal(t, "canceled by watchdog: heartbeat is stale", task.CurStatus)
+	})
+
+	t.Run("requeue", func(t *testing.T) {
+		watchdogCfg.Action = ActionRequeue
+		rt, ctx := trackStale(t, "watchdog requeue", now.Add(-2*time.Minute))
+
+		handleStale(rt, now)
+		assert.ErrorIs(t, ctx.Err(), context.Canceled)
+		assert.True(t, rt.requeue.Load())
+	})
+
+	t.Run("stale entry does not remove a newer claim", func(t *testing.T) {
+		old, _ := trackStale(t, "watchdog reclaimed", now)
+		current, _ := trackStale(t, "watchdog reclaimed", now)
+
+		stopRunning(old)
+		lockRunning.RLock()
+		assert.Same(t, current, running["watchdog reclaimed"])
+		lockRunning.RUnlock()
+	})
+}
+
+func TestWatchdog(t *testing.T) {
+	fake := clock.NewFake(time.Now())
+	clock.Set(fake)
+	defer clock.Set(clock.Real{})
+	defer func(cfg WatchdogConfig) { watchdogCfg = cfg }(watchdogCfg)
+
+	// первый запуск задачи зависает без heartbeat, повторный сразу завершается
+	started := sync.Map{}
+	RegisterExecutor("test_stuck", ExecutorFunc(func(ctx context.Context, job Job) (json.RawMessage, error) {
+		if _, again := started.LoadOrStore(job.UUID, true); again {
+			return json.RawMessage(`"recovered"`), nil
+		}
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}))
+
+	waitState := func(t *testing.T, id, state string) {
+		assert.Eventually(t, func() bool {
+			fake.Advance(10 * time.Second)
+			task, _ := storage.GetResponse(id)
+			return task.State == state
+		}, 5*time.Second, time.Millisecond)
+	}
+
+	tests := []struct {
+		action string
+		state  string
+	}{
+		{ActionCancel, storage.StateCanceled},
+		{ActionRequeue, storage.StateDone},
+	}
+	for _, tt := range tests {
+		t.Run(tt.action, func(t *testing.T) {
+			assert.NoError(t, SetWatchdog(WatchdogConfig{Interval: 10 * time.Second, StaleAfter: 30 * time.Second, Action: tt.action}))
+			InitWorkers()
+			defer Shutdown()
+
+			stuck := stuckTasks.Value()
+			id, _ := storage.AddWithOptions("stuck", storage.TaskOptions{Type: "test_stuck"})
+			assert.NoError(t, AddToChannel(id))
+
+			waitState(t, id, tt.state)
+			assert.Equal(t, stuck+1, stuckTasks.Value())
+			assert.Eventually(t, func() bool {
+				lockRunning.RLock()
+				defer lockRunning.RUnlock()
+				_, ok := running[id]
+				return !ok
+			}, time.Second, time.Millisecond)
+		})
+	}
+}
@@ -2,39 +2,124 @@ package workers
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"ioboundlimiter/internal/clock"
+	"ioboundlimiter/internal/limiter"
+	"ioboundlimiter/internal/metrics"
 	"ioboundlimiter/internal/storage"
 	"log"
 	"math/rand"
+	"runtime/debug"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 var (
-	tasksChan   chan string
-	semaphore   chan struct{}
+	tasksChan   chan struct{}
+	lim         limiter.Limiter
 	wg          sync.WaitGroup // Для ожидания завершения воркеров
 	shutdownCtx context.Context
 	cancelFunc  context.CancelFunc
+
+	inFlight     atomic.Int64
+	workersCount int
+	lockEnqueue  = &sync.Mutex{}
+
+	taskPanics = metrics.NewCounter("ioboundlimiter_task_panics_total", "Number of panics recovered while executing tasks")
+
+	adaptiveCfg *limiter.Config
+	capacity    = maxWorkers
 )
 
-const maxWorkers = 5
+var (
+	ErrQueueFull   = errors.New("task queue is full")
+	ErrStopped     = errors.New("workers are stopped")
+	ErrCostTooHigh = errors.New("task cost exceeds total capacity")
+)
+
+const (
+	maxWorkers = 5
+	queueSize  = 100
+)
+
+func init() {
+	metrics.NewGaugeFunc("ioboundlimiter_concurrency_limit", "Current concurrency limit of the worker pool", func() float64 {
+		if lim == nil {
+			return 0
+		}
+		return float64(lim.Limit())
+	})
+	metrics.NewGaugeFunc("ioboundlimiter_tasks_in_flight", "Number of tasks being executed right now", func() float64 {
+		return float64(inFlight.Load())
+	})
+	metrics.NewGaugeFunc("ioboundlimiter_used_capacity", "Sum of costs of tasks being executed right now", func() float64 {
+		if lim == nil {
+			return 0
+		}
+		return float64(lim.Used())
+	})
+	metrics.NewGaugeFunc("ioboundlimiter_queue_length", "Number of tasks waiting in the queue", func() float64 {
+		return float64(len(tasksChan))
+	})
+}
+
+// SetCapacity задает суммарную емкость семафора (сумму весов одновременно
+// выполняемых задач). Вызывать до InitWorkers.
+func SetCapacity(n int) {
+	if n > 0 {
+		capacity = n
+	}
+}
+
+// UseAdaptiveLimiter включает адаптивный лимит конкурентности вместо
+// фиксированного maxWorkers. Вызывать до InitWorkers.
+func UseAdaptiveLimiter(cfg limiter.Config) {
+	adaptiveCfg = &cfg
+}
 
 func InitWorkers() {
 
 	shutdownCtx, cancelFunc = context.WithCancel(context.Background())
-	tasksChan = make(chan string, 100)
-	semaphore = make(chan struct{}, maxWorkers)
+	tasksChan = make(chan struct{}, queueSize)
+	localTasks = &localQueue{}
+	lockScheduled.Lock()
+	scheduled = newDueQueue()
+	lockScheduled.Unlock()
+
+	if adaptiveCfg != nil {
+		lim = limiter.NewAdaptive(*adaptiveCfg)
+	} else {
+		lim = limiter.NewFixed(capacity)
+	}
+	// воркеров должно хватать, чтобы легкие задачи могли занять всю емкость
+	workersCount = max(maxWorkers, lim.Capacity())
 
-	for i := 0; i < maxWorkers; i++ {
+	for i := 0; i < workersCount; i++ {
 		wg.Add(1)
 		go worker(i)
 	}
+
+	wg.Add(1)
+	go watchdog()
+
+	wg.Add(1)
+	go reapLeases()
+
+	wg.Add(1)
+	go scheduler()
 }
 
 func Shutdown() {
 	cancelFunc()
+
+	// под lockEnqueue, чтобы отложенные задачи не попали в закрытый канал
+	lockEnqueue.Lock()
 	close(tasksChan)
+	lockEnqueue.Unlock()
 
 	done := make(chan struct{})
 	go func() {
@@ -45,11 +130,88 @@ func Shutdown() {
 	select {
 	case <-done:
 		log.Println("All workers stopped gracefully")
-	case <-time.After(5 * time.Second):
+	case <-clock.Get().After(5 * time.Second):
 		log.Println("Timeout: some workers did not finish")
 	}
 }
 
+// CheckCost проверяет, что задачу с таким весом вообще можно выполнить.
+// Задача тяжелее всей емкости никогда не получит семафор.
+func CheckCost(cost int) error {
+	if cost > lim.Capacity() {
+		return fmt.Errorf("%w: %d > %d", ErrCostTooHigh, cost, lim.Capacity())
+	}
+	return nil
+}
+
+type WorkerInfo struct {
+	ID        int        `json:"id"`
+	Busy      bool       `json:"busy"`
+	Task      string     `json:"task,omitempty"`
+	TaskType  string     `json:"task_type,omitempty"`
+	StartedAt *time.Time `json:"started_at,omitempty"`
+}
+
+// Introspection - подробное состояние очередей и воркеров для админов
+type Introspection struct {
+	Queue QueueStatus `json:"queue"`
+	// PendingByType - ожидающие задачи по типам (локальные и удаленные)
+	PendingByType map[string]int `json:"pending_by_type"`
+	// RemotePendingByType - задачи в очереди удаленных воркеров по типам
+	RemotePendingByType map[string]int `json:"remote_pending_by_type"`
+	Workers             []WorkerInfo   `json:"workers"`
+	Throughput          Throughput     `json:"throughput"`
+}
+
+func Introspect() Introspection {
+	workers := make([]WorkerInfo, workersCount)
+	for i := range workers {
+		workers[i].ID = i
+	}
+
+	lockRunning.RLock()
+	for _, rt := range running {
+		if rt.workerID < 0 || rt.workerID >= len(workers) {
+			continue
+		}
+		startedAt := rt.startedAt
+		workers[rt.workerID] = WorkerInfo{ID: rt.workerID, Busy: true, Task: rt.uuid, TaskType: rt.taskType, StartedAt: &startedAt}
+	}
+	lockRunning.RUnlock()
+
+	return Introspection{
+		Queue:               GetQueueStatus(),
+		PendingByType:       storage.CountByType(storage.StatePending),
+		RemotePendingByType: remote.lengthByType(),
+		Workers:             workers,
+		Throughput:          getThroughput(),
+	}
+}
+
+type QueueStatus struct {
+	Length           int  `json:"queue_length"`
+	Capacity         int  `json:"queue_capacity"`
+	RemoteLength     int  `json:"remote_queue_length"`
+	Leased           int  `json:"leased"`
+	InFlight         int  `json:"in_flight"`
+	UsedCapacity     int  `json:"used_capacity"`
+	ConcurrencyLimit int  `json:"concurrency_limit"`
+	Adaptive         bool `json:"adaptive"`
+}
+
+func GetQueueStatus() QueueStatus {
+	return QueueStatus{
+		Length:           len(tasksChan),
+		Capacity:         cap(tasksChan),
+		RemoteLength:     remote.length(),
+		Leased:           remote.leased(),
+		InFlight:         int(inFlight.Load()),
+		UsedCapacity:     lim.Used(),
+		ConcurrencyLimit: lim.Limit(),
+		Adaptive:         adaptiveCfg != nil,
+	}
+}
+
 func worker(id int) {
 	defer wg.Done()
 
@@ -58,38 +220,181 @@ func worker(id int) {
 		case <-shutdownCtx.Done():
 			log.Printf("Worker %d: shutting down...", id)
 			return
-		case uuid, ok := <-tasksChan:
+		case _, ok := <-tasksChan:
 			if !ok {
 				log.Printf("Worker %d: no more tasks, exiting", id)
 				return
 			}
+			uuid, ok := localTasks.pop()
+			if !ok {
+				continue
+			}
 
-			semaphore <- struct{}{}
-			if !storage.IsExists(uuid) {
-				<-semaphore
+			task, err := storage.GetResponse(uuid)
+			if err != nil || task.State != storage.StatePending {
+				continue
+			}
+			// время запуска перенесли, пока задача стояла в очереди
+			if notDue(task) {
+				postpone(uuid, task.ScheduledAt)
 				continue
 			}
+			// освобождается столько, сколько заняли, даже если задача изменится
+			cost := task.Cost
+			if err := lim.Acquire(shutdownCtx, cost); err != nil {
+				log.Printf("Worker %d: shutting down...", id)
+				return
+			}
+			// пока ждали семафор, задачу могли отменить или изменить:
+			// выполняется задача в том виде, в каком ее забрали
+			ctx, cancel := context.WithCancel(shutdownCtx)
+			rt, task, err := claimTask(id, uuid, cancel)
+			if err != nil {
+				cancel()
+				lim.Release(cost, 0, nil)
+				continue
+			}
+			finish, ok := admit(id, uuid, task)
+			if !ok {
+				stopRunning(rt)
+				cancel()
+				lim.Release(cost, 0, nil)
+				continue
+			}
+
+			inFlight.Add(1)
+			recordStart(task.DateCreate)
+			start := clock.Now()
+			err = runTask(ctx, rt, task)
+			cancel()
+			finish()
+			lim.Release(cost, clock.Since(start), err)
+			recordFinish()
+			inFlight.Add(-1)
+		}
+	}
+}
+
+// runTask выполняет задачу, зарегистрированную claimTask, под присмотром
+// watchdog. ctx отменяется через CancelTask или watchdog.
+func runTask(ctx context.Context, rt *runningTask, task storage.Status) error {
+	id, uuid := rt.workerID, rt.uuid
+	defer stopRunning(rt)
+
+	progress := func(done, total int64) {
+		if err := storage.SetProgress(uuid, done, total); err != nil {
+			log.Printf("Worker %d: cannot save progress of task %s: %v", id, uuid, err)
+		}
+	}
+
+	output := func(contentType string, r io.Reader) error {
+		return storage.WriteBlob(uuid, contentType, r)
+	}
+
+	result, err := safeProcess(ctx, Job{WorkerID: id, UUID: uuid, Task: task, Beat: rt.beat, Progress: progress, Output: output})
+
+	switch {
+	case rt.requeue.Load():
+		requeue(id, uuid)
+	case err == nil:
+		if err := storage.CompleteTask(uuid, result); err != nil {
+			log.Printf("Worker %d: cannot finish task %s: %v", id, uuid, err)
+			if errors.Is(err, storage.ErrResultTooLarge) {
+				storage.FailTask(uuid, err.Error(), "")
+			}
+		}
+	case ctx.Err() != nil:
+		if err := storage.SetState(uuid, storage.StateCanceled); err != nil {
+			log.Printf("Worker %d: cannot cancel task %s: %v", id, uuid, err)
+		}
+	default:
+		log.Printf("Worker %d: task %s failed: %v", id, uuid, err)
 
-			if err := processTask(id, uuid); err != nil {
-				log.Printf("Worker %d: task %s failed: %v", id, uuid, err)
+		stack := ""
+		var pe *panicError
+		if errors.As(err, &pe) {
+			stack = pe.stack
+		}
+		if err := storage.FailTask(uuid, err.Error(), stack); err != nil {
+			log.Printf("Worker %d: cannot fail task %s: %v", id, uuid, err)
+		}
+		if result != nil {
+			if err := storage.SetResult(uuid, result); err != nil {
+				log.Printf("Worker %d: cannot save result of task %s: %v", id, uuid, err)
 			}
-			<-semaphore
+		}
+	}
+
+	return err
+}
+
+type panicError struct {
+	value any
+	stack string
+}
+
+func (e *panicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.value)
+}
+
+// safeProcess не дает панике внутри задачи уронить воркер и весь процесс
+func safeProcess(ctx context.Context, job Job) (result json.RawMessage, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			taskPanics.Inc()
+			err = &panicError{value: r, stack: string(debug.Stack())}
+			log.Printf("Worker %d: task %s panicked: %v", job.WorkerID, job.UUID, r)
+		}
+	}()
+
+	executor, ok := getExecutor(job.Task.Type)
+	if !ok {
+		return nil, fmt.Errorf("no executor for task type %s", job.Task.Type)
+	}
+
+	return executor.Execute(ctx, job)
+}
+
+func requeue(id int, uuid string) {
+	if err := storage.SetState(uuid, storage.StatePending); err != nil {
+		log.Printf("Worker %d: cannot requeue task %s: %v", id, uuid, err)
+		return
+	}
+	if err := storage.ChangeStatus(uuid, "pending"); err != nil {
+		log.Printf("Worker %d: cannot requeue task %s: %v", id, uuid, err)
+		return
+	}
+	err := AddToChannel(uuid)
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrQueueFull):
+		// задача остается pending: scheduler повторит постановку, как для созревших
+		log.Printf("Worker %d: queue is full, task %s is requeued in %s", id, uuid, enqueueDelay)
+		postpone(uuid, clock.Now().Add(enqueueDelay))
+	default:
+		log.Printf("Worker %d: cannot requeue task %s: %v", id, uuid, err)
+		if err := storage.FailTask(uuid, "cannot requeue: "+err.Error(), ""); err != nil {
+			log.Printf("Worker %d: cannot fail task %s: %v", id, uuid, err)
 		}
 	}
 }
 
-func processTask(id int, uuid string) error {
+func processTask(ctx context.Context, id int, uuid string, beat func()) error {
 	status := fmt.Sprintf("Worker %d starting task: %s", id, uuid)
 	if err := usefulWork(uuid, status, id); err != nil {
 		return err
 	}
-	time.Sleep(time.Duration(rand.Intn(40)+60) * time.Second)
+	if err := sleepCtx(ctx, time.Duration(rand.Intn(40)+60)*time.Second, beat); err != nil {
+		return err
+	}
 
 	status = fmt.Sprintf("Worker %d asks BD while working with: %s", id, uuid)
 	if err := usefulWork(uuid, status, id); err != nil {
 		return err
 	}
-	time.Sleep(time.Duration(rand.Intn(40)+60) * time.Second)
+	if err := sleepCtx(ctx, time.Duration(rand.Intn(40)+60)*time.Second, beat); err != nil {
+		return err
+	}
 
 	status = fmt.Sprintf("Worker %d sends other bd results about working task: %s", id, uuid)
 	if err := usefulWork(uuid, status, id); err != nil {
@@ -100,16 +405,139 @@ func processTask(id int, uuid string) error {
 	return nil
 }
 
+// sleepCtx имитирует I/O, периодически отправляя heartbeat, и прерывается
+// при отмене контекста.
+func sleepCtx(ctx context.Context, d time.Duration, beat func()) error {
+	timer := clock.Get().NewTimer(d)
+	defer timer.Stop()
+	ticker := clock.Get().NewTicker(HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-timer.C():
+			return nil
+		case <-ticker.C():
+			beat()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// AddToChannel ставит задачу в очередь: задачи с локальным исполнителем -
+// в канал воркеров, остальные - в очередь удаленных воркеров.
 func AddToChannel(uuid string) error {
-	select {
-	case tasksChan <- uuid:
-		log.Printf("task received: %s", uuid)
-	default:
-		return fmt.Errorf("cannot add task: %s (channel full)", uuid)
+	task, err := storage.GetResponse(uuid)
+	if err != nil {
+		return err
 	}
+
+	lockEnqueue.Lock()
+	defer lockEnqueue.Unlock()
+
+	if shutdownCtx.Err() != nil {
+		return fmt.Errorf("cannot add task %s: %w", uuid, ErrStopped)
+	}
+	if notDue(task) {
+		if err := schedule(uuid, task.ScheduledAt); err != nil {
+			return err
+		}
+		log.Printf("task %s is scheduled at %s", uuid, task.ScheduledAt.Format(time.RFC3339))
+		return nil
+	}
+	if err := CheckType(task.Type); err != nil {
+		return err
+	}
+	if _, local := getExecutor(task.Type); !local {
+		return remote.push(uuid, task)
+	}
+
+	if len(tasksChan) == cap(tasksChan) {
+		return fmt.Errorf("cannot add task %s: %w", uuid, ErrQueueFull)
+	}
+	localTasks.push(uuid, task.Priority)
+	tasksChan <- struct{}{}
+	log.Printf("task received: %s", uuid)
 	return nil
 }
 
+// AddBatchToChannel ставит в очередь все задачи или ни одной
+func AddBatchToChannel(uuids []string) error {
+	local := []queueItem{}
+	remoteTasks := map[string]storage.Status{}
+	later := map[string]time.Time{}
+	for _, uuid := range uuids {
+		task, err := storage.GetResponse(uuid)
+		if err != nil {
+			return err
+		}
+		if err := CheckType(task.Type); err != nil {
+			return err
+		}
+		if _, ok := getExecutor(task.Type); notDue(task) {
+			later[uuid] = task.ScheduledAt
+		} else if ok {
+			local = append(local, queueItem{uuid: uuid, priority: task.Priority})
+		} else {
+			remoteTasks[uuid] = task
+		}
+	}
+
+	lockEnqueue.Lock()
+	defer lockEnqueue.Unlock()
+
+	if shutdownCtx.Err() != nil {
+		return fmt.Errorf("cannot add %d tasks: %w", len(uuids), ErrStopped)
+	}
+	if free := cap(tasksChan) - len(tasksChan); free < len(local) {
+		return fmt.Errorf("cannot add %d tasks, only %d free places: %w", len(local), free, ErrQueueFull)
+	}
+	if free := queueSize - scheduledCount(); free < len(later) {
+		return fmt.Errorf("cannot schedule %d tasks, only %d free places: %w", len(later), free, ErrQueueFull)
+	}
+	if err := remote.pushAll(remoteTasks); err != nil {
+		return err
+	}
+
+	for _, item := range local {
+		localTasks.push(item.uuid, item.priority)
+		tasksChan <- struct{}{}
+	}
+	for uuid, at := range later {
+		postpone(uuid, at)
+	}
+	log.Printf("batch of %d tasks received", len(uuids))
+
+	return nil
+}
+
+// CancelTask отменяет задачу: ожидающая задача сразу становится canceled,
+// у выполняемой отменяется контекст.
+func CancelTask(uuid string) error {
+	if remote.cancel(uuid) {
+		return storage.ChangeStatus(uuid, "canceled")
+	}
+
+	// под lockRunning, чтобы не разминуться с claimTask
+	var err error
+	lockRunning.Lock()
+	rt, isRunning := running[uuid]
+	if !isRunning {
+		_, err = storage.CompareAndSetState(uuid, storage.StatePending, storage.StateCanceled)
+	}
+	lockRunning.Unlock()
+
+	if isRunning {
+		rt.cancel()
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("cannot cancel task: %w", err)
+	}
+	return storage.ChangeStatus(uuid, "canceled")
+}
+
 func usefulWork(task, status string, id int) error {
 	if err := storage.ChangeStatus(task, status); err != nil {
 		log.Printf("Worker %d ends task: %s", id, task)
@@ -0,0 +1,279 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"ioboundlimiter/internal/breaker"
+	"ioboundlimiter/internal/clock"
+	"ioboundlimiter/internal/storage"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorkers(t *testing.T) {
+	fake := clock.NewFake(time.Now())
+	clock.Set(fake)
+	defer clock.Set(clock.Real{})
+
+	RegisterExecutor("test_panic", ExecutorFunc(func(ctx context.Context, job Job) (json.RawMessage, error) {
+		panic("boom")
+	}))
+	RegisterExecutor("test_block", ExecutorFunc(func(ctx context.Context, job Job) (json.RawMessage, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}))
+
+	hold := make(chan struct{})
+	RegisterExecutor("test_hold", ExecutorFunc(func(ctx context.Context, job Job) (json.RawMessage, error) {
+		<-hold
+		return nil, nil
+	}))
+
+	RegisterExecutor("test_target", targetExecutor{})
+	assert.NoError(t, SetBreaker(BreakerConfig{
+		Config: breaker.Config{FailureThreshold: 2, OpenTimeout: time.Hour},
+		Action: BreakerFail,
+	}))
+	defer func() { breakerCfg = nil }()
+
+	InitWorkers()
+	defer Shutdown()
+
+	waitState := func(t *testing.T, id, state string) {
+		assert.Eventually(t, func() bool {
+			fake.Advance(10 * time.Second)
+			task, _ := storage.GetResponse(id)
+			return task.State == state
+		}, 5*time.Second, time.Millisecond)
+	}
+
+	t.Run("simulated task completes on fake clock", func(t *testing.T) {
+		id, _ := storage.AddToStorage("flow")
+		assert.NoError(t, AddToChannel(id))
+
+		waitState(t, id, storage.StateDone)
+
+		task, _ := storage.GetResponse(id)
+		assert.False(t, task.FinishedAt.IsZero())
+		assert.False(t, task.Heartbeat.IsZero())
+	})
+
+	t.Run("panic fails task and keeps worker alive", func(t *testing.T) {
+		panics := taskPanics.Value()
+
+		id, _ := storage.AddWithOptions("panic", storage.TaskOptions{Type: "test_panic"})
+		assert.NoError(t, AddToChannel(id))
+
+		waitState(t, id, storage.StateFailed)
+
+		task, _ := storage.GetResponse(id)
+		assert.Equal(t, "panic: boom", task.Error)
+		assert.Contains(t, task.Stack, "goroutine")
+		assert.Equal(t, panics+1, taskPanics.Value())
+		assert.Eventually(t, func() bool { return lim.Used() == 0 }, time.Second, time.Millisecond)
+	})
+
+	t.Run("cancel running task", func(t *testing.T) {
+		id, _ := storage.AddWithOptions("block", storage.TaskOptions{Type: "test_block"})
+		assert.NoError(t, AddToChannel(id))
+
+		waitState(t, id, storage.StateRunning)
+		assert.NoError(t, CancelTask(id))
+		waitState(t, id, storage.StateCanceled)
+	})
+
+	t.Run("open breaker fails tasks fast", func(t *testing.T) {
+		submit := func(name string) string {
+			id, _ := storage.AddWithOptions(name, storage.TaskOptions{Type: "test_target", Payload: json.RawMessage(`"down.example.com"`)})
+			assert.NoError(t, AddToChannel(id))
+			waitState(t, id, storage.StateFailed)
+			return id
+		}
+
+		submit("target 1")
+		submit("target 2")
+		assert.Equal(t, breaker.StateOpen, Breakers()["test_target:down.example.com"].State)
+
+		rejected := breakerRejected.Value()
+		task, _ := storage.GetResponse(submit("target 3"))
+		assert.Equal(t, "circuit breaker for test_target:down.example.com is open", task.Error)
+		assert.Equal(t, rejected+1, breakerRejected.Value())
+	})
+
+	t.Run("idle breakers are evicted", func(t *testing.T) {
+		fake.Advance(2 * time.Hour)
+
+		id, _ := storage.AddWithOptions("other target", storage.TaskOptions{Type: "test_target", Payload: json.RawMessage(`"other.example.com"`)})
+		assert.NoError(t, AddToChannel(id))
+		waitState(t, id, storage.StateFailed)
+
+		snapshots := Breakers()
+		assert.NotContains(t, snapshots, "test_target:down.example.com")
+		assert.Contains(t, snapshots, "test_target:other.example.com")
+	})
+
+	t.Run("scheduled task waits for its time", func(t *testing.T) {
+		id, _ := storage.AddWithOptions("later", storage.TaskOptions{ScheduledAt: fake.Now().Add(time.Hour)})
+		assert.NoError(t, AddToChannel(id))
+		assert.True(t, isScheduled(id))
+
+		task, _ := storage.GetResponse(id)
+		assert.Equal(t, storage.StatePending, task.State)
+
+		fake.Advance(time.Hour)
+		waitState(t, id, storage.StateDone)
+		assert.False(t, isScheduled(id))
+	})
+
+	t.Run("rescheduled task runs now", func(t *testing.T) {
+		id, _ := storage.AddWithOptions("tomorrow", storage.TaskOptions{ScheduledAt: fake.Now().Add(24 * time.Hour)})
+		assert.NoError(t, AddToChannel(id))
+
+		now := fake.Now()
+		_, err := storage.UpdatePending(id, 0, storage.TaskPatch{ScheduledAt: &now})
+		assert.NoError(t, err)
+		TaskUpdated(id)
+
+		waitState(t, id, storage.StateDone)
+	})
+
+	t.Run("introspection reports known workload", func(t *testing.T) {
+		heavy, _ := storage.AddWithOptions("heavy", storage.TaskOptions{Type: "test_hold", Cost: 2})
+		light, _ := storage.AddWithOptions("light", storage.TaskOptions{Type: "test_hold", Cost: 1})
+		assert.NoError(t, AddToChannel(heavy))
+		assert.NoError(t, AddToChannel(light))
+
+		assert.Eventually(t, func() bool { return GetQueueStatus().InFlight == 2 }, 5*time.Second, time.Millisecond)
+
+		info := Introspect()
+		assert.Equal(t, 2, info.Queue.InFlight)
+		assert.Equal(t, 3, info.Queue.UsedCapacity)
+		assert.Equal(t, lim.Capacity(), info.Queue.ConcurrencyLimit)
+		assert.False(t, info.Queue.Adaptive)
+		assert.Len(t, info.Workers, workersCount)
+
+		busy := map[string]string{}
+		for _, w := range info.Workers {
+			if w.Busy {
+				busy[w.Task] = w.TaskType
+			}
+		}
+		assert.Equal(t, map[string]string{heavy: "test_hold", light: "test_hold"}, busy)
+
+		close(hold)
+		assert.Eventually(t, func() bool { return GetQueueStatus().InFlight == 0 }, 5*time.Second, time.Millisecond)
+
+		info = Introspect()
+		assert.Equal(t, 0, info.Queue.UsedCapacity)
+		assert.GreaterOrEqual(t, info.Throughput.LastMinute, 2)
+	})
+
+	t.Run("cost above capacity is rejected", func(t *testing.T) {
+		assert.NoError(t, CheckCost(lim.Capacity()))
+		assert.Error(t, CheckCost(lim.Capacity()+1))
+	})
+
+	t.Run("rescheduling moves the only entry", func(t *testing.T) {
+		id, _ := storage.AddWithOptions("moved", storage.TaskOptions{ScheduledAt: fake.Now().Add(time.Hour)})
+		assert.NoError(t, AddToChannel(id))
+		before := scheduledCount()
+
+		for i := 2; i <= 20; i++ {
+			at := fake.Now().Add(time.Duration(i) * time.Hour)
+			_, err := storage.UpdatePending(id, 0, storage.TaskPatch{ScheduledAt: &at})
+			assert.NoError(t, err)
+			TaskUpdated(id)
+		}
+		assert.Equal(t, before, scheduledCount())
+
+		// старые сроки ничего не делают
+		fake.Advance(10 * time.Hour)
+		task, _ := storage.GetResponse(id)
+		assert.Equal(t, storage.StatePending, task.State)
+		assert.True(t, isScheduled(id))
+
+		fake.Advance(10 * time.Hour)
+		waitState(t, id, storage.StateDone)
+		assert.False(t, isScheduled(id))
+	})
+
+	t.Run("scheduled tasks count toward queue size", func(t *testing.T) {
+		later := fake.Now().Add(24 * time.Hour)
+		ids := []string{}
+		for scheduledCount() < queueSize {
+			id, _ := storage.AddWithOptions("far away", storage.TaskOptions{ScheduledAt: later})
+			assert.NoError(t, AddToChannel(id))
+			ids = append(ids, id)
+		}
+		defer func() {
+			for _, id := range ids {
+				unschedule(id)
+			}
+		}()
+
+		id, _ := storage.AddWithOptions("one too many", storage.TaskOptions{ScheduledAt: later})
+		assert.ErrorIs(t, AddToChannel(id), ErrQueueFull)
+		assert.False(t, isScheduled(id))
+		assert.ErrorIs(t, AddBatchToChannel([]string{id}), ErrQueueFull)
+
+		// перенос срока уже отложенной задачи места не требует
+		moved := later.Add(time.Hour)
+		_, err := storage.UpdatePending(ids[0], 0, storage.TaskPatch{ScheduledAt: &moved})
+		assert.NoError(t, err)
+		TaskUpdated(ids[0])
+		assert.True(t, isScheduled(ids[0]))
+	})
+}
+
+// targetExecutor всегда завершается ошибкой, адресат - строка из payload
+type targetExecutor struct{}
+
+func (targetExecutor) Execute(ctx context.Context, job Job) (json.RawMessage, error) {
+	return nil, errors.New("downstream is down")
+}
+
+func (targetExecutor) Target(task storage.Status) string {
+	var target string
+	json.Unmarshal(task.Payload, &target)
+	return target
+}
+
+func TestLocalQueue(t *testing.T) {
+	q := &localQueue{}
+	q.push("low", -1)
+	q.push("first", 0)
+	q.push("high", 5)
+	q.push("second", 0)
+	q.reprioritize("low", 10)
+
+	order := []string{}
+	for {
+		uuid, ok := q.pop()
+		if !ok {
+			break
+		}
+		order = append(order, uuid)
+	}
+	assert.Equal(t, []string{"low", "high", "first", "second"}, order)
+}
+
+func TestCancelClaimedTask(t *testing.T) {
+	id, _ := storage.AddToStorage("claimed")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rt, task, err := claimTask(0, id, cancel)
+	assert.NoError(t, err)
+	assert.Equal(t, storage.StateRunning, task.State)
+	defer stopRunning(rt)
+
+	// задача уже running, но еще не выполняется: отмена должна дойти до контекста
+	assert.NoError(t, CancelTask(id))
+	assert.ErrorIs(t, ctx.Err(), context.Canceled)
+
+	_, _, err = claimTask(1, id, cancel)
+	assert.ErrorIs(t, err, storage.ErrStateConflict)
+}